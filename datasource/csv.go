@@ -21,6 +21,7 @@ var (
 	_ schema.Source      = (*CsvDataSource)(nil)
 	_ schema.Conn        = (*CsvDataSource)(nil)
 	_ schema.ConnScanner = (*CsvDataSource)(nil)
+	_ schema.ConnSkipper = (*CsvDataSource)(nil)
 )
 
 // Csv DataSource, implements qlbridge schema DataSource, SourceConn, Scanner
@@ -28,7 +29,7 @@ var (
 //	to allow csv files to be full featured databases.
 //	- very, very naive scanner, forward only single pass
 //	- can open a file with .Open()
-//	- assumes comma delimited
+//	- comma delimited unless created with NewCsvSourceDelimiter
 //	- not thread-safe
 //	- does not implement write operations
 type CsvDataSource struct {
@@ -48,6 +49,12 @@ type CsvDataSource struct {
 // NewCsvSource reader assumes we are getting first row as headers
 // - optionally may be gzipped
 func NewCsvSource(table string, indexCol int, ior io.Reader, exit <-chan bool) (*CsvDataSource, error) {
+	return NewCsvSourceDelimiter(table, indexCol, ior, exit, ',')
+}
+
+// NewCsvSourceDelimiter reader same as NewCsvSource for files delimited
+// by given comma rune such as ';' or '\t'.
+func NewCsvSourceDelimiter(table string, indexCol int, ior io.Reader, exit <-chan bool, comma rune) (*CsvDataSource, error) {
 
 	m := CsvDataSource{table: table, indexCol: indexCol}
 	if rc, ok := ior.(io.ReadCloser); ok {
@@ -73,11 +80,7 @@ func NewCsvSource(table string, indexCol int, ior io.Reader, exit <-chan bool) (
 		m.csvr = csv.NewReader(buf)
 	}
 
-	// if flagCsvDelimiter == "|" {
-	// 	m.csvr.Comma = '|'
-	// } else if flagCsvDelimiter == "\t" || flagCsvDelimiter == "t" {
-	// 	m.csvr.Comma = '\t'
-	// }
+	m.csvr.Comma = comma
 	headers, err := m.csvr.Read()
 	if err != nil {
 		return nil, err
@@ -141,6 +144,28 @@ func (m *CsvDataSource) Close() error {
 	return nil
 }
 
+// Skip the next n rows without building messages, the schema.ConnSkipper
+// interface for OFFSET push down.
+func (m *CsvDataSource) Skip(n int) int {
+	skipped := 0
+	for skipped < n {
+		row, err := m.csvr.Read()
+		if err != nil {
+			if err == io.EOF {
+				return skipped
+			}
+			u.Warnf("could not read row? %v", err)
+			continue
+		}
+		m.rowct++
+		if len(row) != len(m.headers) {
+			continue
+		}
+		skipped++
+	}
+	return skipped
+}
+
 func (m *CsvDataSource) Next() schema.Message {
 	select {
 	case <-m.exit:
@@ -56,4 +56,16 @@ func TestCsvDataSource(t *testing.T) {
 	csvIn, err = datasource.NewCsvSource("user.csv", 0, sr, make(<-chan bool, 1))
 	assert.Equal(t, nil, err)
 	csvIn.Close()
+
+	// skip rows for OFFSET push down
+	csvIn, err = csvStringSource.Open("user.csv")
+	assert.True(t, err == nil, "should not have error: %v", err)
+	skipper, ok := csvIn.(schema.ConnSkipper)
+	assert.True(t, ok)
+	assert.Equal(t, 2, skipper.Skip(2))
+	msg := csvIn.(schema.ConnScanner).Next()
+	assert.True(t, msg != nil)
+	assert.Equal(t, uint64(3), msg.Id())
+	assert.Equal(t, 0, skipper.Skip(2))
+	csvIn.Close()
 }
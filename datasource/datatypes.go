@@ -66,6 +66,9 @@ func (m *TimeValue) Scan(src any) error {
 	var t time.Time
 	var dstr string
 	switch val := src.(type) {
+	case time.Time:
+		*m = TimeValue(val)
+		return nil
 	case string:
 		dstr = val
 	case []byte:
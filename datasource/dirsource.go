@@ -0,0 +1,262 @@
+package datasource
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
+)
+
+const (
+	// CsvSourceType is registered source type for csv files "csv:///path?delimiter=;"
+	CsvSourceType = "csv"
+	// JsonSourceType is registered source type for new line delimited
+	// json files "json:///path"
+	JsonSourceType = "json"
+)
+
+var (
+	// Ensure our DirSource implements schema.Source interfaces.
+	_ schema.Source        = (*DirSource)(nil)
+	_ schema.SourceFactory = (*DirSource)(nil)
+
+	// file extensions recognized as tables per format, optionally .gz
+	dirSourceExtensions = map[string][]string{
+		CsvSourceType:  {".csv", ".tsv"},
+		JsonSourceType: {".json", ".jsonl", ".ndjson"},
+	}
+)
+
+// registerDirSources registers the csv, json source types, called after
+// the default registry is created.
+func registerDirSources() {
+	schema.RegisterSourceType(CsvSourceType, NewDirSource(CsvSourceType))
+	schema.RegisterSourceType(JsonSourceType, NewDirSource(JsonSourceType))
+}
+
+// DirSource is a Source of csv or new line delimited json files, either a single
+// file or a directory where each file is a table named by the file name without
+// extension.  Table schemas are introspected from the first rows of each file.
+//
+// Settings
+//   - path:       file or directory path
+//   - delimiter:  csv delimiter, defaults to "," ("tab" for tab delimited)
+type DirSource struct {
+	format    string
+	path      string
+	comma     rune
+	mu        sync.Mutex
+	files     map[string]string // table name -> file path
+	buffered  map[string][]byte // contents of non-regular files such as /dev/stdin
+	tables    map[string]*schema.Table
+	tableList []string
+}
+
+// NewDirSource create a new, not yet setup, source of given format (csv, json).
+func NewDirSource(format string) *DirSource {
+	return &DirSource{
+		format:   format,
+		comma:    ',',
+		files:    make(map[string]string),
+		buffered: make(map[string][]byte),
+		tables:   make(map[string]*schema.Table),
+	}
+}
+
+// NewSource a new source for each schema as each reads a different path.
+func (m *DirSource) NewSource() schema.Source { return NewDirSource(m.format) }
+
+// Init the source
+func (m *DirSource) Init() {}
+
+// Setup this source reading the path, delimiter settings of schema conf
+// and finding the files that are its tables.
+func (m *DirSource) Setup(s *schema.Schema) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s == nil || s.Conf == nil {
+		return fmt.Errorf("%s source requires a path setting", m.format)
+	}
+	conf := s.Conf.Settings
+	m.path = conf.String("path")
+	if m.path == "" {
+		return fmt.Errorf("%s source requires a path setting", m.format)
+	}
+	switch delim := conf.String("delimiter"); delim {
+	case "":
+	case "tab", `\t`:
+		m.comma = '\t'
+	default:
+		r, size := utf8.DecodeRuneInString(delim)
+		if size != len(delim) {
+			return fmt.Errorf("invalid csv delimiter %q", delim)
+		}
+		m.comma = r
+	}
+
+	fi, err := os.Stat(m.path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		name := tableNameFromFile(m.path)
+		if !fi.Mode().IsRegular() {
+			// pipes such as /dev/stdin can only be read once
+			data, err := os.ReadFile(m.path)
+			if err != nil {
+				return err
+			}
+			m.buffered[name] = data
+		}
+		m.addFile(name, m.path)
+		return nil
+	}
+
+	entries, err := os.ReadDir(m.path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !m.isTableFile(e.Name()) {
+			continue
+		}
+		m.addFile(tableNameFromFile(e.Name()), filepath.Join(m.path, e.Name()))
+	}
+	sort.Strings(m.tableList)
+	return nil
+}
+
+func (m *DirSource) addFile(name, fp string) {
+	if _, exists := m.files[name]; !exists {
+		m.tableList = append(m.tableList, name)
+	}
+	m.files[name] = fp
+}
+
+func (m *DirSource) isTableFile(fileName string) bool {
+	fileName = strings.TrimSuffix(strings.ToLower(fileName), ".gz")
+	for _, ext := range dirSourceExtensions[m.format] {
+		if strings.HasSuffix(fileName, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableNameFromFile lowercased file name without extensions "Users.csv.gz" -> "users"
+func tableNameFromFile(fp string) string {
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(fp)), ".gz")
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Close this source.
+func (m *DirSource) Close() error { return nil }
+
+// Tables list of table names, one per file.
+func (m *DirSource) Tables() []string { return m.tableList }
+
+// Table get table schema for given table name, introspecting the
+// column types from the first rows of the file.
+func (m *DirSource) Table(tableName string) (*schema.Table, error) {
+	tableName = strings.ToLower(tableName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tbl, ok := m.tables[tableName]; ok {
+		return tbl, nil
+	}
+	conn, err := m.open(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tbl := schema.NewTable(tableName)
+	switch conn := conn.(type) {
+	case *CsvDataSource:
+		tbl.SetColumns(append([]string(nil), conn.Columns()...))
+		if err := IntrospectTable(tbl, conn); err != nil {
+			return nil, err
+		}
+		// columns without any rows to introspect
+		for _, col := range tbl.Columns() {
+			if _, ok := tbl.FieldMap[col]; !ok {
+				tbl.AddFieldType(col, value.StringType)
+			}
+		}
+	case *JsonSource:
+		found := schema.NewTable(tableName)
+		if err := IntrospectTable(found, conn); err != nil {
+			return nil, err
+		}
+		// json object keys are un-ordered so sort the columns
+		cols := make([]string, 0, len(found.Fields))
+		for _, f := range found.Fields {
+			cols = append(cols, f.Name)
+		}
+		sort.Strings(cols)
+		for _, col := range cols {
+			tbl.AddField(found.FieldMap[col])
+		}
+		tbl.SetColumns(cols)
+	}
+	m.tables[tableName] = tbl
+	return tbl, nil
+}
+
+// Open a connection (forward only scanner) to given table.
+func (m *DirSource) Open(tableName string) (schema.Conn, error) {
+	tbl, err := m.Table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conn, err := m.open(tbl.Name)
+	if err != nil {
+		return nil, err
+	}
+	if js, ok := conn.(*JsonSource); ok {
+		js.tbl = tbl
+		js.columns = tbl.Columns()
+	}
+	return conn, nil
+}
+
+func (m *DirSource) open(tableName string) (schema.Conn, error) {
+	fp, ok := m.files[tableName]
+	if !ok {
+		return nil, schema.ErrNotFound
+	}
+	var rc io.ReadCloser
+	if data, ok := m.buffered[tableName]; ok {
+		rc = io.NopCloser(bytes.NewReader(data))
+	} else {
+		f, err := os.Open(fp)
+		if err != nil {
+			return nil, err
+		}
+		rc = f
+	}
+	var conn schema.Conn
+	var err error
+	exit := make(<-chan bool, 1)
+	if m.format == JsonSourceType {
+		conn, err = NewJsonSource(tableName, rc, exit, nil)
+	} else {
+		conn, err = NewCsvSourceDelimiter(tableName, 0, rc, exit, m.comma)
+	}
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -2,6 +2,7 @@ package files
 
 import (
 	"path/filepath"
+	"sync"
 	"time"
 
 	u "github.com/araddon/gou"
@@ -32,6 +33,9 @@ type FilePager struct {
 	rowct           int64
 	table           string
 	exit            chan bool
+	exitOnce        sync.Once
+	ctx             context.Context
+	cancel          context.CancelFunc // stops the fetcher
 	err             error
 	closed          bool
 	fs              *FileSource
@@ -55,6 +59,7 @@ func NewFilePager(tableName string, fs *FileSource) *FilePager {
 		readers: make(chan *FileReader, FileBufferSize),
 		partid:  -1,
 	}
+	fp.ctx, fp.cancel = context.WithCancel(context.Background())
 	return fp
 }
 
@@ -140,7 +145,7 @@ func (m *FilePager) fetcher() {
 
 	q := cloudstorage.Query{Delimiter: "", Prefix: path}
 	q.Sorted()
-	ctx, ctxCancel := context.WithCancel(context.Background())
+	ctx := m.ctx
 	iter, err := m.fs.store.Objects(ctx, q)
 	if err != nil {
 		m.err = err
@@ -165,7 +170,10 @@ func (m *FilePager) fetcher() {
 		default:
 			o, err := iter.Next()
 			if err == iterator.Done {
-				m.readers <- nil
+				select {
+				case m.readers <- nil:
+				case <-m.exit:
+				}
 				return
 			} else if err == context.Canceled || err == context.DeadlineExceeded {
 				// Return to user
@@ -201,8 +209,7 @@ func (m *FilePager) fetcher() {
 					time.Sleep(time.Millisecond * 50)
 					continue
 				}
-				ctxCancel()
-				close(m.exit)
+				m.stop()
 				u.Errorf("could not read %q err=%v", fi.Name, err)
 				return
 			} else {
@@ -228,7 +235,12 @@ func (m *FilePager) fetcher() {
 			}
 
 			// This will back-pressure after we reach our queue size
-			m.readers <- fr
+			select {
+			case m.readers <- fr:
+			case <-m.exit:
+				f.Close()
+				return
+			}
 
 			if m.Limit > 0 && fetchCt >= m.Limit {
 				return
@@ -277,9 +289,17 @@ func (m *FilePager) Next() schema.Message {
 	}
 }
 
-// Close this connection/pager
+// Close this connection/pager, stopping the fetcher
 func (m *FilePager) Close() error {
 	m.closed = true
-	//close(m.exit)
+	m.stop()
 	return nil
 }
+
+// stop the fetcher, aborting any file listing or open in progress
+func (m *FilePager) stop() {
+	m.exitOnce.Do(func() {
+		m.cancel()
+		close(m.exit)
+	})
+}
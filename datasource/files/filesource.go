@@ -21,7 +21,8 @@ import (
 
 var (
 	// ensure we implement interfaces
-	_ schema.Source = (*FileSource)(nil)
+	_ schema.Source        = (*FileSource)(nil)
+	_ schema.SourceFactory = (*FileSource)(nil)
 
 	schemaRefreshInterval = time.Minute * 5
 )
@@ -29,11 +30,14 @@ var (
 const (
 	// SourceType is the registered Source name in the qlbridge source registry
 	SourceType = "cloudstore"
+	// DsnSourceType is the alias registered for driver dsn's "files:///path?format=csv"
+	DsnSourceType = "files"
 )
 
 func init() {
 	// We need to register our DataSource provider here
 	schema.RegisterSourceType(SourceType, NewFileSource())
+	schema.RegisterSourceType(DsnSourceType, NewFileSource())
 }
 
 // FileReaderIterator defines a file source that can page through files
@@ -92,6 +96,10 @@ func NewFileSource() *FileSource {
 	return &m
 }
 
+// NewSource a new file source for each schema, as each one
+// reads a different store and path.
+func (m *FileSource) NewSource() schema.Source { return NewFileSource() }
+
 func (m *FileSource) Init() {}
 
 // Setup the filesource with schema info
@@ -145,6 +153,13 @@ func (m *FileSource) init() error {
 		if partitioner := conf.String("partitioner"); partitioner != "" {
 			m.Partitioner = partitioner
 		}
+		if conf.String("type") == "" && strings.HasPrefix(m.path, "/") {
+			// dsn form files:///data/bucket is a local folder "bucket" of
+			// tables under the localfs store /data
+			conf["type"] = "localfs"
+			conf["localpath"] = path.Dir(m.path)
+			m.path = path.Base(m.path)
+		}
 
 		store, err := FileStoreLoader(m.ss)
 		if err != nil {
@@ -66,6 +66,10 @@ func KeyFromWhere(wh any) schema.Key {
 			return NewKeyCol(in.Text, valT.Float64)
 		case *expr.StringNode:
 			return NewKeyCol(in.Text, valT.Text)
+		case *expr.ParamNode:
+			if valT.Value != nil {
+				return NewKeyCol(in.Text, valT.Value.Value())
+			}
 		//case *expr.FuncNode:
 		default:
 			u.Warnf("not supported arg? %#v", valT)
@@ -5,6 +5,7 @@ package membtree
 import (
 	"database/sql/driver"
 	"fmt"
+	"strconv"
 
 	u "github.com/araddon/gou"
 	"github.com/dchest/siphash"
@@ -30,6 +31,7 @@ var (
 	_ schema.ConnColumns  = (*StaticDataSource)(nil)
 	_ schema.ConnScanner  = (*StaticDataSource)(nil)
 	_ schema.ConnSeeker   = (*StaticDataSource)(nil)
+	_ schema.ConnSkipper  = (*StaticDataSource)(nil)
 	_ schema.ConnUpsert   = (*StaticDataSource)(nil)
 	_ schema.ConnDeletion = (*StaticDataSource)(nil)
 )
@@ -78,19 +80,14 @@ func makeId(dv driver.Value) uint64 {
 	case int64:
 		return uint64(vt)
 	case []byte:
-		return siphash.Hash(0, 1, vt)
-		// iv, err := strconv.ParseUint(string(vt), 10, 64)
-		// if err != nil {
-		// 	u.Warnf("could not create id: %v  for %v", err, dv)
-		// }
-		// return iv
+		return makeId(string(vt))
 	case string:
+		// integer strings (csv values) get the id of the int, so an int
+		// key and its string form find the same row
+		if iv, err := strconv.ParseInt(vt, 10, 64); err == nil {
+			return uint64(iv)
+		}
 		return siphash.Hash(0, 1, []byte(vt))
-		// iv, err := strconv.ParseUint(vt, 10, 64)
-		// if err != nil {
-		// 	u.Warnf("could not create id: %v  for %v", err, dv)
-		// }
-		// return iv
 	case *Key:
 		//u.Infof("got %#v", vt)
 		return vt.Id
@@ -131,7 +128,7 @@ func NewStaticDataSource(name string, indexedCol int, data [][]driver.Value, col
 	m := StaticDataSource{indexCol: indexedCol, name: name}
 	m.tbl = tbl
 	m.bt = btree.New(32)
-	m.tbl.SetColumns(cols)
+	m.SetColumns(cols)
 	for _, row := range data {
 		m.Put(nil, nil, row)
 	}
@@ -155,14 +152,32 @@ func NewStaticData(name string) *StaticDataSource {
 
 func (m *StaticDataSource) Init()                                     {}
 func (m *StaticDataSource) Setup(*schema.Schema) error                { return nil }
-func (m *StaticDataSource) Open(connInfo string) (schema.Conn, error) { return m, nil }
 func (m *StaticDataSource) Table(table string) (*schema.Table, error) { return m.tbl, nil }
 func (m *StaticDataSource) Close() error                              { return nil }
 func (m *StaticDataSource) CreateIterator() schema.Iterator           { return m }
 func (m *StaticDataSource) Tables() []string                          { return []string{m.name} }
 func (m *StaticDataSource) Columns() []string                         { return m.tbl.Columns() }
 func (m *StaticDataSource) Length() int                               { return m.bt.Len() }
-func (m *StaticDataSource) SetColumns(cols []string)                  { m.tbl.SetColumns(cols) }
+
+// Open a connection with its own scan cursor, sharing the underlying data,
+// so concurrent scans of the same table (self joins, set operations) do not
+// interfere with each other.
+func (m *StaticDataSource) Open(connInfo string) (schema.Conn, error) {
+	conn := *m
+	conn.cursor = nil
+	conn.max = 0
+	return &conn, nil
+}
+
+// SetColumns set the column names, the indexed column is the primary key
+func (m *StaticDataSource) SetColumns(cols []string) {
+	m.tbl.SetColumns(cols)
+	if m.indexCol < len(cols) {
+		m.tbl.Indexes = []*schema.Index{
+			{Name: "id", Fields: []string{cols[m.indexCol]}, PrimaryKey: true},
+		}
+	}
+}
 
 func (m *StaticDataSource) Next() schema.Message {
 	//u.Infof("Next()")
@@ -213,6 +228,33 @@ func (m *StaticDataSource) Next() schema.Message {
 	}
 }
 
+// Skip the next n rows by moving the cursor without copying them, the
+// schema.ConnSkipper interface for OFFSET push down.
+func (m *StaticDataSource) Skip(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	skipped := 0
+	var last btree.Item
+	visit := func(a btree.Item) bool {
+		if m.cursor == a {
+			return true
+		}
+		last = a
+		skipped++
+		return skipped < n
+	}
+	if m.cursor == nil {
+		m.bt.Ascend(visit)
+	} else {
+		m.bt.AscendGreaterOrEqual(m.cursor, visit)
+	}
+	if last != nil {
+		m.cursor = last
+	}
+	return skipped
+}
+
 // interface for Upsert.Put()
 func (m *StaticDataSource) Put(ctx context.Context, key schema.Key, row any) (schema.Key, error) {
 
@@ -230,6 +272,7 @@ func (m *StaticDataSource) Put(ctx context.Context, key schema.Key, row any) (sc
 		if itemResult != nil {
 			//u.Errorf("could not insert? %#v", itemResult)
 		}
+		m.tbl.RowCt = uint64(m.bt.Len())
 		//u.Debugf("%p  PUT: id:%v IdVal:%v  Id():%v vals:%#v", m, id, sdm.IdVal, sdm.Id(), rowVals)
 		return NewKey(id), nil
 	case map[string]driver.Value:
@@ -280,6 +323,7 @@ func (m *StaticDataSource) Put(ctx context.Context, key schema.Key, row any) (sc
 		sdm := datasource.NewSqlDriverMessageMap(id, row, m.tbl.FieldPositions)
 		item := DriverItem{sdm}
 		m.bt.ReplaceOrInsert(&item)
+		m.tbl.RowCt = uint64(m.bt.Len())
 		return NewKey(id), nil
 	default:
 		u.Warnf("not implemented %T", row)
@@ -318,6 +362,7 @@ func (m *StaticDataSource) Delete(key driver.Value) (int, error) {
 		//u.Warnf("could not delete: %v", key)
 		return 0, schema.ErrNotFound
 	}
+	m.tbl.RowCt = uint64(m.bt.Len())
 	return 1, nil
 }
 
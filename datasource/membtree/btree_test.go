@@ -104,6 +104,18 @@ func TestStaticValues(t *testing.T) {
 	assert.True(t, delCt == 0)
 }
 
+func TestStaticDataSourceSkip(t *testing.T) {
+	data := [][]driver.Value{{1, "a"}, {2, "b"}, {3, "c"}, {4, "d"}}
+	static := membtree.NewStaticDataSource("letters", 0, data, []string{"id", "letter"})
+
+	assert.Equal(t, 2, static.Skip(2))
+	msg := static.Next()
+	assert.True(t, msg != nil)
+	assert.Equal(t, "c", msg.Body().(*datasource.SqlDriverMessageMap).Values()[1])
+	assert.Equal(t, 1, static.Skip(5))
+	assert.True(t, static.Next() == nil)
+}
+
 func TestStaticDataSource(t *testing.T) {
 
 	static := membtree.NewStaticDataSource("users", 0, nil, []string{"user_id", "name", "email", "created", "roles"})
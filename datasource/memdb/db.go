@@ -33,6 +33,9 @@ var (
 	_ schema.ConnUpsert   = (*dbConn)(nil)
 	_ schema.ConnDeletion = (*dbConn)(nil)
 	_ schema.ConnSeeker   = (*dbConn)(nil)
+
+	_ schema.ConnTransactional = (*dbConn)(nil)
+	_ schema.ConnTx            = (*dbTx)(nil)
 )
 
 // MemDb implements qlbridge `Source` to allow in-memory native go data
@@ -51,6 +54,14 @@ type dbConn struct {
 	db     *memdb.MemDB
 	txn    *memdb.Txn
 	result memdb.ResultIterator
+	tx     *memdb.Txn // write txn of the transaction this conn was opened in
+}
+
+// dbTx a transaction spanning statements, a single go-memdb write txn
+// so it blocks other writers until it is committed or rolled back.
+type dbTx struct {
+	md  *MemDb
+	txn *memdb.Txn
 }
 
 // NewMemDbData creates a MemDb with given indexes, columns, and values
@@ -141,6 +152,7 @@ func (m *MemDb) buildDefaultIndexes() {
 		m.indexes[0].PrimaryKey = true
 		m.primaryIndex = m.indexes[0].Name
 	}
+	m.tbl.Indexes = m.indexes
 }
 
 //func (m *MemDb) SetColumns(cols []string)                  { m.tbl.SetColumns(cols) }
@@ -151,10 +163,43 @@ func newDbConn(mdb *MemDb) *dbConn {
 }
 func (m *dbConn) Columns() []string { return m.md.tbl.Columns() }
 func (m *dbConn) Close() error      { return nil }
+
+// Begin a transaction, ConnTransactional interface.
+func (m *dbConn) Begin() (schema.ConnTx, error) {
+	return &dbTx{md: m.md, txn: m.db.Txn(true)}, nil
+}
+
+// readTxn the txn to read with, the transaction's if this conn is in one.
+func (m *dbConn) readTxn() *memdb.Txn {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.db.Txn(false)
+}
+
+// writeTxn the txn to write with, the transaction's if this conn is in one
+// which is then only committed or aborted with the transaction.
+func (m *dbConn) writeTxn() *memdb.Txn {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.db.Txn(true)
+}
+func (m *dbConn) commit(txn *memdb.Txn) {
+	if m.tx == nil {
+		txn.Commit()
+	}
+}
+func (m *dbConn) abort(txn *memdb.Txn) {
+	if m.tx == nil {
+		txn.Abort()
+	}
+}
+
 func (m *dbConn) Next() schema.Message {
 
 	if m.txn == nil {
-		m.txn = m.db.Txn(false)
+		m.txn = m.readTxn()
 	}
 	select {
 	case <-m.md.exit:
@@ -187,13 +232,13 @@ func (m *dbConn) Put(ctx context.Context, key schema.Key, row any) (schema.Key,
 
 	switch rowVals := row.(type) {
 	case []driver.Value:
-		txn := m.db.Txn(true)
+		txn := m.writeTxn()
 		key, err := m.putValues(txn, rowVals)
 		if err != nil {
-			txn.Abort()
+			m.abort(txn)
 			return nil, err
 		}
-		txn.Commit()
+		m.commit(txn)
 		return key, nil
 	default:
 		return nil, fmt.Errorf("Expected []driver.Value but got %T", row)
@@ -214,7 +259,7 @@ func (m *dbConn) putValues(txn *memdb.Txn, row []driver.Value) (schema.Key, erro
 }
 
 func (m *dbConn) PutMulti(ctx context.Context, keys []schema.Key, objs any) ([]schema.Key, error) {
-	txn := m.db.Txn(true)
+	txn := m.writeTxn()
 
 	switch rows := objs.(type) {
 	case [][]driver.Value:
@@ -222,26 +267,27 @@ func (m *dbConn) PutMulti(ctx context.Context, keys []schema.Key, objs any) ([]s
 		for _, row := range rows {
 			key, err := m.putValues(txn, row)
 			if err != nil {
-				txn.Abort()
+				m.abort(txn)
 				return nil, err
 			}
 			keys = append(keys, key)
 		}
-		txn.Commit()
+		m.commit(txn)
 		return keys, nil
 	}
+	m.abort(txn)
 	return nil, fmt.Errorf("unrecognized put object type: %T", objs)
 }
 
 func (m *dbConn) Get(key driver.Value) (schema.Message, error) {
-	txn := m.db.Txn(false)
+	txn := m.readTxn()
 	iter, err := txn.Get(m.md.tbl.Name, m.md.primaryIndex, fmt.Sprintf("%v", key))
 	if err != nil {
-		txn.Abort()
+		m.abort(txn)
 		u.Errorf("error reading %v because %v", key, err)
 		return nil, err
 	}
-	txn.Commit() // noop
+	m.commit(txn) // noop
 
 	if item := iter.Next(); item != nil {
 		if msg, ok := item.(schema.Message); ok {
@@ -254,14 +300,14 @@ func (m *dbConn) Get(key driver.Value) (schema.Message, error) {
 
 // Interface for Deletion
 func (m *dbConn) Delete(key driver.Value) (int, error) {
-	txn := m.db.Txn(true)
+	txn := m.writeTxn()
 	err := txn.Delete(m.md.tbl.Name, key)
 	if err != nil {
-		txn.Abort()
+		m.abort(txn)
 		u.Warnf("could not delete: %v  err=%v", key, err)
 		return 0, err
 	}
-	txn.Commit()
+	m.commit(txn)
 	return 1, nil
 }
 
@@ -269,10 +315,10 @@ func (m *dbConn) Delete(key driver.Value) (int, error) {
 func (m *dbConn) DeleteExpression(p any, where expr.Node) (int, error) {
 
 	var deletedKeys []schema.Key
-	txn := m.db.Txn(true)
+	txn := m.writeTxn()
 	iter, err := txn.Get(m.md.tbl.Name, m.md.primaryIndex)
 	if err != nil {
-		txn.Abort()
+		m.abort(txn)
 		u.Errorf("could not get values %v", err)
 		return 0, err
 	}
@@ -318,9 +364,28 @@ deleteLoop:
 		}
 	}
 	if err != nil {
-		txn.Abort()
+		m.abort(txn)
 		return 0, err
 	}
-	txn.Commit()
+	m.commit(txn)
 	return len(deletedKeys), nil
 }
+
+// Open a conn to table inside this transaction.
+func (m *dbTx) Open(table string) (schema.Conn, error) {
+	c := newDbConn(m.md)
+	c.tx = m.txn
+	return c, nil
+}
+
+// Commit this transaction's writes.
+func (m *dbTx) Commit() error {
+	m.txn.Commit()
+	return nil
+}
+
+// Rollback discards this transaction's writes.
+func (m *dbTx) Rollback() error {
+	m.txn.Abort()
+	return nil
+}
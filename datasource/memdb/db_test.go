@@ -115,3 +115,45 @@ func TestMemDb(t *testing.T) {
 	}
 	assert.Equal(t, 0, ct)
 }
+
+func TestMemDbTransaction(t *testing.T) {
+
+	cols := []string{"user_id", "name"}
+	db, err := NewMemDbData("users", [][]driver.Value{{1, "bob"}}, cols)
+	assert.Equal(t, nil, err)
+
+	count := func(c schema.Conn) int {
+		ct := 0
+		for c.(schema.ConnScanner).Next() != nil {
+			ct++
+		}
+		return ct
+	}
+	c, _ := db.Open("users")
+	tx, err := c.(schema.ConnTransactional).Begin()
+	assert.Equal(t, nil, err)
+
+	txc, err := tx.Open("users")
+	assert.Equal(t, nil, err)
+	_, err = txc.(schema.ConnUpsert).Put(nil, nil, []driver.Value{2, "ana"})
+	assert.Equal(t, nil, err)
+
+	// the write is only seen inside the transaction until commited
+	txc, _ = tx.Open("users")
+	assert.Equal(t, 2, count(txc))
+	c, _ = db.Open("users")
+	assert.Equal(t, 1, count(c))
+
+	assert.Equal(t, nil, tx.Rollback())
+	c, _ = db.Open("users")
+	assert.Equal(t, 1, count(c))
+
+	c, _ = db.Open("users")
+	tx, _ = c.(schema.ConnTransactional).Begin()
+	txc, _ = tx.Open("users")
+	_, err = txc.(schema.ConnDeletion).Delete(1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, tx.Commit())
+	c, _ = db.Open("users")
+	assert.Equal(t, 0, count(c))
+}
@@ -101,15 +101,23 @@ func (m *Source) Open(tableName string) (schema.Conn, error) {
 
 	tableName = strings.ToLower(tableName)
 	if ds, ok := m.tables[tableName]; ok {
-		return &Table{StaticDataSource: ds}, nil
+		return openTable(ds)
 	}
 	err := m.loadTable(tableName)
 	if err != nil {
 		u.Errorf("could not load table %q  err=%v", tableName, err)
 		return nil, err
 	}
-	ds := m.tables[tableName]
-	return &Table{StaticDataSource: ds}, nil
+	return openTable(m.tables[tableName])
+}
+
+// openTable a conn with its own cursor on the shared table data
+func openTable(ds *membtree.StaticDataSource) (schema.Conn, error) {
+	conn, err := ds.Open("")
+	if err != nil {
+		return nil, err
+	}
+	return &Table{StaticDataSource: conn.(*membtree.StaticDataSource)}, nil
 }
 
 // Table get table schema for given table name.  If given table is not currently
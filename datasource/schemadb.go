@@ -42,6 +42,7 @@ var (
 func init() {
 	schema.CreateDefaultRegistry(schema.NewApplyer(SchemaDBStoreProvider))
 	registry = schema.DefaultRegistry()
+	registerDirSources()
 }
 
 type (
@@ -29,6 +29,9 @@ var (
 	_ schema.ConnAll      = (*qryconn)(nil)
 	_ schema.ConnMutation = (*qryconn)(nil)
 
+	_ schema.ConnTransactional = (*qryconn)(nil)
+	_ schema.ConnTx            = (*sqliteTx)(nil)
+
 	// SourcePlanner interface {
 	// 	// given our request statement, turn that into a plan.Task.
 	// 	WalkSourceSelect(pl Planner, s *Source) (Task, error)
@@ -37,6 +40,19 @@ var (
 )
 
 type (
+	// sqlQueryer the *sql.DB a qryconn queries, or the *sql.Tx
+	// of the transaction it was opened in.
+	sqlQueryer interface {
+		Exec(query string, args ...any) (sql.Result, error)
+		QueryRow(query string, args ...any) *sql.Row
+		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	}
+	// sqliteTx a transaction on the sqlite db spanning statements, the
+	// qryconns opened in it query the sql.Tx.
+	sqliteTx struct {
+		source *Source
+		tx     *sql.Tx
+	}
 	// qryconn is a single-query connection in order to manage
 	// stateful, non-multi-threaded access to sqlite rows object.
 	qryconn struct {
@@ -44,6 +60,7 @@ type (
 		stmt      rel.SqlStatement
 		exit      <-chan bool
 		source    *Source
+		db        sqlQueryer
 		tbl       *schema.Table
 		ps        *plan.Source
 		indexCol  int
@@ -61,6 +78,7 @@ func newQueryConn(tbl *schema.Table, source *Source) *qryconn {
 		tbl:    tbl,
 		cols:   tbl.Columns(),
 		source: source,
+		db:     source.db,
 	}
 	m.init()
 	return &m
@@ -89,6 +107,31 @@ func (m *qryconn) Close() error {
 	return nil
 }
 
+// Begin a transaction on the sqlite db, ConnTransactional interface.
+func (m *qryconn) Begin() (schema.ConnTx, error) {
+	tx, err := m.source.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteTx{source: m.source, tx: tx}, nil
+}
+
+// Open a qryconn to table inside this transaction.
+func (m *sqliteTx) Open(table string) (schema.Conn, error) {
+	conn, err := m.source.Open(table)
+	if err != nil {
+		return nil, err
+	}
+	conn.(*qryconn).db = m.tx
+	return conn, nil
+}
+
+// Commit the sql.Tx
+func (m *sqliteTx) Commit() error { return m.tx.Commit() }
+
+// Rollback the sql.Tx
+func (m *sqliteTx) Rollback() error { return m.tx.Rollback() }
+
 // CreateIterator creates an interator to page through each row in this query resultset.
 // This qryconn is wrapping a sql rows object, paging through until empty.
 func (m *qryconn) CreateIterator() schema.Iterator { return m }
@@ -172,7 +215,7 @@ func (m *qryconn) Put(ctx context.Context, key schema.Key, row any) (schema.Key,
 
 		id := MakeId(rowVals[m.indexCol])
 
-		row := m.source.db.QueryRow(fmt.Sprintf("SELECT * FROM %v WHERE %s = $1", m.tbl.Name, m.cols[0]), rowVals[m.indexCol])
+		row := m.db.QueryRow(fmt.Sprintf("SELECT * FROM %v WHERE %s = $1", m.tbl.Name, m.cols[0]), rowVals[m.indexCol])
 		vals := make([]driver.Value, len(m.cols))
 		if err := row.Scan(&vals); err != nil && err != sql.ErrNoRows {
 			u.Warnf("could not get current? %v", err)
@@ -184,7 +227,7 @@ func (m *qryconn) Put(ctx context.Context, key schema.Key, row any) (schema.Key,
 			for i, v := range rowVals {
 				ivals[i] = v
 			}
-			_, err = m.source.db.Exec(m.sqlInsert, ivals...)
+			_, err = m.db.Exec(m.sqlInsert, ivals...)
 			if err != nil {
 				u.Warnf("wtf %v", err)
 			}
@@ -192,7 +235,7 @@ func (m *qryconn) Put(ctx context.Context, key schema.Key, row any) (schema.Key,
 		} else {
 			u.Debugf("found current? %v", vals)
 			sdm := datasource.NewSqlDriverMessageMap(id, rowVals, m.tbl.FieldPositions)
-			_, err = m.source.db.Exec(m.stmt.String(), nil)
+			_, err = m.db.Exec(m.stmt.String(), nil)
 			if err != nil {
 				u.Warnf("wtf %v", err)
 			}
@@ -213,7 +256,7 @@ func (m *qryconn) PutMulti(ctx context.Context, keys []schema.Key, src any) ([]s
 // Get a single row by key.
 func (m *qryconn) Get(key driver.Value) (schema.Message, error) {
 
-	row := m.source.db.QueryRow(fmt.Sprintf("SELECT * FROM %v WHERE %s = $1", m.tbl.Name, m.cols[0]), key)
+	row := m.db.QueryRow(fmt.Sprintf("SELECT * FROM %v WHERE %s = $1", m.tbl.Name, m.cols[0]), key)
 	vals := make([]driver.Value, len(m.cols))
 	if err := row.Scan(&vals); err != nil {
 		return nil, err
@@ -245,7 +288,13 @@ func (m *qryconn) WalkSourceSelect(planner plan.Planner, p *plan.Source) (plan.T
 	u.Infof("after sqlite-rewrite %s", sqlSelect.String())
 	u.Infof("pushdown sql: %s", sqlString)
 
-	rows, err := m.source.db.Query(sqlString)
+	// the pushed down query is interrupted once the query is canceled or
+	// times out
+	ctx := p.Context().Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rows, err := m.db.QueryContext(ctx, sqlString)
 	if err != nil {
 		u.Errorf("could not open master err=%v", err)
 		return nil, err
@@ -27,7 +27,8 @@ func init() {
 
 var (
 	// Ensure our source implements Source interface
-	_ schema.Source = (*Source)(nil)
+	_ schema.Source        = (*Source)(nil)
+	_ schema.SourceFactory = (*Source)(nil)
 	// ensure our Source implements connection features
 	_ schema.Conn = (*Source)(nil)
 )
@@ -56,6 +57,10 @@ func newSourceEmtpy() schema.Source {
 	}
 }
 
+// NewSource a new, not yet setup, source for each sqlite schema
+// as each one is a different db file.
+func (m *Source) NewSource() schema.Source { return newSourceEmtpy() }
+
 // Setup this source with schema from parent.
 func (m *Source) Setup(s *schema.Schema) error {
 	m.mu.Lock()
@@ -68,6 +73,10 @@ func (m *Source) Setup(s *schema.Schema) error {
 	}
 
 	m.file = s.Conf.Settings.String("file")
+	if m.file == "" {
+		// dsn form sqlite:///tmp/my.db
+		m.file = s.Conf.Settings.String("path")
+	}
 	if m.file == "" {
 		m.file = fmt.Sprintf("/tmp/%s.sql.db", s.Name)
 		u.Warnf("using tmp? %q", m.file)
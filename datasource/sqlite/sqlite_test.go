@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
@@ -17,6 +18,7 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/exec"
 	"github.com/lytics/qlbridge/plan"
 	"github.com/lytics/qlbridge/schema"
 	"github.com/lytics/qlbridge/testutil"
@@ -151,3 +153,52 @@ func TestSuite(t *testing.T) {
 	LoadTestDataOnce(t)
 	testutil.RunSimpleSuite(t)
 }
+
+func TestSqliteDsn(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "dsn.db")
+	db, err := sql.Open("sqlite3", dbFile)
+	assert.Equal(t, nil, err)
+	_, err = db.Exec("CREATE TABLE article (\n  title text,\n  count integer\n);")
+	assert.Equal(t, nil, err)
+	_, err = db.Exec("INSERT INTO article VALUES ('first', 10), ('second', 20);")
+	assert.Equal(t, nil, err)
+	db.Close()
+
+	// each sqlite dsn is its own source, not the registered singleton
+	exec.RegisterSqlDriver()
+	qdb, err := sql.Open("qlbridge", "sqlite://"+dbFile)
+	assert.Equal(t, nil, err)
+	defer qdb.Close()
+	var title string
+	err = qdb.QueryRow("SELECT title FROM article WHERE count > 15").Scan(&title)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "second", title)
+
+	// inserts in a rolled back transaction are discarded
+	count := func(q interface {
+		Query(string, ...any) (*sql.Rows, error)
+	}) int {
+		rows, err := q.Query("SELECT title FROM article")
+		assert.Equal(t, nil, err)
+		defer rows.Close()
+		ct := 0
+		for rows.Next() {
+			ct++
+		}
+		return ct
+	}
+	tx, err := qdb.Begin()
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("INSERT INTO article (title, count) VALUES ('third', 30)")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, count(tx))
+	assert.Equal(t, nil, tx.Rollback())
+	assert.Equal(t, 2, count(qdb))
+
+	tx, err = qdb.Begin()
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("INSERT INTO article (title, count) VALUES ('third', 30)")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, tx.Commit())
+	assert.Equal(t, 3, count(qdb))
+}
@@ -99,6 +99,12 @@ func (m *rewrite) walkSelectList() error {
 			// 	return nil, value.NewStringValue(curNode.Text), nil
 			// case *expr.StringNode:
 			// 	return nil, value.NewStringValue(curNode.Text), nil
+			case *expr.CaseNode:
+				newNode, err := m.walkCase(curNode)
+				if err != nil {
+					return err
+				}
+				col.Expr = newNode
 			case *expr.IdentityNode:
 				//u.Debugf("likely a projection, not agg T:%T  %v", curNode, curNode)
 			default:
@@ -190,6 +196,8 @@ func (m *rewrite) walkNode(cur expr.Node) (expr.Node, error) {
 		return curNode, nil
 	case *expr.ArrayNode:
 		return m.walkArrayNode(curNode)
+	case *expr.CaseNode:
+		return m.walkCase(curNode)
 	default:
 		u.Debugf("unrecognized T:%T  %v", cur, cur)
 	}
@@ -221,6 +229,38 @@ func (m *rewrite) walkFilterTri(node *expr.TriNode) (expr.Node, error) {
 	return node, nil
 }
 
+// Case Nodes are native to sqlite, only the expressions inside need
+// to be walked.
+//
+//	CASE WHEN x > 5 THEN "big" ELSE "small" END
+func (m *rewrite) walkCase(node *expr.CaseNode) (expr.Node, error) {
+	cn := &expr.CaseNode{}
+	var err error
+	if node.Operand != nil {
+		if cn.Operand, err = m.walkNode(node.Operand); err != nil {
+			return nil, err
+		}
+	}
+	for i, when := range node.Whens {
+		w, err := m.walkNode(when)
+		if err != nil {
+			return nil, err
+		}
+		t, err := m.walkNode(node.Thens[i])
+		if err != nil {
+			return nil, err
+		}
+		cn.Whens = append(cn.Whens, w)
+		cn.Thens = append(cn.Thens, t)
+	}
+	if node.Else != nil {
+		if cn.Else, err = m.walkNode(node.Else); err != nil {
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
 // Array Nodes expressions:
 //
 //	year IN (1990,1992)  =>
@@ -281,6 +321,9 @@ func (m *rewrite) walkFilterBinary(node *expr.BinaryNode) (expr.Node, error) {
 	case lex.TokenGT:
 		// db.inventory.find( { qty: { $gt: 20 } } )
 
+	case lex.TokenIs, lex.TokenIsNot:
+		// x IS NULL, x IS NOT NULL are native sqlite
+
 	case lex.TokenLike:
 		// { $text: { $search: <string>, $language: <string> } }
 		// { <field>: { $regex: /pattern/, $options: '<options>' } }
@@ -308,6 +351,11 @@ func (m *rewrite) walkFilterFunc(node *expr.FuncNode) (expr.Node, error) {
 	switch funcName := strings.ToLower(node.Name); funcName {
 	case "exists", "missing":
 
+	case "if":
+		// sqlite names if(cond, a, b) iif
+		fn := *node
+		fn.Name = "iif"
+		return &fn, nil
 	default:
 		u.Warnf("not implemented %T", funcName)
 	}
@@ -331,6 +379,8 @@ func (m *rewrite) walkProjectionFunc(node *expr.FuncNode) (expr.Node, error) {
 	switch funcName := strings.ToLower(node.Name); funcName {
 	case "count":
 		return node, nil
+	case "if":
+		return m.walkFilterFunc(node)
 	default:
 		u.Warnf("not implemented %v", funcName)
 	}
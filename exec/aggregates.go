@@ -0,0 +1,447 @@
+package exec
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/dchest/siphash"
+
+	"github.com/lytics/qlbridge/value"
+)
+
+// Aggregators of the group by operator beyond sum, avg and count.  Each can
+// run partially (on a shard of the rows) returning an *AggPartial holding its
+// state, which the GroupByFinal merges into the same aggregator.
+
+// minMax smallest (or largest) value, compared as the window operator
+// compares ORDER BY values.
+type minMax struct {
+	partial bool
+	max     bool
+	v       value.Value
+}
+
+func (m *minMax) Do(v value.Value) {
+	if v == nil || v.Nil() {
+		return
+	}
+	if m.v == nil {
+		m.v = v
+		return
+	}
+	c := compareValues(v, m.v)
+	if (m.max && c > 0) || (!m.max && c < 0) {
+		m.v = v
+	}
+}
+func (m *minMax) Result() any {
+	var result any
+	if m.v != nil {
+		result = m.v.Value()
+	}
+	if !m.partial {
+		return result
+	}
+	return &AggPartial{Val: result}
+}
+func (m *minMax) Reset() { m.v = nil }
+func (m *minMax) Merge(a *AggPartial) {
+	if a.Val != nil {
+		m.Do(value.NewValue(a.Val))
+	}
+}
+
+// NewMin aggregator of smallest value of group
+func NewMin(partial bool) Aggregator { return &minMax{partial: partial} }
+
+// NewMax aggregator of largest value of group
+func NewMax(partial bool) Aggregator { return &minMax{partial: partial, max: true} }
+
+// distinct aggregates only the distinct values, it holds each value.  Its
+// partial is the distinct values found, as shards may find the same values.
+//
+//	count(DISTINCT user_id)
+type distinct struct {
+	partial bool
+	agg     Aggregator
+	seen    map[string]struct{}
+	vals    []any
+}
+
+func (m *distinct) Do(v value.Value) {
+	if v == nil || v.Nil() {
+		return
+	}
+	key := v.ToString()
+	if _, dupe := m.seen[key]; dupe {
+		return
+	}
+	m.seen[key] = struct{}{}
+	if m.partial {
+		m.vals = append(m.vals, v.Value())
+		return
+	}
+	m.agg.Do(v)
+}
+func (m *distinct) Result() any {
+	if m.partial {
+		return &AggPartial{Vals: m.vals}
+	}
+	return m.agg.Result()
+}
+func (m *distinct) Reset() {
+	m.seen = make(map[string]struct{})
+	m.vals = nil
+	m.agg.Reset()
+}
+func (m *distinct) Merge(a *AggPartial) {
+	for _, v := range a.Vals {
+		m.Do(value.NewValue(v))
+	}
+}
+
+// NewDistinct aggregator of the distinct values given to (non-partial) @agg
+func NewDistinct(agg Aggregator, partial bool) Aggregator {
+	return &distinct{partial: partial, agg: agg, seen: make(map[string]struct{})}
+}
+
+// approxCountDistinct estimated count of distinct values
+type approxCountDistinct struct {
+	partial bool
+	h       hyperLogLog
+}
+
+func (m *approxCountDistinct) Do(v value.Value) {
+	if v == nil || v.Nil() {
+		return
+	}
+	m.h.add(v.ToString())
+}
+func (m *approxCountDistinct) Result() any {
+	if !m.partial {
+		return m.h.count()
+	}
+	registers := make([]byte, len(m.h))
+	copy(registers, m.h)
+	return &AggPartial{Registers: registers}
+}
+func (m *approxCountDistinct) Reset() { m.h = newHyperLogLog() }
+func (m *approxCountDistinct) Merge(a *AggPartial) {
+	m.h.merge(a.Registers)
+}
+
+// NewApproxCountDistinct aggregator of approx_count_distinct(x)
+func NewApproxCountDistinct(partial bool) Aggregator {
+	return &approxCountDistinct{partial: partial, h: newHyperLogLog()}
+}
+
+// variance of values, calculated in one pass with Welford's algorithm as
+// the sum of squares of differences from the mean (m2) of the ct values.
+type variance struct {
+	partial bool
+	pop     bool // population, instead of sample, variance
+	stddev  bool
+	ct      int64
+	sum     float64
+	m2      float64
+}
+
+func (m *variance) Do(v value.Value) {
+	if v == nil || v.Nil() {
+		return
+	}
+	f, ok := value.ValueToFloat64(v)
+	if !ok || math.IsNaN(f) {
+		return
+	}
+	mean := 0.0
+	if m.ct > 0 {
+		mean = m.sum / float64(m.ct)
+	}
+	m.ct++
+	m.sum += f
+	m.m2 += (f - mean) * (f - m.sum/float64(m.ct))
+}
+func (m *variance) Result() any {
+	if m.partial {
+		return &AggPartial{Ct: m.ct, N: m.sum, M2: m.m2}
+	}
+	n := m.ct
+	if !m.pop {
+		n--
+	}
+	if n < 1 {
+		return nil
+	}
+	variance := m.m2 / float64(n)
+	if m.stddev {
+		return math.Sqrt(variance)
+	}
+	return variance
+}
+func (m *variance) Reset() { m.ct, m.sum, m.m2 = 0, 0, 0 }
+func (m *variance) Merge(a *AggPartial) {
+	if a.Ct == 0 {
+		return
+	}
+	if m.ct == 0 {
+		m.ct, m.sum, m.m2 = a.Ct, a.N, a.M2
+		return
+	}
+	// combine the two groups, Chan et al.
+	na, nb := float64(m.ct), float64(a.Ct)
+	delta := a.N/nb - m.sum/na
+	m.m2 += a.M2 + delta*delta*na*nb/(na+nb)
+	m.ct += a.Ct
+	m.sum += a.N
+}
+
+// NewVariance aggregator of variance, of the population if @pop else of a
+// sample, and its square root if @stddev.
+func NewVariance(partial, pop, stddev bool) Aggregator {
+	return &variance{partial: partial, pop: pop, stddev: stddev}
+}
+
+// percentile value at a fraction of the ordered values
+type percentile struct {
+	partial  bool
+	fraction float64
+	d        *digest
+}
+
+func (m *percentile) Do(v value.Value) {
+	if v == nil || v.Nil() {
+		return
+	}
+	if f, ok := value.ValueToFloat64(v); ok && !math.IsNaN(f) {
+		m.d.add(f, 1)
+	}
+}
+func (m *percentile) Result() any {
+	if m.partial {
+		return &AggPartial{Centroids: m.d.centroids()}
+	}
+	if q, ok := m.d.quantile(m.fraction); ok {
+		return q
+	}
+	return nil
+}
+func (m *percentile) Reset() { m.d = newDigest() }
+func (m *percentile) Merge(a *AggPartial) {
+	for _, c := range a.Centroids {
+		m.d.add(c.Mean, c.Ct)
+	}
+}
+
+// NewPercentile aggregator of the value at @fraction (0 to 1) of values
+func NewPercentile(partial bool, fraction float64) Aggregator {
+	return &percentile{partial: partial, fraction: fraction, d: newDigest()}
+}
+
+// arrayAgg values in the order found
+type arrayAgg struct {
+	partial bool
+	join    bool // string_agg
+	sep     string
+	vals    []any
+}
+
+func (m *arrayAgg) Do(v value.Value) {
+	if v == nil || v.Nil() {
+		return
+	}
+	if m.join {
+		m.vals = append(m.vals, v.ToString())
+		return
+	}
+	m.vals = append(m.vals, v.Value())
+}
+func (m *arrayAgg) Result() any {
+	if m.partial {
+		return &AggPartial{Vals: m.vals}
+	}
+	if len(m.vals) == 0 {
+		return nil
+	}
+	if !m.join {
+		return m.vals
+	}
+	strs := make([]string, len(m.vals))
+	for i, v := range m.vals {
+		strs[i], _ = v.(string)
+	}
+	return strings.Join(strs, m.sep)
+}
+func (m *arrayAgg) Reset() { m.vals = nil }
+func (m *arrayAgg) Merge(a *AggPartial) {
+	m.vals = append(m.vals, a.Vals...)
+}
+
+// NewArrayAgg aggregator of array_agg(x)
+func NewArrayAgg(partial bool) Aggregator { return &arrayAgg{partial: partial} }
+
+// NewStringAgg aggregator of string_agg(x, sep)
+func NewStringAgg(partial bool, sep string) Aggregator {
+	return &arrayAgg{partial: partial, join: true, sep: sep}
+}
+
+// aggSize rough bytes of the state of an aggregator
+func aggSize(agg Aggregator) int64 {
+	switch at := agg.(type) {
+	case *approxCountDistinct:
+		return int64(len(at.h))
+	case *percentile:
+		// the buffer of values of the digest
+		return 16 * 5 * digestCompression
+	}
+	return 64
+}
+
+// aggHeld rough bytes of the values held by an aggregator, for those whose
+// state grows with the values aggregated.
+func aggHeld(agg Aggregator) int64 {
+	switch at := agg.(type) {
+	case *distinct:
+		return int64(48 * len(at.vals))
+	case *arrayAgg:
+		return int64(32 * len(at.vals))
+	}
+	return 0
+}
+
+// hyperLogLogPrecision bits of the hash choosing a register, 2^12 registers
+// have a standard error of about 1.6%.
+const hyperLogLogPrecision = 12
+
+// hyperLogLog a sketch estimating the count of distinct values: each
+// register holds the longest run of leading zeros of the hashes of the
+// values assigned to it.  Sketches merge by taking the max of registers.
+type hyperLogLog []byte
+
+func newHyperLogLog() hyperLogLog {
+	return make(hyperLogLog, 1<<hyperLogLogPrecision)
+}
+
+func (m hyperLogLog) add(key string) {
+	x := siphash.Hash(0, 0, []byte(key))
+	idx := x >> (64 - hyperLogLogPrecision)
+	w := x<<hyperLogLogPrecision | 1<<(hyperLogLogPrecision-1)
+	if rho := byte(bits.LeadingZeros64(w) + 1); rho > m[idx] {
+		m[idx] = rho
+	}
+}
+
+func (m hyperLogLog) merge(registers []byte) {
+	for i, r := range registers {
+		if i < len(m) && r > m[i] {
+			m[i] = r
+		}
+	}
+}
+
+func (m hyperLogLog) count() int64 {
+	ct := float64(len(m))
+	sum, zeros := 0.0, 0.0
+	for _, r := range m {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	est := 0.7213 / (1 + 1.079/ct) * ct * ct / sum
+	if est <= 2.5*ct && zeros > 0 {
+		// small cardinalities are more accurately counted by empty registers
+		est = ct * math.Log(ct/zeros)
+	}
+	return int64(est + 0.5)
+}
+
+// Centroid the mean of Ct values of a digest
+type Centroid struct {
+	Mean float64
+	Ct   float64
+}
+
+// digestCompression bounds the number of centroids of a digest
+const digestCompression = 100
+
+// digest summarizes values as centroids (a t-digest), small near the
+// extremes so quantiles near them are accurate.  Values are buffered and
+// merged into the centroids when the buffer fills.
+type digest struct {
+	cs  []Centroid
+	buf []Centroid
+}
+
+func newDigest() *digest { return &digest{} }
+
+func (m *digest) add(mean, ct float64) {
+	m.buf = append(m.buf, Centroid{Mean: mean, Ct: ct})
+	if len(m.buf) >= 5*digestCompression {
+		m.compress()
+	}
+}
+
+func (m *digest) centroids() []Centroid {
+	m.compress()
+	return m.cs
+}
+
+func (m *digest) compress() {
+	if len(m.buf) == 0 {
+		return
+	}
+	all := append(m.cs, m.buf...)
+	m.buf = nil
+	sort.Slice(all, func(i, j int) bool { return all[i].Mean < all[j].Mean })
+	total := 0.0
+	for _, c := range all {
+		total += c.Ct
+	}
+	cs := make([]Centroid, 0, len(all))
+	cur := all[0]
+	before := 0.0
+	for _, c := range all[1:] {
+		q := (before + cur.Ct + c.Ct/2) / total
+		if cur.Ct+c.Ct <= 4*total*q*(1-q)/digestCompression {
+			cur.Mean += (c.Mean - cur.Mean) * c.Ct / (cur.Ct + c.Ct)
+			cur.Ct += c.Ct
+			continue
+		}
+		cs = append(cs, cur)
+		before += cur.Ct
+		cur = c
+	}
+	m.cs = append(cs, cur)
+}
+
+// quantile the value at fraction q of the values, interpolated between the
+// centers of the centroids either side of it.  Exact when each centroid is
+// a single value.
+func (m *digest) quantile(q float64) (float64, bool) {
+	cs := m.centroids()
+	if len(cs) == 0 {
+		return 0, false
+	}
+	total := 0.0
+	for _, c := range cs {
+		total += c.Ct
+	}
+	pos := q * (total - 1)
+	before := 0.0
+	prevCenter, prevMean := 0.0, 0.0
+	for i, c := range cs {
+		center := before + (c.Ct-1)/2
+		if pos <= center {
+			if i == 0 {
+				return c.Mean, true
+			}
+			return prevMean + (c.Mean-prevMean)*(pos-prevCenter)/(center-prevCenter), true
+		}
+		prevCenter, prevMean = center, c.Mean
+		before += c.Ct
+	}
+	return cs[len(cs)-1].Mean, true
+}
@@ -0,0 +1,76 @@
+package exec
+
+import (
+	"github.com/lytics/qlbridge/schema"
+)
+
+var (
+	// MessageBatchSize max number of messages sent as one MessageBatch between
+	// tasks that support batches, 0 disables batching.
+	MessageBatchSize = 100
+
+	// Ensure we implement the schema.Message interface
+	_ schema.Message = (*MessageBatch)(nil)
+)
+
+type (
+	// MessageBatch is a slice of row messages sent between tasks as a single
+	// channel send, amortizing the channel overhead of scan heavy queries.
+	// Batches are only sent to tasks that are BatchReceivers, all other tasks
+	// get single messages.
+	MessageBatch struct {
+		Msgs []schema.Message
+	}
+	// BatchReceiver is a task whose input channel accepts MessageBatch.
+	BatchReceiver interface {
+		ReceivesBatches() bool
+	}
+	// batchSender is a task which may send MessageBatch downstream.
+	batchSender interface {
+		setBatchSize(size int)
+	}
+)
+
+// NewMessageBatch create a batch of messages
+func NewMessageBatch(msgs []schema.Message) *MessageBatch {
+	return &MessageBatch{Msgs: msgs}
+}
+
+// Id of the first message of the batch
+func (m *MessageBatch) Id() uint64 {
+	if len(m.Msgs) == 0 {
+		return 0
+	}
+	return m.Msgs[0].Id()
+}
+
+// Body the messages of the batch
+func (m *MessageBatch) Body() any { return m.Msgs }
+
+// Len number of messages in batch
+func (m *MessageBatch) Len() int { return len(m.Msgs) }
+
+// linkBatches enables batching from @from to @to if @to accepts batches
+func linkBatches(from, to TaskRunner) {
+	if MessageBatchSize <= 0 {
+		return
+	}
+	if br, ok := to.(BatchReceiver); !ok || !br.ReceivesBatches() {
+		return
+	}
+	if bs, ok := from.(batchSender); ok {
+		bs.setBatchSize(MessageBatchSize)
+	}
+}
+
+// eachMessage calls @fn for each message of @msg, unwrapping batches.
+func eachMessage(msg schema.Message, fn func(schema.Message)) {
+	batch, ok := msg.(*MessageBatch)
+	if !ok {
+		fn(msg)
+		return
+	}
+	for _, m := range batch.Msgs {
+		fn(m)
+	}
+}
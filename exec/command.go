@@ -20,7 +20,7 @@ var (
 	_ TaskRunner = (*Command)(nil)
 )
 
-// Command is executeable task for SET SQL commands
+// Command is executeable task for SET, COMMIT, ROLLBACK SQL commands
 type Command struct {
 	*TaskBase
 	p *plan.Command
@@ -56,9 +56,17 @@ func (m *Command) Run() error {
 	switch kw := m.p.Stmt.Keyword(); kw {
 	case lex.TokenSet:
 		return m.runSet()
-	case lex.TokenRollback, lex.TokenCommit:
-		u.Debugf("ignorning transaction, not implemented.  %v", kw.String())
-		return nil
+	case lex.TokenCommit:
+		if m.Ctx.Tx == nil {
+			// no transaction was begun, each statement was already applied
+			return nil
+		}
+		return m.Ctx.Tx.Commit()
+	case lex.TokenRollback:
+		if m.Ctx.Tx == nil {
+			return nil
+		}
+		return m.Ctx.Tx.Rollback()
 	default:
 		u.Warnf("unrecognized command: kw=%v   stmt:%s", kw, m.p.Stmt)
 	}
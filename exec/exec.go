@@ -100,7 +100,6 @@ type (
 		// DML Child Tasks
 		WalkSource(p *plan.Source) (Task, error)
 		WalkJoin(p *plan.JoinMerge) (Task, error)
-		WalkJoinKey(p *plan.JoinKey) (Task, error)
 		WalkWhere(p *plan.Where) (Task, error)
 		WalkHaving(p *plan.Having) (Task, error)
 		WalkGroupBy(p *plan.GroupBy) (Task, error)
@@ -115,6 +114,18 @@ type (
 		WalkAlter(p *plan.Alter) (Task, error)
 	}
 
+	// ExecutorExtended are the walk methods of the tasks added after the
+	// Executor interface, kept out of it so existing executors still
+	// compile.  The JobExecutor walks these tasks for an Executor which
+	// doesn't implement them.
+	ExecutorExtended interface {
+		WalkSetOp(p *plan.SetOp) (Task, error)
+		WalkWith(p *plan.With) (Task, error)
+		WalkExplain(p *plan.Explain) (Task, error)
+		WalkSemiJoin(p *plan.SemiJoin) (Task, error)
+		WalkWindow(p *plan.Window) (Task, error)
+	}
+
 	// ExecutorSource Sources can often do their own execution-plan for sub-select statements
 	// ie mysql can do its own (select, projection) mongo, es can as well
 	// - provide interface to allow passing down select planning to source
@@ -1,9 +1,14 @@
 package exec_test
 
 import (
+	"bytes"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/gob"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,8 +19,10 @@ import (
 	"github.com/lytics/qlbridge/datasource/mockcsv"
 	td "github.com/lytics/qlbridge/datasource/mockcsvtestdata"
 	"github.com/lytics/qlbridge/exec"
+	"github.com/lytics/qlbridge/plan"
 	"github.com/lytics/qlbridge/schema"
 	"github.com/lytics/qlbridge/testutil"
+	"github.com/lytics/qlbridge/value"
 )
 
 func TestMain(m *testing.M) {
@@ -137,6 +144,203 @@ func TestExecSelectWhere(t *testing.T) {
 	assert.True(t, row[4] == true)
 }
 
+// legacyExecutor and legacyPlanner only implement the Executor and Planner
+// interfaces, not the walk methods of the tasks added since.
+type legacyExecutor struct{ exec.Executor }
+type legacyPlanner struct{ plan.Planner }
+
+func TestExecLegacyExecutor(t *testing.T) {
+	ctx := td.TestContext(`SELECT user_id FROM users UNION SELECT user_id FROM orders`)
+	planner := plan.NewPlanner(ctx)
+	planner.Planner = legacyPlanner{planner}
+	job := exec.NewExecutor(ctx, planner.Planner)
+	job.Executor = legacyExecutor{job}
+	defer job.Close()
+
+	task, err := exec.BuildSqlJobPlanned(job.Planner, job.Executor, ctx)
+	assert.True(t, err == nil, "no error %v", err)
+	job.RootTask = task.(exec.TaskRunner)
+
+	msgs := make([]schema.Message, 0)
+	job.RootTask.Add(exec.NewResultBuffer(ctx, &msgs))
+	assert.Equal(t, nil, job.Setup())
+	assert.Equal(t, nil, job.Run())
+	assert.Equal(t, 4, len(msgs))
+}
+
+func TestExecPreparedJob(t *testing.T) {
+	pj, err := exec.NewPreparedJob(`SELECT order_id FROM orders WHERE price > ?`)
+	assert.True(t, err == nil, "no error %v", err)
+	assert.Equal(t, 1, pj.NumInput())
+
+	build := func(price int64) (*exec.JobExecutor, *[]schema.Message) {
+		ctx := td.TestContext(pj.Raw)
+		job, err := pj.BuildSqlJob(ctx, []value.Value{value.NewIntValue(price)})
+		assert.True(t, err == nil, "no error %v", err)
+		msgs := make([]schema.Message, 0)
+		job.RootTask.Add(exec.NewResultBuffer(ctx, &msgs))
+		assert.Equal(t, nil, job.Setup())
+		return job, &msgs
+	}
+	run := func(job *exec.JobExecutor, msgs *[]schema.Message) []string {
+		assert.Equal(t, nil, job.Run())
+		job.Close()
+		ids := make([]string, 0, len(*msgs))
+		for _, msg := range *msgs {
+			ids = append(ids, fmt.Sprint(msg.(*datasource.SqlDriverMessageMap).Values()[0]))
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// the plan is run again by the next execution, with its own arguments
+	job1, msgs1 := build(20)
+	assert.Equal(t, []string{"1", "2", "3"}, run(job1, msgs1))
+	job2, msgs2 := build(30)
+	assert.Equal(t, []string{"2"}, run(job2, msgs2))
+	assert.True(t, job1.Ctx == job2.Ctx, "plan is re-used")
+
+	// executions at once have their own plans, binding one does not change
+	// the arguments of the other
+	job1, msgs1 = build(20)
+	job2, msgs2 = build(30)
+	assert.True(t, job1.Ctx != job2.Ctx, "plans of running jobs are not shared")
+	assert.Equal(t, []string{"2"}, run(job2, msgs2))
+	assert.Equal(t, []string{"1", "2", "3"}, run(job1, msgs1))
+}
+
+func TestExecBatches(t *testing.T) {
+
+	run := func(sqlText string, batchSize int) []string {
+		defer func(size int) { exec.MessageBatchSize = size }(exec.MessageBatchSize)
+		exec.MessageBatchSize = batchSize
+
+		ctx := td.TestContext(sqlText)
+		job, err := exec.BuildSqlJob(ctx)
+		assert.True(t, err == nil, "no error %v", err)
+
+		msgs := make([]schema.Message, 0)
+		resultWriter := exec.NewResultBuffer(ctx, &msgs)
+		job.RootTask.Add(resultWriter)
+
+		err = job.Setup()
+		assert.True(t, err == nil)
+		err = job.Run()
+		time.Sleep(time.Millisecond * 10)
+		assert.True(t, err == nil, "no error %v", err)
+		rows := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			if msg == nil {
+				continue // LIMIT shutdown
+			}
+			// batches never reach the result writer
+			vals := msg.(*datasource.SqlDriverMessageMap).Values()
+			rows = append(rows, fmt.Sprintf("%v", vals))
+		}
+		sort.Strings(rows)
+		return rows
+	}
+
+	for _, sqlText := range []string{
+		`SELECT user_id, email FROM users WHERE yy(reg_date) > 10`,
+		`SELECT user_id, item_id, price * 2 FROM orders WHERE price > 1`,
+		`SELECT user_id, price FROM orders LIMIT 1`,
+	} {
+		single := run(sqlText, 0)
+		assert.True(t, len(single) > 0, "expected rows for %s", sqlText)
+		// batch sizes smaller than, and larger than the row count
+		assert.Equal(t, single, run(sqlText, 1), sqlText)
+		assert.Equal(t, single, run(sqlText, 2), sqlText)
+		assert.Equal(t, single, run(sqlText, 1000), sqlText)
+	}
+
+	batch := exec.NewMessageBatch([]schema.Message{
+		datasource.NewSqlDriverMessageMapEmpty(),
+	})
+	assert.Equal(t, 1, batch.Len())
+	assert.Equal(t, batch.Msgs, batch.Body())
+}
+
+func TestExecStats(t *testing.T) {
+	ctx := td.TestContext(`SELECT user_id, email FROM users WHERE yy(reg_date) > 10`)
+	job, err := exec.BuildSqlJob(ctx)
+	assert.True(t, err == nil, "no error %v", err)
+
+	msgs := make([]schema.Message, 0)
+	job.RootTask.Add(exec.NewResultBuffer(ctx, &msgs))
+	err = job.Setup()
+	assert.True(t, err == nil)
+	err = job.Run()
+	assert.True(t, err == nil, "no error %v", err)
+	assert.Equal(t, 1, len(msgs))
+
+	stats := job.Stats()
+	assert.True(t, stats.Wall > 0, "wall time of job")
+	byTask := make(map[string]*exec.TaskStats)
+	var walk func(st *exec.TaskStats)
+	walk = func(st *exec.TaskStats) {
+		byTask[st.Task] = st
+		for _, c := range st.Children {
+			walk(c)
+		}
+	}
+	walk(stats)
+	src := byTask["Source"]
+	assert.True(t, src != nil, "has source stats %v", byTask)
+	assert.Equal(t, int64(3), src.RowsIn)
+	assert.Equal(t, int64(3), src.RowsOut)
+	assert.True(t, src.Bytes > 0)
+	assert.True(t, src.Wall > 0)
+	proj := byTask["Projection"]
+	assert.True(t, proj != nil, "has projection stats %v", byTask)
+	assert.Equal(t, int64(1), proj.RowsIn)
+	assert.Equal(t, int64(1), proj.RowsOut)
+	assert.True(t, proj.Wall >= proj.Blocked)
+
+	rows := stats.Rows()
+	assert.Equal(t, int64(1), rows[0][0])
+	assert.Equal(t, int64(0), rows[0][1])
+}
+
+func TestExecStrictNulls(t *testing.T) {
+
+	run := func(sqlText string, strict bool) []string {
+		ctx := td.TestContext(sqlText)
+		ctx.StrictNulls = strict
+		job, err := exec.BuildSqlJob(ctx)
+		assert.True(t, err == nil, "no error %v", err)
+
+		msgs := make([]schema.Message, 0)
+		resultWriter := exec.NewResultBuffer(ctx, &msgs)
+		job.RootTask.Add(resultWriter)
+
+		err = job.Setup()
+		assert.True(t, err == nil)
+		err = job.Run()
+		time.Sleep(time.Millisecond * 10)
+		assert.True(t, err == nil, "no error %v", err)
+		rows := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			vals := msg.(*datasource.SqlDriverMessageMap).Values()
+			rows = append(rows, fmt.Sprintf("%v", vals))
+		}
+		sort.Strings(rows)
+		return rows
+	}
+
+	// the 3rd user has no interests
+	sqlText := `SELECT email FROM users WHERE NOT (interests = "fishing")`
+	assert.Equal(t, []string{"[bob@email.com]", "[not_an_email_2]"}, run(sqlText, false))
+	assert.Equal(t, []string{"[bob@email.com]"}, run(sqlText, true))
+
+	sqlText = `SELECT email FROM users WHERE interests IS NULL OR interests = "fishing"`
+	assert.Equal(t, []string{"[aaron@email.com]", "[not_an_email_2]"}, run(sqlText, true))
+
+	sqlText = `SELECT email, interests = "swimming" AS swims FROM users WHERE email != "aaron@email.com"`
+	assert.Equal(t, []string{"[bob@email.com true]", "[not_an_email_2 false]"}, run(sqlText, false))
+	assert.Equal(t, []string{"[bob@email.com true]", "[not_an_email_2 <nil>]"}, run(sqlText, true))
+}
+
 func TestExecGroupBy(t *testing.T) {
 
 	sqlText := `
@@ -201,6 +405,223 @@ func TestExecGroupBy(t *testing.T) {
 	assert.True(t, int(row[0].(float64)) == 14, "expected avg(len(email))=14 but got %v", int(row[0].(float64)))
 }
 
+func TestExecGroupByPartials(t *testing.T) {
+
+	// each aggregate is calculated over two shards of the values, whose
+	// partials are sent (gob encoded) to the final aggregate to be merged
+	vals := []any{"5", 12, 3.5, nil, "12", 40, 7, "cat"}
+	for i := 0; i < 500; i++ {
+		vals = append(vals, float64(i%97))
+	}
+	tests := []struct {
+		name  string
+		agg   func(partial bool) exec.Aggregator
+		delta float64
+	}{
+		{"min", func(p bool) exec.Aggregator { return exec.NewMin(p) }, 0},
+		{"max", func(p bool) exec.Aggregator { return exec.NewMax(p) }, 0},
+		{"variance", func(p bool) exec.Aggregator { return exec.NewVariance(p, false, false) }, 0},
+		{"stddev_pop", func(p bool) exec.Aggregator { return exec.NewVariance(p, true, true) }, 0},
+		// merging digests moves centroids, the median of 0-96 is approximate
+		{"median", func(p bool) exec.Aggregator { return exec.NewPercentile(p, 0.5) }, 1},
+		{"approx_count_distinct", func(p bool) exec.Aggregator { return exec.NewApproxCountDistinct(p) }, 0},
+		{"count_distinct", func(p bool) exec.Aggregator { return exec.NewDistinct(exec.NewCount(nil), p) }, 0},
+		{"string_agg", func(p bool) exec.Aggregator { return exec.NewStringAgg(p, ",") }, 0},
+	}
+	for _, tt := range tests {
+		whole := tt.agg(false)
+		final := tt.agg(false)
+		shards := []exec.Aggregator{tt.agg(true), tt.agg(true)}
+		for i, v := range vals {
+			whole.Do(value.NewValue(v))
+			shards[i%2].Do(value.NewValue(v))
+		}
+		for _, shard := range shards {
+			var buf bytes.Buffer
+			var row []driver.Value
+			err := gob.NewEncoder(&buf).Encode([]driver.Value{shard.Result()})
+			assert.Equal(t, nil, err, tt.name)
+			err = gob.NewDecoder(&buf).Decode(&row)
+			assert.Equal(t, nil, err, tt.name)
+			partial := row[0].(exec.AggPartial)
+			final.Merge(&partial)
+		}
+		expected, merged := whole.Result(), final.Result()
+		switch ev := expected.(type) {
+		case float64:
+			assert.InDelta(t, ev, merged, tt.delta+1e-9, tt.name)
+		case string:
+			// values are in the order found, which differs by shard
+			assert.ElementsMatch(t, strings.Split(ev, ","), strings.Split(merged.(string), ","), tt.name)
+		default:
+			assert.Equal(t, expected, merged, tt.name)
+		}
+	}
+}
+
+func TestExecJoinSpill(t *testing.T) {
+
+	runJoin := func(sqlText string, budget int64, tempDir string) []string {
+		ctx := td.TestContext(sqlText)
+		ctx.MemoryBudget = budget
+		ctx.TempDir = tempDir
+		job, err := exec.BuildSqlJob(ctx)
+		assert.True(t, err == nil, "no error %v", err)
+
+		msgs := make([]schema.Message, 0)
+		resultWriter := exec.NewResultBuffer(ctx, &msgs)
+		job.RootTask.Add(resultWriter)
+
+		err = job.Setup()
+		assert.True(t, err == nil)
+		err = job.Run()
+		time.Sleep(time.Millisecond * 10)
+		assert.True(t, err == nil, "no error %v", err)
+		rows := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			vals := msg.(*datasource.SqlDriverMessageMap).Values()
+			rows = append(rows, fmt.Sprintf("%v", vals))
+		}
+		sort.Strings(rows)
+		return rows
+	}
+
+	for _, sqlText := range []string{
+		`SELECT u.user_id, o.item_id, u.email, o.price
+		FROM users AS u INNER JOIN orders AS o ON u.user_id = o.user_id`,
+		`SELECT u.user_id, o.item_id, u.email, o.price
+		FROM users AS u FULL OUTER JOIN orders AS o ON u.user_id = o.user_id`,
+	} {
+		inMem := runJoin(sqlText, 0, "")
+		assert.True(t, len(inMem) > 0, "expected rows for %s", sqlText)
+
+		// A tiny budget forces both sides to spill to partition files
+		tempDir := t.TempDir()
+		spilled := runJoin(sqlText, 1, tempDir)
+		assert.Equal(t, inMem, spilled)
+
+		files, err := os.ReadDir(tempDir)
+		assert.True(t, err == nil, "no error %v", err)
+		assert.True(t, len(files) == 0, "spill files should be removed %v", files)
+	}
+}
+
+func TestExecGroupBySpill(t *testing.T) {
+
+	// more groups than fit in the budget below
+	var csv bytes.Buffer
+	csv.WriteString("visit_id,visitor,page,ms\n")
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&csv, "%d,v%d,/p%d,%d\n", i, i%700, i%13, (i*37)%1000)
+	}
+	mockcsv.LoadTable(mockcsv.SchemaName, "visits", csv.String())
+
+	runGroupBy := func(sqlText string, budget int64, tempDir string) []string {
+		ctx := td.TestContext(sqlText)
+		ctx.MemoryBudget = budget
+		ctx.TempDir = tempDir
+		job, err := exec.BuildSqlJob(ctx)
+		assert.True(t, err == nil, "no error %v", err)
+
+		msgs := make([]schema.Message, 0)
+		resultWriter := exec.NewResultBuffer(ctx, &msgs)
+		job.RootTask.Add(resultWriter)
+
+		err = job.Setup()
+		assert.True(t, err == nil)
+		err = job.Run()
+		time.Sleep(time.Millisecond * 10)
+		assert.True(t, err == nil, "no error %v", err)
+		rows := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			vals := msg.(*datasource.SqlDriverMessageMap).Values()
+			rows = append(rows, fmt.Sprintf("%v", vals))
+		}
+		sort.Strings(rows)
+		return rows
+	}
+
+	for _, sqlText := range []string{
+		`SELECT visitor, count(*), sum(ms), min(page), max(ms), count(DISTINCT page)
+		FROM visits GROUP BY visitor`,
+		`SELECT page, avg(ms), approx_count_distinct(visitor) FROM visits GROUP BY page`,
+	} {
+		inMem := runGroupBy(sqlText, 0, "")
+		assert.True(t, len(inMem) > 0, "expected rows for %s", sqlText)
+
+		// A small budget forces many runs of groups to disk
+		tempDir := t.TempDir()
+		spilled := runGroupBy(sqlText, 4096, tempDir)
+		assert.Equal(t, inMem, spilled)
+
+		files, err := os.ReadDir(tempDir)
+		assert.True(t, err == nil, "no error %v", err)
+		assert.True(t, len(files) == 0, "spill files should be removed %v", files)
+	}
+	// more runs than are merged at once, which are compacted as they spill
+	rows := runGroupBy(`SELECT visitor, count(*) FROM visits GROUP BY visitor`, 512, t.TempDir())
+	assert.Equal(t, 700, len(rows))
+}
+
+func TestExecOrderSpill(t *testing.T) {
+
+	var csv bytes.Buffer
+	csv.WriteString("visit_id,visitor,page,ms\n")
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&csv, "%d,v%d,/p%d,%d\n", i, i%700, i%13, (i*37)%1000)
+	}
+	mockcsv.LoadTable(mockcsv.SchemaName, "visits_order", csv.String())
+
+	runOrder := func(sqlText string, budget int64, tempDir string) []string {
+		ctx := td.TestContext(sqlText)
+		ctx.MemoryBudget = budget
+		ctx.TempDir = tempDir
+		job, err := exec.BuildSqlJob(ctx)
+		assert.True(t, err == nil, "no error %v", err)
+
+		msgs := make([]schema.Message, 0)
+		resultWriter := exec.NewResultBuffer(ctx, &msgs)
+		job.RootTask.Add(resultWriter)
+
+		err = job.Setup()
+		assert.True(t, err == nil)
+		err = job.Run()
+		time.Sleep(time.Millisecond * 10)
+		assert.True(t, err == nil, "no error %v", err)
+		rows := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			vals := msg.(*datasource.SqlDriverMessageMap).Values()
+			rows = append(rows, fmt.Sprintf("%v", vals))
+		}
+		return rows
+	}
+
+	sqlText := `SELECT visit_id, page, ms FROM visits_order ORDER BY ms DESC, visit_id`
+	inMem := runOrder(sqlText, 0, "")
+	assert.Equal(t, 3000, len(inMem))
+	assert.Equal(t, "[27 /p1 999]", inMem[0])
+
+	// A small budget forces many sorted runs to disk which are merged
+	tempDir := t.TempDir()
+	spilled := runOrder(sqlText, 4096, tempDir)
+	assert.Equal(t, inMem, spilled)
+
+	files, err := os.ReadDir(tempDir)
+	assert.True(t, err == nil, "no error %v", err)
+	assert.True(t, len(files) == 0, "spill files should be removed %v", files)
+
+	// Top-N keeps only the leading rows in a heap, same as the full sort
+	for _, limit := range []int{1, 10, 2999} {
+		topN := runOrder(fmt.Sprintf("%s LIMIT %d", sqlText, limit), 0, "")
+		assert.Equal(t, inMem[:limit], topN)
+	}
+	topN := runOrder(`SELECT visit_id, page, ms FROM visits_order ORDER BY page LIMIT 3`, 0, "")
+	assert.Equal(t, 3, len(topN))
+	for _, row := range topN {
+		assert.True(t, strings.Contains(row, " /p0 "), "expected first page %s", row)
+	}
+}
+
 func TestExecHaving(t *testing.T) {
 	sqlText := `
 		select 
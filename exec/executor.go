@@ -1,13 +1,16 @@
 package exec
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	u "github.com/araddon/gou"
 
 	"github.com/lytics/qlbridge/datasource/membtree"
 	"github.com/lytics/qlbridge/plan"
 	"github.com/lytics/qlbridge/rel"
+	"github.com/lytics/qlbridge/schema"
 )
 
 var (
@@ -15,7 +18,8 @@ var (
 	_ JobRunner = (*JobExecutor)(nil)
 
 	// Ensure that we implement the plan.Planner interface for our job
-	_ Executor = (*JobExecutor)(nil)
+	_ Executor         = (*JobExecutor)(nil)
+	_ ExecutorExtended = (*JobExecutor)(nil)
 	//_ plan.SourcePlanner = (*SourceBuilder)(nil)
 )
 
@@ -30,14 +34,21 @@ type JobExecutor struct {
 	Ctx      *plan.Context
 	distinct bool
 	children []Task
+	cancel   context.CancelFunc // releases the max_execution_time deadline
+	release  func()             // frees the plan of a PreparedJob to be run again
+	mu       sync.Mutex
+	running  bool
+	released bool
 }
 
-// NewExecutor creates a new Job Executor.
+// NewExecutor creates a new Job Executor.  If the session has a
+// max_execution_time the go context of @ctx gets its deadline.
 func NewExecutor(ctx *plan.Context, planner plan.Planner) *JobExecutor {
 	e := &JobExecutor{}
 	e.Executor = e
 	e.Planner = planner
 	e.Ctx = ctx
+	e.cancel = withDeadline(ctx)
 	return e
 }
 
@@ -47,33 +58,57 @@ func BuildSqlJob(ctx *plan.Context) (*JobExecutor, error) {
 	job := NewExecutor(ctx, plan.NewPlanner(ctx))
 	task, err := BuildSqlJobPlanned(job.Planner, job.Executor, ctx)
 	if err != nil {
+		job.cancel()
 		return nil, err
 	}
 	taskRunner, ok := task.(TaskRunner)
 	if !ok {
+		job.cancel()
 		return nil, fmt.Errorf("Expected TaskRunner but was %T", task)
 	}
 	job.RootTask = taskRunner
 	return job, err
 }
 
+// buildRoot the tasks of plan @p, the root task of the job.
+func (m *JobExecutor) buildRoot(p plan.Task) error {
+	task, err := m.Executor.WalkPlan(p)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return fmt.Errorf("No plan root task found? %v", m.Ctx.Raw)
+	}
+	taskRunner, ok := task.(TaskRunner)
+	if !ok {
+		return fmt.Errorf("Expected TaskRunner but was %T", task)
+	}
+	m.RootTask = taskRunner
+	return nil
+}
+
 // BuildSqlJobPlanned Create Job made up of sub-tasks in DAG that is the
-// plan for execution of this query/job.
+// plan for execution of this query/job.  The statement of the context is
+// planned if already parsed (a prepared statement), else ctx.Raw is parsed.
 func BuildSqlJobPlanned(planner plan.Planner, executor Executor, ctx *plan.Context) (Task, error) {
 
 	//u.Debugf("build: %q", ctx.Raw)
-	if ctx.Raw == "" {
-		return nil, fmt.Errorf("no sql provided")
-	}
-	stmt, err := rel.ParseSql(ctx.Raw)
-	if err != nil {
-		u.Debugf("could not parse sql : %v", err)
-		return nil, err
-	}
+	stmt := ctx.Stmt
 	if stmt == nil {
-		return nil, fmt.Errorf("Not statement for parse? %v", ctx.Raw)
+		if ctx.Raw == "" {
+			return nil, fmt.Errorf("no sql provided")
+		}
+		var err error
+		stmt, err = rel.ParseSql(ctx.Raw)
+		if err != nil {
+			u.Debugf("could not parse sql : %v", err)
+			return nil, err
+		}
+		if stmt == nil {
+			return nil, fmt.Errorf("Not statement for parse? %v", ctx.Raw)
+		}
+		ctx.Stmt = stmt
 	}
-	ctx.Stmt = stmt
 
 	pln, err := plan.WalkStmt(ctx, stmt, planner)
 
@@ -118,6 +153,12 @@ func (m *JobExecutor) WalkPlan(p plan.Task) (Task, error) {
 			p.Stmt.SetSystemQry()
 		}
 		return m.Executor.WalkSelect(p)
+	case *plan.SetOp:
+		return m.extended().WalkSetOp(p)
+	case *plan.With:
+		return m.extended().WalkWith(p)
+	case *plan.Explain:
+		return m.extended().WalkExplain(p)
 	case *plan.Upsert:
 		return m.Executor.WalkUpsert(p)
 	case *plan.Insert:
@@ -140,6 +181,15 @@ func (m *JobExecutor) WalkPlan(p plan.Task) (Task, error) {
 	panic(fmt.Sprintf("Not implemented for %T", p))
 }
 
+// extended the Executor if it implements ExecutorExtended, otherwise the
+// JobExecutor walks those tasks.
+func (m *JobExecutor) extended() ExecutorExtended {
+	if e, ok := m.Executor.(ExecutorExtended); ok {
+		return e
+	}
+	return m
+}
+
 // WalkPreparedStatement not implemented
 func (m *JobExecutor) WalkPreparedStatement(p *plan.PreparedStatement) (Task, error) {
 	return nil, ErrNotImplemented
@@ -152,6 +202,72 @@ func (m *JobExecutor) WalkSelect(p *plan.Select) (Task, error) {
 	root := m.NewTask(p)
 	return root, m.WalkChildren(p, root)
 }
+
+// WalkSetOp create dag of a UNION, INTERSECT, EXCEPT, each side runs
+// in parallel into the SetOp task.
+func (m *JobExecutor) WalkSetOp(p *plan.SetOp) (Task, error) {
+	root := m.NewTask(p)
+	execTask := NewTaskParallel(m.Ctx)
+	l, err := m.WalkPlan(p.Left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := m.WalkPlan(p.Right)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range []Task{l, r, NewSetOp(m.Ctx, l.(TaskRunner), r.(TaskRunner), p)} {
+		if err = execTask.Add(t); err != nil {
+			return nil, err
+		}
+	}
+	if err = root.Add(execTask); err != nil {
+		return nil, err
+	}
+	return root, m.WalkChildren(p, root)
+}
+
+// WalkWith create dag of the statement of a WITH, which runs its common
+// table expressions before the statement.
+func (m *JobExecutor) WalkWith(p *plan.With) (Task, error) {
+	ctes := make([]Task, len(p.Ctes))
+	for i, cte := range p.Ctes {
+		t, err := m.Executor.WalkPlan(cte.Query)
+		if err != nil {
+			return nil, err
+		}
+		ctes[i] = t
+	}
+	main, err := m.Executor.WalkPlan(p.Main)
+	if err != nil {
+		return nil, err
+	}
+	runner, ok := main.(TaskRunner)
+	if !ok {
+		return nil, fmt.Errorf("Expected TaskRunner but was %T", main)
+	}
+	return NewWith(m.Ctx, m.Executor, runner, ctes, p), nil
+}
+
+// WalkExplain create the task which describes the plan of an EXPLAIN
+// statement, the plan itself is only run by EXPLAIN ANALYZE.
+func (m *JobExecutor) WalkExplain(p *plan.Explain) (Task, error) {
+	root := m.NewTask(p)
+	explain := NewExplain(m.Ctx, p)
+	if p.Stmt.Analyze {
+		// EXPLAIN ANALYZE runs the statement
+		t, err := m.Executor.WalkPlan(p.Plan)
+		if err != nil {
+			return nil, err
+		}
+		runner, ok := t.(TaskRunner)
+		if !ok {
+			return nil, fmt.Errorf("Expected TaskRunner but was %T", t)
+		}
+		explain.analyze = runner
+	}
+	return root, root.Add(explain)
+}
 func (m *JobExecutor) WalkUpsert(p *plan.Upsert) (Task, error) {
 	root := m.NewTask(p)
 	return root, root.Add(NewUpsert(m.Ctx, p))
@@ -177,13 +293,15 @@ func (m *JobExecutor) WalkSource(p *plan.Source) (Task, error) {
 			u.Errorf("Could not put %v", err)
 		}
 		return NewSourceScanner(m.Ctx, p, static), nil
+	} else if p.Cte != nil {
+		return NewSourceScanner(m.Ctx, p, newCteScanner(p.Cte)), nil
 	} else if p.Conn == nil {
 		u.Warnf("no conn? %T", p.DataSource)
 		if p.DataSource == nil {
 			u.Warnf("no datasource")
 			return nil, fmt.Errorf("missing data source")
 		}
-		source, err := p.DataSource.Open(p.Stmt.SourceName())
+		source, err := p.Context().OpenConn(p.DataSource, p.Stmt.SourceName())
 		if err != nil {
 			return nil, err
 		}
@@ -204,7 +322,7 @@ func (m *JobExecutor) WalkSourceExec(p *plan.Source) (Task, error) {
 			u.Warnf("no datasource")
 			return nil, fmt.Errorf("missing data source")
 		}
-		source, err := p.DataSource.Open(p.Stmt.SourceName())
+		source, err := p.Context().OpenConn(p.DataSource, p.Stmt.SourceName())
 		if err != nil {
 			return nil, err
 		}
@@ -219,7 +337,22 @@ func (m *JobExecutor) WalkSourceExec(p *plan.Source) (Task, error) {
 	return nil, fmt.Errorf("%T Must Implement Scanner for %q", p.Conn, p.Stmt.String())
 }
 func (m *JobExecutor) WalkWhere(p *plan.Where) (Task, error) {
-	return NewWhere(m.Ctx, p), nil
+	w := NewWhere(m.Ctx, p)
+	for _, sq := range p.SubQueries {
+		t, err := m.Executor.WalkPlan(sq.Select)
+		if err != nil {
+			return nil, err
+		}
+		w.subQueries = append(w.subQueries, &subQuery{p: sq, task: t})
+	}
+	return w, nil
+}
+func (m *JobExecutor) WalkSemiJoin(p *plan.SemiJoin) (Task, error) {
+	t, err := m.Executor.WalkPlan(p.Sub.Select)
+	if err != nil {
+		return nil, err
+	}
+	return NewSemiJoin(m.Ctx, t, p), nil
 }
 func (m *JobExecutor) WalkHaving(p *plan.Having) (Task, error) {
 	return NewHaving(m.Ctx, p), nil
@@ -230,6 +363,9 @@ func (m *JobExecutor) WalkGroupBy(p *plan.GroupBy) (Task, error) {
 func (m *JobExecutor) WalkOrder(p *plan.Order) (Task, error) {
 	return NewOrder(m.Ctx, p), nil
 }
+func (m *JobExecutor) WalkWindow(p *plan.Window) (Task, error) {
+	return NewWindow(m.Ctx, p), nil
+}
 func (m *JobExecutor) WalkProjection(p *plan.Projection) (Task, error) {
 	return NewProjection(m.Ctx, p), nil
 }
@@ -241,11 +377,29 @@ func (m *JobExecutor) WalkJoin(p *plan.JoinMerge) (Task, error) {
 		u.Errorf("whoops %T  %v", l, err)
 		return nil, err
 	}
+	if _, isJoin := p.Left.(*plan.JoinMerge); isJoin {
+		// A parallel task shares its output channel with its parent, wrap
+		// the left join so it keeps its own output for this join to read.
+		seq := NewTaskSequential(m.Ctx)
+		if err = seq.Add(l); err != nil {
+			return nil, err
+		}
+		l = seq
+	}
 	err = execTask.Add(l)
 	if err != nil {
 		u.Errorf("whoops %T  %v", l, err)
 		return nil, err
 	}
+	if p.Seek {
+		// index nested-loop join, right side is never scanned
+		if src, ok := p.Right.(*plan.Source); ok {
+			if seeker, ok := src.Conn.(schema.ConnSeeker); ok {
+				return execTask, execTask.Add(NewJoinSeek(m.Ctx, l.(TaskRunner), seeker, p))
+			}
+		}
+		u.Warnf("join planned as seek but right side is not a seeker %T", p.Right)
+	}
 	r, err := m.WalkPlanAll(p.Right)
 	if err != nil {
 		return nil, err
@@ -262,9 +416,6 @@ func (m *JobExecutor) WalkJoin(p *plan.JoinMerge) (Task, error) {
 	}
 	return execTask, nil
 }
-func (m *JobExecutor) WalkJoinKey(p *plan.JoinKey) (Task, error) {
-	return NewJoinKey(m.Ctx, p), nil
-}
 func (m *JobExecutor) WalkPlanAll(p plan.Task) (Task, error) {
 	root, err := m.WalkPlanTask(p)
 	if err != nil {
@@ -290,18 +441,20 @@ func (m *JobExecutor) WalkPlanTask(p plan.Task) (Task, error) {
 		return m.Executor.WalkSource(p)
 	case *plan.Where:
 		return m.Executor.WalkWhere(p)
+	case *plan.SemiJoin:
+		return m.extended().WalkSemiJoin(p)
 	case *plan.Having:
 		return m.Executor.WalkHaving(p)
 	case *plan.GroupBy:
 		return m.Executor.WalkGroupBy(p)
 	case *plan.Order:
 		return m.Executor.WalkOrder(p)
+	case *plan.Window:
+		return m.extended().WalkWindow(p)
 	case *plan.Projection:
 		return m.Executor.WalkProjection(p)
 	case *plan.JoinMerge:
 		return m.Executor.WalkJoin(p)
-	case *plan.JoinKey:
-		return m.Executor.WalkJoinKey(p)
 	}
 	panic(fmt.Sprintf("Task plan-exec Not implemented for %T", p))
 }
@@ -384,16 +537,94 @@ func (m *JobExecutor) Setup() error {
 	return m.RootTask.Setup(0)
 }
 
-// Run this task
+// Run this task.  Once the go context of the job is done all of its tasks
+// are closed, and the error of the context is returned, a
+// QueryTimeoutError if its deadline was exceeded.
 func (m *JobExecutor) Run() error {
-	return m.RootTask.Run()
+	if !m.start() {
+		return ErrShuttingDown
+	}
+	defer m.releasePlan(false)
+	if m.cancel != nil {
+		// release the max_execution_time deadline, Close also does
+		defer m.cancel()
+	}
+	stop := m.closeOnDone()
+	err := runTimed(m.RootTask)
+	if stop() {
+		return contextErr(m.Ctx)
+	}
+	return err
+}
+
+// closeOnDone closes the tasks, and so the source connections, of the job
+// once its go context is done.  The returned func stops watching, it is
+// true if the tasks were closed.
+func (m *JobExecutor) closeOnDone() func() bool {
+	if m.Ctx == nil || m.Ctx.Context == nil || m.Ctx.Done() == nil {
+		return func() bool { return false }
+	}
+	done := m.Ctx.Done()
+	finished := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-done:
+			m.RootTask.Close()
+			closed <- true
+		case <-finished:
+			closed <- false
+		}
+	}()
+	return func() bool {
+		close(finished)
+		return <-closed
+	}
+}
+
+// Stats the runtime statistics of each task of the job, once Run has
+// returned.
+func (m *JobExecutor) Stats() *TaskStats {
+	if m.RootTask == nil {
+		return nil
+	}
+	return CollectStats(m.RootTask)
 }
 
 // Close the normal close of root task
 func (m *JobExecutor) Close() error {
+	if m.cancel != nil {
+		defer m.cancel()
+	}
+	defer m.releasePlan(true)
 	return m.RootTask.Close()
 }
 
+// start running the job, false if it was closed before it ran.
+func (m *JobExecutor) start() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.released {
+		return false
+	}
+	m.running = true
+	return true
+}
+
+// releasePlan frees the plan of a job of a PreparedJob to be run again, by
+// Run once it returns or by Close of a job which never ran.
+func (m *JobExecutor) releasePlan(closing bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.released || (closing && m.running) {
+		return
+	}
+	m.released = true
+	if m.release != nil {
+		m.release()
+	}
+}
+
 // The drain is the last out channel, on last task
 func (m *JobExecutor) DrainChan() MessageChan {
 	tasks := m.RootTask.Children()
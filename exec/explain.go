@@ -0,0 +1,91 @@
+package exec
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/schema"
+)
+
+var (
+	// Ensure that we implement the Task Runner interface
+	_ TaskRunner = (*Explain)(nil)
+)
+
+// Explain task sends the description of the plan of an EXPLAIN statement
+// as rows, see plan.ExplainColumns.  For EXPLAIN ANALYZE the statement
+// is run, and the runtime statistics of its tasks are sent instead.
+type Explain struct {
+	*TaskBase
+	p       *plan.Explain
+	analyze TaskRunner // the statement of an EXPLAIN ANALYZE
+}
+
+// NewExplain create the task of an EXPLAIN
+func NewExplain(ctx *plan.Context, p *plan.Explain) *Explain {
+	return &Explain{
+		TaskBase: NewTaskBase(ctx),
+		p:        p,
+	}
+}
+
+// Run send a message per row of the explain
+func (m *Explain) Run() error {
+	defer m.Ctx.Recover()
+	defer close(m.msgOutCh)
+
+	var rows [][]driver.Value
+	var err error
+	if m.analyze != nil {
+		rows, err = m.runAnalyze()
+	} else {
+		rows, err = m.p.Rows()
+	}
+	if err != nil {
+		return err
+	}
+	colIndex := make(map[string]int)
+	for i, col := range m.p.Columns() {
+		colIndex[col] = i
+	}
+	for i, row := range rows {
+		select {
+		case <-m.SigChan():
+			return nil
+		case m.msgOutCh <- datasource.NewSqlDriverMessageMap(uint64(i), row, colIndex):
+		}
+	}
+	return nil
+}
+
+// runAnalyze runs the statement discarding its rows, returning the runtime
+// statistics of its tasks.
+func (m *Explain) runAnalyze() ([][]driver.Value, error) {
+	discard := NewTaskBase(m.Ctx)
+	discard.Name = "Discard"
+	discard.Handler = func(ctx *plan.Context, msg schema.Message) bool {
+		return true
+	}
+	if err := m.analyze.Add(discard); err != nil {
+		return nil, err
+	}
+	if err := m.analyze.Setup(0); err != nil {
+		return nil, err
+	}
+	err := runTimed(m.analyze)
+	m.analyze.Close()
+	if err != nil {
+		return nil, err
+	}
+	stats := CollectStats(m.analyze)
+	if m.p.Stmt.Format == "json" {
+		by, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return [][]driver.Value{{string(by)}}, nil
+	}
+	return stats.Rows(), nil
+}
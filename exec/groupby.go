@@ -4,6 +4,8 @@ import (
 	"database/sql/driver"
 	"encoding/gob"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 
 	"github.com/lytics/qlbridge/datasource"
 	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/expr/builtins"
 	"github.com/lytics/qlbridge/plan"
 	"github.com/lytics/qlbridge/rel"
 	"github.com/lytics/qlbridge/value"
@@ -26,14 +29,18 @@ var (
 
 func init() {
 	gob.Register(AggPartial{})
+	// values of min, max and array_agg partials
+	gob.Register(time.Time{})
 }
 
-// Group by a Sql Group By task which creates a hashable key from row
+// GroupBy a Sql Group By task which creates a hashable key from row
 // commposed of key = {each,value,of,column,in,groupby}
 //
-// A very stupid naive parallel groupby holds values in memory.  This
-// is a toy implementation that is only useful for small cardinality
-// group-bys, small number of rows.
+// Rows are aggregated as they arrive, only the state of the aggregates of
+// each group is held (a hash aggregation).  If the plan.Context has a
+// MemoryBudget, once the groups exceed it they are written to disk as a run
+// sorted by key and aggregation starts over, at the end the runs are
+// merged by key combining the partial aggregates of each group.
 type GroupBy struct {
 	*TaskBase
 	closed bool
@@ -73,29 +80,26 @@ func (m *GroupBy) Run() error {
 	defer m.Ctx.Recover()
 	defer close(m.msgOutCh)
 
-	outCh := m.MessageOut()
 	inCh := m.MessageIn()
 
-	columns := m.p.Stmt.Columns
 	colIndex := m.p.Stmt.ColIndexes()
 
-	aggs, err := buildAggs(m.p)
+	ha, err := newHashAgg(m.Ctx, m.p)
 	if err != nil {
 		u.Warnf("Group By statement not supported? %v", err)
 		return err
 	}
-
-	// are are going to hold entire row in memory while we are calculating
-	//  so obviously not scalable.
-	gb := make(map[string][]*datasource.SqlDriverMessageMap)
+	defer ha.Close()
 
 msgReadLoop:
 	for {
 
+		start := time.Now()
 		select {
 		case <-m.SigChan():
 			return nil
 		case msg, ok := <-inCh:
+			m.counters.received(msg, start)
 			if !ok {
 				break msgReadLoop
 			} else {
@@ -125,55 +129,24 @@ msgReadLoop:
 						keys[i] = key.ToString()
 					}
 				}
-				key := strings.Join(keys, ",")
-				gb[key] = append(gb[key], sdm)
+				if err := ha.add(strings.Join(keys, ","), sdm); err != nil {
+					u.Errorf("could not spill group by %v", err)
+					return err
+				}
 			}
 		}
 	}
 
 	i := uint64(0)
-	for key, v := range gb {
-		//u.Debugf("got %s:%v msgs", k, len(v))
-
-		for _, mm := range v {
-			for i, col := range columns {
-				//u.Debugf("col: idx:%v sidx: %v pidx:%v key:%v   %s", col.Index, col.SourceIndex, col.ParentIndex, col.Key(), col.Expr)
-
-				if col.Expr == nil {
-					u.Warnf("wat?   nil col expr? %#v", col)
-				} else {
-					v, ok := vm.Eval(mm, col.Expr)
-					//u.Infof("mt: %T  mm %#v", mm, mm)
-					if !ok || v == nil {
-						//u.Debugf("evaled nil? key=%v  val=%v expr:%s", col.Key(), v, col.Expr.String())
-						//u.Infof("mt: %T  mm %#v", mm, mm)
-						aggs[i].Do(value.NewNilValue())
-					} else {
-						//u.Debugf("evaled: key=%v  val=%v", col.Key(), v.Value())
-						aggs[i].Do(v)
-					}
-				}
-			}
-		}
-
-		row := make([]driver.Value, len(columns))
-		for i, agg := range aggs {
-			row[i] = driver.Value(agg.Result())
-			agg.Reset()
-			//u.Debugf("agg result: %#v  %v", row[i], row[i])
-		}
-
+	return ha.emit(m.p.Partial, func(key string, row []driver.Value) bool {
 		if m.p.Partial {
 			// Partial results, append key at end?  shouldn't be able to be fit in message itself?
 			row = append(row, key)
-			//u.Debugf("GroupBy output row? key:%s %#v", key, row)
 		}
-		//u.Debugf("row: %v  cols:%v", row, colIndex)
-		outCh <- datasource.NewSqlDriverMessageMap(i, row, colIndex)
+		msg := datasource.NewSqlDriverMessageMap(i, row, colIndex)
 		i++
-	}
-
-	return nil
+		return m.send(msg)
+	})
 }
 
 // Run group-by-final Runs standard task interface.
@@ -181,28 +154,28 @@ func (m *GroupByFinal) Run() error {
 	defer m.Ctx.Recover()
 	defer close(m.msgOutCh)
 
-	outCh := m.MessageOut()
 	inCh := m.MessageIn()
 
 	columns := m.p.Stmt.Columns
 	colIndex := m.p.Stmt.ColIndexes()
 
 	m.p.Partial = false
-	aggs, err := buildAggs(m.p)
+	ha, err := newHashAgg(m.Ctx, m.p)
 	if err != nil {
 		return err
 	}
-
-	gb := make(map[string][][]driver.Value)
+	defer ha.Close()
 
 msgReadLoop:
 	for {
 
+		start := time.Now()
 		select {
 		case <-m.SigChan():
 			u.Warnf("got signal quit")
 			return nil
 		case msg, ok := <-inCh:
+			m.counters.received(msg, start)
 			if !ok {
 				//u.Debugf("GroupByFinal, got closed channel shutdown")
 				break msgReadLoop
@@ -212,14 +185,16 @@ msgReadLoop:
 				case *datasource.SqlDriverMessageMap:
 					if len(mt.Vals) != len(columns)+1 {
 						u.Warnf("Wrong number of values? %#v", mt)
+						continue
 					}
 					key, ok := mt.Vals[len(mt.Vals)-1].(string)
 					if !ok {
 						u.Warnf("expected key?  %#v", mt.Vals)
 					}
-					vals := mt.Vals[0 : len(mt.Vals)-1]
-					//u.Infof("found key:%s for %#v", key, mt.Vals)
-					gb[key] = append(gb[key], vals)
+					if err := ha.merge(key, mt.Vals[0:len(mt.Vals)-1]); err != nil {
+						u.Errorf("could not spill group by %v", err)
+						return err
+					}
 				default:
 					err := fmt.Errorf("To use Join must use SqlDriverMessageMap but got %T", msg)
 					u.Errorf("unrecognized msg %T", msg)
@@ -231,50 +206,15 @@ msgReadLoop:
 	}
 
 	i := uint64(0)
-	for _, vals := range gb {
-		//u.Debugf("got %s:%v msgs", key, vals)
-
-		for _, dv := range vals {
-			for i, col := range columns {
-				//u.Debugf("col: idx:%v sidx: %v pidx:%v key:%v   %s", col.Index, col.SourceIndex, col.ParentIndex, col.Key(), col.Expr)
-				if i-1 >= len(dv) {
-					u.Errorf("what??? %v  dv: %d   %#v", i, len(dv), dv)
-				}
-				if col.Expr == nil {
-					u.Warnf("wat?   nil col expr? %#v", col)
-				} else {
-					v := dv[i]
-					switch vt := v.(type) {
-					case *AggPartial:
-						//u.Debugf("evaled: key=%v  val=%v", col.Key(), v.Value())
-						aggs[i].Merge(vt)
-					case AggPartial:
-						aggs[i].Merge(&vt)
-					case int64:
-						aggs[i].Merge(&AggPartial{Ct: vt})
-					case string:
-						aggs[i] = &groupByFunc{vt}
-					default:
-						u.Warnf("unhandled type: %#v", v)
-					}
-				}
-			}
-		}
-
-		row := make([]driver.Value, len(columns))
-		for i, agg := range aggs {
-			row[i] = driver.Value(agg.Result())
-			agg.Reset()
-			//u.Debugf("agg result: %#v  %v", row[i], row[i])
-		}
-		//u.Debugf("GroupBy output row? %v", row)
-		outCh <- datasource.NewSqlDriverMessageMap(i, row, colIndex)
+	err = ha.emit(false, func(key string, row []driver.Value) bool {
+		msg := datasource.NewSqlDriverMessageMap(i, row, colIndex)
 		i++
-	}
+		return m.send(msg)
+	})
 
 	m.isComplete = true
 	close(m.complete)
-	return nil
+	return err
 }
 
 // Close the task, channels, cleanup.
@@ -319,8 +259,13 @@ func (m *GroupByFinal) Close() error {
 // group-bys calculated across multiple nodes this holds info that
 // needs to be further calculated it only represents this hash.
 type AggPartial struct {
-	Ct int64
-	N  float64
+	Ct        int64
+	N         float64
+	M2        float64    // sum of squares of differences from mean, variance
+	Val       any        // min, max
+	Vals      []any      // array_agg, string_agg, distinct values
+	Registers []byte     // HyperLogLog sketch, approx_count_distinct
+	Centroids []Centroid // digest, percentile
 }
 
 type AggFunc func(v value.Value)
@@ -367,11 +312,11 @@ func (m *sum) Result() any {
 		return m.n
 	}
 	return &AggPartial{
-		m.ct,
-		m.n,
+		Ct: m.ct,
+		N:  m.n,
 	}
 }
-func (m *sum) Reset() { m.n = 0 }
+func (m *sum) Reset() { m.n = 0; m.ct = 0 }
 func (m *sum) Merge(a *AggPartial) {
 	m.ct += a.Ct
 	m.n += a.N
@@ -400,8 +345,8 @@ func (m *avg) Result() any {
 		return m.n / float64(m.ct)
 	}
 	return &AggPartial{
-		m.ct,
-		m.n,
+		Ct: m.ct,
+		N:  m.n,
 	}
 }
 func (m *avg) Reset() { m.n = 0; m.ct = 0 }
@@ -434,7 +379,7 @@ func NewCount(col *rel.Column) Aggregator {
 	return &count{}
 }
 
-func buildAggs(p *plan.GroupBy) ([]Aggregator, error) {
+func buildAggs(p *plan.GroupBy, partial bool) ([]Aggregator, error) {
 
 	aggs := make([]Aggregator, len(p.Stmt.Columns))
 colLoop:
@@ -453,30 +398,309 @@ colLoop:
 		}
 
 		// Since we made it here, it is an aggregate func
-		//  move to a registry of some kind to allow extension
-		switch n := col.Expr.(type) {
-		case *expr.FuncNode:
-
-			// TODO:  extract to a UDF Registry Similar to builtins
-			switch strings.ToLower(n.Name) {
-			case "avg":
-				aggs[colIdx] = NewAvg(col, p.Partial)
-			case "count":
-				aggs[colIdx] = NewCount(col)
-			case "sum":
-				aggs[colIdx] = NewSum(col, p.Partial)
-			default:
-				return nil, fmt.Errorf("Not implemented groupby for function: %s", col.Expr)
-			}
-		case *expr.BinaryNode:
-			// expression logic?
-			return nil, fmt.Errorf("Not implemented groupby for expression column: %s", col.Expr)
-		case *expr.IdentityNode:
-			// We can have a naked group by which basically means distinct? should have been caught above
-			return nil, fmt.Errorf("Not implemented groupby for identity column %s", col.Expr)
-		default:
-			return nil, fmt.Errorf("Not implemented groupby for %T column: %s", col.Expr, col.Expr)
+		agg, err := newAggregator(col, partial)
+		if err != nil {
+			return nil, err
 		}
+		aggs[colIdx] = agg
 	}
 	return aggs, nil
 }
+
+// newAggregator the aggregator of the aggregate function of a column
+func newAggregator(col *rel.Column, partial bool) (Aggregator, error) {
+
+	//  move to a registry of some kind to allow extension
+	switch n := col.Expr.(type) {
+	case *expr.FuncNode:
+
+		if n.Distinct {
+			agg, err := newFuncAggregator(col, n, false)
+			if err != nil {
+				return nil, err
+			}
+			return NewDistinct(agg, partial), nil
+		}
+		return newFuncAggregator(col, n, partial)
+	case *expr.BinaryNode:
+		// expression logic?
+		return nil, fmt.Errorf("Not implemented groupby for expression column: %s", col.Expr)
+	case *expr.IdentityNode:
+		// We can have a naked group by which basically means distinct? should have been caught above
+		return nil, fmt.Errorf("Not implemented groupby for identity column %s", col.Expr)
+	default:
+		return nil, fmt.Errorf("Not implemented groupby for %T column: %s", col.Expr, col.Expr)
+	}
+}
+
+func newFuncAggregator(col *rel.Column, n *expr.FuncNode, partial bool) (Aggregator, error) {
+
+	// TODO:  extract to a UDF Registry Similar to builtins
+	switch name := strings.ToLower(n.Name); name {
+	case "avg":
+		return NewAvg(col, partial), nil
+	case "count":
+		return NewCount(col), nil
+	case "sum":
+		return NewSum(col, partial), nil
+	case "min":
+		return NewMin(partial), nil
+	case "max":
+		return NewMax(partial), nil
+	case "approx_count_distinct":
+		return NewApproxCountDistinct(partial), nil
+	case "variance", "var_samp", "var_pop":
+		return NewVariance(partial, name == "var_pop", false), nil
+	case "stddev", "stddev_samp", "stddev_pop":
+		return NewVariance(partial, name == "stddev_pop", true), nil
+	case "percentile", "approx_percentile", "median":
+		fraction, ok := builtins.PercentileFraction(n)
+		if !ok {
+			return nil, fmt.Errorf("percentile fraction must be between 0 and 1: %s", col.Expr)
+		}
+		return NewPercentile(partial, fraction), nil
+	case "array_agg":
+		return NewArrayAgg(partial), nil
+	case "string_agg":
+		sep, ok := builtins.StringAggSeparator(n)
+		if !ok {
+			return nil, fmt.Errorf("string_agg separator must be a string: %s", col.Expr)
+		}
+		return NewStringAgg(partial, sep), nil
+	}
+	return nil, fmt.Errorf("Not implemented groupby for function: %s", col.Expr)
+}
+
+// mergePartial merge value @v of a partial row, ie the result of the same
+// aggregator run with partial, into @agg
+func mergePartial(agg Aggregator, v driver.Value) {
+	if gb, ok := agg.(*groupByFunc); ok {
+		gb.last = v
+		return
+	}
+	switch vt := v.(type) {
+	case *AggPartial:
+		agg.Merge(vt)
+	case AggPartial:
+		agg.Merge(&vt)
+	case int64:
+		agg.Merge(&AggPartial{Ct: vt})
+	case nil:
+	default:
+		u.Warnf("unhandled type: %#v", v)
+	}
+}
+
+// groupByMaxRuns the most runs of a group by before they are merged
+const groupByMaxRuns = 64
+
+// hashAgg the groups of a group by, keyed by the values of the group by
+// expressions, each group holds the partial state of its aggregates.
+type hashAgg struct {
+	p      *plan.GroupBy
+	dir    string
+	budget int64
+	size   int64
+	groups map[string][]Aggregator
+	runs   []*spillFile
+}
+
+func newHashAgg(ctx *plan.Context, p *plan.GroupBy) (*hashAgg, error) {
+	// ensure the statement is supported before the first row
+	if _, err := buildAggs(p, true); err != nil {
+		return nil, err
+	}
+	m := &hashAgg{p: p, groups: make(map[string][]Aggregator)}
+	if ctx != nil {
+		m.budget = ctx.MemoryBudget
+		m.dir = ctx.TempDir
+	}
+	return m, nil
+}
+
+// group the aggregates of group @key
+func (m *hashAgg) group(key string) []Aggregator {
+	aggs, ok := m.groups[key]
+	if !ok {
+		aggs, _ = buildAggs(m.p, true)
+		m.groups[key] = aggs
+		m.size += int64(len(key))
+		for _, agg := range aggs {
+			m.size += aggSize(agg)
+		}
+	}
+	return aggs
+}
+
+// add a row to group @key
+func (m *hashAgg) add(key string, msg *datasource.SqlDriverMessageMap) error {
+	aggs := m.group(key)
+	for i, col := range m.p.Stmt.Columns {
+		if col.Expr == nil {
+			u.Warnf("wat?   nil col expr? %#v", col)
+			continue
+		}
+		v, ok := vm.Eval(msg, col.Expr)
+		if !ok || v == nil {
+			v = value.NewNilValue()
+		}
+		held := aggHeld(aggs[i])
+		aggs[i].Do(v)
+		m.size += aggHeld(aggs[i]) - held
+	}
+	return m.checkBudget()
+}
+
+// merge a partial row into group @key
+func (m *hashAgg) merge(key string, vals []driver.Value) error {
+	aggs := m.group(key)
+	for i, v := range vals {
+		held := aggHeld(aggs[i])
+		mergePartial(aggs[i], v)
+		m.size += aggHeld(aggs[i]) - held
+	}
+	return m.checkBudget()
+}
+
+func (m *hashAgg) checkBudget() error {
+	if m.budget <= 0 || m.size <= m.budget {
+		return nil
+	}
+	return m.spill()
+}
+
+// spill the groups held in memory to a run, sorted by key
+func (m *hashAgg) spill() error {
+	u.Debugf("group by exceeded memory budget %d, spilling %d groups to disk", m.budget, len(m.groups))
+	run, err := newSpillFile(m.dir, "qlbridge-groupby-")
+	if err != nil {
+		return err
+	}
+	m.runs = append(m.runs, run)
+	keys := make([]string, 0, len(m.groups))
+	for key := range m.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		aggs := m.groups[key]
+		row := make([]driver.Value, len(aggs))
+		for i, agg := range aggs {
+			row[i] = agg.Result()
+		}
+		if err := run.Write(&spillRow{Key: key, Vals: row}); err != nil {
+			return err
+		}
+	}
+	m.groups = make(map[string][]Aggregator)
+	m.size = 0
+	if len(m.runs) >= groupByMaxRuns {
+		return m.compact()
+	}
+	return nil
+}
+
+// emit the result row of each group, stopping if @out returns false
+func (m *hashAgg) emit(partial bool, out func(key string, row []driver.Value) bool) error {
+
+	if len(m.runs) == 0 {
+		final, err := buildAggs(m.p, partial)
+		if err != nil {
+			return err
+		}
+		for key, aggs := range m.groups {
+			row := make([]driver.Value, len(final))
+			for i, agg := range aggs {
+				mergePartial(final[i], agg.Result())
+				row[i] = final[i].Result()
+				final[i].Reset()
+			}
+			if !out(key, row) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	if len(m.groups) > 0 {
+		if err := m.spill(); err != nil {
+			return err
+		}
+	}
+	return m.mergeRuns(partial, out)
+}
+
+// mergeRuns merge the runs by key, combining the partials of each group
+func (m *hashAgg) mergeRuns(partial bool, out func(key string, row []driver.Value) bool) error {
+
+	final, err := buildAggs(m.p, partial)
+	if err != nil {
+		return err
+	}
+	result := func(key string) bool {
+		row := make([]driver.Value, len(final))
+		for i, agg := range final {
+			row[i] = agg.Result()
+			agg.Reset()
+		}
+		return out(key, row)
+	}
+
+	merger, err := newSpillMerger(m.runs, func(a, b *spillRow) bool { return a.Key < b.Key })
+	if err != nil {
+		return err
+	}
+	key, found := "", false
+	for {
+		row, err := merger.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if found && row.Key != key && !result(key) {
+			return nil
+		}
+		key, found = row.Key, true
+		for i, v := range row.Vals {
+			mergePartial(final[i], v)
+		}
+	}
+	if found {
+		result(key)
+	}
+	return nil
+}
+
+// compact merge the runs into one, bounding the number of open files
+func (m *hashAgg) compact() error {
+	run, err := newSpillFile(m.dir, "qlbridge-groupby-")
+	if err != nil {
+		return err
+	}
+	var werr error
+	err = m.mergeRuns(true, func(key string, row []driver.Value) bool {
+		werr = run.Write(&spillRow{Key: key, Vals: row})
+		return werr == nil
+	})
+	if err == nil {
+		err = werr
+	}
+	if cerr := m.Close(); err == nil {
+		err = cerr
+	}
+	m.runs = []*spillFile{run}
+	return err
+}
+
+// Close removes any runs
+func (m *hashAgg) Close() error {
+	var err error
+	for _, run := range m.runs {
+		if cerr := run.Close(); err == nil {
+			err = cerr
+		}
+	}
+	m.runs = nil
+	return err
+}
@@ -3,15 +3,20 @@ package exec
 import (
 	"database/sql/driver"
 	"fmt"
+	"io"
+	"math"
 	"strings"
 	"sync"
+	"time"
 
 	u "github.com/araddon/gou"
 
 	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/expr"
 	"github.com/lytics/qlbridge/plan"
 	"github.com/lytics/qlbridge/rel"
 	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
 	"github.com/lytics/qlbridge/vm"
 )
 
@@ -20,91 +25,58 @@ var (
 
 	// Ensure that we implement the Task Runner interface
 	_ TaskRunner = (*JoinMerge)(nil)
+	_ TaskRunner = (*JoinSeek)(nil)
 )
 
 type KeyEvaluator func(msg schema.Message) driver.Value
 
-// Evaluate messages to create JoinKey based message, where the
-//
-//	Join Key (composite of each value in join expr) hashes consistently
-type JoinKey struct {
-	*TaskBase
-	p        *plan.JoinKey
-	colIndex map[string]int
-}
-
-// A JoinKey task that evaluates the compound JoinKey to allow
-//
-//	for parallelized join's
-//
-//	 source1   ->  JoinKey  ->  hash-route
-//	                                       \
-//	                                        --  join  -->
-//	                                       /
-//	 source2   ->  JoinKey  ->  hash-route
-func NewJoinKey(ctx *plan.Context, p *plan.JoinKey) *JoinKey {
-	m := &JoinKey{
-		TaskBase: NewTaskBase(ctx),
-		colIndex: make(map[string]int),
-		p:        p,
-	}
-	return m
-}
-
-func (m *JoinKey) Run() error {
-	defer m.Ctx.Recover()
-	defer close(m.msgOutCh)
-
-	outCh := m.MessageOut()
-	inCh := m.MessageIn()
-	joinNodes := m.p.Source.Stmt.JoinNodes()
-
-	for {
-
-		select {
-		case <-m.SigChan():
-			//u.Debugf("got signal quit")
-			return nil
-		case msg, ok := <-inCh:
-			if !ok {
-				//u.Debugf("NICE, got msg shutdown")
-				return nil
-			}
-
-			//u.Infof("In joinkey msg %#v", msg)
-		msgTypeSwitch:
-			switch mt := msg.(type) {
-			case *datasource.SqlDriverMessageMap:
-				vals := make([]string, len(joinNodes))
-				for i, node := range joinNodes {
-					joinVal, ok := vm.Eval(mt, node)
-					//u.Debugf("evaluating: ok?%v T:%T result=%v node '%v'", ok, joinVal, joinVal.ToString(), node.String())
-					if !ok {
-						u.Errorf("could not evaluate: %T %#v   %v", joinVal, joinVal, msg)
-						break msgTypeSwitch
-					}
-					vals[i] = joinVal.ToString()
-				}
-				//u.Infof("joinkey: %v row:%v", vals, mt)
-				key := strings.Join(vals, string(byte(0)))
-				mt.SetKeyHashed(key)
-				outCh <- mt
-			default:
-				return fmt.Errorf("To use JoinKey must use SqlDriverMessageMap but got %T", msg)
-			}
-
+// joinKey evaluates the composite join key of a message, false if any
+// part of the key is NULL or could not be evaluated.
+func joinKey(mt *datasource.SqlDriverMessageMap, nodes []expr.Node) (string, bool) {
+	vals := make([]string, len(nodes))
+	for i, node := range nodes {
+		joinVal, ok := vm.Eval(mt, node)
+		//u.Debugf("evaluating: ok?%v T:%T result=%v node '%v'", ok, joinVal, joinVal.ToString(), node.String())
+		if !ok || joinVal == nil || joinVal.Nil() {
+			return "", false
 		}
+		vals[i] = joinVal.ToString()
 	}
+	return strings.Join(vals, string(byte(0))), true
 }
 
+// joinPartitions is the number of hash partitions each side of a join
+// is split into once it spills to disk.
+const joinPartitions = 16
+
 // Scans 2 source tasks for rows, evaluate keys, use for join
 type JoinMerge struct {
 	*TaskBase
-	leftStmt  *rel.SqlSource
-	rightStmt *rel.SqlSource
-	ltask     TaskRunner
-	rtask     TaskRunner
-	colIndex  map[string]int
+	joinRows
+	ltask      TaskRunner
+	rtask      TaskRunner
+	leftOuter  bool
+	rightOuter bool
+
+	// memory budget, once both sides together exceed it all rows are
+	// written to hash partitioned temp files (grace hash join)
+	mu      sync.Mutex
+	budget  int64
+	size    int64
+	spilled bool
+	left    *joinSide
+	right   *joinSide
+}
+
+// joinSide is one input of the join, rows held in memory by join key until
+// the memory budget is exceeded at which point they are spilled to
+// partition files by the join key hash.
+type joinSide struct {
+	name  string
+	key   []expr.Node
+	h     map[string][]*datasource.SqlDriverMessageMap
+	null  []*datasource.SqlDriverMessageMap // NULL join keys, only used by outer joins
+	parts []*spillFile
 }
 
 // A very stupid naive parallel join merge, uses Key() as value to merge
@@ -126,17 +98,26 @@ type JoinMerge struct {
 //	source2a  ->                |-> --  join  -->
 //	source2b  -> key-hash-route |-> --  join  -->
 //	source2n  ->                |-> --  join  -->
+//
+// If the plan.Context has a MemoryBudget, once the buffered rows of both
+// sides exceed it, both sides are partitioned by the join key hash into
+// temp files and then joined one partition at a time.
 func NewJoinNaiveMerge(ctx *plan.Context, l, r TaskRunner, p *plan.JoinMerge) *JoinMerge {
 
 	m := &JoinMerge{
-		TaskBase: NewTaskBase(ctx),
-		colIndex: p.ColIndex,
+		TaskBase:   NewTaskBase(ctx),
+		joinRows:   newJoinRows(p),
+		leftOuter:  p.LeftOuter,
+		rightOuter: p.RightOuter,
+		left:       newJoinSide("left", p.LeftKey),
+		right:      newJoinSide("right", p.RightKey),
+	}
+	if ctx != nil {
+		m.budget = ctx.MemoryBudget
 	}
 
 	m.ltask = l
 	m.rtask = r
-	m.leftStmt = p.LeftFrom
-	m.rightStmt = p.RightFrom
 
 	return m
 }
@@ -144,124 +125,456 @@ func NewJoinNaiveMerge(ctx *plan.Context, l, r TaskRunner, p *plan.JoinMerge) *J
 func (m *JoinMerge) Run() error {
 	defer m.Ctx.Recover()
 	defer close(m.msgOutCh)
-
-	outCh := m.MessageOut()
-
-	leftIn := m.ltask.MessageOut()
-	rightIn := m.rtask.MessageOut()
-
-	lh := make(map[driver.Value][]*datasource.SqlDriverMessageMap)
-	rh := make(map[driver.Value][]*datasource.SqlDriverMessageMap)
+	defer m.left.Close()
+	defer m.right.Close()
 
 	wg := new(sync.WaitGroup)
-	wg.Add(1)
-	var fatalErr error
+	errs := make([]error, 2)
+	wg.Add(2)
 	go func() {
-		for {
-			//u.Infof("In source Scanner msg %#v", msg)
-			select {
-			case <-m.SigChan():
-				u.Debugf("got signal quit")
-				wg.Done()
-				wg.Done()
-				return
-			case msg, ok := <-leftIn:
-				if !ok {
-					//u.Debugf("NICE, got left shutdown")
-					wg.Done()
-					return
-				} else {
-					switch mt := msg.(type) {
-					case *datasource.SqlDriverMessageMap:
-						key := mt.Key()
-						if key == "" {
-							fatalErr = fmt.Errorf(`To use Join msgs must have keys but got "" for %+v`, mt)
-							u.Errorf("no key? %#v  %v", mt, fatalErr)
-							close(m.TaskBase.sigCh)
-							return
-						}
-						lh[key] = append(lh[key], mt)
-					default:
-						fatalErr = fmt.Errorf("To use Join must use SqlDriverMessageMap but got %T", msg)
-						u.Errorf("unrecognized msg %T", msg)
-						close(m.TaskBase.sigCh)
-						return
-					}
-				}
-			}
-
-		}
+		defer wg.Done()
+		errs[0] = m.scan(m.ltask.MessageOut(), m.left)
 	}()
-	wg.Add(1)
 	go func() {
-		for {
-
-			//u.Infof("In source Scanner iter %#v", item)
-			select {
-			case <-m.SigChan():
-				u.Debugf("got quit signal join source 1")
-				wg.Done()
-				wg.Done()
-				return
-			case msg, ok := <-rightIn:
-				if !ok {
-					//u.Debugf("NICE, got right shutdown")
-					wg.Done()
-					return
-				} else {
-					switch mt := msg.(type) {
-					case *datasource.SqlDriverMessageMap:
-						key := mt.Key()
-						if key == "" {
-							fatalErr = fmt.Errorf(`To use Join msgs must have keys but got "" for %+v`, mt)
-							u.Errorf("no key? %#v  %v", mt, fatalErr)
-							close(m.TaskBase.sigCh)
-							return
-						}
-						rh[key] = append(rh[key], mt)
-					default:
-						fatalErr = fmt.Errorf("To use Join must use SqlDriverMessageMap but got %T", msg)
-						u.Errorf("unrecognized msg %T", msg)
-						close(m.TaskBase.sigCh)
-						return
-					}
-				}
-			}
-
-		}
+		defer wg.Done()
+		errs[1] = m.scan(m.rtask.MessageOut(), m.right)
 	}()
 	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
 	//u.Info("leaving source scanner")
 	i := uint64(0)
+	emit := func(msgs []*datasource.SqlDriverMessageMap) {
+		for _, msg := range msgs {
+			//u.Debugf("i:%d   msg:%#v", i, msg)
+			msg.IdVal = i
+			i++
+			m.send(msg)
+		}
+	}
+	if !m.spilled {
+		m.join(m.left, m.right, emit)
+		return nil
+	}
+	for p := 0; p < joinPartitions; p++ {
+		left, err := m.left.load(p)
+		if err != nil {
+			return err
+		}
+		right, err := m.right.load(p)
+		if err != nil {
+			return err
+		}
+		m.join(left, right, emit)
+	}
+	return nil
+}
+
+// scan reads all messages from one side of the join until closed
+func (m *JoinMerge) scan(in MessageChan, side *joinSide) error {
+	for {
+		//u.Infof("In source Scanner msg %#v", msg)
+		start := time.Now()
+		select {
+		case <-m.SigChan():
+			u.Debugf("got signal quit join %s", side.name)
+			return nil
+		case msg, ok := <-in:
+			m.counters.received(msg, start)
+			if !ok {
+				//u.Debugf("NICE, got %s shutdown", side.name)
+				return nil
+			}
+			mt, isMap := msg.(*datasource.SqlDriverMessageMap)
+			if !isMap {
+				u.Errorf("unrecognized msg %T", msg)
+				m.Quit()
+				return fmt.Errorf("To use Join must use SqlDriverMessageMap but got %T", msg)
+			}
+			if err := m.add(side, mt); err != nil {
+				u.Errorf("could not spill join %v", err)
+				m.Quit()
+				return err
+			}
+		}
+	}
+}
+
+// add a message to a side of the join, checking the memory budget
+func (m *JoinMerge) add(side *joinSide, mt *datasource.SqlDriverMessageMap) error {
+	if key, ok := joinKey(mt, side.key); ok {
+		mt.SetKeyHashed(key)
+	} else {
+		mt.SetKey("")
+	}
+	if m.budget <= 0 {
+		// no budget, sides don't share any state
+		side.put(mt)
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.spilled {
+		return side.spill(m.Ctx.TempDir, mt)
+	}
+	side.put(mt)
+	m.size += rowSize(mt.Vals)
+	if m.size <= m.budget {
+		return nil
+	}
+	u.Debugf("join exceeded memory budget %d, spilling to disk", m.budget)
+	m.spilled = true
+	if err := m.left.spillAll(m.Ctx.TempDir); err != nil {
+		return err
+	}
+	return m.right.spillAll(m.Ctx.TempDir)
+}
+
+// join the rows of the two sides, emitting matches and outer rows
+func (m *JoinMerge) join(left, right *joinSide, emit func([]*datasource.SqlDriverMessageMap)) {
+	lh, rh := left.h, right.h
 	for keyLeft, valLeft := range lh {
 		//u.Debugf("compare:  key:%v  left:%#v  right:%#v  rh: %#v", keyLeft, valLeft, rh[keyLeft], rh)
-		if valRight, ok := rh[keyLeft]; ok {
-			//u.Debugf("found match?\n\t%d left=%#v\n\t%d right=%#v", len(valLeft), valLeft, len(valRight), valRight)
-			msgs := m.mergeValueMessages(valLeft, valRight)
-			//u.Debugf("msgsct: %v   msgs:%#v", len(msgs), msgs)
-			for _, msg := range msgs {
-				//outCh <- datasource.NewUrlValuesMsg(i, msg)
-				//u.Debugf("i:%d   msg:%#v", i, msg)
-				msg.IdVal = i
-				i++
-				outCh <- msg
+		emit(m.matchValueMessages(valLeft, rh[keyLeft], m.leftOuter, m.rightOuter))
+	}
+	if m.leftOuter {
+		emit(m.mergeValueMessages(left.null, nil))
+	}
+	if m.rightOuter {
+		for keyRight, valRight := range rh {
+			if _, ok := lh[keyRight]; !ok {
+				emit(m.mergeValueMessages(nil, valRight))
+			}
+		}
+		emit(m.mergeValueMessages(nil, right.null))
+	}
+}
+
+func newJoinSide(name string, key []expr.Node) *joinSide {
+	return &joinSide{name: name, key: key, h: make(map[string][]*datasource.SqlDriverMessageMap)}
+}
+
+func (m *joinSide) put(mt *datasource.SqlDriverMessageMap) {
+	key, ok := mt.Key().(string)
+	if !ok || key == "" {
+		// NULL join key, can only be emitted by outer join
+		m.null = append(m.null, mt)
+		return
+	}
+	m.h[key] = append(m.h[key], mt)
+}
+
+// spill a single message to its partition file, NULL keys go to partition 0
+func (m *joinSide) spill(dir string, mt *datasource.SqlDriverMessageMap) error {
+	key, _ := mt.Key().(string)
+	p := 0
+	if key != "" {
+		// Id is the hash of the join key
+		p = int(mt.Id() % joinPartitions)
+	}
+	if m.parts == nil {
+		m.parts = make([]*spillFile, joinPartitions)
+	}
+	if m.parts[p] == nil {
+		sf, err := newSpillFile(dir, "qlbridge-join-"+m.name+"-")
+		if err != nil {
+			return err
+		}
+		m.parts[p] = sf
+	}
+	return m.parts[p].Write(&spillRow{Key: key, Id: mt.Id(), Vals: mt.Vals})
+}
+
+// spillAll moves all in-memory messages to partition files
+func (m *joinSide) spillAll(dir string) error {
+	for _, msgs := range m.h {
+		for _, mt := range msgs {
+			if err := m.spill(dir, mt); err != nil {
+				return err
 			}
 		}
 	}
+	for _, mt := range m.null {
+		if err := m.spill(dir, mt); err != nil {
+			return err
+		}
+	}
+	m.h = make(map[string][]*datasource.SqlDriverMessageMap)
+	m.null = nil
+	return nil
+}
+
+// load a single partition back into memory
+func (m *joinSide) load(p int) (*joinSide, error) {
+	side := newJoinSide(m.name, m.key)
+	if m.parts == nil || m.parts[p] == nil {
+		return side, nil
+	}
+	rdr, err := m.parts[p].Reader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		row, err := rdr.Next()
+		if err == io.EOF {
+			return side, nil
+		} else if err != nil {
+			return nil, err
+		}
+		mt := datasource.NewSqlDriverMessageMap(row.Id, row.Vals, nil)
+		mt.SetKey(row.Key)
+		side.put(mt)
+	}
+}
+
+// Close removes any spill files
+func (m *joinSide) Close() error {
+	for _, sf := range m.parts {
+		if sf != nil {
+			sf.Close()
+		}
+	}
+	m.parts = nil
 	return nil
 }
 
-func (m *JoinMerge) mergeValueMessages(lmsgs, rmsgs []*datasource.SqlDriverMessageMap) []*datasource.SqlDriverMessageMap {
-	// m.leftStmt.Columns, m.rightStmt.Columns, nil
-	//func mergeValuesMsgs(lmsgs, rmsgs []datasource.Message, lcols, rcols []*rel.Column, cols map[string]*rel.Column) []*datasource.SqlDriverMessageMap {
+// JoinSeek is an index nested-loop join.  Instead of scanning the right
+// side, the join key of each left row is looked up on the right source by
+// its primary key using schema.ConnSeeker.
+//
+//	source1   ->  JoinSeek  -->
+//	                  |
+//	          source2.Get(key)
+type JoinSeek struct {
+	*TaskBase
+	joinRows
+	ltask     TaskRunner
+	seeker    schema.ConnSeeker
+	leftKey   []expr.Node
+	keyType   value.ValueType
+	leftOuter bool
+}
+
+// NewJoinSeek create an index nested-loop join task for a plan whose right
+// side is Seekable.
+func NewJoinSeek(ctx *plan.Context, l TaskRunner, seeker schema.ConnSeeker, p *plan.JoinMerge) *JoinSeek {
+	m := &JoinSeek{
+		TaskBase:  NewTaskBase(ctx),
+		joinRows:  newJoinRows(p),
+		ltask:     l,
+		seeker:    seeker,
+		leftKey:   p.LeftKey,
+		leftOuter: p.LeftOuter,
+	}
+	// the type of the primary key, sources such as membtree hash an int
+	// and its string form to different ids so keys are coerced to it.
+	if src, ok := p.Right.(*plan.Source); ok && src.Tbl != nil {
+		if pk := src.Tbl.PrimaryKey(); len(pk) == 1 {
+			if f, ok := src.Tbl.FieldMap[pk[0]]; ok {
+				m.keyType = f.ValueType()
+			}
+		}
+	}
+	return m
+}
+
+func (m *JoinSeek) Run() error {
+	defer m.Ctx.Recover()
+	defer close(m.msgOutCh)
+
+	leftIn := m.ltask.MessageOut()
+	leftNodes := m.leftKey
+	if len(leftNodes) != 1 {
+		return fmt.Errorf("JoinSeek requires a single join key but got %d", len(leftNodes))
+	}
+
+	i := uint64(0)
+	for {
+		select {
+		case <-m.SigChan():
+			return nil
+		case msg, ok := <-leftIn:
+			if !ok {
+				return nil
+			}
+			mt, isMap := msg.(*datasource.SqlDriverMessageMap)
+			if !isMap {
+				u.Errorf("unrecognized msg %T", msg)
+				return fmt.Errorf("To use Join must use SqlDriverMessageMap but got %T", msg)
+			}
+			var right []*datasource.SqlDriverMessageMap
+			if key, ok := vm.Eval(mt, leftNodes[0]); ok && key != nil && !key.Nil() {
+				if key, ok := m.seekKey(key); ok {
+					rmsg, err := m.seeker.Get(key)
+					if err != nil && err != schema.ErrNotFound {
+						u.Errorf("could not seek %v err=%v", key, err)
+						return err
+					}
+					if rmsg != nil {
+						right = append(right, m.project(rmsg))
+					}
+				}
+			}
+			lmsgs := []*datasource.SqlDriverMessageMap{mt}
+			for _, out := range m.matchValueMessages(lmsgs, right, m.leftOuter, false) {
+				out.IdVal = i
+				i++
+				if !m.send(out) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// seekKey the join key coerced to the type of the primary key, false if
+// it can't be, in which case no right row can match.
+func (m *JoinSeek) seekKey(key value.Value) (driver.Value, bool) {
+	switch m.keyType {
+	case value.UnknownType, value.NilType, key.Type():
+		return key.Value(), true
+	case value.StringType:
+		return key.ToString(), true
+	case value.IntType:
+		// 1.5 is not the key 1
+		if f, ok := key.(value.NumberValue); ok && f.Val() != math.Trunc(f.Val()) {
+			return nil, false
+		}
+		return value.ValueToInt64(key)
+	case value.NumberType:
+		return value.ValueToFloat64(key)
+	}
+	kv, err := value.Cast(m.keyType, key)
+	if err != nil {
+		return nil, false
+	}
+	return kv.Value(), true
+}
+
+// project a raw row from the right source into the columns of the right
+// hand sub-select, the same shape a scanned right side would have.
+func (m *JoinSeek) project(msg schema.Message) *datasource.SqlDriverMessageMap {
+	cols := m.rightStmt.Source.Columns
+	vals := make([]driver.Value, len(cols))
+	reader, ok := msg.Body().(expr.ContextReader)
+	if !ok {
+		u.Warnf("could not read seek msg %T", msg.Body())
+		return datasource.NewSqlDriverMessageMap(msg.Id(), vals, nil)
+	}
+	for _, col := range cols {
+		if col.Expr == nil || col.Index < 0 || col.Index >= len(vals) {
+			continue
+		}
+		if v, ok := vm.Eval(reader, col.Expr); ok && v != nil && !v.Nil() {
+			vals[col.Index] = v.Value()
+		}
+	}
+	return datasource.NewSqlDriverMessageMap(msg.Id(), vals, nil)
+}
+
+// joinRows builds the output rows of a join from the left and right
+// source rows, using the plan's ColIndex.  All joins of a statement share
+// the same row layout, so if the left side is itself a join its rows are
+// copied as is.
+type joinRows struct {
+	leftStmt   *rel.SqlSource
+	rightStmt  *rel.SqlSource
+	leftIsJoin bool
+	colIndex   map[string]int
+	rowWidth   int
+	filter     expr.Node
+}
+
+func newJoinRows(p *plan.JoinMerge) joinRows {
+	_, leftIsJoin := p.Left.(*plan.JoinMerge)
+	return joinRows{
+		leftStmt:   p.LeftFrom,
+		rightStmt:  p.RightFrom,
+		leftIsJoin: leftIsJoin,
+		colIndex:   p.ColIndex,
+		rowWidth:   p.RowWidth(),
+		filter:     p.Filter,
+	}
+}
+
+// matchValueMessages joins the left and right messages sharing a key,
+// keeping the pairs the ON conditions other than the key accept.  Messages
+// without a match are merged with NULL values for the other side if that
+// side is outer joined.
+func (m *joinRows) matchValueMessages(lmsgs, rmsgs []*datasource.SqlDriverMessageMap, leftOuter, rightOuter bool) []*datasource.SqlDriverMessageMap {
+	if m.filter == nil && len(lmsgs) > 0 && len(rmsgs) > 0 {
+		return m.mergeValueMessages(lmsgs, rmsgs)
+	}
 	out := make([]*datasource.SqlDriverMessageMap, 0)
-	//u.Infof("merge values: %v:%v", len(lcols), len(rcols))
+	rightMatched := make([]bool, len(rmsgs))
+	for _, lm := range lmsgs {
+		matched := false
+		for i, rm := range rmsgs {
+			vals := m.leftValues(lm)
+			vals = m.valIndexing(vals, rm.Values(), m.rightStmt)
+			newMsg := datasource.NewSqlDriverMessageMap(0, vals, m.colIndex)
+			if !m.matches(newMsg) {
+				continue
+			}
+			matched, rightMatched[i] = true, true
+			out = append(out, newMsg)
+		}
+		if !matched && leftOuter {
+			out = append(out, m.mergeValueMessages([]*datasource.SqlDriverMessageMap{lm}, nil)...)
+		}
+	}
+	if rightOuter {
+		for i, rm := range rmsgs {
+			if !rightMatched[i] {
+				out = append(out, m.mergeValueMessages(nil, []*datasource.SqlDriverMessageMap{rm})...)
+			}
+		}
+	}
+	return out
+}
+
+// matches does the joined row pass the filter, a NULL result does not
+func (m *joinRows) matches(msg *datasource.SqlDriverMessageMap) bool {
+	if m.filter == nil {
+		return true
+	}
+	v, ok := vm.Eval(msg, m.filter)
+	if !ok {
+		return false
+	}
+	bv, isBool := v.(value.BoolValue)
+	return isBool && bv.Val()
+}
+
+// mergeValueMessages creates the cross product of left and right messages
+// sharing a key.  If either side is empty, the other side's messages are
+// merged with NULL values for the missing side (outer join).
+func (m *joinRows) mergeValueMessages(lmsgs, rmsgs []*datasource.SqlDriverMessageMap) []*datasource.SqlDriverMessageMap {
+	out := make([]*datasource.SqlDriverMessageMap, 0)
+	//u.Infof("merge values: %v:%v", len(lmsgs), len(rmsgs))
+	switch {
+	case len(rmsgs) == 0:
+		for _, lm := range lmsgs {
+			vals := m.leftValues(lm)
+			out = append(out, datasource.NewSqlDriverMessageMap(0, vals, m.colIndex))
+		}
+		return out
+	case len(lmsgs) == 0:
+		for _, rm := range rmsgs {
+			vals := make([]driver.Value, m.rowWidth)
+			vals = m.valIndexing(vals, rm.Values(), m.rightStmt)
+			out = append(out, datasource.NewSqlDriverMessageMap(0, vals, m.colIndex))
+		}
+		return out
+	}
 	for _, lm := range lmsgs {
 		//u.Warnf("nice SqlDriverMessageMap: %#v", lmt)
 		for _, rm := range rmsgs {
-			vals := make([]driver.Value, len(m.colIndex))
-			vals = m.valIndexing(vals, lm.Values(), m.leftStmt.Source.Columns)
-			vals = m.valIndexing(vals, rm.Values(), m.rightStmt.Source.Columns)
+			vals := m.leftValues(lm)
+			vals = m.valIndexing(vals, rm.Values(), m.rightStmt)
 			newMsg := datasource.NewSqlDriverMessageMap(0, vals, m.colIndex)
 			//u.Infof("out: %+v", newMsg)
 			out = append(out, newMsg)
@@ -270,26 +583,33 @@ func (m *JoinMerge) mergeValueMessages(lmsgs, rmsgs []*datasource.SqlDriverMessa
 	return out
 }
 
-func (m *JoinMerge) valIndexing(valOut, valSource []driver.Value, cols []*rel.Column) []driver.Value {
-	for _, col := range cols {
-		if col.ParentIndex < 0 {
-			continue
-		}
-		if col.ParentIndex >= len(valOut) {
-			u.Warnf("not enough values to read col? i=%v len(vals)=%v  %#v", col.ParentIndex, len(valOut), valOut)
+// leftValues a new output row holding the left message's values
+func (m *joinRows) leftValues(lm *datasource.SqlDriverMessageMap) []driver.Value {
+	vals := make([]driver.Value, m.rowWidth)
+	if m.leftIsJoin {
+		copy(vals, lm.Values())
+		return vals
+	}
+	return m.valIndexing(vals, lm.Values(), m.leftStmt)
+}
+
+// valIndexing copy the values of a source row into the output row positions
+func (m *joinRows) valIndexing(valOut, valSource []driver.Value, from *rel.SqlSource) []driver.Value {
+	for _, col := range from.Source.Columns {
+		idx, ok := m.colIndex[from.Alias+"."+col.Key()]
+		if !ok {
 			continue
 		}
-		if col.ParentIndex < 0 {
-			// Negative parent index means the parent query doesn't use this field, ie used
-			// as where, or join key, but not projected
-			u.Errorf("negative parentindex? %s", col)
+		if idx >= len(valOut) {
+			u.Warnf("not enough values to read col? i=%v len(vals)=%v  %#v", idx, len(valOut), valOut)
 			continue
 		}
 		if col.Index < 0 || col.Index >= len(valSource) {
 			u.Errorf("source index out of range? idx:%v of %d  source: %#v  \n\tcol=%#v", col.Index, len(valSource), valSource, col)
+			continue
 		}
 		//u.Infof("found: si=%v pi:%v idx:%d as=%v vals:%v len(out):%v", col.SourceIndex, col.ParentIndex, col.Index, col.As, valSource, len(valOut))
-		valOut[col.ParentIndex] = valSource[col.Index]
+		valOut[idx] = valSource[col.Index]
 	}
 	return valOut
 }
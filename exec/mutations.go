@@ -85,11 +85,16 @@ func NewDelete(ctx *plan.Context, p *plan.Delete) *DeletionTask {
 }
 
 func (m *Upsert) Close() error {
+	m.Lock()
 	if m.closed {
+		m.Unlock()
 		return nil
 	}
 	m.closed = true
-	if closer, ok := m.db.(schema.Source); ok {
+	m.Unlock()
+	// the conn was opened for this statement, sources such as sqlite
+	// hold a lock until it is closed
+	if closer, ok := m.db.(schema.Conn); ok {
 		if err := closer.Close(); err != nil {
 			return err
 		}
@@ -118,7 +123,7 @@ func (m *Upsert) Run() error {
 	if err != nil {
 		u.Warnf("errored, should not complete %v", err)
 		vals[0] = err.Error()
-		vals[1] = -1
+		vals[1] = int64(-1)
 		m.msgOutCh <- &datasource.SqlDriverMessage{Vals: vals, IdVal: 1}
 		return err
 	}
@@ -221,7 +226,9 @@ func (m *DeletionTask) Close() error {
 	}
 	m.closed = true
 	m.Unlock()
-	if closer, ok := m.db.(schema.Source); ok {
+	// the conn was opened for this statement, sources such as sqlite
+	// hold a lock until it is closed
+	if closer, ok := m.db.(schema.Conn); ok {
 		if err := closer.Close(); err != nil {
 			return err
 		}
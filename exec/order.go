@@ -1,7 +1,10 @@
 package exec
 
 import (
+	"container/heap"
+	"database/sql/driver"
 	"fmt"
+	"io"
 	"sort"
 	"time"
 
@@ -10,28 +13,37 @@ import (
 	"github.com/lytics/qlbridge/datasource"
 	"github.com/lytics/qlbridge/expr"
 	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/rel"
+	"github.com/lytics/qlbridge/value"
 	"github.com/lytics/qlbridge/vm"
 )
 
-// Order
+// Order a Sql Order By task, sorts all rows by the typed values of the
+// ORDER BY expressions (numbers numerically, times chronologically) with
+// NULLS FIRST/LAST.
+//
+// Rows are buffered in memory.  If the plan.Context has a MemoryBudget,
+// once the buffered rows exceed it they are sorted and written to disk as
+// a run, at the end the runs are k-way merged.
+//
+// If the plan is a Top-N (ORDER BY ... LIMIT) only the leading N rows are
+// kept in a bounded heap, so memory is constant regardless of input size.
 type Order struct {
 	*TaskBase
-	p          *plan.Order
-	complete   chan bool
-	closed     bool
-	isComplete bool
+	p      *plan.Order
+	closed bool
 }
 
-// NewORder create new order by exec task
+// NewOrder create new order by exec task
 func NewOrder(ctx *plan.Context, p *plan.Order) *Order {
 	o := &Order{
 		TaskBase: NewTaskBase(ctx),
 		p:        p,
-		complete: make(chan bool),
 	}
 	return o
 }
 
+// Close the task, channels, cleanup.
 func (m *Order) Close() error {
 	m.Lock()
 	if m.closed {
@@ -40,19 +52,6 @@ func (m *Order) Close() error {
 	}
 	m.closed = true
 	m.Unlock()
-
-	// what should this be?
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	//u.Infof("%p group by final Close() waiting for complete", m)
-	select {
-	case <-ticker.C:
-		u.Warnf("order by timeout???? ")
-	case <-m.complete:
-		//u.Warnf("%p got groupbyfinal complete", m)
-	}
-
 	return m.TaskBase.Close()
 }
 
@@ -60,26 +59,29 @@ func (m *Order) Run() error {
 	defer m.Ctx.Recover()
 	defer close(m.msgOutCh)
 
-	outCh := m.MessageOut()
 	inCh := m.MessageIn()
 
 	colIndex := m.p.Stmt.ColIndexes()
-	orderCt := len(m.p.Stmt.OrderBy)
 
-	// are are going to hold entire row in memory while we are calculating
-	//  so obviously not scalable.
-	sl := NewOrderMessages(m.p)
+	var sorter rowSorter
+	if m.p.Limit > 0 {
+		sorter = newTopN(m.p.Stmt.OrderBy, m.p.Limit)
+	} else {
+		sorter = newExternalSort(m.Ctx, m.p.Stmt.OrderBy)
+	}
+	defer sorter.Close()
 
 msgReadLoop:
 	for {
 
+		start := time.Now()
 		select {
 		case <-m.SigChan():
 			u.Warnf("got signal quit")
 			return nil
 		case msg, ok := <-inCh:
+			m.counters.received(msg, start)
 			if !ok {
-				//u.Debugf("NICE, got closed channel shutdown")
 				break msgReadLoop
 			} else {
 				var sdm *datasource.SqlDriverMessageMap
@@ -91,7 +93,7 @@ msgReadLoop:
 
 					msgReader, isContextReader := msg.(expr.ContextReader)
 					if !isContextReader {
-						err := fmt.Errorf("To use Join must use SqlDriverMessageMap but got %T", msg)
+						err := fmt.Errorf("To use Order must use SqlDriverMessageMap but got %T", msg)
 						u.Errorf("unrecognized msg %T", msg)
 						close(m.TaskBase.sigCh)
 						return err
@@ -100,84 +102,263 @@ msgReadLoop:
 					sdm = datasource.NewSqlDriverMessageMapCtx(msg.Id(), msgReader, colIndex)
 				}
 
-				// We are going to use VM Engine to create a value for each statement in group by
-				//  then join each value together to create a unique key.
-				keys := make([]string, orderCt)
+				// We are going to use VM Engine to create a value for each
+				// expression in order by, a row without a value sorts as NULL.
+				keys := make([]value.Value, len(m.p.Stmt.OrderBy))
 				for i, col := range m.p.Stmt.OrderBy {
 					if col.Expr != nil {
 						if key, ok := vm.Eval(sdm, col.Expr); ok {
-							//u.Debugf("msgtype:%T  key:%q for-expr:%s", sdm, key, col.Expr)
-							keys[i] = key.ToString()
-						} else {
-							// Is this an error?
-							//u.Warnf("no key?  %s for %+v", col.Expr, sdm)
+							keys[i] = key
 						}
-					} else {
-						//u.Warnf("no col.expr? %#v", col)
 					}
 				}
-
-				//u.Infof("found key:%s for %+v", key, sdm)
-				sl.l = append(sl.l, &msgkey{keys, sdm})
+				if m.p.Cursor != nil && compareOrderKeys(m.p.Stmt.OrderBy, keys, m.p.Cursor) <= 0 {
+					// keyset pagination, rows up to the cursor were on earlier pages
+					continue
+				}
+				if err := sorter.add(keys, sdm); err != nil {
+					u.Errorf("could not spill order by %v", err)
+					return err
+				}
 			}
 		}
 	}
 
-	sort.Sort(sl)
+	return sorter.emit(func(msg *datasource.SqlDriverMessageMap) bool {
+		return m.send(msg)
+	})
+}
+
+// orderRow a buffered row and the values of its order by expressions
+type orderRow struct {
+	seq  uint64
+	keys []value.Value
+	msg  *datasource.SqlDriverMessageMap
+}
+
+// rowSorter collects rows with the values of their order by expressions
+// then emits them in order.
+type rowSorter interface {
+	add(keys []value.Value, msg *datasource.SqlDriverMessageMap) error
+	// emit rows in order, stops early if out returns false.
+	emit(out func(msg *datasource.SqlDriverMessageMap) bool) error
+	Close() error
+}
+
+// topN keeps the first n rows in order using a heap with the last of
+// them on top, a row that sorts before the top replaces it.  Rows with
+// equal keys keep their arrival order.
+type topN struct {
+	orderBy rel.Columns
+	n       int
+	seq     uint64
+	rows    []*orderRow
+}
+
+func newTopN(orderBy rel.Columns, n int) *topN {
+	return &topN{orderBy: orderBy, n: n, rows: make([]*orderRow, 0, n)}
+}
 
-	for _, m := range sl.l {
-		//u.Debugf("got %s:%v msgs", key, vals)
-		outCh <- m.msg
+func (m *topN) add(keys []value.Value, msg *datasource.SqlDriverMessageMap) error {
+	row := &orderRow{seq: m.seq, keys: keys, msg: msg}
+	m.seq++
+	if len(m.rows) < m.n {
+		heap.Push(m, row)
+	} else if orderLess(m.orderBy, row, m.rows[0]) {
+		m.rows[0] = row
+		heap.Fix(m, 0)
 	}
+	return nil
+}
 
-	m.isComplete = true
-	close(m.complete)
+func (m *topN) emit(out func(msg *datasource.SqlDriverMessageMap) bool) error {
+	sort.Slice(m.rows, func(i, j int) bool {
+		return orderLess(m.orderBy, m.rows[i], m.rows[j])
+	})
+	for _, row := range m.rows {
+		if !out(row.msg) {
+			return nil
+		}
+	}
+	return nil
+}
 
+func (m *topN) Close() error { return nil }
+
+// heap.Interface, the greatest row is on top
+func (m *topN) Len() int           { return len(m.rows) }
+func (m *topN) Less(i, j int) bool { return orderLess(m.orderBy, m.rows[j], m.rows[i]) }
+func (m *topN) Swap(i, j int)      { m.rows[i], m.rows[j] = m.rows[j], m.rows[i] }
+func (m *topN) Push(x any)         { m.rows = append(m.rows, x.(*orderRow)) }
+func (m *topN) Pop() any {
+	row := m.rows[len(m.rows)-1]
+	m.rows = m.rows[:len(m.rows)-1]
+	return row
+}
+
+// externalSort sorts rows in memory until they exceed the memory budget,
+// then writes them to disk as sorted runs which are merged when emitted.
+// Rows with equal keys keep their arrival order.
+type externalSort struct {
+	orderBy  rel.Columns
+	dir      string
+	budget   int64
+	size     int64
+	seq      uint64
+	colIndex map[string]int
+	rows     []*orderRow
+	runs     []*spillFile
+}
+
+func newExternalSort(ctx *plan.Context, orderBy rel.Columns) *externalSort {
+	m := &externalSort{orderBy: orderBy}
+	if ctx != nil {
+		m.budget = ctx.MemoryBudget
+		m.dir = ctx.TempDir
+	}
+	return m
+}
+
+func (m *externalSort) add(keys []value.Value, msg *datasource.SqlDriverMessageMap) error {
+	if m.colIndex == nil {
+		m.colIndex = msg.ColIndex
+	}
+	m.rows = append(m.rows, &orderRow{seq: m.seq, keys: keys, msg: msg})
+	m.seq++
+	m.size += rowSize(msg.Vals) + int64(16*len(keys))
+	if m.budget > 0 && m.size > m.budget {
+		return m.spill()
+	}
 	return nil
 }
 
-type msgkey struct {
-	keys []string
-	msg  *datasource.SqlDriverMessageMap
+func (m *externalSort) sort() {
+	sort.Slice(m.rows, func(i, j int) bool {
+		return orderLess(m.orderBy, m.rows[i], m.rows[j])
+	})
 }
-type OrderMessages struct {
-	l      []*msgkey
-	invert []bool
+
+// spill the buffered rows to a sorted run on disk, the key values are
+// appended after the row values so they need not be evaluated again.
+func (m *externalSort) spill() error {
+	u.Debugf("order by exceeded memory budget %d, spilling %d rows to disk", m.budget, len(m.rows))
+	run, err := newSpillFile(m.dir, "qlbridge-order-")
+	if err != nil {
+		return err
+	}
+	m.runs = append(m.runs, run)
+	m.sort()
+	for _, row := range m.rows {
+		vals := make([]driver.Value, len(row.msg.Vals), len(row.msg.Vals)+len(row.keys))
+		copy(vals, row.msg.Vals)
+		for _, key := range row.keys {
+			if key == nil || key.Nil() {
+				vals = append(vals, nil)
+			} else {
+				vals = append(vals, key.Value())
+			}
+		}
+		if err := run.Write(&spillRow{Id: row.seq, Vals: vals}); err != nil {
+			return err
+		}
+	}
+	m.rows = m.rows[:0]
+	m.size = 0
+	return nil
 }
 
-func NewOrderMessages(p *plan.Order) *OrderMessages {
-	invert := make([]bool, len(p.Stmt.OrderBy))
-	for i, col := range p.Stmt.OrderBy {
-		//u.Debugf("invert?  %s ORDER %v", col.Expr, col.Order)
-		if col.Expr != nil {
-			if !col.Asc() {
-				invert[i] = true
+// emit all rows in order, stops early if out returns false.
+func (m *externalSort) emit(out func(msg *datasource.SqlDriverMessageMap) bool) error {
+
+	if len(m.runs) == 0 {
+		m.sort()
+		for _, row := range m.rows {
+			if !out(row.msg) {
+				return nil
 			}
 		}
+		return nil
+	}
+
+	if len(m.rows) > 0 {
+		if err := m.spill(); err != nil {
+			return err
+		}
+	}
+
+	keyCt := len(m.orderBy)
+	toRow := func(sr *spillRow) *orderRow {
+		n := len(sr.Vals) - keyCt
+		keys := make([]value.Value, keyCt)
+		for i, v := range sr.Vals[n:] {
+			keys[i] = value.NewValue(v)
+		}
+		return &orderRow{seq: sr.Id, keys: keys}
 	}
-	return &OrderMessages{
-		l:      make([]*msgkey, 0),
-		invert: invert,
+	merger, err := newSpillMerger(m.runs, func(a, b *spillRow) bool {
+		return orderLess(m.orderBy, toRow(a), toRow(b))
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		sr, err := merger.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		vals := sr.Vals[:len(sr.Vals)-keyCt]
+		if !out(datasource.NewSqlDriverMessageMap(sr.Id, vals, m.colIndex)) {
+			return nil
+		}
 	}
 }
-func (m *OrderMessages) Len() int {
-	return len(m.l)
+
+// Close removes any runs spilled to disk
+func (m *externalSort) Close() error {
+	var err error
+	for _, run := range m.runs {
+		if cerr := run.Close(); err == nil {
+			err = cerr
+		}
+	}
+	m.runs = nil
+	return err
 }
-func (m *OrderMessages) Less(i, j int) bool {
-	for ki, key := range m.l[i].keys {
-		if key < m.l[j].keys[ki] {
-			if m.invert[ki] {
-				return false
-			}
-			return true
-		} else {
-			if m.invert[ki] {
-				return true
+
+// orderLess does row a sort before b, rows with equal keys are ordered
+// by arrival.
+func orderLess(orderBy rel.Columns, a, b *orderRow) bool {
+	if c := compareOrderKeys(orderBy, a.keys, b.keys); c != 0 {
+		return c < 0
+	}
+	return a.seq < b.seq
+}
+
+// compareOrderKeys compare the ORDER BY values of two rows, honoring the
+// direction and NULLS FIRST/LAST of each column.
+func compareOrderKeys(orderBy rel.Columns, a, b []value.Value) int {
+	for i, col := range orderBy {
+		an := a[i] == nil || a[i].Nil()
+		bn := b[i] == nil || b[i].Nil()
+		switch {
+		case an && bn:
+			continue
+		case an || bn:
+			// NULL position does not flip with the direction
+			if an == col.NullsFirst() {
+				return -1
 			}
+			return 1
+		}
+		c := compareValues(a[i], b[i])
+		if !col.Asc() {
+			c = -c
+		}
+		if c != 0 {
+			return c
 		}
 	}
-	return false
-}
-func (m *OrderMessages) Swap(i, j int) {
-	m.l[i], m.l[j] = m.l[j], m.l[i]
+	return 0
 }
@@ -0,0 +1,153 @@
+package exec
+
+import (
+	"sync"
+
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/rel"
+	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
+)
+
+// PreparedJob a prepared statement, planned once and run again by each
+// execution with the arguments of the execution bound to its placeholders
+// (? or $1).  The sources of the plan open new connections per execution.
+//
+// An execution while earlier ones still run, as when the rows of an earlier
+// query are still read, plans its own copy of the statement, so the values
+// bound to the placeholders of a running plan never change.
+type PreparedJob struct {
+	Raw      string
+	Stmt     rel.SqlStatement // the statement as parsed, executions bind and plan their own copies
+	numInput int
+	mu       sync.Mutex
+	free     []*preparedPlan // plans not running, to run again
+}
+
+// preparedPlan a copy of the statement of a PreparedJob and its plan, run
+// by one execution at a time.
+type preparedPlan struct {
+	prepared *rel.PreparedStatement
+	schema   *schema.Schema // schema it was planned in
+	ctx      *plan.Context  // plan context of the plan, of each execution of it
+	root     plan.Task      // nil until planned
+}
+
+// NewPreparedJob parse @query as a prepared statement.
+func NewPreparedJob(query string) (*PreparedJob, error) {
+	prepared, err := rel.PrepareSql(query)
+	if err != nil {
+		return nil, err
+	}
+	return &PreparedJob{Raw: query, Stmt: prepared.Statement, numInput: prepared.NumInput()}, nil
+}
+
+// NumInput the number of placeholders of the statement.
+func (m *PreparedJob) NumInput() int { return m.numInput }
+
+// BuildSqlJob the job of an execution of the statement, with @args bound to
+// its placeholders, in the go context, schema, session and transaction of
+// @ctx.  The job has a plan context of its own, its Ctx, which is re-used by
+// later executions once the job has run (or is closed without running), so
+// results of the job are read in @ctx.
+func (m *PreparedJob) BuildSqlJob(ctx *plan.Context, args []value.Value) (*JobExecutor, error) {
+	p, err := m.get(ctx.Schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.prepared.Bind(args); err != nil {
+		m.put(p)
+		return nil, err
+	}
+	job, err := m.build(p, ctx)
+	if err == plan.ErrNotReusable {
+		// a source planned its own query, or the plan depends on the
+		// arguments bound, plan the statement again
+		if p, err = m.parse(ctx.Schema); err != nil {
+			return nil, err
+		}
+		if err := p.prepared.Bind(args); err != nil {
+			return nil, err
+		}
+		job, err = m.build(p, ctx)
+	}
+	if err != nil {
+		// a plan which failed is not run again
+		return nil, err
+	}
+	job.release = func() { m.put(p) }
+	// results of the job are read in @ctx, with the go context of the
+	// execution (and its max_execution_time deadline), and the statement
+	// and projection planned
+	ctx.Context = job.Ctx.Context
+	ctx.Stmt = job.Ctx.Stmt
+	ctx.Projection = job.Ctx.Projection
+	return job, nil
+}
+
+// build the job of plan @p, planning it on its first execution and else
+// opening the connections of its sources again.
+func (m *PreparedJob) build(p *preparedPlan, ctx *plan.Context) (*JobExecutor, error) {
+	if p.root != nil && p.prepared.BindsLimit() {
+		// the plan was made for the LIMIT and OFFSET of an earlier execution
+		return nil, plan.ErrNotReusable
+	}
+	if p.ctx == nil {
+		pctx := *ctx
+		pctx.Raw = m.Raw
+		pctx.Stmt = p.prepared.Statement
+		p.ctx = &pctx
+	}
+	p.ctx.Context = ctx.Context
+	p.ctx.Session = ctx.Session
+	p.ctx.Tx = ctx.Tx
+
+	job := NewExecutor(p.ctx, plan.NewPlanner(p.ctx))
+	var err error
+	if p.root == nil {
+		p.root, err = plan.WalkStmt(p.ctx, p.ctx.Stmt, job.Planner)
+	} else {
+		err = plan.Reopen(p.ctx, p.root)
+	}
+	if err != nil {
+		job.cancel()
+		return nil, err
+	}
+	if err := job.buildRoot(p.root); err != nil {
+		job.cancel()
+		return nil, err
+	}
+	return job, nil
+}
+
+// get a plan of the statement in @s which is not running, or a new copy
+// of the statement.  Plans of other schemas are dropped.
+func (m *PreparedJob) get(s *schema.Schema) (*preparedPlan, error) {
+	m.mu.Lock()
+	for len(m.free) > 0 {
+		p := m.free[len(m.free)-1]
+		m.free = m.free[:len(m.free)-1]
+		if p.schema == s {
+			m.mu.Unlock()
+			return p, nil
+		}
+	}
+	m.mu.Unlock()
+	return m.parse(s)
+}
+
+func (m *PreparedJob) put(p *preparedPlan) {
+	m.mu.Lock()
+	m.free = append(m.free, p)
+	m.mu.Unlock()
+}
+
+// parse a new copy of the statement, planning re-writes it so each plan
+// has its own.
+func (m *PreparedJob) parse(s *schema.Schema) (*preparedPlan, error) {
+	prepared, err := rel.PrepareSql(m.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return &preparedPlan{prepared: prepared, schema: s}, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/lytics/qlbridge/datasource"
 	"github.com/lytics/qlbridge/expr"
 	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/rel"
 	"github.com/lytics/qlbridge/schema"
 	"github.com/lytics/qlbridge/value"
 	"github.com/lytics/qlbridge/vm"
@@ -98,6 +99,9 @@ func (m *Projection) Close() error {
 	return nil
 }
 
+// ReceivesBatches the projection accepts MessageBatch input
+func (m *Projection) ReceivesBatches() bool { return true }
+
 // CloseFinal after exit, cleanup some more
 func (m *Projection) CloseFinal() error {
 	//u.Debugf("Projection CloseFinal  alreadyclosed?%v", m.closed)
@@ -110,6 +114,26 @@ func (m *Projection) CloseFinal() error {
 	return m.TaskBase.Close()
 }
 
+// compileColumns compiles the expression and guard of each column once,
+// entries are nil for columns without them (star, window columns)
+func compileColumns(mode vm.NullMode, columns rel.Columns) (exprs, guards []*vm.Program, err error) {
+	exprs = make([]*vm.Program, len(columns))
+	guards = make([]*vm.Program, len(columns))
+	for i, col := range columns {
+		if col.Guard != nil {
+			if guards[i], err = vm.CompileMode(mode, col.Guard); err != nil {
+				return nil, nil, err
+			}
+		}
+		if col.Expr != nil && !col.Star && col.Over == nil {
+			if exprs[i], err = vm.CompileMode(mode, col.Expr); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return exprs, guards, nil
+}
+
 // Create handler function for evaluation (ie, field selection from tuples)
 func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 
@@ -120,12 +144,21 @@ func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 	if limit == 0 {
 		limit = math.MaxInt32
 	}
+	offset := m.p.Offset()
 	colCt := len(columns)
 	// If we have a projection, use that as col count
 	if m.p.Proj != nil {
 		colCt = len(m.p.Proj.Columns)
 	}
 
+	exprs, guards, err := compileColumns(nullMode(m.Ctx), columns)
+	if err != nil {
+		u.Errorf("could not compile projection %v", err)
+		return func(ctx *plan.Context, msg schema.Message) bool {
+			return false
+		}
+	}
+
 	rowCt := 0
 	return func(ctx *plan.Context, msg schema.Message) bool {
 
@@ -148,7 +181,7 @@ func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 			}, mt.Ts())
 			//u.Debugf("about to project: %#v", mt)
 			colIdx := -1
-			for _, col := range columns {
+			for i, col := range columns {
 				colIdx += 1
 				//u.Debugf("%d  colidx:%v sidx: %v pidx:%v key:%q Expr:%v", colIdx, col.Index, col.SourceIndex, col.ParentIndex, col.Key(), col.Expr)
 
@@ -157,7 +190,7 @@ func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 				}
 
 				if col.Guard != nil {
-					ifColValue, ok := vm.Eval(rdr, col.Guard)
+					ifColValue, ok := guards[i].Eval(rdr)
 					if !ok {
 						// Most likely scenario here is Missing Columns.
 						// Unlikely traditional sql, we are going to operate in both strict-schema mode
@@ -203,8 +236,13 @@ func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 
 				} else if col.Expr == nil {
 					u.Warnf("wat?   nil col expr? %#v", col)
+				} else if col.Over != nil {
+					// window columns were evaluated by the window task
+					if v, ok := mt.Get(windowKey(col)); ok && v != nil && !v.Nil() {
+						row[colIdx] = v.Value()
+					}
 				} else {
-					v, ok := vm.Eval(rdr, col.Expr)
+					v, ok := exprs[i].Eval(rdr)
 					if !ok {
 						u.Warnf("failed eval key=%q  val=%#v expr:%q  expr:%#v mt:%#v", col.Key(), v, col.Expr, col.Expr, mt)
 						// for k, v := range ctx.Session.Row() {
@@ -241,7 +279,7 @@ func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 				}
 
 				if col.Guard != nil {
-					ifColValue, ok := vm.Eval(mt, col.Guard)
+					ifColValue, ok := guards[i].Eval(mt)
 					if !ok {
 						u.Errorf("Could not evaluate if:   %v", col.Guard.String())
 						//return fmt.Errorf("Could not evaluate if clause: %v", col.Guard.String())
@@ -270,7 +308,7 @@ func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 				} else if col.Expr == nil {
 					u.Warnf("wat?   nil col expr? %#v", col)
 				} else {
-					v, ok := vm.Eval(mt, col.Expr)
+					v, ok := exprs[i].Eval(mt)
 					if !ok {
 						//u.Warnf("failed eval key=%v  val=%#v expr:%s   mt:%#v", col.Key(), v, col.Expr, mt.Row())
 					} else if v == nil {
@@ -294,8 +332,13 @@ func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 			u.Errorf("could not project msg:  %T", msg)
 		}
 
+		if offset > 0 {
+			offset--
+			return true // skip rows before OFFSET
+		}
 		if rowCt >= limit {
 			//u.Debugf("%p Projection reaching Limit!!! rowct:%v  limit:%v", m, rowCt, limit)
+			m.Flush()
 			out <- nil // Sending nil message is a message to downstream to shutdown
 			m.Quit()   // should close rest of dag as well
 			return false
@@ -303,12 +346,7 @@ func (m *Projection) projectionEvaluator(isFinal bool) MessageHandler {
 		rowCt++
 
 		//u.Debugf("row:%d  completed projection for: %p %#v", rowCt, out, outMsg)
-		select {
-		case out <- outMsg:
-			return true
-		case <-m.SigChan():
-			return false
-		}
+		return m.Emit(outMsg)
 	}
 }
 
@@ -320,6 +358,7 @@ func (m *Projection) limitEvaluator() MessageHandler {
 	if limit == 0 {
 		limit = math.MaxInt32
 	}
+	offset := m.p.Offset()
 
 	rowCt := 0
 	return func(ctx *plan.Context, msg schema.Message) bool {
@@ -331,6 +370,10 @@ func (m *Projection) limitEvaluator() MessageHandler {
 		default:
 		}
 
+		if offset > 0 {
+			offset--
+			return true // skip rows before OFFSET
+		}
 		if rowCt >= limit {
 			if rowCt == limit {
 				//u.Debugf("%p Projection reaching Limit!!! rowct:%v  limit:%v", m, rowCt, limit)
@@ -344,11 +387,6 @@ func (m *Projection) limitEvaluator() MessageHandler {
 		}
 		rowCt++
 
-		select {
-		case out <- msg:
-			return true
-		case <-m.SigChan():
-			return false
-		}
+		return m.send(msg)
 	}
 }
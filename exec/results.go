@@ -1,14 +1,21 @@
 package exec
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"io"
+	"reflect"
+	"strings"
+	"time"
 
 	u "github.com/araddon/gou"
 
 	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/expr"
 	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/rel"
 	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
 )
 
 const (
@@ -19,7 +26,13 @@ var (
 	_ = u.EMPTY
 
 	// ensure our resultwriter implements database/sql/driver `driver.Rows`
-	_ driver.Rows = (*ResultWriter)(nil)
+	_ driver.Rows                           = (*ResultWriter)(nil)
+	_ driver.RowsColumnTypeScanType         = (*ResultWriter)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*ResultWriter)(nil)
+
+	scanTypeAny = reflect.TypeOf((*any)(nil)).Elem()
+	// timeLayouts of the time values of sources which read them as strings
+	timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"}
 
 	// Ensure that we implement the Task Runner interface
 	// required for usage as tasks in Executor
@@ -42,6 +55,7 @@ type (
 		*TaskBase
 		closed bool
 		cols   []string
+		types  []value.ValueType // of the cols, UnknownType if not known
 	}
 	// ResultBuffer for writing tasks results
 	ResultBuffer struct {
@@ -60,8 +74,9 @@ func NewResultExecWriter(ctx *plan.Context) *ResultExecWriter {
 		switch mt := msg.(type) {
 		case *datasource.SqlDriverMessage:
 			if len(mt.Vals) > 1 {
-				m.lastInsertID = mt.Vals[0].(int64)
-				m.rowsAffected = mt.Vals[1].(int64)
+				// a failed mutation sends its error rather than an id
+				m.lastInsertID, _ = mt.Vals[0].(int64)
+				m.rowsAffected, _ = mt.Vals[1].(int64)
 			}
 		case nil:
 			u.Warnf("got nil")
@@ -86,16 +101,54 @@ func NewResultWriter(ctx *plan.Context) *ResultWriter {
 	return m
 }
 
-// NewResultRows a resultwriter
+// NewResultRows a resultwriter, the types of its columns are those of the
+// projection of the planned statement of the context.
 func NewResultRows(ctx *plan.Context, cols []string) *ResultWriter {
 	stepper := NewTaskStepper(ctx)
 	m := &ResultWriter{
 		TaskBase: stepper.TaskBase,
 		cols:     cols,
+		types:    projectionTypes(ctx, cols),
 	}
 	return m
 }
 
+// projectionTypes the value types of the result columns @cols, from the
+// projection of the planned statement.  Only columns of the schema (and
+// literals, counts) are typed, the projection types expressions by the
+// first column they refer to.  Others, and those of joins, are UnknownType.
+func projectionTypes(ctx *plan.Context, cols []string) []value.ValueType {
+	types := make([]value.ValueType, len(cols))
+	for i := range types {
+		types[i] = value.UnknownType
+	}
+	var sel *rel.SqlSelect
+	switch st := ctx.Stmt.(type) {
+	case *rel.SqlSelect:
+		sel = st
+	case *rel.SqlSetOp:
+		sel = st.First()
+	case *rel.SqlWith:
+		sel = st.First()
+	}
+	// the projection of an EXPLAIN is of the statement being explained
+	if sel == nil || ctx.Projection == nil || ctx.Projection.Proj == nil {
+		return types
+	}
+	for i, col := range cols {
+		if i < len(sel.Columns) && !sel.Star && !typedExpr(sel.Columns[i].Expr) {
+			continue
+		}
+		for _, rc := range ctx.Projection.Proj.Columns {
+			if strings.EqualFold(rc.As, col) {
+				types[i] = rc.Type
+				break
+			}
+		}
+	}
+	return types
+}
+
 // NewResultBuffer create a result buffer to write temp tasks into results.
 func NewResultBuffer(ctx *plan.Context, writeTo *[]schema.Message) *ResultBuffer {
 	m := &ResultBuffer{
@@ -166,17 +219,52 @@ func (m *ResultBuffer) Close() error {
 func (m *ResultWriter) Next(dest []driver.Value) error {
 	select {
 	case <-m.SigChan():
+		if err := contextErr(m.Ctx); err != nil {
+			return err
+		}
+		// the error of a task which closed the job
+		select {
+		case err := <-m.ErrChan():
+			return err
+		default:
+		}
 		return ErrShuttingDown
 	case err := <-m.ErrChan():
 		return err
 	case msg, ok := <-m.MessageIn():
-		if !ok {
+		if !ok || msg == nil {
+			// a canceled query also ends by closing its channels
+			if err := contextErr(m.Ctx); err != nil {
+				return err
+			}
 			return io.EOF
 		}
-		if msg == nil {
-			return io.EOF
+		if err := msgToRow(msg, m.cols, dest); err != nil {
+			return err
+		}
+		m.castTimes(dest)
+		return nil
+	}
+}
+
+// castTimes converts the values of time columns read as strings (from
+// sources such as csv) to time.Time, as reported by ColumnTypeScanType.
+// Only the layouts written by sources are parsed, not any date like string.
+func (m *ResultWriter) castTimes(dest []driver.Value) {
+	for i, vt := range m.types {
+		if vt != value.TimeType || i >= len(dest) {
+			continue
+		}
+		s, ok := dest[i].(string)
+		if !ok {
+			continue
+		}
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				dest[i] = t
+				break
+			}
 		}
-		return msgToRow(msg, m.cols, dest)
 	}
 }
 
@@ -203,6 +291,69 @@ func (m *ResultWriter) Columns() []string {
 	return m.cols
 }
 
+// typedExpr is the type of the result column of expression @n known
+func typedExpr(n expr.Node) bool {
+	switch nt := n.(type) {
+	case nil, *expr.IdentityNode, *expr.NumberNode, *expr.StringNode:
+		return true
+	case *expr.FuncNode:
+		return strings.ToLower(nt.Name) == "count"
+	}
+	return false
+}
+
+// ColumnTypeScanType the go type to scan the column @index into, a sql.Null*
+// type as any column may be NULL.
+func (m *ResultWriter) ColumnTypeScanType(index int) reflect.Type {
+	switch m.ColumnType(index) {
+	case value.IntType:
+		return reflect.TypeOf(sql.NullInt64{})
+	case value.NumberType:
+		return reflect.TypeOf(sql.NullFloat64{})
+	case value.BoolType:
+		return reflect.TypeOf(sql.NullBool{})
+	case value.TimeType:
+		return reflect.TypeOf(sql.NullTime{})
+	case value.StringType:
+		return reflect.TypeOf(sql.NullString{})
+	case value.ByteSliceType:
+		return reflect.TypeOf(sql.RawBytes{})
+	}
+	return scanTypeAny
+}
+
+// ColumnTypeDatabaseTypeName the mysql type name of the column @index, empty
+// if not known.
+func (m *ResultWriter) ColumnTypeDatabaseTypeName(index int) string {
+	switch m.ColumnType(index) {
+	case value.IntType:
+		return "BIGINT"
+	case value.NumberType:
+		return "DOUBLE"
+	case value.BoolType:
+		return "BOOLEAN"
+	case value.TimeType:
+		return "DATETIME"
+	case value.StringType:
+		return "VARCHAR"
+	case value.ByteSliceType:
+		return "BLOB"
+	case value.JsonType:
+		return "JSON"
+	case value.UnknownType, value.NilType:
+		return ""
+	}
+	return "TEXT"
+}
+
+// ColumnType the value type of the column @index, UnknownType if not known.
+func (m *ResultWriter) ColumnType(index int) value.ValueType {
+	if index < 0 || index >= len(m.types) {
+		return value.UnknownType
+	}
+	return m.types[index]
+}
+
 func resultWrite(m *ResultWriter) MessageHandler {
 	out := m.MessageOut()
 	return func(ctx *plan.Context, msg schema.Message) bool {
@@ -259,8 +410,10 @@ func msgToRow(msg schema.Message, cols []string, dest []driver.Value) error {
 				//u.Infof("key=%v   val=%v", key, val)
 			} else if val == nil {
 				u.Errorf("could not evaluate? %v  %#v", key, mt)
+				dest[i] = nil
 			} else {
-				u.Warnf("missing value? %v %T %v", key, val.Value(), val.Value())
+				// NULL, ie the missing side of an outer join
+				dest[i] = nil
 			}
 		}
 		//u.Debugf("got msg in row result writer: %#v", dest)
@@ -0,0 +1,221 @@
+package exec
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/lex"
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/value"
+)
+
+var (
+	// Ensure that we implement the Task Runner interface
+	_ TaskRunner = (*SetOp)(nil)
+)
+
+// SetOp combines the rows of two queries
+//
+//	UNION      rows of both, without duplicates (ALL keeps them)
+//	INTERSECT  rows of left also found in right
+//	EXCEPT     rows of left not found in right
+//
+// Rows are matched by position, and named by the columns of the first
+// select of the statement.  Duplicates are found by comparing values,
+// NULL is equal to NULL.
+//
+//	left   ->  \
+//	            setop  ->
+//	right  ->  /
+type SetOp struct {
+	*TaskBase
+	p        *plan.SetOp
+	ltask    TaskRunner
+	rtask    TaskRunner
+	colIndex map[string]int
+	id       uint64
+}
+
+// NewSetOp create a set operation task reading from the left and right tasks.
+func NewSetOp(ctx *plan.Context, l, r TaskRunner, p *plan.SetOp) *SetOp {
+	m := &SetOp{
+		TaskBase: NewTaskBase(ctx),
+		p:        p,
+		ltask:    l,
+		rtask:    r,
+	}
+	if first := p.Stmt.First(); first != nil {
+		m.colIndex = first.ColIndexes()
+	}
+	return m
+}
+
+func (m *SetOp) Run() error {
+	defer m.Ctx.Recover()
+	defer close(m.msgOutCh)
+
+	switch m.p.Stmt.Op {
+	case lex.TokenUnion:
+		return m.union()
+	case lex.TokenIntersect, lex.TokenExcept:
+		return m.filter()
+	}
+	return fmt.Errorf("unsupported set operator %s", m.p.Stmt.Op)
+}
+
+// union emits rows of both sides as they arrive
+func (m *SetOp) union() error {
+	var mu sync.Mutex
+	seen := make(map[string]struct{})
+	emit := func(vals []driver.Value) bool {
+		if !m.p.Stmt.All {
+			key := rowKey(vals)
+			mu.Lock()
+			_, dupe := seen[key]
+			seen[key] = struct{}{}
+			mu.Unlock()
+			if dupe {
+				return true
+			}
+		}
+		return m.emit(vals)
+	}
+
+	wg := new(sync.WaitGroup)
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = m.scan(m.ltask.MessageOut(), emit)
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = m.scan(m.rtask.MessageOut(), emit)
+	}()
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter reads all of the right side, then emits the left rows that are
+// (INTERSECT) or are not (EXCEPT) found in it.
+func (m *SetOp) filter() error {
+	all := m.p.Stmt.All
+	intersect := m.p.Stmt.Op == lex.TokenIntersect
+
+	counts := make(map[string]int)
+	err := m.scan(m.rtask.MessageOut(), func(vals []driver.Value) bool {
+		counts[rowKey(vals)]++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]struct{})
+	return m.scan(m.ltask.MessageOut(), func(vals []driver.Value) bool {
+		key := rowKey(vals)
+		ct := counts[key]
+		switch {
+		case intersect && ct == 0:
+			return true
+		case intersect && all:
+			counts[key] = ct - 1
+		case intersect:
+			// only the first, the rest are duplicates
+			counts[key] = 0
+		case ct > 0 && all:
+			counts[key] = ct - 1
+			return true
+		case ct > 0:
+			return true
+		case !all:
+			if _, dupe := seen[key]; dupe {
+				return true
+			}
+			seen[key] = struct{}{}
+		}
+		return m.emit(vals)
+	})
+}
+
+// scan reads all rows from one side until closed, or handle returns false
+func (m *SetOp) scan(in MessageChan, handle func([]driver.Value) bool) error {
+	for {
+		start := time.Now()
+		select {
+		case <-m.SigChan():
+			return nil
+		case msg, ok := <-in:
+			m.counters.received(msg, start)
+			if !ok {
+				return nil
+			}
+			if msg == nil {
+				// a side with a limit signals its end, its channel closes next
+				continue
+			}
+			mt, isMap := msg.(*datasource.SqlDriverMessageMap)
+			if !isMap {
+				u.Errorf("unrecognized msg %T", msg)
+				m.Quit()
+				return fmt.Errorf("To use %s must use SqlDriverMessageMap but got %T", m.p.Stmt.Op, msg)
+			}
+			if !handle(mt.Values()) {
+				return nil
+			}
+		}
+	}
+}
+
+// emit a row, re-keyed with the column names of the first select
+func (m *SetOp) emit(vals []driver.Value) bool {
+	m.Lock()
+	id := m.id
+	m.id++
+	m.Unlock()
+	return m.send(datasource.NewSqlDriverMessageMap(id, vals, m.colIndex))
+}
+
+// rowKey is a key equal for rows of equal values, used to find duplicates.
+// Values of different types are different, int 1 is not string "1".
+func rowKey(vals []driver.Value) string {
+	var buf bytes.Buffer
+	for _, v := range vals {
+		if v == nil {
+			buf.WriteString("\x00N")
+			continue
+		}
+		val := value.NewValue(v)
+		buf.WriteString("\x00V")
+		buf.WriteString(val.Type().String())
+		buf.WriteByte(':')
+		buf.WriteString(val.ToString())
+	}
+	return buf.String()
+}
+
+// matchKey is a key equal for values which compare equal, int 1 matches
+// string "1" as in a WHERE x = y.  Used for IN and correlation keys.
+func matchKey(vals []driver.Value) string {
+	var buf bytes.Buffer
+	for _, v := range vals {
+		if v == nil {
+			buf.WriteString("\x00N")
+			continue
+		}
+		buf.WriteString("\x00V")
+		buf.WriteString(value.NewValue(v).ToString())
+	}
+	return buf.String()
+}
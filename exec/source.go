@@ -130,16 +130,28 @@ func (m *Source) Run() error {
 	}
 
 	sigChan := m.SigChan()
+	done := m.Ctx.Done()
+
+	if m.p.Offset > 0 {
+		if skipper, ok := m.Scanner.(schema.ConnSkipper); ok {
+			skipper.Skip(m.p.Offset)
+		}
+	}
 
 	for item := m.Scanner.Next(); item != nil; item = m.Scanner.Next() {
 
 		select {
 		case <-sigChan:
 			return nil
-		case m.msgOutCh <- item:
-			// continue
+		case <-done:
+			return nil
+		default:
+		}
+		m.counters.rowsIn.Add(1)
+		if !m.Emit(item) {
+			return nil
 		}
-
 	}
+	m.Flush()
 	return nil
 }
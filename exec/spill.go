@@ -0,0 +1,171 @@
+package exec
+
+import (
+	"bufio"
+	"container/heap"
+	"database/sql/driver"
+	"encoding/gob"
+	"io"
+	"os"
+	"time"
+)
+
+func init() {
+	// Values inside of []driver.Value are interfaces, gob needs to know
+	// the concrete types that are not builtin.
+	gob.Register(time.Time{})
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+}
+
+// spillRow is the on-disk form of a row written by operators (join, groupby,
+// sort) that have exceeded their plan.Context MemoryBudget.
+type spillRow struct {
+	Key  string
+	Id   uint64
+	Vals []driver.Value
+}
+
+// spillFile is an append only temp file of gob encoded rows.  Write all
+// rows, then Reader() to read them back in the same order.  Close removes
+// the underlying file.
+type spillFile struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc *gob.Encoder
+	n   int
+}
+
+func newSpillFile(dir, prefix string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &spillFile{f: f, w: w, enc: gob.NewEncoder(w)}, nil
+}
+
+// Write a row to end of file
+func (m *spillFile) Write(row *spillRow) error {
+	m.n++
+	return m.enc.Encode(row)
+}
+
+// Len is the number of rows written
+func (m *spillFile) Len() int { return m.n }
+
+// Reader flushes any buffered rows and returns a reader positioned
+// at the start of the file.
+func (m *spillFile) Reader() (*spillReader, error) {
+	if err := m.w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := m.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &spillReader{dec: gob.NewDecoder(bufio.NewReader(m.f))}, nil
+}
+
+// Close and remove the temp file
+func (m *spillFile) Close() error {
+	err := m.f.Close()
+	if rerr := os.Remove(m.f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// spillReader reads rows back from a spillFile
+type spillReader struct {
+	dec *gob.Decoder
+}
+
+// Next row, returns io.EOF when no more rows.
+func (m *spillReader) Next() (*spillRow, error) {
+	row := &spillRow{}
+	if err := m.dec.Decode(row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// spillMerger reads the rows of spill files (runs) each written in order,
+// merging them into a single ordered stream.
+type spillMerger struct {
+	less  func(a, b *spillRow) bool
+	heads []*spillHead
+}
+
+// spillHead the next row of one run
+type spillHead struct {
+	row *spillRow
+	r   *spillReader
+}
+
+func newSpillMerger(runs []*spillFile, less func(a, b *spillRow) bool) (*spillMerger, error) {
+	m := &spillMerger{less: less, heads: make([]*spillHead, 0, len(runs))}
+	for _, run := range runs {
+		r, err := run.Reader()
+		if err != nil {
+			return nil, err
+		}
+		row, err := r.Next()
+		if err == io.EOF {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		m.heads = append(m.heads, &spillHead{row: row, r: r})
+	}
+	heap.Init(m)
+	return m, nil
+}
+
+// Next row of all runs, returns io.EOF when no more rows.
+func (m *spillMerger) Next() (*spillRow, error) {
+	if len(m.heads) == 0 {
+		return nil, io.EOF
+	}
+	h := m.heads[0]
+	row := h.row
+	next, err := h.r.Next()
+	switch {
+	case err == io.EOF:
+		heap.Pop(m)
+	case err != nil:
+		return nil, err
+	default:
+		h.row = next
+		heap.Fix(m, 0)
+	}
+	return row, nil
+}
+
+func (m *spillMerger) Len() int           { return len(m.heads) }
+func (m *spillMerger) Less(i, j int) bool { return m.less(m.heads[i].row, m.heads[j].row) }
+func (m *spillMerger) Swap(i, j int)      { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+func (m *spillMerger) Push(x any)         { m.heads = append(m.heads, x.(*spillHead)) }
+func (m *spillMerger) Pop() any {
+	h := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return h
+}
+
+// rowSize is a rough estimate of the in-memory bytes held by a row, used
+// to compare against memory budgets.
+func rowSize(vals []driver.Value) int64 {
+	size := int64(24 + 16*len(vals))
+	for _, v := range vals {
+		switch vt := v.(type) {
+		case string:
+			size += int64(len(vt))
+		case []byte:
+			size += int64(len(vt))
+		case time.Time:
+			size += 24
+		default:
+			size += 8
+		}
+	}
+	return size
+}
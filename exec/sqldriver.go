@@ -1,39 +1,46 @@
 package exec
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
 	"database/sql/driver"
-	"errors"
 	"fmt"
-	"io"
-	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	u "github.com/araddon/gou"
 
+	"github.com/lytics/qlbridge/datasource"
 	"github.com/lytics/qlbridge/expr"
 	"github.com/lytics/qlbridge/plan"
 	"github.com/lytics/qlbridge/rel"
 	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
 )
 
 var (
 	// Ensure our driver implements appropriate database/sql interfaces
-	_ driver.Conn    = (*qlbConn)(nil)
-	_ driver.Driver  = (*qlbdriver)(nil)
-	_ driver.Execer  = (*qlbConn)(nil)
-	_ driver.Queryer = (*qlbConn)(nil)
-	_ driver.Result  = (*qlbResult)(nil)
-	_ driver.Rows    = (*qlbRows)(nil)
-	_ driver.Stmt    = (*qlbStmt)(nil)
-	//_ driver.Tx      = (*driverConn)(nil)
+	_ driver.Conn               = (*qlbConn)(nil)
+	_ driver.Driver             = (*qlbdriver)(nil)
+	_ driver.Execer             = (*qlbConn)(nil)
+	_ driver.Queryer            = (*qlbConn)(nil)
+	_ driver.ExecerContext      = (*qlbConn)(nil)
+	_ driver.QueryerContext     = (*qlbConn)(nil)
+	_ driver.ConnPrepareContext = (*qlbConn)(nil)
+	_ driver.ConnBeginTx        = (*qlbConn)(nil)
+	_ driver.NamedValueChecker  = (*qlbConn)(nil)
+	_ driver.Pinger             = (*qlbConn)(nil)
+	_ driver.Result             = (*qlbResult)(nil)
+	_ driver.Stmt               = (*qlbStmt)(nil)
+	_ driver.StmtExecContext    = (*qlbStmt)(nil)
+	_ driver.StmtQueryContext   = (*qlbStmt)(nil)
+	_ driver.Tx                 = (*qlbTx)(nil)
 
 	// Create an instance of our driver
 	qlbd          = &qlbdriver{}
 	qlbDriverOnce sync.Once
+	// dsnMu serializes creating schemas from dsn's on first Open
+	dsnMu sync.Mutex
 
 	// Runtime Schema Config as in in-mem data structure of the
 	//  datasources, tables, etc.   Sources must be registered
@@ -86,9 +93,37 @@ type qlbdriver struct{}
 func (m *qlbdriver) Open(connInfo string) (driver.Conn, error) {
 	s, ok := registry.Schema(connInfo)
 	if !ok || s == nil {
-		return nil, fmt.Errorf("No schema was found for %q", connInfo)
+		if !strings.Contains(connInfo, "://") {
+			return nil, fmt.Errorf("No schema was found for %q", connInfo)
+		}
+		var err error
+		if s, err = schemaFromDsn(connInfo); err != nil {
+			return nil, err
+		}
+	}
+	return &qlbConn{connInfo: connInfo, schema: s, session: datasource.NewMySqlSessionVars()}, nil
+}
+
+// schemaFromDsn get the schema for a sourcetype://path?settings dsn, creating
+// and registering it from the registered source type on first use.
+func schemaFromDsn(dsn string) (*schema.Schema, error) {
+	conf, err := schema.NewConfigSourceFromDsn(dsn)
+	if err != nil {
+		return nil, err
+	}
+	dsnMu.Lock()
+	defer dsnMu.Unlock()
+	if s, ok := registry.Schema(conf.Name); ok && s != nil {
+		return s, nil
 	}
-	return &qlbConn{schema: s}, nil
+	if err = registry.SchemaAddFromConfig(conf); err != nil {
+		return nil, fmt.Errorf("could not create schema for %q: %w", dsn, err)
+	}
+	s, ok := registry.Schema(conf.Name)
+	if !ok || s == nil {
+		return nil, fmt.Errorf("No schema was found for %q", dsn)
+	}
+	return s, nil
 }
 
 // A stateful connection to database/source
@@ -108,6 +143,8 @@ type qlbConn struct {
 	parallel bool   // Do we Run In Background Mode?  Default = true
 	connInfo string //
 	schema   *schema.Schema
+	session  expr.ContextReadWriter // session variables, SET by this connection
+	tx       *schema.Transaction    // transaction begun on this connection
 }
 
 // Exec may return ErrSkip.
@@ -115,20 +152,65 @@ type qlbConn struct {
 // Execer implementation. To be used for queries that do not return any rows
 // such as Create Index, Insert, Upset, Delete etc
 func (m *qlbConn) Exec(query string, args []driver.Value) (driver.Result, error) {
-	stmt := &qlbStmt{conn: m, query: query}
+	stmt, err := m.prepare(query)
+	if err != nil {
+		return nil, err
+	}
 	return stmt.Exec(args)
 }
 
 // Queryer implementation
 // Query may return ErrSkip
 func (m *qlbConn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	stmt := &qlbStmt{conn: m, query: query}
+	stmt, err := m.prepare(query)
+	if err != nil {
+		return nil, err
+	}
 	return stmt.Query(args)
 }
 
-// Prepare returns a prepared statement, bound to this connection.
+// ExecContext ExecerContext implementation, the statement is stopped
+// once @ctx is done.
+func (m *qlbConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	stmt, err := m.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args)
+}
+
+// QueryContext QueryerContext implementation, the query is stopped once
+// @ctx is done.
+func (m *qlbConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	stmt, err := m.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args)
+}
+
+// Prepare returns a prepared statement, bound to this connection.  The
+// query is parsed and planned once, its placeholders (? or $1) are bound
+// to the arguments of each Exec or Query.
 func (m *qlbConn) Prepare(query string) (driver.Stmt, error) {
-	return nil, expr.ErrNotImplemented
+	return m.prepare(query)
+}
+
+// PrepareContext ConnPrepareContext implementation, parsing does not
+// block so @ctx is only checked before it.
+func (m *qlbConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.prepare(query)
+}
+
+func (m *qlbConn) prepare(query string) (*qlbStmt, error) {
+	prepared, err := NewPreparedJob(query)
+	if err != nil {
+		return nil, err
+	}
+	return &qlbStmt{conn: m, prepared: prepared}, nil
 }
 
 // Close invalidates and potentially stops any current
@@ -140,31 +222,78 @@ func (m *qlbConn) Prepare(query string) (driver.Stmt, error) {
 // idle connections, it shouldn't be necessary for drivers to
 // do their own connection caching.
 func (m *qlbConn) Close() error {
-	//u.Debugf("sqlbConn.Close() do we need to do anything here?")
+	// a transaction left open is rolled back
+	if m.tx != nil {
+		return m.tx.Rollback()
+	}
 	return nil
 }
 
-// Begin starts and returns a new transaction.
+// Begin starts and returns a new transaction, the statements run on this
+// connection until it is committed or rolled back run inside it.
 func (m *qlbConn) Begin() (driver.Tx, error) {
-	return nil, expr.ErrNotImplemented
+	if m.tx != nil && !m.tx.Done() {
+		return nil, fmt.Errorf("a transaction was already begun on this connection")
+	}
+	m.tx = schema.NewTransaction()
+	return &qlbTx{tx: m.tx}, nil
 }
 
-// sql.Tx Transaction Interface implementation.
-type qlbTx struct{}
+// BeginTx ConnBeginTx implementation, only the default isolation level
+// is supported.
+func (m *qlbConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if level := sql.IsolationLevel(opts.Isolation); level != sql.LevelDefault {
+		return nil, fmt.Errorf("isolation level %v is not supported", level)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Begin()
+}
 
-func (conn *qlbTx) Commit() error {
-	return expr.ErrNotImplemented
+// Ping Pinger implementation, a connection is bad once its schema is no
+// longer registered.
+func (m *qlbConn) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s, ok := registry.Schema(m.schema.Name); !ok || s == nil {
+		return driver.ErrBadConn
+	}
+	return nil
 }
-func (conn *qlbTx) Rollback() error { return expr.ErrNotImplemented }
+
+// CheckNamedValue NamedValueChecker implementation, value.Value arguments
+// are bound as they are, others are converted to driver values.
+func (m *qlbConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(value.Value); ok {
+		return nil
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = v
+	return nil
+}
+
+// sql.Tx Transaction Interface implementation.  A transaction already
+// ended by a COMMIT or ROLLBACK statement is not ended again.
+type qlbTx struct {
+	tx *schema.Transaction
+}
+
+func (m *qlbTx) Commit() error   { return m.tx.Commit() }
+func (m *qlbTx) Rollback() error { return m.tx.Rollback() }
 
 // driver.Stmt Interface implementation.
 //
 // Stmt is a prepared statement. It is bound to a Conn and not
 // used by multiple goroutines concurrently.
 type qlbStmt struct {
-	job   *JobExecutor
-	query string
-	conn  *qlbConn
+	job      *JobExecutor
+	prepared *PreparedJob // parsed query, planned once, with its placeholders
+	conn     *qlbConn
 }
 
 // Close closes the statement.
@@ -187,27 +316,33 @@ func (m *qlbStmt) Close() error {
 // NumInput may also return -1, if the driver doesn't know
 // its number of placeholders. In that case, the sql package
 // will not sanity check Exec or Query argument counts.
-func (m *qlbStmt) NumInput() int { return 0 }
+func (m *qlbStmt) NumInput() int { return m.prepared.NumInput() }
 
 // Exec executes a query that doesn't return rows, such
 // as an INSERT, UPDATE, DELETE
 func (m *qlbStmt) Exec(args []driver.Value) (driver.Result, error) {
-	var err error
-	if len(args) > 0 {
-		m.query, err = queryArgsConvert(m.query, args)
-		if err != nil {
-			return nil, err
-		}
+	return m.exec(context.Background(), args)
+}
+
+// ExecContext StmtExecContext implementation, the statement is stopped
+// once @ctx is done.
+func (m *qlbStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	vals, err := namedValues(args)
+	if err != nil {
+		return nil, err
 	}
+	return m.exec(ctx, vals)
+}
 
+func (m *qlbStmt) exec(goCtx context.Context, args []driver.Value) (driver.Result, error) {
 	// Create a Job, which is Dag of Tasks that Run()
-	ctx := plan.NewContext(m.query)
-	ctx.Schema = m.conn.schema
-	job, err := BuildSqlJob(ctx)
+	ctx, job, err := m.bind(goCtx, args)
 	if err != nil {
 		return nil, err
 	}
-	m.job = job
+	// the job has run once Exec returns, closing it closes the
+	// connections it opened to its sources
+	defer job.Close()
 
 	resultWriter := NewResultExecWriter(ctx)
 	job.RootTask.Add(resultWriter)
@@ -218,27 +353,35 @@ func (m *qlbStmt) Exec(args []driver.Value) (driver.Result, error) {
 	//u.Debugf("After qlb driver.Run() in Exec()")
 	if err != nil {
 		u.Errorf("error on Query.Run(): %v", err)
+		if ctxErr := contextErr(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
 		//resultWriter.ErrChan() <- err
 		//job.Close()
 	}
 	return resultWriter.Result(), nil
 }
 
+// QueryContext StmtQueryContext implementation, the query is stopped once
+// @ctx is done.
+func (m *qlbStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	vals, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return m.query(ctx, vals)
+}
+
 // Query executes a query that may return rows, such as a SELECT
 func (m *qlbStmt) Query(args []driver.Value) (driver.Rows, error) {
-	var err error
-	if len(args) > 0 {
-		m.query, err = queryArgsConvert(m.query, args)
-		if err != nil {
-			return nil, err
-		}
-	}
-	u.Debugf("query: %v", m.query)
+	return m.query(context.Background(), args)
+}
+
+func (m *qlbStmt) query(goCtx context.Context, args []driver.Value) (driver.Rows, error) {
+	u.Debugf("query: %v", m.prepared.Raw)
 
 	// Create a Job, which is Dag of Tasks that Run()
-	ctx := plan.NewContext(m.query)
-	ctx.Schema = m.conn.schema
-	job, err := BuildSqlJob(ctx)
+	ctx, job, err := m.bind(goCtx, args)
 	if err != nil {
 		u.Warnf("return error? %v", err)
 		return nil, err
@@ -247,15 +390,27 @@ func (m *qlbStmt) Query(args []driver.Value) (driver.Rows, error) {
 
 	// The only type of stmt that makes sense for Query is SELECT
 	//  and we need list of columns that requires casing
-	sqlSelect, ok := job.Ctx.Stmt.(*rel.SqlSelect)
-	if !ok {
+	var cols []string
+	switch st := job.Ctx.Stmt.(type) {
+	case *rel.SqlSelect:
+		cols = st.Columns.AliasedFieldNames()
+	case *rel.SqlSetOp:
+		// result columns are named by the first select
+		cols = st.First().Columns.AliasedFieldNames()
+	case *rel.SqlWith:
+		cols = st.First().Columns.AliasedFieldNames()
+	case *rel.SqlDescribe:
+		cols = plan.ExplainResultColumns(st)
+	default:
 		u.Warnf("ctx? %v", job.Ctx)
+		job.Close()
 		return nil, fmt.Errorf("We could not recognize that as a select query: %T", job.Ctx.Stmt)
 	}
 
 	// Prepare a result writer, we manually append this task to end
-	// of job?
-	resultWriter := NewResultRows(ctx, sqlSelect.Columns.AliasedFieldNames())
+	// of job?  It reads the context of this execution, the plan context
+	// of the job is re-used by the next one.
+	resultWriter := NewResultRows(ctx, cols)
 
 	job.RootTask.Add(resultWriter)
 
@@ -265,7 +420,7 @@ func (m *qlbStmt) Query(args []driver.Value) (driver.Rows, error) {
 	// how to open in go-routine and still be able to send error to rows?
 	go func() {
 		//u.Debugf("Start Job.Run")
-		err = job.Run()
+		err := job.Run()
 		//u.Debugf("After job.Run()")
 		if err != nil {
 			u.Errorf("error on Query.Run(): %v", err)
@@ -279,42 +434,38 @@ func (m *qlbStmt) Query(args []driver.Value) (driver.Rows, error) {
 	return resultWriter, nil
 }
 
-// driver.ColumnConverter Interface implementation.
-//
-// ColumnConverter may be optionally implemented by driver.Stmt if the
-// statement is aware of its own columns' types and can convert from
-// any type to a driver Value.
-//
-// ColumnConverter returns a ValueConverter for the provided
-// column index.  If the type of a specific column isn't known
-// or shouldn't be handled specially, DefaultValueConverter
-// can be returned.
-func (conn *qlbStmt) ColumnConverter(idx int) driver.ValueConverter { return nil }
-
-// driver.Rows Interface implementation.
-//
-// Rows is an iterator over an executed query's results.
-type qlbRows struct{}
-
-// Columns returns the names of the columns. The number of
-// columns of the result is inferred from the length of the
-// slice.  If a particular column name isn't known, an empty
-// string should be returned for that entry.
-func (conn *qlbRows) Columns() []string { return nil }
-
-// Close closes the rows iterator.
-func (conn *qlbRows) Close() error { return expr.ErrNotImplemented }
+// bind the arguments to the placeholders of the prepared statement, the
+// job of this execution of it in go context @goCtx.  The plan of the
+// statement is cached, each execution runs it again with its own
+// connections to the sources, see PreparedJob.
+func (m *qlbStmt) bind(goCtx context.Context, args []driver.Value) (*plan.Context, *JobExecutor, error) {
+	vals := make([]value.Value, len(args))
+	for i, arg := range args {
+		if by, ok := arg.([]byte); ok {
+			arg = string(by)
+		}
+		vals[i] = value.NewValue(arg)
+	}
+	ctx := m.newContext(goCtx)
+	job, err := m.prepared.BuildSqlJob(ctx, vals)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ctx, job, nil
+}
 
-// Next is called to populate the next row of data into
-// the provided slice. The provided slice will be the same
-// size as the Columns() are wide.
-//
-// The dest slice may be populated only with
-// a driver Value type, but excluding string.
-// All string values must be converted to []byte.
-//
-// Next should return io.EOF when there are no more rows.
-func (conn *qlbRows) Next(dest []driver.Value) error { return expr.ErrNotImplemented }
+// newContext the plan context of an execution of the statement, with the
+// session of its connection and go context @goCtx.
+func (m *qlbStmt) newContext(goCtx context.Context) *plan.Context {
+	ctx := plan.NewContext(m.prepared.Raw)
+	ctx.Context = goCtx
+	ctx.Schema = m.conn.schema
+	ctx.Session = m.conn.session
+	if tx := m.conn.tx; tx != nil && !tx.Done() {
+		ctx.Tx = tx
+	}
+	return ctx
+}
 
 // driver.Result Interface implementation.
 //
@@ -334,109 +485,15 @@ func (r *qlbResult) LastInsertId() (int64, error) { return r.lastId, r.err }
 // query.
 func (r *qlbResult) RowsAffected() (int64, error) { return r.affected, r.err }
 
-func join(a []string) string {
-	n := 0
-	for _, s := range a {
-		n += len(s)
-	}
-	b := make([]byte, n)
-	n = 0
-	for _, s := range a {
-		n += copy(b[n:], s)
-	}
-	return string(b)
-}
-
-func queryArgsConvert(query string, args []driver.Value) (string, error) {
-	if len(args) == 0 {
-		return query, nil
-	}
-	// a tiny, tiny, tiny bit of string sanitization
-	if strings.ContainsAny(query, `'"`) {
-		return "", nil
-	}
-	q := make([]string, 2*len(args)+1)
-	n := 0
-	for _, a := range args {
-		i := strings.IndexRune(query, '?')
-		if i == -1 {
-			return "", errors.New("number of parameters doesn't match number of placeholders")
-		}
-		var s string
-		switch v := a.(type) {
-		case nil:
-			s = "NULL"
-		case string:
-			s = "'" + escapeString(v) + "'"
-		case []byte:
-			s = "'" + escapeString(string(v)) + "'"
-		case int64:
-			s = strconv.FormatInt(v, 10)
-		case time.Time:
-			s = "'" + v.Format(MysqlTimeFormat) + "'"
-		case bool:
-			if v {
-				s = "1"
-			} else {
-				s = "0"
-			}
-		case float64:
-			s = strconv.FormatFloat(v, 'e', 12, 64)
-		default:
-			panic(fmt.Sprintf("%v (%T) can't be handled by godrv", v, v))
-		}
-		q[n] = query[:i]
-		q[n+1] = s
-		query = query[i+1:]
-		n += 2
-	}
-	q[n] = query
-	return join(q), nil
-}
-
-func escapeString(txt string) string {
-	var (
-		esc string
-		buf bytes.Buffer
-	)
-	last := 0
-	for ii, bb := range txt {
-		switch bb {
-		case 0:
-			esc = `\0`
-		case '\n':
-			esc = `\n`
-		case '\r':
-			esc = `\r`
-		case '\\':
-			esc = `\\`
-		case '\'':
-			esc = `\'`
-		case '"':
-			esc = `\"`
-		case '\032':
-			esc = `\Z`
-		default:
-			continue
-		}
-		io.WriteString(&buf, txt[last:ii])
-		io.WriteString(&buf, esc)
-		last = ii + 1
-	}
-	io.WriteString(&buf, txt[last:])
-	return buf.String()
-}
-
-func escapeQuotes(txt string) string {
-	var buf bytes.Buffer
-	last := 0
-	for ii, bb := range txt {
-		if bb == '\'' {
-			io.WriteString(&buf, txt[last:ii])
-			io.WriteString(&buf, `''`)
-			last = ii + 1
+// namedValues the values of positional arguments, named arguments are not
+// supported.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("named argument %q is not supported", arg.Name)
 		}
+		vals[i] = arg.Value
 	}
-	io.WriteString(&buf, txt[last:])
-	return buf.String()
+	return vals, nil
 }
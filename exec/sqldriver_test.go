@@ -1,7 +1,18 @@
 package exec_test
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -9,6 +20,13 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/datasource/memdb"
+	"github.com/lytics/qlbridge/datasource/mockcsv"
+	td "github.com/lytics/qlbridge/datasource/mockcsvtestdata"
+	"github.com/lytics/qlbridge/exec"
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
 )
 
 type user struct {
@@ -207,6 +225,671 @@ func TestSqlCsvDriverJoinWithWhere2(t *testing.T) {
 	assert.True(t, uo1.Price == 22.5, "? %#v", uo1)
 }
 
+func TestSqlCsvDriverOuterJoin(t *testing.T) {
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	type outerRow struct {
+		UserId sql.NullString
+		ItemId sql.NullString
+		Email  sql.NullString
+	}
+	joinRows := func(sqlText string) []outerRow {
+		rows, err := db.Query(sqlText)
+		assert.True(t, err == nil, "no error: %v", err)
+		defer rows.Close()
+		out := make([]outerRow, 0)
+		for rows.Next() {
+			var r outerRow
+			err = rows.Scan(&r.UserId, &r.ItemId, &r.Email)
+			assert.True(t, err == nil, "no error: %v", err)
+			out = append(out, r)
+		}
+		assert.True(t, rows.Err() == nil, "no error: %v", rows.Err())
+		return out
+	}
+	countNull := func(rows []outerRow) (users, items int) {
+		for _, r := range rows {
+			if !r.UserId.Valid {
+				users++
+			}
+			if !r.ItemId.Valid {
+				items++
+			}
+		}
+		return
+	}
+
+	// users has 3 rows, one of which has 2 orders, orders has one
+	// row whose user does not exist
+	rows := joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		LEFT JOIN orders AS o
+			ON u.user_id = o.user_id;`)
+	assert.True(t, len(rows) == 4, "want 4 rows: %+v", rows)
+	nullUsers, nullItems := countNull(rows)
+	assert.True(t, nullUsers == 0 && nullItems == 2, "want 2 un-matched users: %+v", rows)
+
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		RIGHT OUTER JOIN orders AS o
+			ON u.user_id = o.user_id;`)
+	assert.True(t, len(rows) == 3, "want 3 rows: %+v", rows)
+	nullUsers, nullItems = countNull(rows)
+	assert.True(t, nullUsers == 1 && nullItems == 0, "want 1 un-matched order: %+v", rows)
+
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		FULL OUTER JOIN orders AS o
+			ON u.user_id = o.user_id;`)
+	assert.True(t, len(rows) == 5, "want 5 rows: %+v", rows)
+	nullUsers, nullItems = countNull(rows)
+	assert.True(t, nullUsers == 1 && nullItems == 2, "want un-matched from both sides: %+v", rows)
+
+	// where on the outer side removes the NULL filled rows
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		LEFT JOIN orders AS o
+			ON u.user_id = o.user_id
+		WHERE o.price > 10;`)
+	assert.True(t, len(rows) == 2, "want 2 rows: %+v", rows)
+
+	// a where on the null-supplying side is evaluated after the join, not
+	// pushed down into its source
+	userIds := func(rows []outerRow) []string {
+		ids := make([]string, 0, len(rows))
+		for _, r := range rows {
+			ids = append(ids, r.UserId.String)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		LEFT JOIN orders AS o
+			ON u.user_id = o.user_id
+		WHERE o.item_id IS NULL;`)
+	assert.Equal(t, []string{"hT2impsOPUREcVPc", "hT2impsabc345c"}, userIds(rows), "users without orders")
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		LEFT JOIN orders AS o
+			ON u.user_id = o.user_id
+		WHERE o.price > 30;`)
+	assert.Equal(t, []string{"9Ip1aKbeZe2njCDM"}, userIds(rows))
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		LEFT JOIN orders AS o
+			ON u.user_id = o.user_id
+		WHERE u.referral_count < 50;`)
+	assert.Equal(t, []string{"hT2impsOPUREcVPc", "hT2impsabc345c"}, userIds(rows))
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		RIGHT JOIN orders AS o
+			ON u.user_id = o.user_id
+		WHERE u.email IS NULL;`)
+	assert.True(t, len(rows) == 1 && !rows[0].UserId.Valid && rows[0].ItemId.String == "1", "orders without users: %+v", rows)
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		RIGHT JOIN orders AS o
+			ON u.user_id = o.user_id
+		WHERE u.referral_count > 50;`)
+	assert.Equal(t, []string{"9Ip1aKbeZe2njCDM", "9Ip1aKbeZe2njCDM"}, userIds(rows))
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		FULL OUTER JOIN orders AS o
+			ON u.user_id = o.user_id
+		WHERE o.item_id IS NULL;`)
+	assert.Equal(t, []string{"hT2impsOPUREcVPc", "hT2impsabc345c"}, userIds(rows))
+
+	// ON conditions other than the join key decide which rows match, a
+	// row of the outer side that matches none of them is still NULL filled
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		INNER JOIN orders AS o
+			ON u.user_id = o.user_id AND o.price > 30;`)
+	assert.True(t, len(rows) == 1 && rows[0].ItemId.String == "2", "only the 37.50 order: %+v", rows)
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		LEFT JOIN orders AS o
+			ON u.user_id = o.user_id AND o.price > 30;`)
+	assert.Equal(t, []string{"9Ip1aKbeZe2njCDM", "hT2impsOPUREcVPc", "hT2impsabc345c"}, userIds(rows))
+	for _, r := range rows {
+		if r.UserId.String == "9Ip1aKbeZe2njCDM" {
+			assert.Equal(t, "2", r.ItemId.String)
+		} else {
+			assert.False(t, r.ItemId.Valid, "no order over 30 for %v", r.UserId.String)
+		}
+	}
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		LEFT JOIN orders AS o
+			ON u.user_id = o.user_id AND u.referral_count < 50;`)
+	users, items := countNull(rows)
+	assert.Equal(t, 3, len(rows), "%+v", rows)
+	assert.Equal(t, 0, users)
+	assert.Equal(t, 3, items, "only users with referral_count < 50 get orders, none have any")
+	rows = joinRows(`
+		SELECT u.user_id, o.item_id, u.email
+		FROM users AS u
+		RIGHT JOIN orders AS o
+			ON u.user_id = o.user_id AND o.price > 30;`)
+	users, items = countNull(rows)
+	assert.Equal(t, 3, len(rows), "%+v", rows)
+	assert.Equal(t, 2, users, "the 22.50 orders have no user")
+	assert.Equal(t, 0, items)
+
+	explain, err := db.Query(`EXPLAIN SELECT u.user_id, o.item_id FROM users AS u
+		LEFT JOIN orders AS o ON u.user_id = o.user_id AND o.price > 30`)
+	assert.True(t, err == nil, "no error: %v", err)
+	details := make([]string, 0)
+	for explain.Next() {
+		var id, parent int64
+		var task string
+		var detail sql.NullString
+		var parallel bool
+		assert.Equal(t, nil, explain.Scan(&id, &parent, &task, &parallel, &detail))
+		details = append(details, detail.String)
+	}
+	explain.Close()
+	assert.True(t, len(details) > 1, "%v", details)
+	assert.Equal(t, "type=left, on=u.user_id = o.user_id, filter=o.price > 30", details[1])
+}
+
+func TestSqlCsvDriverJoinSeek(t *testing.T) {
+
+	// users is keyed by user_id so is looked up per order
+	// instead of being scanned
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	for _, tc := range []struct {
+		sql   string
+		rows  int
+		nulls int
+	}{
+		{`SELECT o.order_id, u.user_id, u.email FROM orders AS o
+			INNER JOIN users AS u ON o.user_id = u.user_id`, 2, 0},
+		{`SELECT o.order_id, u.user_id, u.email FROM orders AS o
+			LEFT JOIN users AS u ON o.user_id = u.user_id`, 3, 1},
+		{`SELECT o.order_id, u.user_id, u.email FROM orders AS o
+			INNER JOIN users AS u ON o.user_id = u.user_id AND u.referral_count < 50`, 0, 0},
+		{`SELECT o.order_id, u.user_id, u.email FROM orders AS o
+			LEFT JOIN users AS u ON o.user_id = u.user_id AND u.referral_count < 50`, 3, 3},
+	} {
+		rows, err := db.Query(tc.sql)
+		assert.True(t, err == nil, "no error: %v", err)
+		ct, nullUsers := 0, 0
+		for rows.Next() {
+			var orderId, userId, email sql.NullString
+			err = rows.Scan(&orderId, &userId, &email)
+			assert.True(t, err == nil, "no error: %v", err)
+			if !userId.Valid {
+				nullUsers++
+			} else {
+				assert.Equal(t, "aaron@email.com", email.String)
+			}
+			ct++
+		}
+		rows.Close()
+		assert.True(t, ct == tc.rows, "want %d rows got %d for %s", tc.rows, ct, tc.sql)
+		assert.True(t, nullUsers == tc.nulls, "want un-matched orders %d got %d", tc.nulls, nullUsers)
+	}
+}
+
+func TestSqlCsvDriverJoinSeekKeyTypes(t *testing.T) {
+
+	// csv values are strings, the inserted item has an int key, the join
+	// keys are coerced to the int item_id of the seeked items
+	mockcsv.LoadTable(mockcsv.SchemaName, "seekitems", `item_id,name
+1,apple
+2,orange`)
+	mockcsv.LoadTable(mockcsv.SchemaName, "seekorders", `order_id,item_ref
+100,1
+101,3
+102,x`)
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO seekitems (item_id, name) VALUES (3, "pear")`)
+	assert.True(t, err == nil, "no error: %v", err)
+
+	rows, err := db.Query(`SELECT o.order_id, i.name FROM seekorders AS o
+		INNER JOIN seekitems AS i ON o.item_ref = i.item_id`)
+	assert.True(t, err == nil, "no error: %v", err)
+	defer rows.Close()
+	names := make(map[string]string)
+	for rows.Next() {
+		var orderId, name string
+		assert.Equal(t, nil, rows.Scan(&orderId, &name))
+		names[orderId] = name
+	}
+	assert.Equal(t, nil, rows.Err())
+	assert.Equal(t, map[string]string{"100": "apple", "101": "pear"}, names)
+}
+
+func TestSqlCsvDriverJoinMulti(t *testing.T) {
+
+	mockcsv.LoadTable(mockcsv.SchemaName, "items", `item_id,name
+1,apple
+2,orange
+4,pear`)
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	for _, tc := range []struct {
+		sql  string
+		rows int
+	}{
+		{`SELECT u.email, o.order_id, i.name FROM users AS u
+			INNER JOIN orders AS o ON u.user_id = o.user_id
+			INNER JOIN items AS i ON o.item_id = i.item_id`, 2},
+		// users joins on orders, not the adjacent items
+		{`SELECT u.email, o.order_id, i.name FROM orders AS o
+			INNER JOIN items AS i ON o.item_id = i.item_id
+			INNER JOIN users AS u ON o.user_id = u.user_id`, 2},
+		{`SELECT u.email, o.order_id, i.name FROM users AS u
+			INNER JOIN orders AS o ON u.user_id = o.user_id
+			INNER JOIN items AS i ON o.item_id = i.item_id
+			WHERE i.name = "orange"`, 1},
+		{`SELECT u.email, o.order_id, i.name FROM orders AS o
+			LEFT JOIN users AS u ON o.user_id = u.user_id
+			LEFT JOIN items AS i ON o.item_id = i.item_id`, 3},
+	} {
+		rows, err := db.Query(tc.sql)
+		assert.True(t, err == nil, "no error: %v", err)
+		ct := 0
+		for rows.Next() {
+			var email, orderId, name sql.NullString
+			err = rows.Scan(&email, &orderId, &name)
+			assert.True(t, err == nil, "no error: %v", err)
+			assert.True(t, orderId.Valid && name.Valid, "want order and item: %v %v", orderId, name)
+			if email.Valid {
+				assert.Equal(t, "aaron@email.com", email.String)
+				switch orderId.String {
+				case "1":
+					assert.Equal(t, "apple", name.String)
+				case "2":
+					assert.Equal(t, "orange", name.String)
+				}
+			}
+			ct++
+		}
+		rows.Close()
+		assert.True(t, ct == tc.rows, "want %d rows got %d for %s", tc.rows, ct, tc.sql)
+	}
+}
+
+func TestSqlCsvDriverSetOp(t *testing.T) {
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	queryIds := func(sqlText string) []string {
+		rows, err := db.Query(sqlText)
+		assert.True(t, err == nil, "no error: %v", err)
+		cols, err := rows.Columns()
+		assert.True(t, err == nil, "no error: %v", err)
+		assert.Equal(t, 1, len(cols))
+		ids := make([]string, 0)
+		for rows.Next() {
+			var id string
+			err = rows.Scan(&id)
+			assert.True(t, err == nil, "no error: %v", err)
+			ids = append(ids, id)
+		}
+		rows.Close()
+		return ids
+	}
+
+	for _, tc := range []struct {
+		sql  string
+		rows int
+	}{
+		{`SELECT user_id FROM users UNION SELECT user_id FROM orders`, 4},
+		{`SELECT user_id FROM users UNION ALL SELECT user_id FROM orders`, 6},
+		{`SELECT user_id FROM users INTERSECT SELECT user_id FROM orders`, 1},
+		{`SELECT user_id FROM orders INTERSECT ALL SELECT user_id FROM orders`, 3},
+		{`SELECT user_id FROM orders EXCEPT SELECT user_id FROM users`, 1},
+		{`SELECT user_id FROM orders EXCEPT ALL SELECT user_id FROM users`, 2},
+		{`SELECT user_id FROM users EXCEPT SELECT user_id FROM orders
+			UNION SELECT user_id FROM orders WHERE price > 30`, 3},
+		// values of different types are different rows
+		{`SELECT 1 UNION SELECT 1`, 1},
+		{`SELECT 1 UNION SELECT "1"`, 2},
+		{`SELECT 1 INTERSECT SELECT "1"`, 0},
+		{`SELECT 1 EXCEPT SELECT "1"`, 1},
+	} {
+		ids := queryIds(tc.sql)
+		assert.True(t, len(ids) == tc.rows, "want %d rows got %v for %s", tc.rows, ids, tc.sql)
+	}
+
+	ids := queryIds(`SELECT user_id FROM users UNION SELECT user_id FROM orders
+		ORDER BY user_id DESC LIMIT 2`)
+	assert.Equal(t, []string{"hT2impsabc345c", "hT2impsOPUREcVPc"}, ids)
+
+	// columns are named by the first select
+	rows, err := db.Query(`SELECT email FROM users UNION ALL SELECT item_id FROM orders`)
+	assert.True(t, err == nil, "no error: %v", err)
+	cols, _ := rows.Columns()
+	assert.Equal(t, []string{"email"}, cols)
+	rows.Close()
+
+	_, err = db.Query(`SELECT email, user_id FROM users UNION SELECT item_id FROM orders`)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSqlCsvDriverWindow(t *testing.T) {
+
+	mockcsv.LoadTable(mockcsv.SchemaName, "events", `event_id,user_id,event,amount
+1,a,open,10
+2,a,click,20
+3,b,open,5
+4,a,close,30
+5,b,click,5
+6,b,close,40`)
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	query := func(sqlText string) [][]string {
+		rows, err := db.Query(sqlText)
+		assert.True(t, err == nil, "no error: %v  %s", err, sqlText)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		cols, _ := rows.Columns()
+		out := make([][]string, 0)
+		for rows.Next() {
+			vals := make([]sql.NullString, len(cols))
+			dest := make([]any, len(cols))
+			for i := range vals {
+				dest[i] = &vals[i]
+			}
+			err = rows.Scan(dest...)
+			assert.True(t, err == nil, "no error: %v", err)
+			row := make([]string, len(cols))
+			for i, v := range vals {
+				row[i] = v.String
+			}
+			out = append(out, row)
+		}
+		return out
+	}
+
+	// previous and next event of each user
+	rows := query(`SELECT event_id, lag(event) OVER (PARTITION BY user_id ORDER BY event_id) AS prev,
+			lead(event, 1, "none") OVER (PARTITION BY user_id ORDER BY event_id) AS next
+		FROM events ORDER BY event_id ASC`)
+	assert.Equal(t, [][]string{
+		{"1", "", "click"},
+		{"2", "open", "close"},
+		{"3", "", "click"},
+		{"4", "click", "none"},
+		{"5", "open", "close"},
+		{"6", "click", "none"},
+	}, rows)
+
+	rows = query(`SELECT event_id,
+			row_number() OVER (ORDER BY amount) AS rn,
+			rank() OVER (ORDER BY amount) AS r,
+			dense_rank() OVER (ORDER BY amount) AS dr
+		FROM events ORDER BY event_id ASC`)
+	assert.Equal(t, [][]string{
+		{"1", "3", "3", "2"},
+		{"2", "4", "4", "3"},
+		{"3", "1", "1", "1"},
+		{"4", "5", "5", "4"},
+		{"5", "2", "1", "1"},
+		{"6", "6", "6", "5"},
+	}, rows)
+
+	// running, sliding and whole partition aggregates
+	rows = query(`SELECT event_id,
+			sum(amount) OVER (PARTITION BY user_id ORDER BY event_id) AS running,
+			sum(amount) OVER (PARTITION BY user_id ORDER BY event_id ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) AS sliding,
+			count(amount) OVER (PARTITION BY user_id) AS ct,
+			avg(amount) OVER (PARTITION BY user_id ORDER BY event_id ROWS BETWEEN CURRENT ROW AND 1 FOLLOWING) AS nextavg
+		FROM events WHERE event_id < 6 ORDER BY event_id ASC`)
+	assert.Equal(t, [][]string{
+		{"1", "10", "10", "3", "15"},
+		{"2", "30", "30", "3", "25"},
+		{"3", "5", "5", "2", "5"},
+		{"4", "60", "50", "3", "30"},
+		{"5", "10", "10", "2", "5"},
+	}, rows)
+
+	// ORDER BY the window column alias
+	rows = query(`SELECT event_id, row_number() OVER (ORDER BY event_id DESC) AS rn
+		FROM events ORDER BY rn ASC LIMIT 2`)
+	assert.Equal(t, [][]string{{"6", "1"}, {"5", "2"}}, rows)
+
+	_, err = db.Query(`SELECT user_id, row_number() OVER () FROM events GROUP BY user_id`)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSqlCsvDriverAggregates(t *testing.T) {
+
+	mockcsv.LoadTable(mockcsv.SchemaName, "sales", `sale_id,region,rep,amount
+1,east,ann,10
+2,east,bob,20
+3,east,ann,30
+4,east,ann,40
+5,west,cat,5
+6,west,cat,
+7,west,dan,15`)
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	query := func(sqlText string) map[string][]string {
+		rows, err := db.Query(sqlText)
+		assert.True(t, err == nil, "no error: %v  %s", err, sqlText)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		cols, _ := rows.Columns()
+		out := make(map[string][]string)
+		for rows.Next() {
+			vals := make([]sql.NullString, len(cols))
+			dest := make([]any, len(cols))
+			for i := range vals {
+				dest[i] = &vals[i]
+			}
+			err = rows.Scan(dest...)
+			assert.True(t, err == nil, "no error: %v", err)
+			row := make([]string, len(cols)-1)
+			for i, v := range vals[1:] {
+				row[i] = v.String
+			}
+			out[vals[0].String] = row
+		}
+		return out
+	}
+
+	rows := query(`SELECT region, min(amount), max(amount), count(DISTINCT rep), approx_count_distinct(rep)
+		FROM sales GROUP BY region`)
+	assert.Equal(t, map[string][]string{
+		"east": {"10", "40", "2", "2"},
+		"west": {"5", "15", "2", "2"},
+	}, rows)
+
+	rows = query(`SELECT region, var_pop(amount), stddev_pop(amount), variance(amount), median(amount), percentile(amount, 0.9)
+		FROM sales GROUP BY region`)
+	assert.Equal(t, map[string][]string{
+		"east": {"125", "11.180339887498949", "166.66666666666666", "25", "37"},
+		"west": {"25", "5", "50", "10", "14"},
+	}, rows)
+
+	rows = query(`SELECT region, sum(DISTINCT amount), count(DISTINCT amount), string_agg(DISTINCT rep, "|")
+		FROM sales WHERE sale_id != 3 GROUP BY region`)
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, []string{"70", "3"}, rows["east"][:2])
+	assert.Equal(t, []string{"20", "2"}, rows["west"][:2])
+
+	// values are in the order found
+	rows = query(`SELECT rep, string_agg(sale_id, "|") FROM sales WHERE region = "east" GROUP BY rep`)
+	assert.Equal(t, 2, len(rows))
+	ids := strings.Split(rows["ann"][0], "|")
+	sort.Strings(ids)
+	assert.Equal(t, []string{"1", "3", "4"}, ids)
+	assert.Equal(t, "2", rows["bob"][0])
+
+	var amounts any
+	err = db.QueryRow(`SELECT array_agg(amount) FROM sales WHERE rep = "bob"`).Scan(&amounts)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"20"}, amounts)
+
+	// aggregates over a window frame
+	rows = query(`SELECT sale_id, max(amount) OVER (PARTITION BY region ORDER BY sale_id) AS high,
+			count(DISTINCT rep) OVER (PARTITION BY region) AS reps
+		FROM sales WHERE region = "east"`)
+	assert.Equal(t, map[string][]string{
+		"1": {"10", "2"},
+		"2": {"20", "2"},
+		"3": {"30", "2"},
+		"4": {"40", "2"},
+	}, rows)
+
+	_, err = db.Query(`SELECT region, tolower(DISTINCT rep) FROM sales`)
+	assert.NotEqual(t, nil, err)
+	_, err = db.Query(`SELECT region, percentile(amount, 2) FROM sales GROUP BY region`)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSqlCsvDriverOrderBy(t *testing.T) {
+
+	mockcsv.LoadTable(mockcsv.SchemaName, "scores", `score_id,player,points,played
+1,ann,9,2017-01-05
+2,bob,10,2017-01-03
+3,cat,,2017-01-04
+4,dan,100,
+5,eve,9,2017-01-01`)
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	query := func(sqlText string) []string {
+		rows, err := db.Query(sqlText)
+		assert.True(t, err == nil, "no error: %v  %s", err, sqlText)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		out := make([]string, 0)
+		for rows.Next() {
+			var player string
+			err = rows.Scan(&player)
+			assert.True(t, err == nil, "no error: %v", err)
+			out = append(out, player)
+		}
+		return out
+	}
+
+	// numbers sort by value not lexically, ties keep their input order
+	// and no direction is ascending with NULL first
+	assert.Equal(t, []string{"cat", "ann", "eve", "bob", "dan"},
+		query(`SELECT player FROM scores ORDER BY points, score_id`))
+	assert.Equal(t, []string{"dan", "bob", "ann", "eve", "cat"},
+		query(`SELECT player FROM scores ORDER BY points DESC, score_id ASC`))
+	assert.Equal(t, []string{"ann", "eve", "bob", "dan", "cat"},
+		query(`SELECT player FROM scores ORDER BY points ASC NULLS LAST, score_id`))
+	assert.Equal(t, []string{"cat", "dan", "bob", "eve", "ann"},
+		query(`SELECT player FROM scores ORDER BY points DESC NULLS FIRST, score_id DESC`))
+	assert.Equal(t, []string{"eve", "bob", "cat", "ann", "dan"},
+		query(`SELECT player FROM scores ORDER BY todate(played) NULLS LAST`))
+	assert.Equal(t, []string{"ann", "bob"},
+		query(`SELECT player FROM scores ORDER BY score_id LIMIT 2`))
+}
+
+func TestSqlCsvDriverPaging(t *testing.T) {
+
+	mockcsv.LoadTable(mockcsv.SchemaName, "pages", `page_id,title,views,published
+1,home,10,2017-01-01
+2,about,30,2017-01-02
+3,blog,20,2017-01-02
+4,jobs,30,2017-01-04
+5,news,50,2017-01-05
+6,docs,20,2017-01-06`)
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	query := func(sqlText string) []string {
+		rows, err := db.Query(sqlText)
+		assert.True(t, err == nil, "no error: %v  %s", err, sqlText)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		out := make([]string, 0)
+		for rows.Next() {
+			var title string
+			err = rows.Scan(&title)
+			assert.True(t, err == nil, "no error: %v", err)
+			out = append(out, title)
+		}
+		return out
+	}
+
+	// offset after ordering, a Top-N of limit + offset rows
+	assert.Equal(t, []string{"blog", "docs", "about"},
+		query(`SELECT title FROM pages ORDER BY views, page_id LIMIT 3 OFFSET 1`))
+	assert.Equal(t, []string{"jobs", "news"},
+		query(`SELECT title FROM pages ORDER BY views, page_id LIMIT 10 OFFSET 4`))
+	assert.Equal(t, []string{"news", "docs"},
+		query(`SELECT title FROM pages WHERE views >= 20 ORDER BY page_id LIMIT 2 OFFSET 3`))
+	assert.Equal(t, []string{"docs"},
+		query(`SELECT title FROM pages WHERE views = 20 UNION SELECT title FROM pages WHERE views = 10
+			ORDER BY title LIMIT 1 OFFSET 1`))
+	assert.Equal(t, 0, len(query(`SELECT title FROM pages ORDER BY page_id LIMIT 2 OFFSET 6`)))
+
+	// offset pushed down to the source is the same as skipping in the projection
+	all := query(`SELECT title FROM pages`)
+	assert.Equal(t, 6, len(all))
+	assert.Equal(t, all[2:4], query(`SELECT title FROM pages LIMIT 2 OFFSET 2`))
+	assert.Equal(t, all[5:], query(`SELECT title FROM pages LIMIT 2 OFFSET 5`))
+
+	// keyset pagination, each page starts after the order by values of the
+	// last row of the previous one
+	assert.Equal(t, []string{"about", "jobs"},
+		query(`SELECT title FROM pages ORDER BY views DESC, page_id LIMIT 2 WITH cursor='[50, 5]'`))
+	assert.Equal(t, []string{"blog", "docs"},
+		query(`SELECT title FROM pages ORDER BY views DESC, page_id LIMIT 2 WITH cursor='[30, 4]'`))
+	assert.Equal(t, []string{"home"},
+		query(`SELECT title FROM pages ORDER BY views DESC, page_id LIMIT 2 WITH cursor='[20, 6]'`))
+	assert.Equal(t, []string{"jobs", "news"},
+		query(`SELECT title FROM pages ORDER BY todate(published), page_id LIMIT 2 WITH cursor='["2017-01-02", 3]'`))
+	assert.Equal(t, []string{"blog", "jobs"},
+		query(`SELECT title FROM pages ORDER BY page_id LIMIT 2 WITH cursor=2`))
+}
+
 func TestSqlCsvDriverSubQuery(t *testing.T) {
 	// Sub-Query
 	sqlText := `
@@ -287,6 +970,595 @@ func TestSqlCsvDriverSubQuery(t *testing.T) {
 	// `
 }
 
+func TestSqlCsvDriverWhereSubQuery(t *testing.T) {
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	queryIds := func(sqlText string) []string {
+		rows, err := db.Query(sqlText)
+		assert.True(t, err == nil, "no error: %v  %s", err, sqlText)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		ids := make([]string, 0)
+		for rows.Next() {
+			var id string
+			err = rows.Scan(&id)
+			assert.True(t, err == nil, "no error: %v", err)
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	for _, tc := range []struct {
+		sql string
+		ids []string
+	}{
+		// un-correlated IN, NOT IN
+		{`SELECT user_id FROM users WHERE user_id IN (SELECT user_id FROM orders)`,
+			[]string{"9Ip1aKbeZe2njCDM"}},
+		{`SELECT user_id FROM users WHERE user_id NOT IN (SELECT user_id FROM orders)`,
+			[]string{"hT2impsOPUREcVPc", "hT2impsabc345c"}},
+		{`SELECT user_id FROM users WHERE user_id IN (SELECT user_id FROM orders WHERE price > 30)
+			AND email IS NOT NULL`,
+			[]string{"9Ip1aKbeZe2njCDM"}},
+		// IN inside of an OR is run before filtering
+		{`SELECT user_id FROM users WHERE email = "not_an_email_2"
+			OR user_id IN (SELECT user_id FROM orders)`,
+			[]string{"9Ip1aKbeZe2njCDM", "hT2impsabc345c"}},
+		// the sub query has a NULL, so NOT IN is NULL not true for the
+		// user_id's not found and only the other side of the OR matches
+		{`SELECT user_id FROM users
+			WHERE user_id NOT IN (SELECT CASE WHEN price > 30 THEN NULL ELSE user_id END FROM orders)
+			OR email = "bob@email.com"`,
+			[]string{"hT2impsOPUREcVPc"}},
+		{`SELECT user_id FROM users
+			WHERE user_id IN (SELECT CASE WHEN price > 30 THEN NULL ELSE user_id END FROM orders)
+			OR email = "bob@email.com"`,
+			[]string{"9Ip1aKbeZe2njCDM", "hT2impsOPUREcVPc"}},
+		// EXISTS
+		{`SELECT user_id FROM users WHERE EXISTS (SELECT order_id FROM orders WHERE price > 100)`,
+			[]string{}},
+		{`SELECT user_id FROM users AS u
+			WHERE EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id = u.user_id)`,
+			[]string{"9Ip1aKbeZe2njCDM"}},
+		{`SELECT user_id FROM users AS u
+			WHERE NOT EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id = u.user_id AND o.price > 30)`,
+			[]string{"hT2impsOPUREcVPc", "hT2impsabc345c"}},
+		// correlated IN
+		{`SELECT user_id FROM users AS u
+			WHERE "2" IN (SELECT item_id FROM orders AS o WHERE o.user_id = u.user_id)`,
+			[]string{"9Ip1aKbeZe2njCDM"}},
+		// scalar
+		{`SELECT order_id FROM orders WHERE price > (SELECT avg(price) FROM orders)`,
+			[]string{"2"}},
+		{`SELECT order_id FROM orders WHERE price > (SELECT price FROM orders WHERE price > 100)`,
+			[]string{}},
+	} {
+		ids := queryIds(tc.sql)
+		assert.Equal(t, tc.ids, ids, tc.sql)
+	}
+
+	// correlated sub query in an OR
+	_, err = db.Query(`SELECT user_id FROM users AS u WHERE email = "bob@email.com"
+		OR EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id = u.user_id)`)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSqlCsvDriverWith(t *testing.T) {
+
+	mockcsv.LoadTable(mockcsv.SchemaName, "employees", `emp_id,name,manager_id
+1,ceo,0
+2,cto,1
+3,cfo,1
+4,dev1,2
+5,dev2,2
+6,intern,4`)
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	// rows of two columns as "a:b", sorted
+	queryRows := func(sqlText string) []string {
+		rows, err := db.Query(sqlText)
+		assert.True(t, err == nil, "no error: %v  %s", err, sqlText)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		out := make([]string, 0)
+		for rows.Next() {
+			var a, b string
+			err = rows.Scan(&a, &b)
+			assert.True(t, err == nil, "no error: %v", err)
+			out = append(out, a+":"+b)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	for _, tc := range []struct {
+		sql  string
+		rows []string
+	}{
+		{`WITH big AS (SELECT user_id, price FROM orders WHERE price > 30)
+			SELECT user_id, price FROM big`,
+			[]string{"9Ip1aKbeZe2njCDM:37.50"}},
+		// joined with a table, and read by a later expression
+		{`WITH big AS (SELECT user_id, order_id FROM orders WHERE price > 30),
+				emails (id, addr) AS (SELECT u.user_id, u.email FROM users AS u
+					INNER JOIN big AS b ON u.user_id = b.user_id)
+			SELECT id, addr FROM emails`,
+			[]string{"9Ip1aKbeZe2njCDM:aaron@email.com"}},
+		{`WITH one AS (SELECT 1 AS a, 2 AS b) SELECT a, b FROM one`,
+			[]string{"1:2"}},
+		// org chart, depth of each employee under the ceo
+		{`WITH RECURSIVE org (id, name, depth) AS (
+				SELECT emp_id, name, 0 FROM employees WHERE manager_id = 0
+				UNION ALL
+				SELECT e.emp_id, e.name, o.depth + 1
+				FROM employees AS e INNER JOIN org AS o ON e.manager_id = o.id
+			)
+			SELECT name, depth FROM org`,
+			[]string{"ceo:0", "cfo:1", "cto:1", "dev1:2", "dev2:2", "intern:3"}},
+		// everyone reporting to the cto
+		{`WITH RECURSIVE reports AS (
+				SELECT emp_id, name FROM employees WHERE name = "cto"
+				UNION
+				SELECT e.emp_id, e.name FROM employees AS e
+				INNER JOIN reports AS r ON e.manager_id = r.emp_id
+			)
+			SELECT emp_id, name FROM reports WHERE name != "cto"`,
+			[]string{"4:dev1", "5:dev2", "6:intern"}},
+		{`WITH RECURSIVE n (i, sq) AS (SELECT 1, 1 UNION ALL SELECT i + 1, sq + 2 * i + 1 FROM n WHERE i < 4)
+			SELECT i, sq FROM n`,
+			[]string{"1:1", "2:4", "3:9", "4:16"}},
+	} {
+		rows := queryRows(tc.sql)
+		assert.Equal(t, tc.rows, rows, tc.sql)
+	}
+
+	for _, sqlText := range []string{
+		// reads itself without RECURSIVE
+		`WITH n AS (SELECT 1 AS i UNION ALL SELECT i + 1 FROM n WHERE i < 3) SELECT i FROM n`,
+		// anchor reads itself
+		`WITH RECURSIVE n AS (SELECT i FROM n UNION ALL SELECT 1 AS i) SELECT i FROM n`,
+		// named columns don't match
+		`WITH big (a, b) AS (SELECT user_id FROM orders) SELECT a FROM big`,
+	} {
+		_, err = db.Query(sqlText)
+		assert.NotEqual(t, nil, err, sqlText)
+	}
+
+	// a common table expression failing as it runs ends the rows of the
+	// statement with its error
+	defer func(max int) { exec.CteMaxRecursion = max }(exec.CteMaxRecursion)
+	exec.CteMaxRecursion = 10
+	done := make(chan error, 1)
+	go func() {
+		rows, err := db.Query(`WITH RECURSIVE n AS (SELECT 1 AS i UNION ALL SELECT i + 1 FROM n)
+			SELECT i FROM n`)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		done <- rows.Err()
+	}()
+	select {
+	case err = <-done:
+		assert.NotEqual(t, nil, err)
+		if err != nil {
+			assert.Contains(t, err.Error(), "did not finish after 10 iterations")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("rows of a failed common table expression did not end")
+	}
+}
+
+func TestSqlCsvDriverExplain(t *testing.T) {
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	rows, err := db.Query(`EXPLAIN SELECT u.user_id, o.item_id
+		FROM users AS u LEFT JOIN orders AS o ON u.user_id = o.user_id
+		WHERE u.referral_count > 1 AND o.price > 1`)
+	assert.True(t, err == nil, "no error: %v", err)
+	cols, err := rows.Columns()
+	assert.True(t, err == nil, "no error: %v", err)
+	assert.Equal(t, []string{"id", "parent_id", "task", "parallel", "detail"}, cols)
+
+	tasks := make([]string, 0)
+	details := make([]string, 0)
+	parents := make(map[int64]int64)
+	for rows.Next() {
+		var id, parent int64
+		var task string
+		var detail sql.NullString // NULL for tasks without details
+		var parallel bool
+		err = rows.Scan(&id, &parent, &task, &parallel, &detail)
+		assert.True(t, err == nil, "no error: %v", err)
+		tasks = append(tasks, task)
+		details = append(details, detail.String)
+		parents[id] = parent
+		if task == "JoinMerge" {
+			assert.True(t, parallel, "sides of a join run in parallel")
+		}
+	}
+	rows.Close()
+	assert.Equal(t, []string{"Select", "JoinMerge", "Source", "Where", "Projection", "Source",
+		"Projection", "Where", "Projection"}, tasks)
+	assert.Equal(t, "type=left, on=u.user_id = o.user_id", details[1])
+	// the where on referral_count is pushed into the users source query, the
+	// one on price of the outer joined orders only runs on the joined rows
+	assert.True(t, strings.Contains(details[2], "WHERE referral_count > 1"), details[2])
+	assert.False(t, strings.Contains(details[5], "WHERE"), details[5])
+	assert.Equal(t, int64(0), parents[1])
+	assert.Equal(t, int64(2), parents[3])
+	assert.Equal(t, int64(3), parents[4])
+
+	rows, err = db.Query(`EXPLAIN FORMAT=JSON SELECT user_id, count(*) FROM orders GROUP BY user_id`)
+	assert.True(t, err == nil, "no error: %v", err)
+	cols, _ = rows.Columns()
+	assert.Equal(t, []string{"explain"}, cols)
+	assert.True(t, rows.Next())
+	var doc string
+	assert.Equal(t, nil, rows.Scan(&doc))
+	assert.False(t, rows.Next())
+	rows.Close()
+	node := &plan.ExplainNode{}
+	assert.Equal(t, nil, json.Unmarshal([]byte(doc), node))
+	assert.Equal(t, "Select", node.Task)
+	assert.Equal(t, 2, len(node.Children), doc)
+	assert.Equal(t, "GroupBy", node.Children[1].Task)
+	assert.Equal(t, "by=user_id", node.Children[1].Detail)
+
+	rows, err = db.Query(`EXPLAIN ANALYZE SELECT user_id, price FROM orders WHERE price > 30`)
+	assert.True(t, err == nil, "no error: %v", err)
+	cols, _ = rows.Columns()
+	assert.Equal(t, []string{"id", "parent_id", "task", "rows_in", "rows_out", "bytes", "wall_ms", "blocked_ms"}, cols)
+	found := make(map[string][2]int64)
+	for rows.Next() {
+		var id, parent, rowsIn, rowsOut, bytes int64
+		var task string
+		var wall, blocked float64
+		err = rows.Scan(&id, &parent, &task, &rowsIn, &rowsOut, &bytes, &wall, &blocked)
+		assert.True(t, err == nil, "no error: %v", err)
+		if rowsIn > 0 || rowsOut > 0 {
+			found[task] = [2]int64{rowsIn, rowsOut}
+		}
+	}
+	rows.Close()
+	// the statement ran, the where kept 1 of the 3 orders
+	assert.Equal(t, [2]int64{3, 3}, found["Source"], "%v", found)
+	assert.Equal(t, [2]int64{1, 1}, found["Projection"], "%v", found)
+}
+
+func TestSqlCsvDriverPrepared(t *testing.T) {
+
+	mockcsv.LoadTable(mockcsv.SchemaName, "bookmarks", `bookmark_id,user_id,url,visits
+1,9Ip1aKbeZe2njCDM,"a.com",3`)
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	queryIds := func(stmt *sql.Stmt, args ...any) []string {
+		rows, err := stmt.Query(args...)
+		assert.True(t, err == nil, "no error: %v  %v", err, args)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		ids := make([]string, 0)
+		for rows.Next() {
+			var id string
+			err = rows.Scan(&id)
+			assert.True(t, err == nil, "no error: %v", err)
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// each statement is parsed once, and re-bound per execution
+	for _, tc := range []struct {
+		sql  string
+		runs [][]any
+		ids  [][]string
+	}{
+		{`SELECT order_id FROM orders WHERE price > ? AND item_id = ?`,
+			[][]any{{20, "1"}, {30, "2"}, {30, "1"}},
+			[][]string{{"1", "3"}, {"2"}, {}}},
+		{`SELECT order_id FROM orders WHERE order_id IN ($2, $1) AND price < $3`,
+			[][]any{{"1", "2", 100}, {"3", "2", 30}},
+			[][]string{{"1", "2"}, {"3"}}},
+		{`SELECT o.order_id FROM users AS u INNER JOIN orders AS o
+			ON u.user_id = o.user_id WHERE o.price > ?`,
+			[][]any{{20}, {30}},
+			[][]string{{"1", "2"}, {"2"}}},
+		{`SELECT user_id FROM users WHERE user_id IN (SELECT user_id FROM orders WHERE price > ?)`,
+			[][]any{{30}, {100}},
+			[][]string{{"9Ip1aKbeZe2njCDM"}, {}}},
+		{`SELECT user_id FROM orders WHERE price > ? GROUP BY user_id`,
+			[][]any{{20}, {30}},
+			[][]string{{"9Ip1aKbeZe2njCDM", "abcabcabc"}, {"9Ip1aKbeZe2njCDM"}}},
+		// arguments are values, never sql
+		{`SELECT user_id FROM users WHERE email = ?`,
+			[][]any{{"aaron@email.com"}, {`bob@email.com' OR 'a' = 'a`}, {nil}, {[]byte("bob@email.com")}},
+			[][]string{{"9Ip1aKbeZe2njCDM"}, {}, {}, {"hT2impsOPUREcVPc"}}},
+		// the plan depends on the LIMIT and OFFSET bound
+		{`SELECT order_id FROM orders WHERE price > ? ORDER BY order_id LIMIT ? OFFSET ?`,
+			[][]any{{20, 2, 0}, {20, 2, 1}, {20, 1, 2}, {30, 5, 0}},
+			[][]string{{"1", "2"}, {"2", "3"}, {"3"}, {"2"}}},
+		{`SELECT order_id FROM orders ORDER BY order_id LIMIT ?, ?`,
+			[][]any{{1, 1}, {0, 2}},
+			[][]string{{"2"}, {"1", "2"}}},
+		{`SELECT order_id FROM orders WHERE item_id = ? UNION ALL
+			SELECT order_id FROM orders WHERE item_id = ? ORDER BY order_id LIMIT ?`,
+			[][]any{{"1", "2", 2}, {"2", "1", 3}},
+			[][]string{{"1", "2"}, {"1", "2", "3"}}},
+	} {
+		stmt, err := db.Prepare(tc.sql)
+		assert.True(t, err == nil, "no error: %v  %s", err, tc.sql)
+		if err != nil {
+			continue
+		}
+		for i, args := range tc.runs {
+			assert.Equal(t, tc.ids[i], queryIds(stmt, args...), "%s %v", tc.sql, args)
+		}
+		stmt.Close()
+	}
+
+	stmt, err := db.Prepare(`SELECT user_id FROM users WHERE email = ?`)
+	assert.Equal(t, nil, err)
+	_, err = stmt.Query()
+	assert.NotEqual(t, nil, err, "missing argument")
+	_, err = stmt.Query("a", "b")
+	assert.NotEqual(t, nil, err, "extra argument")
+	stmt.Close()
+
+	stmt, err = db.Prepare(`SELECT user_id FROM users LIMIT ?`)
+	assert.Equal(t, nil, err)
+	_, err = stmt.Query(-1)
+	assert.NotEqual(t, nil, err, "negative limit")
+	_, err = stmt.Query("ten")
+	assert.NotEqual(t, nil, err, "limit not an integer")
+	stmt.Close()
+
+	_, err = db.Prepare(`SELECT user_id FROM users WHERE email = ? OR user_id = $1`)
+	assert.NotEqual(t, nil, err, "can not mix placeholders")
+
+	// placeholders of writes
+	ins, err := db.Prepare(`INSERT INTO bookmarks (bookmark_id, user_id, url, visits) VALUES (?, ?, ?, ?)`)
+	assert.Equal(t, nil, err)
+	_, err = ins.Exec(2, "hT2impsOPUREcVPc", "b.com", 5)
+	assert.Equal(t, nil, err)
+	_, err = ins.Exec(3, "hT2impsOPUREcVPc", "it's.com", 8)
+	assert.Equal(t, nil, err)
+	ins.Close()
+
+	upd, err := db.Prepare(`UPDATE bookmarks SET visits = ? WHERE bookmark_id = ?`)
+	assert.Equal(t, nil, err)
+	_, err = upd.Exec(1, 3)
+	assert.Equal(t, nil, err)
+	upd.Close()
+
+	stmt, err = db.Prepare(`SELECT url FROM bookmarks WHERE visits >= ?`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"a.com", "b.com"}, queryIds(stmt, 3))
+	assert.Equal(t, []string{"b.com"}, queryIds(stmt, 4))
+	stmt.Close()
+
+	stmt, err = db.Prepare(`SELECT url FROM bookmarks WHERE bookmark_id = ?`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"it's.com"}, queryIds(stmt, 3))
+	stmt.Close()
+
+	// executing the statement again does not change the rows of an
+	// earlier execution still being read
+	conn, err := db.Conn(context.Background())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	stmt, err = conn.PrepareContext(context.Background(), `SELECT url FROM bookmarks WHERE visits >= ?`)
+	assert.Equal(t, nil, err)
+	rows, err := stmt.Query(4)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"a.com", "b.com"}, queryIds(stmt, 3))
+	urls := make([]string, 0)
+	for rows.Next() {
+		var url string
+		assert.Equal(t, nil, rows.Scan(&url))
+		urls = append(urls, url)
+	}
+	rows.Close()
+	assert.Equal(t, []string{"b.com"}, urls)
+	stmt.Close()
+}
+
+func TestSqlDriverColumnTypes(t *testing.T) {
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT user_id, referral_count, reg_date FROM users WHERE referral_count > ?`, 50)
+	assert.Equal(t, nil, err)
+	cts, err := rows.ColumnTypes()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(cts))
+	names := make([]string, 0, len(cts))
+	for _, ct := range cts {
+		names = append(names, ct.Name())
+	}
+	assert.Equal(t, []string{"user_id", "referral_count", "reg_date"}, names)
+	assert.Equal(t, reflect.TypeOf(sql.NullString{}), cts[0].ScanType())
+	assert.Equal(t, "VARCHAR", cts[0].DatabaseTypeName())
+	assert.Equal(t, reflect.TypeOf(sql.NullInt64{}), cts[1].ScanType())
+	assert.Equal(t, "BIGINT", cts[1].DatabaseTypeName())
+	assert.Equal(t, reflect.TypeOf(sql.NullTime{}), cts[2].ScanType())
+	assert.Equal(t, "DATETIME", cts[2].DatabaseTypeName())
+
+	// scanning into values of the scan types, as ORMs do
+	ct := 0
+	for rows.Next() {
+		dest := make([]any, len(cts))
+		for i, ct := range cts {
+			dest[i] = reflect.New(ct.ScanType()).Interface()
+		}
+		assert.Equal(t, nil, rows.Scan(dest...))
+		assert.Equal(t, "9Ip1aKbeZe2njCDM", dest[0].(*sql.NullString).String)
+		assert.Equal(t, int64(82), dest[1].(*sql.NullInt64).Int64)
+		assert.Equal(t, 2012, dest[2].(*sql.NullTime).Time.Year())
+		ct++
+	}
+	assert.Equal(t, nil, rows.Err())
+	assert.Equal(t, 1, ct)
+	rows.Close()
+
+	// expressions other than counts are not typed
+	rows, err = db.Query(`SELECT user_id, count(*) AS ct, yymm(reg_date) AS ym FROM users GROUP BY user_id`)
+	assert.Equal(t, nil, err)
+	cts, err = rows.ColumnTypes()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"VARCHAR", "BIGINT", ""},
+		[]string{cts[0].DatabaseTypeName(), cts[1].DatabaseTypeName(), cts[2].DatabaseTypeName()})
+	rows.Close()
+
+	// un-typed columns scan into any
+	rows, err = db.Query(`EXPLAIN SELECT user_id FROM users`)
+	assert.Equal(t, nil, err)
+	cts, err = rows.ColumnTypes()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "id", cts[0].Name())
+	assert.Equal(t, reflect.TypeOf((*any)(nil)).Elem(), cts[0].ScanType())
+	assert.Equal(t, "", cts[0].DatabaseTypeName())
+	rows.Close()
+}
+
+func TestSqlDriverConn(t *testing.T) {
+
+	db, err := sql.Open("qlbridge", "mockcsv")
+	assert.True(t, err == nil, "no error: %v", err)
+	defer db.Close()
+	bg := context.Background()
+
+	assert.Equal(t, nil, db.PingContext(bg))
+
+	queryId := func(rows *sql.Rows, err error) string {
+		assert.Equal(t, nil, err)
+		if err != nil {
+			return ""
+		}
+		defer rows.Close()
+		id := ""
+		for rows.Next() {
+			assert.Equal(t, nil, rows.Scan(&id))
+		}
+		return id
+	}
+
+	// prepared with a context, queried with another
+	stmt, err := db.PrepareContext(bg, `SELECT user_id FROM users WHERE email = ?`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hT2impsOPUREcVPc", queryId(stmt.QueryContext(bg, "bob@email.com")))
+	// value.Value arguments are bound as they are
+	assert.Equal(t, "9Ip1aKbeZe2njCDM", queryId(stmt.QueryContext(bg, value.NewStringValue("aaron@email.com"))))
+	ctx, cancel := context.WithCancel(bg)
+	cancel()
+	_, err = stmt.QueryContext(ctx, "bob@email.com")
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	stmt.Close()
+
+	_, err = db.PrepareContext(ctx, `SELECT user_id FROM users`)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+
+	// named arguments are not supported, as placeholders are ? or $1
+	_, err = db.QueryContext(bg, `SELECT user_id FROM users WHERE email = ?`, sql.Named("email", "bob@email.com"))
+	assert.NotEqual(t, nil, err)
+	_, err = db.QueryContext(bg, `SELECT user_id FROM users WHERE email = ?`, struct{}{})
+	assert.NotEqual(t, nil, err, "unsupported argument type")
+
+	_, err = db.BeginTx(bg, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSqlDriverDsn(t *testing.T) {
+
+	dir := t.TempDir()
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "Users.csv"),
+		[]byte("user_id;name;age\n1;bob;42\n2;ana;23\n3;eve;31\n"), 0644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "events.json"),
+		[]byte(`{"user_id":"1","event":"login","ct":3}`+"\n"+`{"user_id":"2","event":"logout","ct":5}`+"\n"), 0644))
+
+	names := func(db *sql.DB, sql string, args ...any) []string {
+		rows, err := db.Query(sql, args...)
+		assert.True(t, err == nil, "no error: %v", err)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		var vals []string
+		for rows.Next() {
+			var v string
+			assert.Equal(t, nil, rows.Scan(&v))
+			vals = append(vals, v)
+		}
+		assert.Equal(t, nil, rows.Err())
+		return vals
+	}
+
+	dsn := "csv://" + dir + "?delimiter=;"
+	db, err := sql.Open("qlbridge", dsn)
+	assert.Equal(t, nil, err)
+	defer db.Close()
+	assert.Equal(t, nil, db.Ping())
+	assert.Equal(t, []string{"users"}, names(db, "SHOW TABLES"))
+	assert.Equal(t, []string{"ana", "eve"}, names(db, "SELECT name FROM users WHERE age < ? ORDER BY name", 40))
+
+	// the column types are introspected from the file
+	rows, err := db.Query("SELECT user_id, age FROM users")
+	assert.Equal(t, nil, err)
+	cts, err := rows.ColumnTypes()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "BIGINT", cts[1].DatabaseTypeName())
+	rows.Close()
+
+	// the schema is created once and shared by opens of same dsn
+	db2, err := sql.Open("qlbridge", dsn)
+	assert.Equal(t, nil, err)
+	defer db2.Close()
+	assert.Equal(t, []string{"bob"}, names(db2, "SELECT name FROM users WHERE user_id = 1"))
+
+	db3, err := sql.Open("qlbridge", "json://"+dir)
+	assert.Equal(t, nil, err)
+	defer db3.Close()
+	assert.Equal(t, []string{"events"}, names(db3, "SHOW TABLES"))
+	assert.Equal(t, []string{"logout"}, names(db3, "SELECT event FROM events WHERE ct > 4"))
+
+	// a single file
+	db4, err := sql.Open("qlbridge", "csv://"+filepath.Join(dir, "Users.csv")+"?delimiter=;")
+	assert.Equal(t, nil, err)
+	defer db4.Close()
+	assert.Equal(t, []string{"3"}, names(db4, "SELECT count(*) FROM users"))
+
+	for _, bad := range []string{"nosuchsource:///tmp", "csv://" + filepath.Join(dir, "missing")} {
+		db, err := sql.Open("qlbridge", bad)
+		assert.Equal(t, nil, err)
+		assert.NotEqual(t, nil, db.Ping(), bad)
+		db.Close()
+	}
+}
+
 func TestSqlDbConnFailure(t *testing.T) {
 	// Where Statement on join on column (o.item_count) that isn't in query
 	sqlText := `
@@ -366,3 +1638,184 @@ func TestSqlDbConnFailure(t *testing.T) {
 	assert.True(t, uo1.Price == 22.5, "? %#v", uo1)
 	rows2.Close()
 }
+
+// slowSource a source of table "slow" whose scans block until their conn is
+// closed, to test that queries are stopped.
+type slowSource struct {
+	closes atomic.Int64 // number of conns closed
+}
+
+type slowConn struct {
+	src  *slowSource
+	exit chan bool
+	once sync.Once
+}
+
+func (m *slowSource) Init()                      {}
+func (m *slowSource) Setup(*schema.Schema) error { return nil }
+func (m *slowSource) Close() error               { return nil }
+func (m *slowSource) Tables() []string           { return []string{"slow"} }
+func (m *slowSource) Table(table string) (*schema.Table, error) {
+	if table != "slow" {
+		return nil, schema.ErrNotFound
+	}
+	tbl := schema.NewTable("slow")
+	tbl.AddField(schema.NewFieldBase("id", value.IntType, 64, "id"))
+	tbl.SetColumnsFromFields()
+	return tbl, nil
+}
+func (m *slowSource) Open(table string) (schema.Conn, error) {
+	return &slowConn{src: m, exit: make(chan bool)}, nil
+}
+func (m *slowConn) Columns() []string { return []string{"id"} }
+func (m *slowConn) Next() schema.Message {
+	<-m.exit
+	return nil
+}
+func (m *slowConn) Close() error {
+	m.once.Do(func() {
+		close(m.exit)
+		m.src.closes.Add(1)
+	})
+	return nil
+}
+
+func TestSqlDriverTimeout(t *testing.T) {
+	src := &slowSource{}
+	err := schema.RegisterSourceAsSchema("slowdb", src)
+	assert.Equal(t, nil, err)
+
+	db, err := sql.Open("qlbridge", "slowdb")
+	assert.Equal(t, nil, err)
+	defer db.Close()
+
+	scan := func(rows *sql.Rows, err error) error {
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return rows.Err()
+	}
+	bg := context.Background()
+
+	// deadline of the go context
+	ctx, cancel := context.WithTimeout(bg, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = scan(db.QueryContext(ctx, "SELECT id FROM slow WHERE id > 1"))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	// the source conn is closed
+	assert.Eventually(t, func() bool { return src.closes.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// canceled
+	ctx, cancel = context.WithCancel(bg)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = scan(db.QueryContext(ctx, "SELECT id FROM slow"))
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.Eventually(t, func() bool { return src.closes.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// max_execution_time of the session of the connection
+	conn, err := db.Conn(bg)
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(bg, "SET max_execution_time = 50")
+	assert.Equal(t, nil, err)
+	err = scan(conn.QueryContext(bg, "SELECT id FROM slow"))
+	var te *exec.QueryTimeoutError
+	assert.True(t, errors.As(err, &te), "%T %v", err, err)
+	if te != nil {
+		assert.Equal(t, 50*time.Millisecond, te.MaxExecutionTime)
+		assert.True(t, te.Timeout())
+	}
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.Eventually(t, func() bool { return src.closes.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	// a query which finishes in time ends without error
+	var one int64
+	assert.Equal(t, nil, conn.QueryRowContext(bg, "SELECT 1").Scan(&one))
+	assert.Equal(t, int64(1), one)
+
+	// the deadline is released once the job ran, even if not closed
+	pctx := td.TestContext("SELECT 1")
+	pctx.Session = datasource.NewContextSimpleNative(map[string]any{"max_execution_time": int64(50)})
+	job, err := exec.BuildSqlJob(pctx)
+	assert.Equal(t, nil, err)
+	_, hasDeadline := pctx.Deadline()
+	assert.True(t, hasDeadline)
+	msgs := make([]schema.Message, 0)
+	assert.Equal(t, nil, job.RootTask.Add(exec.NewResultBuffer(pctx, &msgs)))
+	assert.Equal(t, nil, job.Setup())
+	assert.Equal(t, nil, job.Run())
+	assert.Equal(t, 1, len(msgs))
+	assert.NotEqual(t, nil, pctx.Err())
+}
+
+func TestSqlDriverTransaction(t *testing.T) {
+	src, err := memdb.NewMemDbData("accounts", [][]driver.Value{{int64(1), "bob"}}, []string{"id", "name"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, schema.RegisterSourceAsSchema("txdb", src))
+
+	db, err := sql.Open("qlbridge", "txdb")
+	assert.Equal(t, nil, err)
+	defer db.Close()
+
+	type queryer interface {
+		Query(query string, args ...any) (*sql.Rows, error)
+	}
+	names := func(q queryer) []string {
+		rows, err := q.Query("SELECT name FROM accounts")
+		assert.Equal(t, nil, err)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		var vals []string
+		for rows.Next() {
+			var v string
+			assert.Equal(t, nil, rows.Scan(&v))
+			vals = append(vals, v)
+		}
+		sort.Strings(vals)
+		return vals
+	}
+
+	// rolled back writes are discarded
+	tx, err := db.Begin()
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("INSERT INTO accounts (id, name) VALUES (2, 'ana')")
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("INSERT INTO accounts (id, name) VALUES (3, 'eve')")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"ana", "bob", "eve"}, names(tx))
+	assert.Equal(t, []string{"bob"}, names(db))
+	assert.Equal(t, nil, tx.Rollback())
+	assert.Equal(t, []string{"bob"}, names(db))
+
+	// committed with the COMMIT statement
+	tx, err = db.Begin()
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("INSERT INTO accounts (id, name) VALUES (4, 'max')")
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("COMMIT")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, tx.Commit())
+	assert.Equal(t, []string{"bob", "max"}, names(db))
+
+	// ROLLBACK statement
+	tx, err = db.Begin()
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("DELETE FROM accounts WHERE id = 1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"max"}, names(tx))
+	_, err = tx.Exec("ROLLBACK")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, tx.Rollback())
+	assert.Equal(t, []string{"bob", "max"}, names(db))
+
+	// outside of a transaction COMMIT does nothing, writes are applied
+	_, err = db.Exec("COMMIT")
+	assert.Equal(t, nil, err)
+}
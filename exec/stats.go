@@ -0,0 +1,151 @@
+package exec
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lytics/qlbridge/schema"
+)
+
+// TaskStats runtime statistics of a task and its children, see CollectStats
+type TaskStats struct {
+	Task     string        `json:"task"`
+	RowsIn   int64         `json:"rows_in"`
+	RowsOut  int64         `json:"rows_out"`
+	Bytes    int64         `json:"bytes"`      // approximate size of the values of rows out
+	Wall     time.Duration `json:"wall_ns"`    // time running
+	Blocked  time.Duration `json:"blocked_ns"` // time waiting on input and output channels
+	Children []*TaskStats  `json:"children,omitempty"`
+}
+
+// taskCounters are counted while a task runs, atomically as some tasks
+// (joins) read their inputs concurrently.
+type taskCounters struct {
+	rowsIn  atomic.Int64
+	rowsOut atomic.Int64
+	bytes   atomic.Int64
+	wall    atomic.Int64
+	blocked atomic.Int64
+}
+
+// statsRecorder a task which records runtime statistics
+type statsRecorder interface {
+	Stats() *TaskStats
+	setWall(d time.Duration)
+}
+
+// received records a message read from input after waiting since @start
+func (m *taskCounters) received(msg schema.Message, start time.Time) {
+	m.rowsIn.Add(messageRows(msg))
+	m.blocked.Add(int64(time.Since(start)))
+}
+
+// sent records a message sent to output after waiting since @start
+func (m *taskCounters) sent(msg schema.Message, start time.Time) {
+	m.rowsOut.Add(messageRows(msg))
+	m.bytes.Add(messageBytes(msg))
+	m.blocked.Add(int64(time.Since(start)))
+}
+
+// Stats the runtime statistics of this task, complete once Run has returned
+func (m *TaskBase) Stats() *TaskStats {
+	return &TaskStats{
+		Task:    m.Name,
+		RowsIn:  m.counters.rowsIn.Load(),
+		RowsOut: m.counters.rowsOut.Load(),
+		Bytes:   m.counters.bytes.Load(),
+		Wall:    time.Duration(m.counters.wall.Load()),
+		Blocked: time.Duration(m.counters.blocked.Load()),
+	}
+}
+func (m *TaskBase) setWall(d time.Duration) { m.counters.wall.Store(int64(d)) }
+
+// runTimed runs the task recording its wall time
+func runTimed(task TaskRunner) error {
+	start := time.Now()
+	err := task.Run()
+	if sr, ok := task.(statsRecorder); ok {
+		sr.setWall(time.Since(start))
+	}
+	return err
+}
+
+// CollectStats the runtime statistics of the task and its children, once
+// the task has run.
+func CollectStats(t Task) *TaskStats {
+	st := &TaskStats{}
+	if sr, ok := t.(statsRecorder); ok {
+		st = sr.Stats()
+	}
+	if st.Task == "" {
+		st.Task = strings.TrimPrefix(fmt.Sprintf("%T", t), "*exec.")
+	}
+	for _, c := range t.Children() {
+		st.Children = append(st.Children, CollectStats(c))
+	}
+	return st
+}
+
+// Rows flattens the stats depth first into rows of
+// plan.ExplainAnalyzeColumns, a parent_id of 0 is the root.
+func (m *TaskStats) Rows() [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	var walk func(st *TaskStats, parent int64)
+	walk = func(st *TaskStats, parent int64) {
+		id := int64(len(rows) + 1)
+		rows = append(rows, []driver.Value{id, parent, st.Task, st.RowsIn, st.RowsOut, st.Bytes,
+			durationMs(st.Wall), durationMs(st.Blocked)})
+		for _, c := range st.Children {
+			walk(c, id)
+		}
+	}
+	walk(m, 0)
+	return rows
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// messageRows number of rows of a message
+func messageRows(msg schema.Message) int64 {
+	switch mt := msg.(type) {
+	case nil:
+		return 0
+	case *MessageBatch:
+		return int64(mt.Len())
+	}
+	return 1
+}
+
+// messageBytes approximate size of the values of a message
+func messageBytes(msg schema.Message) int64 {
+	switch mt := msg.(type) {
+	case *MessageBatch:
+		n := int64(0)
+		for _, m := range mt.Msgs {
+			n += messageBytes(m)
+		}
+		return n
+	case schema.MessageValues:
+		n := int64(0)
+		for _, v := range mt.Values() {
+			switch vt := v.(type) {
+			case nil:
+			case string:
+				n += int64(len(vt))
+			case []byte:
+				n += int64(len(vt))
+			case bool:
+				n++
+			default:
+				n += 8
+			}
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,345 @@
+package exec
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	u "github.com/araddon/gou"
+
+	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/lex"
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
+	"github.com/lytics/qlbridge/vm"
+)
+
+var (
+	// Ensure that we implement the Task Runner interface
+	_ TaskRunner = (*SemiJoin)(nil)
+)
+
+// SemiJoin keeps the rows whose key is found (or for anti joins is not
+// found) in the rows of a sub query.  The sub query is run to completion
+// before reading the first row.
+//
+//	WHERE user_id IN (SELECT user_id FROM orders)
+//	WHERE NOT EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id = u.user_id)
+//
+// NULL never matches, a NOT IN whose sub query rows (for the key of a row)
+// include a NULL keeps no rows.
+type SemiJoin struct {
+	*TaskBase
+	p    *plan.SemiJoin
+	sub  Task
+	cols map[string]int
+}
+
+// semiGroup the sub query rows of one correlation key
+type semiGroup struct {
+	in      map[string]struct{} // values of IN
+	hasNull bool                // IN values include NULL
+}
+
+// NewSemiJoin create a semi join task from the tasks of its sub query
+func NewSemiJoin(ctx *plan.Context, sub Task, p *plan.SemiJoin) *SemiJoin {
+	return &SemiJoin{
+		TaskBase: NewTaskBase(ctx),
+		p:        p,
+		sub:      sub,
+		cols:     p.Stmt.ColIndexes(),
+	}
+}
+
+func (m *SemiJoin) Run() error {
+	rows, err := runSubQuery(m.Ctx, m.sub)
+	if err != nil {
+		close(m.msgOutCh)
+		return err
+	}
+
+	// rows are the value of IN (if any) followed by the correlation key
+	hasIn := m.p.In != nil
+	groups := make(map[string]*semiGroup)
+	for _, row := range rows {
+		var key []driver.Value
+		if len(m.p.Key) > 0 {
+			key = row[len(row)-len(m.p.Key):]
+		}
+		if hasNull(key) {
+			// can't be equal to any row
+			continue
+		}
+		g, ok := groups[matchKey(key)]
+		if !ok {
+			g = &semiGroup{in: make(map[string]struct{})}
+			groups[matchKey(key)] = g
+		}
+		switch {
+		case !hasIn:
+		case row[0] == nil:
+			g.hasNull = true
+		default:
+			g.in[matchKey(row[:1])] = struct{}{}
+		}
+	}
+
+	m.Handler = m.semiJoinFilter(groups)
+	return m.TaskBase.Run()
+}
+
+func (m *SemiJoin) semiJoinFilter(groups map[string]*semiGroup) MessageHandler {
+	return func(ctx *plan.Context, msg schema.Message) bool {
+
+		rdr, ok := msgReader(msg, m.cols)
+		if !ok {
+			u.Errorf("could not convert to message reader: %T", msg)
+			return false
+		}
+
+		var g *semiGroup
+		if key, ok := evalKey(rdr, m.p.Key); ok {
+			g = groups[matchKey(key)]
+		}
+
+		keep := g != nil
+		if m.p.In != nil {
+			keep = false
+			inVal, ok := vm.Eval(rdr, m.p.In)
+			isNull := !ok || inVal == nil || inVal.Nil()
+			switch {
+			case g == nil:
+				// NOT IN of no rows is true, even for NULL
+				keep = m.p.Anti
+			case isNull:
+				// NULL IN, NOT IN is NULL
+			default:
+				_, found := g.in[matchKey([]driver.Value{inVal.Value()})]
+				if m.p.Anti {
+					keep = !found && !g.hasNull
+				} else {
+					keep = found
+				}
+			}
+		} else if m.p.Anti {
+			keep = !keep
+		}
+		if !keep {
+			return true
+		}
+
+		return m.send(msg)
+	}
+}
+
+// evalKey the values of key expressions, false if any is NULL
+func evalKey(rdr expr.ContextReader, nodes []expr.Node) ([]driver.Value, bool) {
+	vals := make([]driver.Value, len(nodes))
+	for i, node := range nodes {
+		v, ok := vm.Eval(rdr, node)
+		if !ok || v == nil || v.Nil() {
+			return nil, false
+		}
+		vals[i] = v.Value()
+	}
+	return vals, true
+}
+
+func hasNull(vals []driver.Value) bool {
+	for _, v := range vals {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// msgReader a reader of the values of a message by column name
+func msgReader(msg schema.Message, cols map[string]int) (expr.ContextReader, bool) {
+	switch mt := msg.(type) {
+	case *datasource.SqlDriverMessage:
+		return mt.ToMsgMap(cols), true
+	case expr.ContextReader:
+		return mt, true
+	}
+	return nil, false
+}
+
+// runSubQuery runs the tasks of a sub query to completion, returning its rows
+func runSubQuery(ctx *plan.Context, task Task) ([][]driver.Value, error) {
+	runner, ok := task.(TaskRunner)
+	if !ok {
+		return nil, fmt.Errorf("Expected TaskRunner but was %T", task)
+	}
+	msgs := make([]schema.Message, 0)
+	if err := runner.Add(NewResultBuffer(ctx, &msgs)); err != nil {
+		return nil, err
+	}
+	if err := runner.Setup(0); err != nil {
+		return nil, err
+	}
+	err := runner.Run()
+	runner.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]driver.Value, 0, len(msgs))
+	for _, msg := range msgs {
+		switch mt := msg.(type) {
+		case nil:
+			// a sub query with a limit signals its end
+		case *datasource.SqlDriverMessageMap:
+			rows = append(rows, mt.Values())
+		default:
+			return nil, fmt.Errorf("To use a sub query must use SqlDriverMessageMap but got %T", msg)
+		}
+	}
+	return rows, nil
+}
+
+// subQueryResults copy of node with each of its sub queries replaced by
+// their result rows
+//
+//	x IN (SELECT ...)     values of the first column
+//	EXISTS (SELECT ...)   true if there are any rows
+//	x > (SELECT ...)      the value of the one row, NULL if none
+func subQueryResults(node expr.Node, results map[*expr.SubQueryNode][][]driver.Value) (expr.Node, error) {
+
+	args := func(nodes []expr.Node) ([]expr.Node, error) {
+		out := make([]expr.Node, len(nodes))
+		for i, arg := range nodes {
+			n, err := subQueryResults(arg, results)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = n
+		}
+		return out, nil
+	}
+
+	switch n := node.(type) {
+	case *expr.SubQueryNode:
+		rows, ok := results[n]
+		if !ok {
+			return nil, fmt.Errorf("sub query was not run: %s", n)
+		}
+		switch {
+		case len(rows) == 0:
+			return expr.NewNull(lex.Token{}), nil
+		case len(rows) > 1:
+			return nil, fmt.Errorf("sub query used as a value returned %d rows: %s", len(rows), n)
+		case len(rows[0]) != 1:
+			return nil, fmt.Errorf("sub query used as a value must select exactly one column: %s", n)
+		case rows[0][0] == nil:
+			return expr.NewNull(lex.Token{}), nil
+		}
+		return expr.NewValueNode(value.NewValue(rows[0][0])), nil
+	case *expr.UnaryNode:
+		if sq, ok := n.Arg.(*expr.SubQueryNode); ok && n.Operator.T == lex.TokenExists {
+			rows, ok := results[sq]
+			if !ok {
+				return nil, fmt.Errorf("sub query was not run: %s", sq)
+			}
+			return expr.NewValueNode(value.NewBoolValue(len(rows) > 0)), nil
+		}
+		arg, err := subQueryResults(n.Arg, results)
+		if err != nil {
+			return nil, err
+		}
+		return &expr.UnaryNode{Operator: n.Operator, Arg: arg}, nil
+	case *expr.BinaryNode:
+		if sq, ok := n.Args[1].(*expr.SubQueryNode); ok && n.Operator.T == lex.TokenIN {
+			rows, ok := results[sq]
+			if !ok {
+				return nil, fmt.Errorf("sub query was not run: %s", sq)
+			}
+			vals := make([]value.Value, 0, len(rows))
+			hasNull := false
+			for _, row := range rows {
+				switch {
+				case len(row) == 0:
+				case row[0] == nil:
+					hasNull = true
+				default:
+					vals = append(vals, value.NewValue(row[0]))
+				}
+			}
+			left, err := subQueryResults(n.Args[0], results)
+			if err != nil {
+				return nil, err
+			}
+			in := expr.NewBinaryNode(n.Operator, left, expr.NewValueNode(value.NewSliceValues(vals)))
+			if !hasNull {
+				return in, nil
+			}
+			// x IN (.., NULL) is NULL not false if x isn't found, so
+			// NOT IN is NULL as well, as the semi join does
+			cn := expr.NewCaseNode()
+			cn.Whens = []expr.Node{in}
+			cn.Thens = []expr.Node{expr.NewValueNode(value.NewBoolValue(true))}
+			return cn, nil
+		}
+		nargs, err := args(n.Args)
+		if err != nil {
+			return nil, err
+		}
+		bn := *n
+		bn.Args = nargs
+		return &bn, nil
+	case *expr.BooleanNode:
+		nargs, err := args(n.Args)
+		if err != nil {
+			return nil, err
+		}
+		bn := *n
+		bn.Args = nargs
+		return &bn, nil
+	case *expr.TriNode:
+		nargs, err := args(n.Args)
+		if err != nil {
+			return nil, err
+		}
+		tn := *n
+		tn.Args = nargs
+		return &tn, nil
+	case *expr.FuncNode:
+		nargs, err := args(n.Args)
+		if err != nil {
+			return nil, err
+		}
+		fn := *n
+		fn.Args = nargs
+		return &fn, nil
+	case *expr.ArrayNode:
+		nargs, err := args(n.Args)
+		if err != nil {
+			return nil, err
+		}
+		an := *n
+		an.Args = nargs
+		return &an, nil
+	case *expr.CaseNode:
+		cn := &expr.CaseNode{}
+		var err error
+		if n.Operand != nil {
+			if cn.Operand, err = subQueryResults(n.Operand, results); err != nil {
+				return nil, err
+			}
+		}
+		if cn.Whens, err = args(n.Whens); err != nil {
+			return nil, err
+		}
+		if cn.Thens, err = args(n.Thens); err != nil {
+			return nil, err
+		}
+		if n.Else != nil {
+			if cn.Else, err = subQueryResults(n.Else, results); err != nil {
+				return nil, err
+			}
+		}
+		return cn, nil
+	}
+	return node, nil
+}
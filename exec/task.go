@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	u "github.com/araddon/gou"
 
@@ -32,6 +33,10 @@ type TaskBase struct {
 	errCh    ErrChan
 	sigCh    SigChan // notify of quit/stop
 	errors   []error
+	// batchSize > 0 when downstream accepts MessageBatch, see Emit
+	batchSize int
+	pending   []schema.Message
+	counters  taskCounters
 }
 
 func NewTaskBase(ctx *plan.Context) *TaskBase {
@@ -95,7 +100,47 @@ func (m *TaskBase) Close() error {
 	close(m.sigCh)
 	return nil
 }
-func (m *TaskBase) CloseFinal() error { return nil }
+func (m *TaskBase) CloseFinal() error     { return nil }
+func (m *TaskBase) setBatchSize(size int) { m.batchSize = size }
+
+// Emit sends a message downstream.  If downstream accepts batches it is
+// buffered and sent as part of a MessageBatch, see Flush.  Returns false
+// if the task was signaled to quit.
+func (m *TaskBase) Emit(msg schema.Message) bool {
+	if m.batchSize <= 0 {
+		return m.send(msg)
+	}
+	m.pending = append(m.pending, msg)
+	if len(m.pending) >= m.batchSize {
+		return m.Flush()
+	}
+	return true
+}
+
+// Flush sends any messages buffered by Emit as a MessageBatch.
+func (m *TaskBase) Flush() bool {
+	if len(m.pending) == 0 {
+		return true
+	}
+	batch := NewMessageBatch(m.pending)
+	m.pending = make([]schema.Message, 0, m.batchSize)
+	return m.send(batch)
+}
+
+// send a message downstream, returns false if the task was signaled to quit
+// or the go context of the query is done.
+func (m *TaskBase) send(msg schema.Message) bool {
+	start := time.Now()
+	select {
+	case m.msgOutCh <- msg:
+		m.counters.sent(msg, start)
+		return true
+	case <-m.sigCh:
+		return false
+	case <-m.Ctx.Done():
+		return false
+	}
+}
 
 func MakeHandler(task TaskRunner) MessageHandler {
 	out := task.MessageOut()
@@ -140,17 +185,28 @@ msgLoop:
 		}
 
 		//
+		start := time.Now()
 		select {
 		case msg, ok = <-m.msgInCh:
+			m.counters.received(msg, start)
 			if ok {
 				//u.Debugf("sending to handler: %T  %+v", msg, msg)
-				m.Handler(m.Ctx, msg)
+				eachMessage(msg, func(msg schema.Message) {
+					m.Handler(m.Ctx, msg)
+				})
+				// don't hold buffered messages while upstream is idle
+				if len(m.msgInCh) == 0 {
+					m.Flush()
+				}
 			} else {
 				//u.Debugf("msg in closed shutting down")
+				m.Flush()
 				break msgLoop
 			}
 		case <-m.sigCh:
 			break msgLoop
+		case <-m.Ctx.Done(): // canceled or timed out, see JobExecutor.Run
+			break msgLoop
 		}
 	}
 
@@ -90,6 +90,7 @@ func (m *TaskSequential) Setup(depth int) error {
 	//u.Infof("%d  TaskSequential Setup  tasks len=%d", depth, len(m.tasks))
 	for i := 1; i < len(m.runners); i++ {
 		m.runners[i].MessageInSet(m.runners[i-1].MessageOut())
+		linkBatches(m.runners[i-1], m.runners[i])
 		//u.Infof("%d-%d setup msgin: %T  %p", depth, i, m.runners[i], m.runners[i].MessageIn())
 	}
 	if depth > 0 {
@@ -148,7 +149,7 @@ func (m *TaskSequential) Run() (err error) {
 		go func(taskId int) {
 			task := m.runners[taskId]
 			//u.Infof("starting task %d-%d %T in:%p  out:%p", m.depth, taskId, task, task.MessageIn(), task.MessageOut())
-			if taskErr := task.Run(); taskErr != nil {
+			if taskErr := runTimed(task); taskErr != nil {
 				u.Errorf("%T.Run() errored %v", task, taskErr)
 				// TODO:  what do we do with this error?   send to error channel?
 				err = taskErr
@@ -0,0 +1,101 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/value"
+)
+
+var (
+	// errJobDone the cause of the deadline of a job released once it ran,
+	// which is not an error of the query.
+	errJobDone = errors.New("job done")
+
+	// MaxExecutionTimeVars session variables of the max milliseconds a query
+	// may run, as mysql SET max_execution_time = 1000, 0 is unlimited.
+	MaxExecutionTimeVars = []string{"@@session.max_execution_time", "@@max_execution_time", "max_execution_time"}
+)
+
+// QueryTimeoutError a query was stopped as it ran past its deadline, either
+// the max_execution_time of the session or the deadline of the go context
+// of its plan.Context.  It matches context.DeadlineExceeded with errors.Is.
+type QueryTimeoutError struct {
+	// MaxExecutionTime of the session, 0 if the deadline was of the go context
+	MaxExecutionTime time.Duration
+}
+
+func (e *QueryTimeoutError) Error() string {
+	if e.MaxExecutionTime > 0 {
+		return fmt.Sprintf("QLBridge: Query execution was interrupted, max_execution_time of %v exceeded", e.MaxExecutionTime)
+	}
+	return "QLBridge: Query execution was interrupted, deadline exceeded"
+}
+
+// Timeout is true, as net.Error
+func (e *QueryTimeoutError) Timeout() bool { return true }
+func (e *QueryTimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// maxExecutionTime of the session of the context, 0 if unlimited
+func maxExecutionTime(ctx *plan.Context) time.Duration {
+	if ctx.Session == nil {
+		return 0
+	}
+	for _, name := range MaxExecutionTimeVars {
+		v, ok := ctx.Session.Get(name)
+		if !ok || v == nil || v.Nil() {
+			continue
+		}
+		if ms, ok := value.ValueToInt64(v); ok && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+		return 0
+	}
+	return 0
+}
+
+// withDeadline sets the go context of @ctx to time out after the
+// max_execution_time of its session, returning the func to release it.
+// Once released the context is done, but contextErr is nil.
+func withDeadline(ctx *plan.Context) context.CancelFunc {
+	if ctx.Context == nil {
+		ctx.Context = context.Background()
+	}
+	limit := maxExecutionTime(ctx)
+	if limit <= 0 {
+		return func() {}
+	}
+	parent, release := context.WithCancelCause(ctx.Context)
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithTimeoutCause(parent, limit, &QueryTimeoutError{MaxExecutionTime: limit})
+	return func() {
+		release(errJobDone)
+		cancel()
+	}
+}
+
+// contextErr the error of a query whose go context is done, nil if it is not.
+func contextErr(ctx *plan.Context) error {
+	if ctx == nil || ctx.Context == nil {
+		return nil
+	}
+	err := ctx.Err()
+	if err == nil {
+		return nil
+	}
+	cause := context.Cause(ctx)
+	if cause == errJobDone {
+		return nil
+	}
+	var te *QueryTimeoutError
+	if errors.As(cause, &te) {
+		return te
+	}
+	if err == context.DeadlineExceeded {
+		return &QueryTimeoutError{}
+	}
+	return err
+}
@@ -1,6 +1,8 @@
 package exec
 
 import (
+	"database/sql/driver"
+
 	u "github.com/araddon/gou"
 
 	"github.com/lytics/qlbridge/datasource"
@@ -15,8 +17,16 @@ import (
 // Where execution of A filter to implement where clause
 type Where struct {
 	*TaskBase
-	filter expr.Node
-	sel    *rel.SqlSelect
+	filter     expr.Node
+	sel        *rel.SqlSelect
+	cols       map[string]int
+	subQueries []*subQuery
+}
+
+// subQuery the tasks of an un-correlated sub query of the filter
+type subQuery struct {
+	p    *plan.SubQuery
+	task Task
 }
 
 // NewWhere create new Where Clause
@@ -26,14 +36,23 @@ func NewWhere(ctx *plan.Context, p *plan.Where) *Where {
 	if p.Final {
 		return NewWhereFinal(ctx, p)
 	}
-	return NewWhereFilter(ctx, p.Stmt)
+	s := NewWhereFilter(ctx, p.Stmt)
+	if p.Filter != nil {
+		s.filter = p.Filter
+		s.Handler = whereFilter(ctx, s.filter, s, s.cols)
+	}
+	return s
 }
 
 func NewWhereFinal(ctx *plan.Context, p *plan.Where) *Where {
+	filter := p.Filter
+	if filter == nil {
+		filter = p.Stmt.Where.Expr
+	}
 	s := &Where{
 		TaskBase: NewTaskBase(ctx),
 		sel:      p.Stmt,
-		filter:   p.Stmt.Where.Expr,
+		filter:   filter,
 	}
 	cols := make(map[string]int)
 
@@ -60,7 +79,8 @@ func NewWhereFinal(ctx *plan.Context, p *plan.Where) *Where {
 
 	//u.Debugf("found where columns: %d", len(cols))
 
-	s.Handler = whereFilter(s.filter, s, cols)
+	s.cols = cols
+	s.Handler = whereFilter(ctx, s.filter, s, cols)
 	return s
 }
 
@@ -69,26 +89,87 @@ func NewWhereFilter(ctx *plan.Context, sql *rel.SqlSelect) *Where {
 	s := &Where{
 		TaskBase: NewTaskBase(ctx),
 		filter:   sql.Where.Expr,
+		cols:     sql.ColIndexes(),
 	}
-	cols := sql.ColIndexes()
-	s.Handler = whereFilter(s.filter, s, cols)
+	s.Handler = whereFilter(ctx, s.filter, s, s.cols)
 	return s
 }
 
+// Run the sub queries of the filter before filtering any rows, each is
+// replaced in the filter by its results.
+func (m *Where) Run() error {
+	if len(m.subQueries) > 0 {
+		filter, err := m.resolveSubQueries()
+		if err != nil {
+			close(m.msgOutCh)
+			return err
+		}
+		m.Handler = whereFilter(m.Ctx, filter, m, m.cols)
+	}
+	return m.TaskBase.Run()
+}
+
+func (m *Where) resolveSubQueries() (expr.Node, error) {
+	results := make(map[*expr.SubQueryNode][][]driver.Value, len(m.subQueries))
+	for _, sq := range m.subQueries {
+		rows, err := runSubQuery(m.Ctx, sq.task)
+		if err != nil {
+			return nil, err
+		}
+		results[sq.p.Node] = rows
+	}
+	return subQueryResults(m.filter, results)
+}
+
 // NewHaving Filter
 func NewHaving(ctx *plan.Context, p *plan.Having) *Where {
 	s := &Where{
 		TaskBase: NewTaskBase(ctx),
 		filter:   p.Stmt.Having,
 	}
-	s.Handler = whereFilter(p.Stmt.Having, s, p.Stmt.ColIndexes())
+	s.Handler = whereFilter(ctx, p.Stmt.Having, s, p.Stmt.ColIndexes())
 	return s
 }
 
-func whereFilter(filter expr.Node, task TaskRunner, cols map[string]int) MessageHandler {
+// nullMode the NULL logic of expressions evaluated in @ctx
+func nullMode(ctx *plan.Context) vm.NullMode {
+	if ctx != nil && ctx.StrictNulls {
+		return vm.NullStrict
+	}
+	return vm.NullLenient
+}
+
+// ReceivesBatches the filter accepts MessageBatch input
+func (m *Where) ReceivesBatches() bool { return true }
+
+// emitter sends messages from @task downstream, batching them if the task
+// supports it.
+func emitter(task TaskRunner) func(msg schema.Message) bool {
+	if e, ok := task.(interface{ Emit(schema.Message) bool }); ok {
+		return e.Emit
+	}
 	out := task.MessageOut()
+	return func(msg schema.Message) bool {
+		select {
+		case out <- msg:
+			return true
+		case <-task.SigChan():
+			return false
+		}
+	}
+}
+
+func whereFilter(ctx *plan.Context, filter expr.Node, task TaskRunner, cols map[string]int) MessageHandler {
+	emit := emitter(task)
 
 	//u.Debugf("prepare filter %s", filter)
+	prog, err := vm.CompileMode(nullMode(ctx), filter)
+	if err != nil {
+		u.Errorf("could not compile filter %s: %v", filter, err)
+		return func(ctx *plan.Context, msg schema.Message) bool {
+			return false
+		}
+	}
 	return func(ctx *plan.Context, msg schema.Message) bool {
 
 		var filterValue value.Value
@@ -99,9 +180,9 @@ func whereFilter(filter expr.Node, task TaskRunner, cols map[string]int) Message
 			//u.Debugf("WHERE:  T:%T  vals:%#v", msg, mt.Vals)
 			//u.Debugf("cols:  %#v", cols)
 			msgReader := mt.ToMsgMap(cols)
-			filterValue, ok = vm.Eval(msgReader, filter)
+			filterValue, ok = prog.Eval(msgReader)
 		case *datasource.SqlDriverMessageMap:
-			filterValue, ok = vm.Eval(mt, filter)
+			filterValue, ok = prog.Eval(mt)
 			if !ok {
 				u.Warnf("wtf %s    %#v", filter, mt)
 			}
@@ -109,7 +190,7 @@ func whereFilter(filter expr.Node, task TaskRunner, cols map[string]int) Message
 			//u.Debugf("cols:  %#v", cols)
 		default:
 			if msgReader, isContextReader := msg.(expr.ContextReader); isContextReader {
-				filterValue, ok = vm.Eval(msgReader, filter)
+				filterValue, ok = prog.Eval(msgReader)
 				if !ok {
 					u.Warnf("wat? %v  filterval:%#v expr: %s", filter.String(), filterValue, filter)
 				}
@@ -138,11 +219,6 @@ func whereFilter(filter expr.Node, task TaskRunner, cols map[string]int) Message
 		}
 
 		//u.Debugf("about to send from where to forward: %#v", msg)
-		select {
-		case out <- msg:
-			return true
-		case <-task.SigChan():
-			return false
-		}
+		return emit(msg)
 	}
 }
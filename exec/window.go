@@ -0,0 +1,446 @@
+package exec
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/lex"
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/rel"
+	"github.com/lytics/qlbridge/value"
+	"github.com/lytics/qlbridge/vm"
+)
+
+var (
+	// Ensure that we implement the Task Runner interface
+	_ TaskRunner = (*Window)(nil)
+)
+
+// Window evaluates analytic function columns, which need all of the rows
+// of their window partition, not just the current row.
+//
+//	SELECT user_id, lag(event) OVER (PARTITION BY user_id ORDER BY ts) AS prev
+//
+// Supports ranking   row_number(), rank(), dense_rank()
+// offsets            lag(), lead()
+// and aggregates     sum(), avg(), count()  over a frame of the partition.
+//
+// Rows are held in memory, each is emitted with the value of each window
+// column appended (found by windowKey) for the final projection to use.
+type Window struct {
+	*TaskBase
+	p *plan.Window
+}
+
+// NewWindow create window function exec task
+func NewWindow(ctx *plan.Context, p *plan.Window) *Window {
+	return &Window{
+		TaskBase: NewTaskBase(ctx),
+		p:        p,
+	}
+}
+
+// windowKey is the column name the value of a window column is found by
+func windowKey(col *rel.Column) string {
+	return "$window." + strconv.Itoa(col.Index)
+}
+
+// windowRow a row and the values of its ORDER BY within one window
+type windowRow struct {
+	idx  int
+	keys []value.Value
+}
+
+func (m *Window) Run() error {
+	defer m.Ctx.Recover()
+	defer close(m.msgOutCh)
+
+	inCh := m.MessageIn()
+
+	colIndex := m.p.Stmt.ColIndexes()
+	cols := make(rel.Columns, 0)
+	for _, col := range m.p.Stmt.Columns {
+		if col.Over != nil {
+			cols = append(cols, col)
+		}
+	}
+
+	// are are going to hold entire row in memory while we are calculating
+	rows := make([]*datasource.SqlDriverMessageMap, 0)
+
+msgReadLoop:
+	for {
+		start := time.Now()
+		select {
+		case <-m.SigChan():
+			return nil
+		case msg, ok := <-inCh:
+			m.counters.received(msg, start)
+			if !ok {
+				break msgReadLoop
+			}
+			switch mt := msg.(type) {
+			case *datasource.SqlDriverMessageMap:
+				rows = append(rows, mt)
+			default:
+				msgReader, isContextReader := msg.(expr.ContextReader)
+				if !isContextReader {
+					u.Errorf("unrecognized msg %T", msg)
+					close(m.TaskBase.sigCh)
+					return fmt.Errorf("To use Window must use SqlDriverMessageMap but got %T", msg)
+				}
+				rows = append(rows, datasource.NewSqlDriverMessageMapCtx(msg.Id(), msgReader, colIndex))
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	results := make([][]driver.Value, len(rows))
+	for i := range results {
+		results[i] = make([]driver.Value, len(cols))
+	}
+
+	// rows are emitted in the partition order of the first window column
+	var emitOrder []int
+	for ci, col := range cols {
+		fn, ok := col.Expr.(*expr.FuncNode)
+		if !ok {
+			return fmt.Errorf("window column must be a function: %s", col)
+		}
+		for _, part := range partitionRows(rows, col.Over) {
+			if ci == 0 {
+				for _, wr := range part {
+					emitOrder = append(emitOrder, wr.idx)
+				}
+			}
+			if err := evalWindow(col, fn, rows, part, results, ci); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the appended window values follow the columns of the input rows
+	outIndex := make(map[string]int, len(rows[0].ColIndex)+len(cols))
+	width := 0
+	for k, idx := range rows[0].ColIndex {
+		outIndex[k] = idx
+		if idx >= width {
+			width = idx + 1
+		}
+	}
+	for ci, col := range cols {
+		outIndex[windowKey(col)] = width + ci
+		if _, exists := outIndex[col.As]; !exists {
+			// allow ORDER BY of the window alias
+			outIndex[col.As] = width + ci
+		}
+	}
+
+	for _, ri := range emitOrder {
+		vals := make([]driver.Value, width, width+len(cols))
+		copy(vals, rows[ri].Vals)
+		vals = append(vals, results[ri]...)
+		if !m.send(datasource.NewSqlDriverMessageMap(rows[ri].Id(), vals, outIndex)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// partitionRows groups rows into the partitions of window, each sorted by
+// the window ORDER BY.  Partitions are in order of their first row.
+func partitionRows(rows []*datasource.SqlDriverMessageMap, w *rel.Window) [][]*windowRow {
+
+	parts := make([][]*windowRow, 0)
+	partIdx := make(map[string]int)
+	for i, row := range rows {
+		key := ""
+		if len(w.PartitionBy) > 0 {
+			vals := make([]driver.Value, len(w.PartitionBy))
+			for pi, node := range w.PartitionBy {
+				if v, ok := vm.Eval(row, node); ok && v != nil && !v.Nil() {
+					vals[pi] = v.Value()
+				}
+			}
+			key = rowKey(vals)
+		}
+		wr := &windowRow{idx: i, keys: make([]value.Value, len(w.OrderBy))}
+		for oi, col := range w.OrderBy {
+			if v, ok := vm.Eval(row, col.Expr); ok {
+				wr.keys[oi] = v
+			}
+		}
+		pi, exists := partIdx[key]
+		if !exists {
+			pi = len(parts)
+			partIdx[key] = pi
+			parts = append(parts, nil)
+		}
+		parts[pi] = append(parts[pi], wr)
+	}
+
+	if len(w.OrderBy) > 0 {
+		for _, part := range parts {
+			sort.SliceStable(part, func(i, j int) bool {
+				return compareOrderKeys(w.OrderBy, part[i].keys, part[j].keys) < 0
+			})
+		}
+	}
+	return parts
+}
+
+// compareValues orders nil first, then numbers (including numeric strings of
+// schema-less sources), times, and everything else by its string value.
+func compareValues(a, b value.Value) int {
+	an := a == nil || a.Nil()
+	bn := b == nil || b.Nil()
+	switch {
+	case an && bn:
+		return 0
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	if af, ok := windowNumber(a); ok {
+		if bf, ok := windowNumber(b); ok {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			}
+			return 0
+		}
+	}
+	at, aok := a.(value.TimeValue)
+	bt, bok := b.(value.TimeValue)
+	// a time and a date string (such as a cursor value) compare as times
+	if as, ok := a.(value.StringValue); ok && bok {
+		if t, ok := value.ValueToTime(as); ok {
+			at, aok = value.NewTimeValue(t), true
+		}
+	} else if bs, ok := b.(value.StringValue); ok && aok {
+		if t, ok := value.ValueToTime(bs); ok {
+			bt, bok = value.NewTimeValue(t), true
+		}
+	}
+	if aok && bok {
+		switch {
+		case at.Val().Before(bt.Val()):
+			return -1
+		case at.Val().After(bt.Val()):
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.ToString(), b.ToString())
+}
+
+func windowNumber(v value.Value) (float64, bool) {
+	switch v.(type) {
+	case value.NumericValue, value.StringValue:
+		f, ok := value.ValueToFloat64(v)
+		return f, ok && !math.IsNaN(f)
+	}
+	return 0, false
+}
+
+// evalWindow the values of window column @ci for the rows of one sorted partition
+func evalWindow(col *rel.Column, fn *expr.FuncNode, rows []*datasource.SqlDriverMessageMap,
+	part []*windowRow, results [][]driver.Value, ci int) error {
+
+	w := col.Over
+	peer := func(i, j int) bool {
+		return compareOrderKeys(w.OrderBy, part[i].keys, part[j].keys) == 0
+	}
+
+	name := strings.ToLower(fn.Name)
+	switch name {
+	case "row_number":
+		for i, wr := range part {
+			results[wr.idx][ci] = int64(i + 1)
+		}
+	case "rank", "dense_rank":
+		dense := name == "dense_rank"
+		rank := int64(0)
+		for i, wr := range part {
+			switch {
+			case i > 0 && peer(i, i-1):
+			case dense:
+				rank++
+			default:
+				rank = int64(i + 1)
+			}
+			results[wr.idx][ci] = rank
+		}
+	case "lag", "lead":
+		for i, wr := range part {
+			row := rows[wr.idx]
+			offset := 1
+			if len(fn.Args) > 1 {
+				v, ok := vm.Eval(row, fn.Args[1])
+				if !ok {
+					return fmt.Errorf("could not evaluate offset of %s", fn)
+				}
+				n, ok := value.ValueToInt64(v)
+				if !ok || n < 0 {
+					return fmt.Errorf("offset of %s must be a non-negative integer", fn)
+				}
+				offset = int(n)
+			}
+			if name == "lag" {
+				offset = -offset
+			}
+			var val value.Value
+			if j := i + offset; j >= 0 && j < len(part) {
+				val, _ = vm.Eval(rows[part[j].idx], fn.Args[0])
+			} else if len(fn.Args) > 2 {
+				val, _ = vm.Eval(row, fn.Args[2])
+			}
+			if val != nil && !val.Nil() {
+				results[wr.idx][ci] = val.Value()
+			}
+		}
+	case "sum", "avg", "count":
+		if fn.Distinct {
+			return evalWindowAgg(col, fn, rows, part, results, ci, peer)
+		}
+		// prefix sums of the partition, so each frame is constant time
+		n := len(part)
+		sums := make([]float64, n+1)
+		cts := make([]int64, n+1)
+		countStar := col.CountStar()
+		for i, wr := range part {
+			sums[i+1], cts[i+1] = sums[i], cts[i]
+			if countStar {
+				cts[i+1]++
+				continue
+			}
+			v, ok := vm.Eval(rows[wr.idx], fn.Args[0])
+			if !ok || v == nil || v.Nil() {
+				continue
+			}
+			if name == "count" {
+				cts[i+1]++
+				continue
+			}
+			if f, ok := value.ValueToFloat64(v); ok {
+				sums[i+1] += f
+				cts[i+1]++
+			}
+		}
+		for i, wr := range part {
+			start, end := windowFrame(w, part, i, peer)
+			sum, ct := sums[end+1]-sums[start], cts[end+1]-cts[start]
+			switch {
+			case name == "count":
+				results[wr.idx][ci] = ct
+			case ct == 0:
+				// sum, avg of no values is null
+			case name == "sum":
+				results[wr.idx][ci] = sum
+			default:
+				results[wr.idx][ci] = sum / float64(ct)
+			}
+		}
+	default:
+		if fn.F.Aggregate {
+			return evalWindowAgg(col, fn, rows, part, results, ci, peer)
+		}
+		return fmt.Errorf("Not implemented window function: %s", fn)
+	}
+	return nil
+}
+
+// evalWindowAgg the value of an aggregate function (as it aggregates a group)
+// over the frame of each row of a partition.
+func evalWindowAgg(col *rel.Column, fn *expr.FuncNode, rows []*datasource.SqlDriverMessageMap,
+	part []*windowRow, results [][]driver.Value, ci int, peer func(i, j int) bool) error {
+
+	agg, err := newAggregator(col, false)
+	if err != nil {
+		return err
+	}
+	vals := make([]value.Value, len(part))
+	for i, wr := range part {
+		if v, ok := vm.Eval(rows[wr.idx], fn); ok {
+			vals[i] = v
+		}
+	}
+	for i, wr := range part {
+		start, end := windowFrame(col.Over, part, i, peer)
+		for j := start; j <= end; j++ {
+			agg.Do(vals[j])
+		}
+		results[wr.idx][ci] = agg.Result()
+		agg.Reset()
+	}
+	return nil
+}
+
+// windowFrame the first and last positions of the partition in the frame of
+// row i.  Without a frame, a window with ORDER BY is the rows up to and
+// including the peers of the current row, otherwise the whole partition.
+func windowFrame(w *rel.Window, part []*windowRow, i int, peer func(i, j int) bool) (int, int) {
+
+	frame := w.Frame
+	if frame == nil {
+		frame = &rel.WindowFrame{
+			Range: true,
+			Start: rel.WindowBound{Type: lex.TokenPreceding, Unbounded: true},
+			End:   rel.WindowBound{Type: lex.TokenFollowing, Unbounded: true},
+		}
+		if len(w.OrderBy) > 0 {
+			frame.End = rel.WindowBound{Type: lex.TokenCurrentRow}
+		}
+	}
+
+	last := len(part) - 1
+	start, startUnbounded := frame.Start.Position()
+	end, endUnbounded := frame.End.Position()
+	switch {
+	case startUnbounded:
+		start = 0
+	case frame.Range:
+		start = i
+		for start > 0 && peer(start-1, i) {
+			start--
+		}
+	default:
+		start = i + start
+	}
+	switch {
+	case endUnbounded:
+		end = last
+	case frame.Range:
+		end = i
+		for end < last && peer(end+1, i) {
+			end++
+		}
+	default:
+		end = i + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > last {
+		end = last
+	}
+	if start > end {
+		// an empty frame, ie  ROWS BETWEEN 3 FOLLOWING AND 5 FOLLOWING on last row
+		return 0, -1
+	}
+	return start, end
+}
@@ -0,0 +1,167 @@
+package exec
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/schema"
+)
+
+var (
+	// Ensure that we implement the Task Runner interface
+	_ TaskRunner = (*With)(nil)
+
+	// Ensure the rows of a common table expression can be scanned
+	_ schema.ConnScanner = (*cteScanner)(nil)
+
+	// CteMaxRecursion is the most iterations of a recursive common table
+	// expression before it is an error, a guard against cycles in the data.
+	CteMaxRecursion = 1000
+)
+
+// With runs the statement of a WITH, first running each of its common
+// table expressions (in order) into its table.
+//
+//	cte  ->  cte  ->  statement ->
+//
+// A recursive expression runs its anchor, then runs its recursive select
+// over the rows found by the previous iteration until it finds no more.
+// Unless UNION ALL, rows already found are not found again.
+type With struct {
+	TaskRunner // the statement
+	p          *plan.With
+	executor   Executor
+	ctes       []Task
+}
+
+// NewWith create the task of a WITH running @ctes before @main
+func NewWith(ctx *plan.Context, executor Executor, main TaskRunner, ctes []Task, p *plan.With) *With {
+	return &With{
+		TaskRunner: main,
+		p:          p,
+		executor:   executor,
+		ctes:       ctes,
+	}
+}
+
+func (m *With) Run() error {
+	for i, cte := range m.p.Ctes {
+		rows, err := runSubQuery(cte.Ctx, m.ctes[i])
+		if err == nil && cte.Recursive != nil {
+			rows, err = m.recurse(cte, rows)
+		}
+		if err != nil {
+			m.fail(i, err)
+			return err
+		}
+		cte.Table.SetRows(rows)
+	}
+	return m.TaskRunner.Run()
+}
+
+// fail ends the statement, which won't run, as the common table expression
+// @failed errored.  The error is sent to the tasks of the statement so the
+// reader of its rows gets it instead of waiting for rows.
+func (m *With) fail(failed int, err error) {
+	for _, task := range append([]Task{m.TaskRunner}, m.TaskRunner.Children()...) {
+		if tr, ok := task.(TaskRunner); ok {
+			select {
+			case tr.ErrChan() <- err:
+			default:
+			}
+		}
+	}
+	m.TaskRunner.Close()
+	for i, cte := range m.p.Ctes {
+		if i > failed {
+			// not run, so not closed by runSubQuery
+			m.ctes[i].Close()
+		}
+		cte.Table.SetRows(nil)
+	}
+}
+
+// recurse runs the recursive select of @cte starting from the @rows of
+// its anchor, returning all rows found.
+func (m *With) recurse(cte *plan.Cte, rows [][]driver.Value) ([][]driver.Value, error) {
+
+	var seen map[string]struct{}
+	if !cte.All {
+		seen = make(map[string]struct{}, len(rows))
+		rows = distinctRows(rows, seen)
+	}
+
+	working := rows
+	for i := 0; len(working) > 0; i++ {
+		if i >= CteMaxRecursion {
+			return nil, fmt.Errorf("recursive common table expression %q did not finish after %d iterations", cte.Stmt.Name, CteMaxRecursion)
+		}
+		p, err := cte.PlanRecursive(working)
+		if err != nil {
+			return nil, err
+		}
+		task, err := m.executor.WalkPlan(p)
+		if err != nil {
+			return nil, err
+		}
+		found, err := runSubQuery(p.Ctx, task)
+		if err != nil {
+			return nil, err
+		}
+		if seen != nil {
+			found = distinctRows(found, seen)
+		}
+		rows = append(rows, found...)
+		working = found
+	}
+	return rows, nil
+}
+
+// distinctRows the rows not already in @seen, adding them to it
+func distinctRows(rows [][]driver.Value, seen map[string]struct{}) [][]driver.Value {
+	out := rows[:0:0]
+	for _, row := range rows {
+		key := rowKey(row)
+		if _, dupe := seen[key]; dupe {
+			continue
+		}
+		seen[key] = struct{}{}
+		out = append(out, row)
+	}
+	return out
+}
+
+// cteScanner reads the rows of a common table expression, which are not
+// known until the statement runs so are read on the first Next()
+type cteScanner struct {
+	tbl     *plan.CteTable
+	cols    map[string]int
+	rows    [][]driver.Value
+	pos     int
+	started bool
+}
+
+func newCteScanner(tbl *plan.CteTable) *cteScanner {
+	cols := make(map[string]int)
+	for i, col := range tbl.Columns() {
+		cols[col] = i
+	}
+	return &cteScanner{tbl: tbl, cols: cols}
+}
+
+func (m *cteScanner) Close() error { return nil }
+func (m *cteScanner) Next() schema.Message {
+	if !m.started {
+		m.rows = m.tbl.Rows()
+		m.started = true
+	}
+	if m.pos >= len(m.rows) {
+		return nil
+	}
+	row := make([]driver.Value, len(m.rows[m.pos]))
+	copy(row, m.rows[m.pos])
+	m.pos++
+	return datasource.NewSqlDriverMessageMap(uint64(m.pos), row, m.cols)
+}
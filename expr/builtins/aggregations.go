@@ -133,6 +133,11 @@ func sumEval(ctx expr.EvalContext, vals []value.Value) (value.Value, bool) {
 //
 //	count(anyvalue)     =>  1, true
 //	count(not_number)   =>  -- 0, false
+//
+// The count of distinct values is the value of the row, which the group by
+// operator counts once per value.
+//
+//	count(DISTINCT user_id)  => "9Ip1aKbeZe2njCDM", true
 type Count struct{}
 
 // Type is Integer
@@ -143,6 +148,9 @@ func (m *Count) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
 	if len(n.Args) != 1 {
 		return nil, fmt.Errorf("Expected max 1 arg for count(arg) but got %s", n)
 	}
+	if n.Distinct {
+		return aggValueEval, nil
+	}
 	return incrementEval, nil
 }
 
@@ -152,3 +160,214 @@ func incrementEval(ctx expr.EvalContext, vals []value.Value) (value.Value, bool)
 	}
 	return value.NewIntValue(1), true
 }
+
+// Aggregates of the values of a column, evaluated on a single row they are
+// the value of that row, which the group by operator aggregates.
+//
+//	SELECT user_id, max(price), stddev(price) FROM orders GROUP BY user_id
+
+// Min smallest value of group, numbers (including numeric strings) are
+// compared as numbers, times as times, anything else as strings.
+//
+//	min(price)  => 22.50
+type Min struct{}
+
+// Type is unknown, it is the type of its arg
+func (m *Min) Type() value.ValueType { return value.UnknownType }
+func (m *Min) IsAgg() bool           { return true }
+func (m *Min) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 1 {
+		return nil, fmt.Errorf("Expected 1 arg for min(arg) but got %s", n)
+	}
+	return aggValueEval, nil
+}
+
+// Max largest value of group, see Min for how values compare.
+//
+//	max(price)  => 37.50
+type Max struct{}
+
+// Type is unknown, it is the type of its arg
+func (m *Max) Type() value.ValueType { return value.UnknownType }
+func (m *Max) IsAgg() bool           { return true }
+func (m *Max) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 1 {
+		return nil, fmt.Errorf("Expected 1 arg for max(arg) but got %s", n)
+	}
+	return aggValueEval, nil
+}
+
+// ApproxCountDistinct estimate of the count of distinct non-null values of
+// group, using a HyperLogLog sketch so uses little memory even for large
+// numbers of values.  count(DISTINCT x) is the exact count.
+//
+//	approx_count_distinct(user_id)  => 2
+type ApproxCountDistinct struct{}
+
+// Type is Integer
+func (m *ApproxCountDistinct) Type() value.ValueType { return value.IntType }
+func (m *ApproxCountDistinct) IsAgg() bool           { return true }
+func (m *ApproxCountDistinct) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 1 {
+		return nil, fmt.Errorf("Expected 1 arg for approx_count_distinct(arg) but got %s", n)
+	}
+	return aggValueEval, nil
+}
+
+// Variance of the numeric values of group.  variance and var_samp are the
+// sample variance, var_pop the population variance.
+//
+//	variance(price)  => 75
+//	var_pop(price)   => 50
+type Variance struct{}
+
+// Type is number
+func (m *Variance) Type() value.ValueType { return value.NumberType }
+func (m *Variance) IsAgg() bool           { return true }
+func (m *Variance) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 1 {
+		return nil, fmt.Errorf("Expected 1 arg for variance(arg) but got %s", n)
+	}
+	return aggNumberEval, nil
+}
+
+// Stddev standard deviation of the numeric values of group.  stddev and
+// stddev_samp are the sample deviation, stddev_pop the population deviation.
+//
+//	stddev(price)      => 8.66
+//	stddev_pop(price)  => 7.07
+type Stddev struct{}
+
+// Type is number
+func (m *Stddev) Type() value.ValueType { return value.NumberType }
+func (m *Stddev) IsAgg() bool           { return true }
+func (m *Stddev) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 1 {
+		return nil, fmt.Errorf("Expected 1 arg for stddev(arg) but got %s", n)
+	}
+	return aggNumberEval, nil
+}
+
+// Percentile approximate value at fraction (0 to 1) of the ordered numeric
+// values of group.  The values are summarized by a digest, which is exact
+// for small groups and accurate to well under 1% at the tails of large ones.
+//
+//	percentile(price, 0.9)         => 34.5
+//	approx_percentile(price, 0.5)  => 22.5
+type Percentile struct{}
+
+// Type is number
+func (m *Percentile) Type() value.ValueType { return value.NumberType }
+func (m *Percentile) IsAgg() bool           { return true }
+func (m *Percentile) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 2 {
+		return nil, fmt.Errorf("Expected 2 args for percentile(arg, fraction) but got %s", n)
+	}
+	if _, ok := PercentileFraction(n); !ok {
+		return nil, fmt.Errorf("Expected fraction between 0 and 1 for percentile(arg, fraction) but got %s", n)
+	}
+	return aggNumberEval, nil
+}
+
+// PercentileFraction the fraction of a percentile() or median() function,
+// which must be a number between 0 and 1.
+func PercentileFraction(n *expr.FuncNode) (float64, bool) {
+	if len(n.Args) < 2 {
+		return 0.5, true
+	}
+	nn, ok := n.Args[1].(*expr.NumberNode)
+	if !ok || nn.Float64 < 0 || nn.Float64 > 1 {
+		return 0, false
+	}
+	return nn.Float64, true
+}
+
+// Median approximate middle value of the ordered numeric values of group,
+// same as percentile(arg, 0.5).
+//
+//	median(price)  => 22.5
+type Median struct{}
+
+// Type is number
+func (m *Median) Type() value.ValueType { return value.NumberType }
+func (m *Median) IsAgg() bool           { return true }
+func (m *Median) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 1 {
+		return nil, fmt.Errorf("Expected 1 arg for median(arg) but got %s", n)
+	}
+	return aggNumberEval, nil
+}
+
+// ArrayAgg the non-null values of group as an array.
+//
+//	array_agg(item_id)  => ["1","4"]
+type ArrayAgg struct{}
+
+// Type is slice
+func (m *ArrayAgg) Type() value.ValueType { return value.SliceValueType }
+func (m *ArrayAgg) IsAgg() bool           { return true }
+func (m *ArrayAgg) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 1 {
+		return nil, fmt.Errorf("Expected 1 arg for array_agg(arg) but got %s", n)
+	}
+	return aggValueEval, nil
+}
+
+// StringAgg the non-null values of group joined by a separator, which
+// defaults to a comma.
+//
+//	string_agg(item_id, "|")  => "1|4"
+type StringAgg struct{}
+
+// Type is string
+func (m *StringAgg) Type() value.ValueType { return value.StringType }
+func (m *StringAgg) IsAgg() bool           { return true }
+func (m *StringAgg) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) < 1 || len(n.Args) > 2 {
+		return nil, fmt.Errorf("Expected 1 or 2 args for string_agg(arg, separator) but got %s", n)
+	}
+	if _, ok := StringAggSeparator(n); !ok {
+		return nil, fmt.Errorf("Expected string separator for string_agg(arg, separator) but got %s", n)
+	}
+	return aggStringEval, nil
+}
+
+// StringAggSeparator the separator of a string_agg() function
+func StringAggSeparator(n *expr.FuncNode) (string, bool) {
+	if len(n.Args) < 2 {
+		return ",", true
+	}
+	sn, ok := n.Args[1].(*expr.StringNode)
+	if !ok {
+		return "", false
+	}
+	return sn.Text, true
+}
+
+// aggValueEval the value of the row, nil is not a value of the aggregate
+func aggValueEval(ctx expr.EvalContext, vals []value.Value) (value.Value, bool) {
+	if vals[0] == nil || vals[0].Err() || vals[0].Nil() {
+		return nil, false
+	}
+	return vals[0], true
+}
+
+// aggNumberEval the numeric value of the row
+func aggNumberEval(ctx expr.EvalContext, vals []value.Value) (value.Value, bool) {
+	if vals[0] == nil || vals[0].Err() || vals[0].Nil() {
+		return value.NumberNaNValue, false
+	}
+	fv, ok := value.ValueToFloat64(vals[0])
+	if !ok || math.IsNaN(fv) {
+		return value.NumberNaNValue, false
+	}
+	return value.NewNumberValue(fv), true
+}
+
+// aggStringEval the string value of the row
+func aggStringEval(ctx expr.EvalContext, vals []value.Value) (value.Value, bool) {
+	if vals[0] == nil || vals[0].Err() || vals[0].Nil() {
+		return nil, false
+	}
+	return value.NewStringValue(vals[0].ToString()), true
+}
@@ -26,6 +26,27 @@ func LoadAllBuiltins() {
 		expr.FuncAdd("count", &Count{})
 		expr.FuncAdd("avg", &Avg{})
 		expr.FuncAdd("sum", &Sum{})
+		expr.FuncAdd("min", &Min{})
+		expr.FuncAdd("max", &Max{})
+		expr.FuncAdd("approx_count_distinct", &ApproxCountDistinct{})
+		expr.FuncAdd("variance", &Variance{})
+		expr.FuncAdd("var_samp", &Variance{})
+		expr.FuncAdd("var_pop", &Variance{})
+		expr.FuncAdd("stddev", &Stddev{})
+		expr.FuncAdd("stddev_samp", &Stddev{})
+		expr.FuncAdd("stddev_pop", &Stddev{})
+		expr.FuncAdd("percentile", &Percentile{})
+		expr.FuncAdd("approx_percentile", &Percentile{})
+		expr.FuncAdd("median", &Median{})
+		expr.FuncAdd("array_agg", &ArrayAgg{})
+		expr.FuncAdd("string_agg", &StringAgg{})
+
+		// window ops
+		expr.FuncAdd("row_number", &RowNumber{})
+		expr.FuncAdd("rank", &Rank{})
+		expr.FuncAdd("dense_rank", &DenseRank{})
+		expr.FuncAdd("lag", &Lag{})
+		expr.FuncAdd("lead", &Lead{})
 
 		// logical
 		expr.FuncAdd("gt", &Gt{})
@@ -91,6 +112,10 @@ func LoadAllBuiltins() {
 
 		// selection
 		expr.FuncAdd("oneof", &OneOf{})
+		expr.FuncAdd("coalesce", &Coalesce{})
+		expr.FuncAdd("ifnull", &IfNull{})
+		expr.FuncAdd("nullif", &NullIf{})
+		expr.FuncAdd("if", &If{})
 		expr.FuncAdd("match", &Match{})
 		expr.FuncAdd("mapkeys", &MapKeys{})
 		expr.FuncAdd("mapvalues", &MapValues{})
@@ -238,6 +238,20 @@ var builtinTests = []testBuiltins{
 	{`oneof(email, email(not_a_field)) NOT IN ("a","b",10, 4.5) `, value.NewBoolValue(true)},
 	{`oneof(email, email(not_a_field)) IN ("email@email.com","b",10, 4.5) `, value.NewBoolValue(true)},
 	{`oneof(email, email(not_a_field)) IN ("b",10, 4.5) `, value.NewBoolValue(false)},
+
+	// coalesce returns first non-nil value, zero values included
+	{`coalesce(not_a_field, event)`, value.NewStringValue("hello")},
+	{`coalesce(not_a_field, 0, event)`, value.NewIntValue(0)},
+	{`coalesce(not_a_field, not_a_field2)`, nil},
+	{`ifnull(not_a_field, "default")`, value.NewStringValue("default")},
+	{`ifnull(event, "default")`, value.NewStringValue("hello")},
+	{`nullif(event, "hello")`, nil},
+	{`nullif(event, "world")`, value.NewStringValue("hello")},
+	{`nullif(not_a_field, "world")`, nil},
+	{`if(eq(5,5), "yes", "no")`, value.NewStringValue("yes")},
+	{`if(eq(5,6), "yes", "no")`, value.NewStringValue("no")},
+	{`if(not_a_field, "yes", "no")`, value.NewStringValue("no")},
+	{`if(event == "hello", score_amount, not_a_field)`, value.NewStringValue("22")},
 	{`oneof("","")`, value.ErrValue},
 
 	{`map(event, 22)`, value.NewMapValue(map[string]any{"hello": 22})},
@@ -794,6 +808,17 @@ var builtinTests = []testBuiltins{
 	{`count(4)`, value.NewIntValue(1)},
 	{`count(not_a_field)`, value.ErrValue},
 	{`count(not_a_field)`, nil},
+	{`count(DISTINCT "abc")`, value.NewStringValue("abc")},
+
+	{`min(4)`, value.NewIntValue(4)},
+	{`max("abc")`, value.NewStringValue("abc")},
+	{`approx_count_distinct("abc")`, value.NewStringValue("abc")},
+	{`variance("2.5")`, value.NewNumberValue(2.5)},
+	{`stddev(4)`, value.NewNumberValue(4)},
+	{`percentile(4, 0.9)`, value.NewNumberValue(4)},
+	{`median("abc")`, value.ErrValue},
+	{`array_agg(4)`, value.NewIntValue(4)},
+	{`string_agg(4, "|")`, value.NewStringValue("4")},
 
 	// JsonPath
 	{`json.jmespath(json_field, "[?name == 'n1'].name | [0]")`, value.NewStringValue("n1")},
@@ -902,6 +927,11 @@ var testValidation = []string{
 	`avg()`,                   // must have 1 args
 	`sum()`,                   // must have 1 args
 	`count()`, `count(a,b,c)`, // must have 1 arg
+	`min()`, `max(a,b)`, // must have 1 arg
+	`variance()`, `stddev(a,b)`, `median(a,b)`, // must have 1 arg
+	`percentile(a)`, `percentile(a,2)`, `percentile(a,b)`, // 2nd must be fraction 0-1
+	`string_agg(a,2)`,       // separator must be string
+	`tolower(DISTINCT a)`,   // DISTINCT only of aggregates
 
 	// strings
 	`contains()`, `contains(a,b,c)`, // must be 2 args
@@ -32,6 +32,94 @@ func oneOfEval(ctx expr.EvalContext, args []value.Value) (value.Value, bool) {
 	return value.NilValueVal, false
 }
 
+// Coalesce choose the first non-nil argument, unlike oneof zero values
+// and empty strings are chosen
+//
+//	coalesce(nil, 0, "hello") => 0
+type Coalesce struct{}
+
+// Type unknown
+func (m *Coalesce) Type() value.ValueType { return value.UnknownType }
+func (m *Coalesce) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) < 1 {
+		return nil, fmt.Errorf("Expected 1 or more args for Coalesce(arg, arg, ...) but got %s", n)
+	}
+	return coalesceEval, nil
+}
+func coalesceEval(ctx expr.EvalContext, args []value.Value) (value.Value, bool) {
+	for _, v := range args {
+		if v != nil && !v.Nil() {
+			return v, true
+		}
+	}
+	return value.NilValueVal, false
+}
+
+// IfNull the first argument, or the second if the first is nil
+//
+//	ifnull(not_a_field, "hello") => 'hello'
+type IfNull struct{}
+
+// Type unknown
+func (m *IfNull) Type() value.ValueType { return value.UnknownType }
+func (m *IfNull) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 2 {
+		return nil, fmt.Errorf("Expected exactly 2 args for IfNull(arg, default) but got %s", n)
+	}
+	return coalesceEval, nil
+}
+
+// NullIf nil if the two arguments are equal, else the first
+//
+//	nullif("hello", "hello") => nil
+//	nullif("hello", "world") => 'hello'
+type NullIf struct{}
+
+// Type unknown
+func (m *NullIf) Type() value.ValueType { return value.UnknownType }
+func (m *NullIf) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 2 {
+		return nil, fmt.Errorf("Expected exactly 2 args for NullIf(arg, arg) but got %s", n)
+	}
+	return nullIfEval, nil
+}
+func nullIfEval(ctx expr.EvalContext, args []value.Value) (value.Value, bool) {
+	if args[0] == nil || args[0].Nil() {
+		return value.NilValueVal, false
+	}
+	if args[1] != nil && !args[1].Nil() {
+		if eq, err := value.Equal(args[0], args[1]); err == nil && eq {
+			return value.NilValueVal, false
+		}
+	}
+	return args[0], true
+}
+
+// If the second argument if the first is true, else the third
+//
+//	if(eq(5,5), "yes", "no") => 'yes'
+//	if(not_a_field, "yes", "no") => 'no'
+type If struct{}
+
+// Type unknown
+func (m *If) Type() value.ValueType { return value.UnknownType }
+func (m *If) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 3 {
+		return nil, fmt.Errorf("Expected exactly 3 args for If(cond, then, else) but got %s", n)
+	}
+	return ifEval, nil
+}
+func ifEval(ctx expr.EvalContext, args []value.Value) (value.Value, bool) {
+	v := args[2]
+	if cond, ok := value.ValueToBool(args[0]); ok && cond {
+		v = args[1]
+	}
+	if v == nil || v.Nil() {
+		return value.NilValueVal, false
+	}
+	return v, true
+}
+
 // FilterFromArgs given set of values
 func FiltersFromArgs(filterVals []value.Value) []string {
 	filters := make([]string, 0, len(filterVals))
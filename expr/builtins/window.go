@@ -0,0 +1,94 @@
+package builtins
+
+import (
+	"fmt"
+
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/value"
+)
+
+// Window functions are only meaningful over the window of a sql column
+//
+//	row_number() OVER (PARTITION BY user_id ORDER BY ts)
+//
+// their values are calculated by the window operator which sees all rows
+// of the partition, evaluated on a single row they are nil.
+
+// RowNumber position of row in its window partition, starting at 1.
+//
+//	row_number() OVER (ORDER BY ts)  => 1, 2, 3, 4
+type RowNumber struct{}
+
+// Type is Integer
+func (m *RowNumber) Type() value.ValueType { return value.IntType }
+func (m *RowNumber) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 0 {
+		return nil, fmt.Errorf("Expected no args for row_number() but got %s", n)
+	}
+	return windowEval, nil
+}
+
+// Rank of row in its window partition, rows with equal ORDER BY values
+// share a rank and leave a gap.
+//
+//	rank() OVER (ORDER BY score)  => 1, 2, 2, 4
+type Rank struct{}
+
+// Type is Integer
+func (m *Rank) Type() value.ValueType { return value.IntType }
+func (m *Rank) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 0 {
+		return nil, fmt.Errorf("Expected no args for rank() but got %s", n)
+	}
+	return windowEval, nil
+}
+
+// DenseRank of row in its window partition, rows with equal ORDER BY values
+// share a rank without a gap.
+//
+//	dense_rank() OVER (ORDER BY score)  => 1, 2, 2, 3
+type DenseRank struct{}
+
+// Type is Integer
+func (m *DenseRank) Type() value.ValueType { return value.IntType }
+func (m *DenseRank) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) != 0 {
+		return nil, fmt.Errorf("Expected no args for dense_rank() but got %s", n)
+	}
+	return windowEval, nil
+}
+
+// Lag value of expression from a previous row of the window partition,
+// offset defaults to 1, default is returned when there is no such row.
+//
+//	lag(event) OVER (PARTITION BY user_id ORDER BY ts)    => previous event
+//	lag(ts, 2, 0) OVER (PARTITION BY user_id ORDER BY ts)
+type Lag struct{}
+
+// Type is unknown, type of expression
+func (m *Lag) Type() value.ValueType { return value.UnknownType }
+func (m *Lag) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) < 1 || len(n.Args) > 3 {
+		return nil, fmt.Errorf("Expected 1 to 3 args for lag(expr, [offset, default]) but got %s", n)
+	}
+	return windowEval, nil
+}
+
+// Lead value of expression from a following row of the window partition,
+// offset defaults to 1, default is returned when there is no such row.
+//
+//	lead(event) OVER (PARTITION BY user_id ORDER BY ts)    => next event
+type Lead struct{}
+
+// Type is unknown, type of expression
+func (m *Lead) Type() value.ValueType { return value.UnknownType }
+func (m *Lead) Validate(n *expr.FuncNode) (expr.EvaluatorFunc, error) {
+	if len(n.Args) < 1 || len(n.Args) > 3 {
+		return nil, fmt.Errorf("Expected 1 to 3 args for lead(expr, [offset, default]) but got %s", n)
+	}
+	return windowEval, nil
+}
+
+func windowEval(ctx expr.EvalContext, args []value.Value) (value.Value, bool) {
+	return value.NewNilValue(), false
+}
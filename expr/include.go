@@ -38,6 +38,25 @@ func inlineIncludesDepth(ctx Includer, arg Node, depth int) (Node, error) {
 	}
 
 	switch n := arg.(type) {
+	case *CaseNode:
+		// ChildrenArgs of a case is a new slice, so replace in place
+		nodes := []*Node{&n.Operand, &n.Else}
+		for i := range n.Whens {
+			nodes = append(nodes, &n.Whens[i], &n.Thens[i])
+		}
+		for _, np := range nodes {
+			if *np == nil {
+				continue
+			}
+			newNode, err := inlineIncludesDepth(ctx, *np, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if newNode != nil {
+				*np = newNode
+			}
+		}
+		return arg, nil
 	// FuncNode, BinaryNode, BooleanNode, TriNode, UnaryNode, ArrayNode
 	case NodeArgs:
 		args := n.ChildrenArgs()
@@ -116,6 +135,10 @@ func findAllIncludes(node Node, current []string) []string {
 		for _, arg := range n.Args {
 			current = findAllIncludes(arg, current)
 		}
+	case *CaseNode:
+		for _, arg := range n.ChildrenArgs() {
+			current = findAllIncludes(arg, current)
+		}
 	}
 	return current
 }
@@ -57,6 +57,7 @@ var (
 	_ NodeArgs = (*FuncNode)(nil)
 	_ NodeArgs = (*UnaryNode)(nil)
 	_ NodeArgs = (*ArrayNode)(nil)
+	_ NodeArgs = (*CaseNode)(nil)
 )
 
 type (
@@ -206,11 +207,12 @@ type (
 	// FuncNode holds a Func, which desribes a go Function as
 	// well as fulfilling the Pos, String() etc for a Node
 	FuncNode struct {
-		Name    string        // Name of func
-		F       Func          // The actual function that this AST maps to
-		Eval    EvaluatorFunc // the evaluator function
-		Missing bool
-		Args    []Node // Arguments are them-selves nodes
+		Name     string        // Name of func
+		F        Func          // The actual function that this AST maps to
+		Eval     EvaluatorFunc // the evaluator function
+		Missing  bool
+		Distinct bool   // aggregate of only the distinct values   count(DISTINCT x)
+		Args     []Node // Arguments are them-selves nodes
 	}
 
 	// IdentityNode will look up a value out of a env bag also identities of
@@ -315,6 +317,52 @@ type (
 		wraptype string //  (   or [
 		Args     []Node
 	}
+
+	// SubQuery is a statement nested inside of an expression, the expr
+	// package does not know sql statements so only needs to write it.
+	SubQuery interface {
+		String() string
+		WriteDialect(w DialectWriter)
+	}
+
+	// SubQueryParser is implemented by token pagers of a language with sub
+	// queries (sql) to parse the statement found after a left parenthesis.
+	SubQueryParser interface {
+		ParseSubQuery() (SubQuery, error)
+	}
+
+	// SubQueryNode a select statement nested in an expression, whose
+	// results are the values of the expression
+	//
+	//    user_id IN (SELECT user_id FROM orders)
+	//    EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.user_id)
+	//    price > (SELECT avg(price) FROM orders)
+	SubQueryNode struct {
+		Stmt SubQuery
+	}
+
+	// ParamNode a placeholder of a prepared statement, ? or $1, whose value
+	// is bound before each execution of the statement.
+	//
+	//    user_id = ?
+	//    price > $2
+	ParamNode struct {
+		Text  string      // ? or $1 as written
+		Pos   int         // 1 based position of the argument bound to it
+		Value value.Value // bound value, nil until bound
+	}
+
+	// CaseNode a searched or simple case expression, the value of the
+	// THEN of the first matching WHEN, else the ELSE (or nil)
+	//
+	//    CASE WHEN x > 5 THEN "big" WHEN x > 2 THEN "medium" ELSE "small" END
+	//    CASE x WHEN 1 THEN "one" WHEN 2 THEN "two" END
+	CaseNode struct {
+		Operand Node   // operand of the simple form, nil if searched
+		Whens   []Node // conditions, or values compared to Operand
+		Thens   []Node // result of the WHEN at the same position
+		Else    Node   // optional
+	}
 )
 
 // Includer defines an interface used for resolving INCLUDE clauses into a
@@ -410,6 +458,10 @@ func findIdentities(node Node, l IdentityNodes) IdentityNodes {
 		for _, arg := range n.Args {
 			l = findIdentities(arg, l)
 		}
+	case *CaseNode:
+		for _, arg := range n.ChildrenArgs() {
+			l = findIdentities(arg, l)
+		}
 	}
 	return l
 }
@@ -552,6 +604,9 @@ func (m *FuncNode) String() string {
 func (m *FuncNode) WriteDialect(w DialectWriter) {
 	io.WriteString(w, m.Name)
 	io.WriteString(w, "(")
+	if m.Distinct {
+		io.WriteString(w, "DISTINCT ")
+	}
 	for i, arg := range m.Args {
 		if i > 0 {
 			io.WriteString(w, ", ")
@@ -562,6 +617,9 @@ func (m *FuncNode) WriteDialect(w DialectWriter) {
 }
 func (m *FuncNode) Validate() error {
 
+	if m.Distinct && !m.F.Aggregate && !m.Missing {
+		return fmt.Errorf("DISTINCT is only valid for aggregate functions: %s", m)
+	}
 	if m.F.CustomFunc != nil {
 		// Nice new style function
 		ev, err := m.F.CustomFunc.Validate(m)
@@ -641,7 +699,7 @@ func (m *FuncNode) Equal(n Node) bool {
 		return false
 	}
 	if nt, ok := n.(*FuncNode); ok {
-		if m.Name != nt.Name {
+		if m.Name != nt.Name || m.Distinct != nt.Distinct {
 			return false
 		}
 		if len(m.Args) != len(nt.Args) {
@@ -1923,6 +1981,271 @@ func (m *ArrayNode) Equal(n Node) bool {
 	return false
 }
 
+// NewSubQueryNode create a node of a nested statement
+func NewSubQueryNode(stmt SubQuery) *SubQueryNode {
+	return &SubQueryNode{Stmt: stmt}
+}
+func (m *SubQueryNode) Copy() Node {
+	n := *m
+	return &n
+}
+func (m *SubQueryNode) NodeType() string { return "SubQuery" }
+func (m *SubQueryNode) String() string {
+	w := NewDefaultWriter()
+	m.WriteDialect(w)
+	return w.String()
+}
+func (m *SubQueryNode) WriteDialect(w DialectWriter) {
+	io.WriteString(w, "(")
+	m.Stmt.WriteDialect(w)
+	io.WriteString(w, ")")
+}
+func (m *SubQueryNode) Validate() error {
+	if m.Stmt == nil {
+		return fmt.Errorf("sub query has no statement")
+	}
+	return nil
+}
+func (m *SubQueryNode) Expr() *Expr {
+	return &Expr{Op: "SUBQUERY", Value: m.Stmt.String()}
+}
+func (m *SubQueryNode) FromExpr(e *Expr) error {
+	return fmt.Errorf("sub query can not be created from expression %+v", e)
+}
+func (m *SubQueryNode) Equal(n Node) bool {
+	if m == nil && n == nil {
+		return true
+	}
+	if m == nil && n != nil {
+		return false
+	}
+	if m != nil && n == nil {
+		return false
+	}
+	if nt, ok := n.(*SubQueryNode); ok {
+		return m.Stmt.String() == nt.Stmt.String()
+	}
+	return false
+}
+
+// NewParamNode create a placeholder node from a param token, a ? is
+// positioned by the parser, a $n is at position n.
+func NewParamNode(tok lex.Token) (*ParamNode, error) {
+	n := &ParamNode{Text: tok.V}
+	if strings.HasPrefix(tok.V, "$") {
+		pos, err := strconv.Atoi(tok.V[1:])
+		if err != nil || pos < 1 {
+			return nil, fmt.Errorf("invalid placeholder %q", tok.V)
+		}
+		n.Pos = pos
+	}
+	return n, nil
+}
+func (m *ParamNode) Copy() Node {
+	n := *m
+	return &n
+}
+func (m *ParamNode) NodeType() string { return "Param" }
+func (m *ParamNode) String() string {
+	w := NewDefaultWriter()
+	m.WriteDialect(w)
+	return w.String()
+}
+
+// WriteDialect writes the bound value, so statements pushed down to a
+// source are complete, or else the placeholder.
+func (m *ParamNode) WriteDialect(w DialectWriter) {
+	switch vt := m.Value.(type) {
+	case nil:
+		io.WriteString(w, m.Text)
+	case value.NilValue, *value.NilValue:
+		w.WriteNull()
+	case value.TimeValue:
+		w.WriteLiteral(vt.Val().Format(time.RFC3339Nano))
+	default:
+		w.WriteValue(vt)
+	}
+}
+func (m *ParamNode) Validate() error { return nil }
+func (m *ParamNode) Expr() *Expr {
+	return &Expr{Op: "PARAM", Value: m.Text}
+}
+func (m *ParamNode) FromExpr(e *Expr) error {
+	n, err := NewParamNode(lex.Token{T: lex.TokenParam, V: e.Value})
+	if err != nil {
+		return err
+	}
+	*m = *n
+	return nil
+}
+func (m *ParamNode) Equal(n Node) bool {
+	if m == nil && n == nil {
+		return true
+	}
+	if m == nil && n != nil {
+		return false
+	}
+	if m != nil && n == nil {
+		return false
+	}
+	if nt, ok := n.(*ParamNode); ok {
+		return m.Text == nt.Text && m.Pos == nt.Pos
+	}
+	return false
+}
+
+// NewCaseNode create a case expression node
+func NewCaseNode() *CaseNode {
+	return &CaseNode{}
+}
+func (m *CaseNode) Copy() Node {
+	n := &CaseNode{Whens: copyNodes(m.Whens), Thens: copyNodes(m.Thens)}
+	if m.Operand != nil {
+		n.Operand = m.Operand.Copy()
+	}
+	if m.Else != nil {
+		n.Else = m.Else.Copy()
+	}
+	return n
+}
+func (m *CaseNode) NodeType() string { return "Case" }
+func (m *CaseNode) String() string {
+	w := NewDefaultWriter()
+	m.WriteDialect(w)
+	return w.String()
+}
+func (m *CaseNode) WriteDialect(w DialectWriter) {
+	io.WriteString(w, "CASE")
+	if m.Operand != nil {
+		io.WriteString(w, " ")
+		m.Operand.WriteDialect(w)
+	}
+	for i, when := range m.Whens {
+		io.WriteString(w, " WHEN ")
+		when.WriteDialect(w)
+		io.WriteString(w, " THEN ")
+		m.Thens[i].WriteDialect(w)
+	}
+	if m.Else != nil {
+		io.WriteString(w, " ELSE ")
+		m.Else.WriteDialect(w)
+	}
+	io.WriteString(w, " END")
+}
+func (m *CaseNode) Validate() error {
+	if len(m.Whens) == 0 {
+		return fmt.Errorf("CASE requires at least one WHEN")
+	}
+	if len(m.Whens) != len(m.Thens) {
+		return fmt.Errorf("CASE requires a THEN for each WHEN")
+	}
+	for _, n := range m.ChildrenArgs() {
+		if err := n.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChildrenArgs the operand, each WHEN and THEN, and the ELSE
+func (m *CaseNode) ChildrenArgs() []Node {
+	args := make([]Node, 0, len(m.Whens)*2+2)
+	if m.Operand != nil {
+		args = append(args, m.Operand)
+	}
+	for i, when := range m.Whens {
+		args = append(args, when, m.Thens[i])
+	}
+	if m.Else != nil {
+		args = append(args, m.Else)
+	}
+	return args
+}
+
+// Expr of a case is
+//
+//	{"op":"case", "args":[<operand>, {"op":"when","args":[<when>,<then>]}, {"op":"else","args":[<else>]}]}
+//
+// where operand and else are optional
+func (m *CaseNode) Expr() *Expr {
+	fe := &Expr{Op: "case"}
+	if m.Operand != nil {
+		fe.Args = append(fe.Args, m.Operand.Expr())
+	}
+	for i, when := range m.Whens {
+		fe.Args = append(fe.Args, &Expr{Op: "when", Args: []*Expr{when.Expr(), m.Thens[i].Expr()}})
+	}
+	if m.Else != nil {
+		fe.Args = append(fe.Args, &Expr{Op: "else", Args: []*Expr{m.Else.Expr()}})
+	}
+	return fe
+}
+func (m *CaseNode) FromExpr(e *Expr) error {
+	if !strings.EqualFold(e.Op, "case") {
+		return fmt.Errorf("Invalid CaseNode %+v", e)
+	}
+	for i, arg := range e.Args {
+		switch {
+		case strings.EqualFold(arg.Op, "when"):
+			if len(arg.Args) != 2 {
+				return fmt.Errorf("Invalid CaseNode WHEN, expected 2 args %+v", arg)
+			}
+			args, err := NodesFromExprs(arg.Args)
+			if err != nil {
+				return err
+			}
+			m.Whens = append(m.Whens, args[0])
+			m.Thens = append(m.Thens, args[1])
+		case strings.EqualFold(arg.Op, "else"):
+			if len(arg.Args) != 1 {
+				return fmt.Errorf("Invalid CaseNode ELSE, expected 1 arg %+v", arg)
+			}
+			n, err := NodeFromExpr(arg.Args[0])
+			if err != nil {
+				return err
+			}
+			m.Else = n
+		case i == 0:
+			n, err := NodeFromExpr(arg)
+			if err != nil {
+				return err
+			}
+			m.Operand = n
+		default:
+			return fmt.Errorf("Invalid CaseNode, unexpected arg %+v", arg)
+		}
+	}
+	return m.Validate()
+}
+func (m *CaseNode) Equal(n Node) bool {
+	if m == nil && n == nil {
+		return true
+	}
+	if m == nil && n != nil {
+		return false
+	}
+	if m != nil && n == nil {
+		return false
+	}
+	nt, ok := n.(*CaseNode)
+	if !ok {
+		return false
+	}
+	if (m.Operand == nil) != (nt.Operand == nil) || (m.Else == nil) != (nt.Else == nil) {
+		return false
+	}
+	if len(m.Whens) != len(nt.Whens) || len(m.Thens) != len(nt.Thens) {
+		return false
+	}
+	ma, na := m.ChildrenArgs(), nt.ChildrenArgs()
+	for i, arg := range ma {
+		if !arg.Equal(na[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // Node serialization helpers
 func tokenFromInt(iv int32) lex.Token {
 	t, ok := lex.TokenNameMap[lex.TokenType(iv)]
@@ -2030,8 +2353,12 @@ func NodeFromExpr(e *Expr) (Node, error) {
 			n = &UnaryNode{}
 		case "BETWEEN":
 			n = &TriNode{}
+		case "CASE":
+			n = &CaseNode{}
+		case "PARAM":
+			n = &ParamNode{}
 		case "=", "-", "+", "++", "+=", "/", "%", "==", "<=", "!=", ">=", ">", "<", "*",
-			"LIKE", "CONTAINS", "INTERSECTS", "IN":
+			"LIKE", "CONTAINS", "INTERSECTS", "IN", "IS", "IS NOT":
 
 			// very weird special case for FILTER * where the * is an ident not op
 			if e.Op == "*" && len(e.Args) == 0 {
@@ -36,6 +36,8 @@ var copyTest = []string{
 	`NOT AND ( EXISTS x, INCLUDE ref_name, NOT OR (x > 5, y < 10) )`,
 	`company = "Toys R"" Us"`,
 	`NOT providers.id != NULL`,
+	`CASE WHEN x > 5 THEN "big" ELSE "small" END`,
+	`CASE x WHEN 1 THEN "one" WHEN 2 THEN "two" END`,
 }
 
 func TestNodeCopy(t *testing.T) {
@@ -95,6 +97,30 @@ func TestExprRoundTrip(t *testing.T) {
 	}
 }
 
+func TestCaseExprRoundTrip(t *testing.T) {
+	t.Parallel()
+	for _, exprText := range []string{
+		`CASE WHEN x > y THEN "big" WHEN x > "2" THEN "medium" ELSE "small" END`,
+		`CASE x WHEN "a" THEN "one" WHEN "b" THEN "two" END`,
+		`CASE x + y WHEN z THEN "same" ELSE "different" END`,
+		`eq(CASE WHEN exists(x) THEN x END, "5")`,
+	} {
+		exp, err := expr.ParseExpression(exprText)
+		require.NoError(t, err, exprText)
+		by, err := json.Marshal(exp.Expr())
+		require.NoError(t, err)
+		en := &expr.Expr{}
+		require.NoError(t, json.Unmarshal(by, en))
+		nn, err := expr.NodeFromExpr(en)
+		require.NoError(t, err, string(by))
+		assert.Equal(t, exprText, nn.String())
+		assert.True(t, nn.Equal(exp), "%s doesn't match %s", exprText, nn)
+	}
+
+	_, err := expr.NodeFromExpr(&expr.Expr{Op: "case", Args: []*expr.Expr{{Identity: "x"}}})
+	assert.Error(t, err, "a case needs a WHEN")
+}
+
 func TestNodeJson(t *testing.T) {
 	t.Parallel()
 	for _, exprText := range pbTests {
@@ -49,6 +49,12 @@ type TokenPager interface {
 }
 
 // SchemaInfo is interface for a Column type
+// ParamPager is a TokenPager which collects the placeholders of a prepared
+// statement as they are parsed, see ParamNode.
+type ParamPager interface {
+	AddParam(n *ParamNode)
+}
+
 type SchemaInfo interface {
 	Key() string
 }
@@ -283,16 +289,17 @@ https://developer.mozilla.org/en-US/docs/Web/JavaScript/Reference/Operators/Oper
 http://www.postgresql.org/docs/9.4/static/sql-syntax-lexical.html#SQL-PRECEDENCE
 
 TODO:
- - if/else, case, for
+ - for
  - call stack & vars
 --------------------------------------
 Or(O) -> A {( "||" | OR  ) A}
 And(A) -> C {( "&&" | AND ) C}
-BinaryComparison(C) -> P {( "==" | "!=" | ">" | ">=" | "<" | "<=" | "LIKE" | "IN" | "CONTAINS" | "INTERSECTS") P}
+BinaryComparison(C) -> P {( "==" | "!=" | ">" | ">=" | "<" | "<=" | "LIKE" | "IN" | "CONTAINS" | "INTERSECTS" | "IS" ["NOT"]) P}
 MathAddSub(P) -> M {( "+" | "-" ) M}
 MathMultiDiv(M) -> F {( "*" | "/" ) F}
 UnaryComparison(F) -> v | "(" O ")" | "!" v | "-" O | "NOT" C | "EXISTS" v | "IS" O | "AND (" O ")" | "OR (" O ")"
-base(v) -> value | Func | "INCLUDE" <identity>
+base(v) -> value | Func | Case | "INCLUDE" <identity>
+Case -> "CASE" [O] "WHEN" O "THEN" O {"WHEN" O "THEN" O} ["ELSE" O] "END"
 Func -> <identity> "(" value {"," value} ")"
 value -> number | "string" | O | <identity>
 
@@ -371,14 +378,14 @@ func (t *tree) BinaryComparison(depth int) Node {
 			t.Next()
 			return NewUnary(cur, t.cInner(n, depth+1))
 		case lex.TokenIs:
+			// x IS NULL, x IS NOT NULL, x IS TRUE
 			t.Next()
+			op := lex.Token{T: lex.TokenIs, V: "IS"}
 			if t.Cur().T == lex.TokenNegate {
-				cur = t.Next()
-				ne := lex.Token{T: lex.TokenNE, V: "!="}
-				return NewBinaryNode(ne, n, t.MathAddSub(depth+1))
+				t.Next()
+				op = lex.Token{T: lex.TokenIsNot, V: "IS NOT"}
 			}
-			u.Warnf("TokenIS?  is this supported?")
-			return NewUnary(cur, t.cInner(n, depth+1))
+			return NewBinaryNode(op, n, t.MathAddSub(depth+1))
 		default:
 			return t.cInner(n, depth)
 		}
@@ -415,6 +422,10 @@ func (t *tree) cInner(n Node, depth int) Node {
 				}
 				return NewBinaryNode(cur, n, NewValueNode(val))
 			case lex.TokenLeftParenthesis:
+				if t.Peek().T == lex.TokenSelect {
+					// x IN (SELECT ...)
+					return NewBinaryNode(cur, n, t.SubQuery(depth))
+				}
 				// This is a special type of Binary? its 2nd argument is a array node
 				return NewBinaryNode(cur, n, t.ArrayNode(depth))
 			case lex.TokenUdfExpr:
@@ -613,6 +624,16 @@ func (t *tree) base(depth int) Node {
 	case lex.TokenNull:
 		t.Next()
 		return NewNull(cur)
+	case lex.TokenParam:
+		n, err := NewParamNode(cur)
+		if err != nil {
+			t.error(err)
+		}
+		if pp, ok := t.TokenPager.(ParamPager); ok {
+			pp.AddParam(n)
+		}
+		t.Next()
+		return n
 	// This really should be only TokenStar, but the lexer emits TokenMultiply as of (3.16.23).
 	case lex.TokenStar, lex.TokenMultiply:
 		n := NewStringNoQuoteNode(cur.V)
@@ -631,7 +652,12 @@ func (t *tree) base(depth int) Node {
 	case lex.TokenUdfExpr:
 		t.Next() // consume Function Name
 		return t.Func(depth, cur)
+	case lex.TokenCase:
+		return t.Case(depth)
 	case lex.TokenLeftParenthesis:
+		if t.Peek().T == lex.TokenSelect {
+			return t.SubQuery(depth)
+		}
 		t.Next() // Consume  (
 		n := t.Or(depth + 1)
 		debugf(depth, "v: paren  T:%T  %v   cur:%v", n, n, t.Cur())
@@ -703,8 +729,20 @@ func (t *tree) Func(depth int, funcTok lex.Token) (fn *FuncNode) {
 			t.unexpected(t.Cur(), "func AS exected Identity")
 		}
 		fn.append(NewStringNodeToken(t.Next()))
+		if t.Cur().T == lex.TokenRightParenthesis {
+			t.Next()
+		}
 		return fn
 	default:
+		if cur := t.Cur(); cur.T == lex.TokenIdentity && strings.ToLower(cur.V) == "distinct" {
+			// An aggregate of distinct values   count(DISTINCT x)
+			switch t.Peek().T {
+			case lex.TokenComma, lex.TokenRightParenthesis:
+			default:
+				fn.Distinct = true
+				t.Next()
+			}
+		}
 		lastComma := false
 		for {
 			node = nil
@@ -772,6 +810,52 @@ func (t *tree) Func(depth int, funcTok lex.Token) (fn *FuncNode) {
 	}
 }
 
+// Case parses a searched   CASE WHEN x > 5 THEN 1 ELSE 0 END
+// or simple   CASE x WHEN 1 THEN "one" END   case expression.
+func (t *tree) Case(depth int) Node {
+	debugf(depth, "Case: %v", t.Cur())
+	t.Next() // Consume CASE
+
+	n := &CaseNode{}
+	if t.Cur().T != lex.TokenWhen {
+		n.Operand = t.Or(depth + 1)
+	}
+	for t.Cur().T == lex.TokenWhen {
+		t.Next() // Consume WHEN
+		when := t.Or(depth + 1)
+		t.expect(lex.TokenThen, "Expected THEN in CASE")
+		t.Next() // Consume THEN
+		then := t.Or(depth + 1)
+		n.Whens = append(n.Whens, when)
+		n.Thens = append(n.Thens, then)
+	}
+	if len(n.Whens) == 0 {
+		t.unexpected(t.Cur(), "Expected WHEN in CASE")
+	}
+	if t.Cur().T == lex.TokenElse {
+		t.Next() // Consume ELSE
+		n.Else = t.Or(depth + 1)
+	}
+	t.expect(lex.TokenEnd, "Expected END to close CASE")
+	t.Next()
+	return n
+}
+
+// SubQuery a parenthesized select statement, which only the pager knows
+// how to parse.
+func (t *tree) SubQuery(depth int) Node {
+	debugf(depth, "SubQuery: %v", t.Cur())
+	sp, ok := t.TokenPager.(SubQueryParser)
+	if !ok {
+		t.unexpected(t.Peek(), "sub query not supported")
+	}
+	stmt, err := sp.ParseSubQuery()
+	if err != nil {
+		t.error(err)
+	}
+	return NewSubQueryNode(stmt)
+}
+
 // get Function from Global function registry.
 func (t *tree) getFunction(name string) (fn Func, ok bool) {
 	if t.fr != nil {
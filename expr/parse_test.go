@@ -332,6 +332,58 @@ var exprTests = []exprTest{
 		`AND ( x == "y", stuff == x )`,
 		true,
 	},
+	// Case expressions
+	{
+		`case when x > 5 then "big" when x > 2 then "medium" else "small" end`,
+		`CASE WHEN x > 5 THEN "big" WHEN x > 2 THEN "medium" ELSE "small" END`,
+		true,
+	},
+	{
+		`CASE x WHEN 1 THEN "one" WHEN 2 THEN "two" END`,
+		`CASE x WHEN 1 THEN "one" WHEN 2 THEN "two" END`,
+		true,
+	},
+	{
+		`tostring(CASE WHEN exists(x) AND y = "a" THEN x + 1 ELSE 0 END) == "1"`,
+		`tostring(CASE WHEN exists(x) AND y = "a" THEN x + 1 ELSE 0 END) == "1"`,
+		true,
+	},
+	{
+		`CASE WHEN x > 5 THEN CASE y WHEN "a" THEN 1 END END`,
+		`CASE WHEN x > 5 THEN CASE y WHEN "a" THEN 1 END END`,
+		true,
+	},
+	{
+		`CASE x END`, // at least one WHEN
+		"",
+		false,
+	},
+	{
+		`CASE WHEN x > 5 "big" END`, // missing THEN
+		"",
+		false,
+	},
+	{
+		`CASE WHEN x > 5 THEN "big"`, // missing END
+		"",
+		false,
+	},
+	// IS [NOT] NULL
+	{
+		`x IS NULL`,
+		`x IS NULL`,
+		true,
+	},
+	{
+		`x is not null AND y > 1`,
+		`x IS NOT NULL AND y > 1`,
+		true,
+	},
+	{
+		`x IS NOT TRUE`,
+		`x IS NOT TRUE`,
+		true,
+	},
 }
 
 func TestParseExpressions(t *testing.T) {
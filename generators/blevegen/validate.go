@@ -41,6 +41,8 @@ func (m *TypeValidator) walkNode(node expr.Node) error {
 		return nil
 	case *expr.FuncNode:
 		return m.funcExpr(n)
+	case *expr.CaseNode:
+		return m.caseNode(n)
 	default:
 		gou.Warnf("not handled type validation %v %T", node, node)
 		return fmt.Errorf("blevegen: unsupported node in expression: %T (%s)", node, node)
@@ -118,6 +120,25 @@ func (m *TypeValidator) triNode(_ *expr.TriNode) error {
 	return nil
 }
 
+func (m *TypeValidator) caseNode(n *expr.CaseNode) error {
+	args := append(append([]expr.Node{}, n.Thens...), n.Else)
+	if n.Operand != nil {
+		args = append(args, n.Operand)
+	} else {
+		args = append(args, n.Whens...)
+	}
+	for _, arg := range args {
+		if in, ok := arg.(*expr.IdentityNode); arg == nil || ok && in.IsBooleanIdentity() {
+			// no ELSE, or a true/false result
+			continue
+		}
+		if err := m.walkNode(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *TypeValidator) funcExpr(_ *expr.FuncNode) error {
 	return nil
 }
@@ -88,6 +88,8 @@ func (fg *FilterGenerator) walkExpr(node expr.Node, depth int) (any, error) {
 		filter, err = fg.walkExpr(n.ExprNode, depth+1)
 	case *expr.FuncNode:
 		filter, err = fg.funcExpr(n, depth+1)
+	case *expr.CaseNode:
+		filter, err = fg.caseExpr(n, depth+1)
 	case *expr.StringNode:
 		// Special case for *.
 		iv := strings.ToLower(n.Text)
@@ -220,6 +222,15 @@ func (fg *FilterGenerator) binaryExpr(node *expr.BinaryNode, _ int) (any, error)
 		}
 		return NotFilter(Term(lhs.Field, rhs)), nil
 
+	case lex.TokenIs, lex.TokenIsNot: // ident(0) IS [NOT] NULL
+		if _, ok := node.Args[1].(*expr.NullNode); !ok {
+			return nil, fmt.Errorf("unsupported second argument for IS: %s expr: %s", node.Args[1].NodeType(), node.Args[1])
+		}
+		if op == lex.TokenIs {
+			return NotFilter(Exists(lhs)), nil
+		}
+		return Exists(lhs), nil
+
 	case lex.TokenContains: // ident CONTAINS literal
 		rhsstr := ""
 		switch rhst := node.Args[1].(type) {
@@ -292,6 +303,55 @@ func (fg *FilterGenerator) triExpr(node *expr.TriNode, _ int) (any, error) {
 	return nil, fmt.Errorf("unsupported ternary expression: %s", node.Operator.T)
 }
 
+// caseExpr a CASE used as a filter matches when the THEN of the first
+// matching WHEN matches, or the ELSE if no WHEN does.
+//
+//	CASE WHEN a THEN b WHEN c THEN d ELSE e END
+//	=> (a AND b) OR (NOT a AND c AND d) OR (NOT a AND NOT c AND e)
+func (fg *FilterGenerator) caseExpr(node *expr.CaseNode, depth int) (any, error) {
+	nots := make([]any, 0, len(node.Whens))
+	items := make([]any, 0, len(node.Whens)+1)
+	for i, when := range node.Whens {
+		if node.Operand != nil {
+			// CASE x WHEN 1 THEN ...  is   x = 1
+			when = expr.NewBinaryNode(lex.Token{T: lex.TokenEqual, V: "="}, node.Operand, when)
+		}
+		cond, err := fg.walkExpr(when, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if !isFalse(node.Thens[i]) {
+			then, err := fg.walkExpr(node.Thens[i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			clauses := append(append(make([]any, 0, len(nots)+2), nots...), cond, then)
+			items = append(items, AndFilter(clauses))
+		}
+		nots = append(nots, NotFilter(cond))
+	}
+	if node.Else != nil && !isFalse(node.Else) {
+		els, err := fg.walkExpr(node.Else, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, AndFilter(append(nots, els)))
+	}
+	switch len(items) {
+	case 0:
+		return MatchNone, nil
+	case 1:
+		return items[0], nil
+	}
+	return OrFilter(items), nil
+}
+
+// isFalse is the node the literal false, a CASE result that never matches
+func isFalse(n expr.Node) bool {
+	in, ok := n.(*expr.IdentityNode)
+	return ok && in.IsBooleanIdentity() && !in.Bool()
+}
+
 func (fg *FilterGenerator) funcExpr(node *expr.FuncNode, _ int) (any, error) {
 	switch node.Name {
 	case "timewindow":
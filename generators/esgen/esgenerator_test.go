@@ -63,6 +63,34 @@ func TestWalk(t *testing.T) {
 				assert.Equal(t, "bob", tm.Term["x"])
 			},
 		},
+		{
+			name: "TestIsNotNull",
+			filter: func(t *testing.T) *rel.FilterStatement {
+				fs, err := rel.ParseFilterQL(`FILTER x IS NOT NULL`)
+				require.NoError(t, err)
+				return fs
+			},
+			asserts: func(t *testing.T, res *gentypes.Payload) {
+				e, ok := res.Filter.(*exists)
+				require.True(t, ok, "%T", res.Filter)
+				assert.Equal(t, "x", e.Exists["field"])
+			},
+		},
+		{
+			name: "TestIsNull",
+			filter: func(t *testing.T) *rel.FilterStatement {
+				fs, err := rel.ParseFilterQL(`FILTER x IS NULL`)
+				require.NoError(t, err)
+				return fs
+			},
+			asserts: func(t *testing.T, res *gentypes.Payload) {
+				b, ok := res.Filter.(*BoolFilter)
+				require.True(t, ok, "%T", res.Filter)
+				e, ok := b.Occurs.MustNot.(*exists)
+				require.True(t, ok, "%T", b.Occurs.MustNot)
+				assert.Equal(t, "x", e.Exists["field"])
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
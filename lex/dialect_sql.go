@@ -11,6 +11,7 @@ var (
 	// SqlDialect is a SQL dialect
 	//
 	//    SELECT
+	//    WITH
 	//    UPDATE
 	//    INSERT
 	//    UPSERT
@@ -31,6 +32,7 @@ var (
 		Statements: []*Clause{
 			{Token: TokenPrepare, Clauses: SqlPrepare},
 			{Token: TokenSelect, Clauses: SqlSelect},
+			{Token: TokenWith, Clauses: SqlWith},
 			{Token: TokenUpdate, Clauses: SqlUpdate},
 			{Token: TokenUpsert, Clauses: SqlUpsert},
 			{Token: TokenInsert, Clauses: SqlInsert},
@@ -59,11 +61,16 @@ var (
 		{Token: TokenHaving, Lexer: LexConditionalClause, Optional: true, Name: "sqlSelect.having"},
 		{Token: TokenOrderBy, Lexer: LexOrderByColumn, Optional: true, Name: "sqlSelect.orderby"},
 		{Token: TokenLimit, Lexer: LexLimit, Optional: true, Name: "sqlSelect.limit"},
-		{Token: TokenOffset, Lexer: LexNumber, Optional: true, Name: "sqlSelect.offset"},
+		{Token: TokenOffset, Lexer: LexNumberOrParam, Optional: true, Name: "sqlSelect.offset"},
 		{Token: TokenWith, Lexer: LexJsonOrKeyValue, Optional: true, Name: "sqlSelect.with"},
 		{Token: TokenAlias, Lexer: LexIdentifier, Optional: true, Name: "sqlSelect.alias"},
+		{KeywordMatcher: setOpMatch, Lexer: LexSetOperator, Optional: true, Name: "sqlSelect.setop"},
 		{Token: TokenEOF, Lexer: LexEndOfStatement, Optional: false, Name: "sqlSelect.eos"},
 	}
+	// SqlWith common table expressions, followed by the select that uses them.
+	SqlWith = []*Clause{
+		{Token: TokenWith, Lexer: LexCommonTableExprs, Name: "sqlWith.with"},
+	}
 	fromSource = []*Clause{
 		{KeywordMatcher: sourceMatch, Lexer: LexTableReferenceFirst, Name: "fromSource.matcher"},
 		{Token: TokenSelect, Lexer: LexSelectClause, Name: "fromSource.Select"},
@@ -73,7 +80,7 @@ var (
 		{Token: TokenGroupBy, Lexer: LexColumns, Optional: true, Name: "fromSource.GroupBy"},
 		{Token: TokenOrderBy, Lexer: LexOrderByColumn, Optional: true, Name: "fromSource.OrderBy"},
 		{Token: TokenLimit, Lexer: LexLimit, Optional: true, Name: "fromSource.Limit"},
-		{Token: TokenOffset, Lexer: LexNumber, Optional: true, Name: "fromSource.Offset"},
+		{Token: TokenOffset, Lexer: LexNumberOrParam, Optional: true, Name: "fromSource.Offset"},
 		{Token: TokenRightParenthesis, Lexer: LexEndOfSubStatement, Optional: true, Name: "fromSource.EndParen"},
 		{Token: TokenAs, Lexer: LexIdentifier, Optional: true, Name: "fromSource.As"},
 		{Token: TokenOn, Lexer: LexConditionalClause, Optional: true, Name: "fromSource.On"},
@@ -87,7 +94,7 @@ var (
 		{Token: TokenGroupBy, Lexer: LexColumns, Optional: true, Name: "moreSources.GroupBy"},
 		{Token: TokenOrderBy, Lexer: LexOrderByColumn, Optional: true, Name: "moreSources.OrderBy"},
 		{Token: TokenLimit, Lexer: LexLimit, Optional: true, Name: "moreSources.Limit"},
-		{Token: TokenOffset, Lexer: LexNumber, Optional: true, Name: "moreSources.Offset"},
+		{Token: TokenOffset, Lexer: LexNumberOrParam, Optional: true, Name: "moreSources.Offset"},
 		{Token: TokenRightParenthesis, Lexer: LexEndOfSubStatement, Optional: false, Name: "moreSources.EndParen"},
 		{Token: TokenAs, Lexer: LexIdentifier, Optional: true, Name: "moreSources.As"},
 		{Token: TokenOn, Lexer: LexConditionalClause, Optional: true, Name: "moreSources.On"},
@@ -228,12 +235,123 @@ func sourceMatch(c *Clause, peekWord string, l *Lexer) bool {
 		return true
 	case "select":
 		return true
-	case "left", "right", "inner", "outer", "join":
+	case "left", "right", "full", "inner", "outer", "join":
+		return true
+	}
+	return false
+}
+
+// find a set operator that combines two selects
+//
+//	UNION | INTERSECT | EXCEPT
+func setOpMatch(c *Clause, peekWord string, l *Lexer) bool {
+	switch peekWord {
+	case "union", "intersect", "except":
 		return true
 	}
 	return false
 }
 
+// LexSetOperator lexes the set operator between two selects and then
+// starts over lexing the next select statement.
+//
+//	<select> (UNION | INTERSECT | EXCEPT) [ALL | DISTINCT] <select>
+func LexSetOperator(l *Lexer) StateFn {
+	l.SkipWhiteSpaces()
+	word := strings.ToLower(l.PeekWord())
+	switch word {
+	case "union":
+		l.ConsumeWord(word)
+		l.Emit(TokenUnion)
+	case "intersect":
+		l.ConsumeWord(word)
+		l.Emit(TokenIntersect)
+	case "except":
+		l.ConsumeWord(word)
+		l.Emit(TokenExcept)
+	default:
+		return l.errorToken("expected UNION, INTERSECT or EXCEPT but got: " + word)
+	}
+	l.SkipWhiteSpaces()
+	switch word = strings.ToLower(l.PeekWord()); word {
+	case "all":
+		l.ConsumeWord(word)
+		l.Emit(TokenAll)
+	case "distinct":
+		l.ConsumeWord(word)
+		l.Emit(TokenDistinct)
+	}
+	l.SkipWhiteSpaces()
+	l.curClause = l.statement.Clauses[0]
+	return LexMatchClosure(TokenSelect, LexSelectClause)
+}
+
+// LexCommonTableExprs lexes the named queries of a WITH and then starts
+// lexing the select statement which follows them.
+//
+//	WITH [RECURSIVE] <name> [(<column>, ...)] AS (<select>) [, ...] <select>
+func LexCommonTableExprs(l *Lexer) StateFn {
+	l.SkipWhiteSpaces()
+	if l.IsEnd() {
+		return nil
+	}
+	switch l.Peek() {
+	case '(':
+		// optional list of column names
+		l.Next()
+		l.Emit(TokenLeftParenthesis)
+		l.Push("LexCommonTableExprs", LexCommonTableExprs)
+		return lexCteColumns
+	case ',':
+		l.Next()
+		l.Emit(TokenComma)
+		return LexCommonTableExprs
+	}
+	word := strings.ToLower(l.PeekWord())
+	switch {
+	case word == "recursive" && l.lastToken.T == TokenWith:
+		l.ConsumeWord(word)
+		l.Emit(TokenRecursive)
+		return LexCommonTableExprs
+	case word == "as":
+		l.ConsumeWord(word)
+		l.Emit(TokenAs)
+		l.Push("LexCommonTableExprs", LexCommonTableExprs)
+		return LexSubSelect
+	case word == "select":
+		for _, stmt := range l.dialect.Statements {
+			if stmt.Token == TokenSelect {
+				l.statement = stmt
+				l.curClause = stmt.Clauses[0]
+				return LexMatchClosure(TokenSelect, LexSelectClause)
+			}
+		}
+		return l.errorToken("dialect does not support select: " + word)
+	}
+	l.Push("LexCommonTableExprs", LexCommonTableExprs)
+	return LexIdentifier
+}
+
+// lexCteColumns the column names of a common table expression, after (
+func lexCteColumns(l *Lexer) StateFn {
+	l.SkipWhiteSpaces()
+	switch l.Peek() {
+	case ')':
+		l.Next()
+		l.Emit(TokenRightParenthesis)
+		return nil
+	case ',':
+		l.Next()
+		l.Emit(TokenComma)
+		return lexCteColumns
+	}
+	if l.IsEnd() {
+		return l.errorToken("un-terminated column list")
+	}
+	l.Push("lexCteColumns", lexCteColumns)
+	return LexIdentifier
+}
+
 // LexEndOfSubStatement Look for end of statement defined by either
 // a semicolon or end of file.
 func LexEndOfSubStatement(l *Lexer) StateFn {
@@ -363,6 +481,7 @@ func LexInto(l *Lexer) StateFn {
 //	LIMIT 1000 OFFSET 100
 //	LIMIT 0, 1000
 //	LIMIT 1000
+//	LIMIT ? OFFSET ?
 func LexLimit(l *Lexer) StateFn {
 
 	l.SkipWhiteSpaces()
@@ -377,11 +496,11 @@ func LexLimit(l *Lexer) StateFn {
 	case ",":
 		l.ConsumeWord(keyWord)
 		l.Emit(TokenComma)
-		return LexNumber
+		return LexNumberOrParam
 	default:
-		if isDigit(l.Peek()) {
+		if r := l.Peek(); isDigit(r) || r == '?' || r == '$' {
 			l.Push("LexLimit", LexLimit)
-			return LexNumber
+			return LexNumberOrParam
 		}
 	}
 	return nil
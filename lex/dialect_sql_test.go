@@ -380,4 +380,27 @@ func TestLexSqlSelect(t *testing.T) {
 			tv(TokenOffset, "OFFSET"),
 			tv(TokenInteger, "100"),
 		})
+	// placeholders of a prepared statement
+	verifyTokens(t, `SELECT a FROM tbl LIMIT ? OFFSET $2`,
+		[]Token{
+			tv(TokenSelect, "SELECT"),
+			tv(TokenIdentity, "a"),
+			tv(TokenFrom, "FROM"),
+			tv(TokenIdentity, "tbl"),
+			tv(TokenLimit, "LIMIT"),
+			tv(TokenParam, "?"),
+			tv(TokenOffset, "OFFSET"),
+			tv(TokenParam, "$2"),
+		})
+	verifyTokens(t, `SELECT a FROM tbl LIMIT ?, ?`,
+		[]Token{
+			tv(TokenSelect, "SELECT"),
+			tv(TokenIdentity, "a"),
+			tv(TokenFrom, "FROM"),
+			tv(TokenIdentity, "tbl"),
+			tv(TokenLimit, "LIMIT"),
+			tv(TokenParam, "?"),
+			tv(TokenComma, ","),
+			tv(TokenParam, "?"),
+		})
 }
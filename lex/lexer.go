@@ -151,6 +151,10 @@ type Lexer struct {
 	// during lex, using push/pop to add and remove states needing evaluation
 	stack      []NamedStateFn
 	depthLimit int
+
+	// depth of nested CASE expressions, WHEN, THEN, ELSE, END are only
+	// keywords inside of one
+	caseDepth int
 }
 
 func (l *Lexer) init() {
@@ -626,7 +630,8 @@ func (l *Lexer) isNextKeyword(peekWord string) bool {
 		}
 		// TODO:  allow clauses to reserve keywords, or sub-clause
 		switch kwMaybe {
-		case "select", "insert", "delete", "update", "from", "inner", "outer":
+		case "select", "insert", "delete", "update", "from", "inner", "outer",
+			"union", "intersect", "except":
 			//u.Warnf("doing true: %v", kwMaybe)
 			return true
 		}
@@ -639,6 +644,23 @@ func (l *Lexer) isNextKeyword(peekWord string) bool {
 	return false
 }
 
+// non-consuming check to see if we are about to find a join keyword that
+// starts the next source, ie   ON a.x = b.x LEFT JOIN ...  as opposed to
+// a function of the same name such as left(str, 2)
+func (l *Lexer) isJoinKeyword(peekWord string) bool {
+	switch peekWord {
+	case "left", "right", "full", "join":
+	default:
+		return false
+	}
+	rest := strings.TrimLeftFunc(l.input[l.pos:], unicode.IsSpace)
+	if len(rest) < len(peekWord) {
+		return false
+	}
+	rest = strings.TrimLeftFunc(rest[len(peekWord):], unicode.IsSpace)
+	return !strings.HasPrefix(rest, "(")
+}
+
 // non-consuming isIdentity
 // Identities are non-numeric string values that are not quoted
 func (l *Lexer) isIdentity() bool {
@@ -936,6 +958,8 @@ func LexEmpty(l *Lexer) StateFn { return nil }
 //	1.23  -> [float] = 1.23
 //	100   -> [integer] = 100
 //	["hello","world"]  -> [array] {"hello","world"}
+//	?     -> [param] = ?
+//	$1    -> [param] = $1
 func LexValue(l *Lexer) StateFn {
 
 	l.SkipWhiteSpaces()
@@ -960,6 +984,20 @@ func LexValue(l *Lexer) StateFn {
 		}
 		l.Emit(TokenLeftBracket)
 		return LexJsonArray
+	case '?':
+		// placeholder of a prepared statement
+		l.Emit(TokenParam)
+		return nil
+	case '$':
+		// numbered placeholder of a prepared statement   $1
+		if !unicode.IsDigit(l.Peek()) {
+			return l.errorToken("expected number after $")
+		}
+		for unicode.IsDigit(l.Peek()) {
+			l.Next()
+		}
+		l.Emit(TokenParam)
+		return nil
 	case '\'', '"':
 		// quoted string, allows escaping
 		firstRune := rune
@@ -1101,6 +1139,9 @@ func LexExpressionOrIdentity(l *Lexer) StateFn {
 		l.Push("LexParenRight", LexParenRight)
 		return LexExpressionOrIdentity
 	}
+	if state, ok := lexCase(l); ok {
+		return state
+	}
 	// u.Debugf("LexExpressionOrIdentity identity?%v expr?%v %v peek5='%v'", l.isIdentity(), l.isExpr(), string(l.Peek()), string(l.PeekX(5)))
 	// Expressions end in Parens:     LOWER(item)
 	if l.isExpr() {
@@ -1115,6 +1156,46 @@ func LexExpressionOrIdentity(l *Lexer) StateFn {
 	}
 }
 
+// lexCase the keywords of a CASE expression
+//
+//	CASE [<expr>] WHEN <expr> THEN <expr> [WHEN ...] [ELSE <expr>] END
+func lexCase(l *Lexer) (StateFn, bool) {
+	word := strings.ToLower(l.PeekWord())
+	switch word {
+	case "case":
+		l.caseDepth++
+		l.ConsumeWord(word)
+		l.Emit(TokenCase)
+	case "when", "then", "else":
+		if l.caseDepth == 0 {
+			return nil, false
+		}
+		l.ConsumeWord(word)
+		switch word {
+		case "when":
+			l.Emit(TokenWhen)
+		case "then":
+			l.Emit(TokenThen)
+		default:
+			l.Emit(TokenElse)
+		}
+	case "end":
+		if l.caseDepth == 0 {
+			return nil, false
+		}
+		l.caseDepth--
+		l.ConsumeWord(word)
+		l.Emit(TokenEnd)
+		if l.curClause != nil {
+			return l.clauseState(), true
+		}
+		return LexExpression, true
+	default:
+		return nil, false
+	}
+	return LexExpression, true
+}
+
 // look for either an Identity or Value
 func LexIdentityOrValue(l *Lexer) StateFn {
 
@@ -1677,6 +1758,92 @@ func LexSubQuery(l *Lexer) StateFn {
 	return LexSelectClause
 }
 
+// isSubSelect is the input at a parenthesized select, ie a subquery
+// nested in an expression (does not consume).
+//
+//	x IN (SELECT ...)
+func (l *Lexer) isSubSelect() bool {
+	if l.Peek() != '(' {
+		return false
+	}
+	rest := strings.TrimLeftFunc(l.input[l.pos+1:], unicode.IsSpace)
+	if len(rest) < 6 || !strings.EqualFold(rest[:6], "select") {
+		return false
+	}
+	if len(rest) > 6 {
+		r, _ := utf8.DecodeRuneInString(rest[6:])
+		return !IsIdentifierRune(r)
+	}
+	return true
+}
+
+// matchingParen the position of the ) closing the paren opened just
+// before current position, skipping quoted strings.  -1 if un-terminated.
+func (l *Lexer) matchingParen() int {
+	depth := 1
+	for i := l.pos; i < len(l.input); i++ {
+		switch c := l.input[i]; c {
+		case '\'', '"', '`':
+			for i++; i < len(l.input) && l.input[i] != c; i++ {
+				if l.input[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// LexSubSelect lexes a parenthesized select nested in an expression
+//
+//	user_id IN (SELECT user_id FROM orders)
+//	EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.user_id)
+//	price > (SELECT avg(price) FROM orders)
+//
+// The select is lexed as its own statement by a nested lexer, whose
+// tokens are emitted in place, so subqueries may be nested to any depth.
+func LexSubSelect(l *Lexer) StateFn {
+
+	l.SkipWhiteSpaces()
+	if l.Next() != '(' {
+		return l.errorToken("expected ( to start sub-select " + l.current())
+	}
+	l.Emit(TokenLeftParenthesis)
+	end := l.matchingParen()
+	if end < 0 {
+		return l.errorToken("un-terminated sub-select " + l.current())
+	}
+	offset, line := l.pos, l.line
+	sub := NewLexer(l.input[l.pos:end], l.dialect)
+
+	var nested StateFn
+	nested = func(l *Lexer) StateFn {
+		tok := sub.NextToken()
+		if tok.T == TokenEOF {
+			l.pos, l.start = end, end
+			l.Next()
+			l.Emit(TokenRightParenthesis)
+			return nil
+		}
+		tok.Pos += offset
+		tok.Line += line
+		l.lastToken = tok
+		l.tokens <- tok
+		if tok.T == TokenError {
+			return nil
+		}
+		return nested
+	}
+	return nested
+}
+
 // Handle prepared statements
 //
 // <PREPARE_STMT> := PREPARE <identity>	FROM <string_value>
@@ -1735,6 +1902,10 @@ func LexSelectList(l *Lexer) StateFn {
 		l.Push("LexSelectList", LexSelectList)
 		return LexIdentifier
 	case "if":
+		if strings.ToLower(l.PeekX(3)) == "if(" {
+			// if(cond, a, b) is a function, not a guard
+			break
+		}
 		l.skipX(2)
 		l.Emit(TokenIf)
 		l.Push("LexSelectList", LexSelectList)
@@ -1750,7 +1921,7 @@ func LexSelectList(l *Lexer) StateFn {
 //	<sources>      := <source> [, <join_clause> <source>]*
 //	<source>       := ( <table_source> | <subselect> ) [AS <identifier>]
 //	<table_source> := <identifier>
-//	<join_clause>  := (INNER | LEFT | OUTER)? JOIN [ON <conditional_clause>]
+//	<join_clause>  := (INNER | [LEFT | RIGHT | FULL] OUTER)? JOIN [ON <conditional_clause>]
 //	<subselect>    := '(' <select_stmt> ')'
 func LexTableReferenceFirst(l *Lexer) StateFn {
 
@@ -1814,7 +1985,7 @@ func LexTableReferenceFirst(l *Lexer) StateFn {
 			l.Push("LexTableReferenceFirst", LexTableReferenceFirst)
 			return LexExpressionOrIdentity
 		}
-		if l.isNextKeyword(word) {
+		if l.isNextKeyword(word) || l.isJoinKeyword(word) {
 			//u.Warnf("found keyword? %v ", word)
 			return nil
 		}
@@ -1839,7 +2010,7 @@ func LexTableReferenceFirst(l *Lexer) StateFn {
 //	<sources>      := <source> [, <join_clause> <source>]*
 //	<source>       := ( <table_source> | <subselect> ) [AS <identifier>]
 //	<table_source> := <identifier>
-//	<join_clause>  := (INNER | LEFT | OUTER)? JOIN [ON <conditional_clause>]
+//	<join_clause>  := (INNER | [LEFT | RIGHT | FULL] OUTER)? JOIN [ON <conditional_clause>]
 //	<subselect>    := '(' <select_stmt> ')'
 func LexTableReferences(l *Lexer) StateFn {
 
@@ -1909,6 +2080,10 @@ func LexTableReferences(l *Lexer) StateFn {
 		l.ConsumeWord(word)
 		l.Emit(TokenRight)
 		return LexTableReferences
+	case "full":
+		l.ConsumeWord(word)
+		l.Emit(TokenFull)
+		return LexTableReferences
 	case "join":
 		l.ConsumeWord(word)
 		l.Emit(TokenJoin)
@@ -1963,7 +2138,7 @@ func LexTableReferences(l *Lexer) StateFn {
 //	<sources>      := <source> [, <join_clause> <source>]*
 //	<source>       := ( <table_source> | <subselect> ) [AS <identifier>]
 //	<table_source> := <identifier>
-//	<join_clause>  := (INNER | LEFT | OUTER)? JOIN [ON <conditional_clause>]
+//	<join_clause>  := (INNER | [LEFT | RIGHT | FULL] OUTER)? JOIN [ON <conditional_clause>]
 //	<subselect>    := '(' <select_stmt> ')'
 func LexJoinEntry(l *Lexer) StateFn {
 
@@ -2018,6 +2193,10 @@ func LexJoinEntry(l *Lexer) StateFn {
 		l.ConsumeWord(word)
 		l.Emit(TokenRight)
 		return LexJoinEntry
+	case "full":
+		l.ConsumeWord(word)
+		l.Emit(TokenFull)
+		return LexJoinEntry
 	case "join":
 		l.ConsumeWord(word)
 		l.Emit(TokenJoin)
@@ -2189,6 +2368,10 @@ func LexConditionalClause(l *Lexer) StateFn {
 		//l.Push("LexParenRight", LexParenRight)
 		return nil
 	case '(':
+		if l.isSubSelect() {
+			l.Push("LexConditionalClause", LexConditionalClause)
+			return LexSubSelect
+		}
 		l.Next()
 		l.Emit(TokenLeftParenthesis)
 		l.Push("LexConditionalClause", LexConditionalClause)
@@ -2207,7 +2390,7 @@ func LexConditionalClause(l *Lexer) StateFn {
 		l.Push("LexExpression", LexExpression)
 		return LexExpression(l)
 	}
-	if l.isNextKeyword(word) {
+	if l.isNextKeyword(word) || l.isJoinKeyword(word) {
 		//u.Infof("is keyword %v", word)
 		return nil
 	}
@@ -2301,6 +2484,13 @@ func LexExpression(l *Lexer) StateFn {
 		u.Warnf("un-handled? ")
 	case '(': // this is a logical Grouping/Ordering and must be a single
 		// logically valid expression
+		l.backup()
+		if l.isSubSelect() {
+			//  price > (SELECT avg(price) FROM orders)
+			l.Push("LexExpression", l.clauseState())
+			return LexSubSelect
+		}
+		l.Next()
 		l.Push("LexParenRight", LexParenRight)
 		l.Emit(TokenLeftParenthesis)
 		l.Push("LexExpression", l.clauseState())
@@ -2423,14 +2613,12 @@ func LexExpression(l *Lexer) StateFn {
 			l.ConsumeWord(word)
 			l.Emit(TokenIN)
 			l.SkipWhiteSpaces()
+			if l.isSubSelect() {
+				return LexSubSelect
+			}
 			if l.PeekX(1) == "(" {
 				l.ConsumeWord("(")
 				l.Emit(TokenLeftParenthesis)
-				l.SkipWhiteSpaces()
-				word = strings.ToLower(l.PeekWord())
-				if word == "select" {
-					return nil
-				}
 				l.Push("LexParenRight", LexParenRight)
 				return LexListOfArgs
 			}
@@ -2468,10 +2656,18 @@ func LexExpression(l *Lexer) StateFn {
 		l.ConsumeWord(word)
 		l.Emit(TokenInclude)
 		return LexIdentifier
+	case "over":
+		if l.lastToken.T == TokenRightParenthesis {
+			//  row_number() OVER (PARTITION BY user_id)
+			l.ConsumeWord(word)
+			l.Emit(TokenOver)
+			l.Push("LexExpression", l.clauseState())
+			return LexWindow
+		}
 	case "exists":
 		l.ConsumeWord(word)
 		r = l.Peek()
-		if r == '(' {
+		if r == '(' && !l.isSubSelect() {
 			l.Emit(TokenUdfExpr)
 			l.ConsumeWord("(")
 			l.Emit(TokenLeftParenthesis)
@@ -2480,6 +2676,11 @@ func LexExpression(l *Lexer) StateFn {
 			return LexExpression
 		}
 		l.Emit(TokenExists)
+		l.SkipWhiteSpaces()
+		if l.isSubSelect() {
+			//  EXISTS (SELECT 1 FROM orders WHERE ...)
+			return LexSubSelect
+		}
 		return LexExpression
 	case "is":
 		l.ConsumeWord(word)
@@ -2566,7 +2767,7 @@ func LexExpression(l *Lexer) StateFn {
 			l.Push("LexExpression", l.clauseState())
 			return LexExpressionOrIdentity
 		}
-		if l.isNextKeyword(word) {
+		if l.isNextKeyword(word) || l.isJoinKeyword(word) {
 			return nil
 		}
 	}
@@ -2605,6 +2806,12 @@ func LexOrderByColumn(l *Lexer) StateFn {
 		return LexExpressionOrIdentity
 	}
 
+	if l.caseDepth > 0 {
+		// inside of  CASE ... END  the operators of expressions
+		l.Push("LexOrderByColumn", LexOrderByColumn)
+		return LexExpression
+	}
+
 	word := strings.ToLower(l.PeekWord())
 	//u.Debugf("word: %v", word)
 	if l.isNextKeyword(word) {
@@ -2620,6 +2827,11 @@ func LexOrderByColumn(l *Lexer) StateFn {
 		l.ConsumeWord(word)
 		l.Emit(TokenDesc)
 		return LexOrderByColumn
+	case "nulls":
+		if !lexNulls(l) {
+			return l.errorToken("expected NULLS FIRST or NULLS LAST")
+		}
+		return LexOrderByColumn
 	default:
 		if len(l.stack) < 2 {
 			l.Push("LexOrderByColumn", LexOrderByColumn)
@@ -2633,6 +2845,123 @@ func LexOrderByColumn(l *Lexer) StateFn {
 	return nil
 }
 
+// lexNulls the position of NULL values of an ORDER BY column
+//
+//	NULLS FIRST | NULLS LAST
+func lexNulls(l *Lexer) bool {
+	l.ConsumeWord("nulls")
+	// keep the whitespace between the words in the token value
+	for isWhiteSpace(l.Peek()) {
+		l.Next()
+	}
+	switch second := strings.ToLower(l.PeekWord()); second {
+	case "first":
+		l.ConsumeWord(second)
+		l.Emit(TokenNullsFirst)
+	case "last":
+		l.ConsumeWord(second)
+		l.Emit(TokenNullsLast)
+	default:
+		return false
+	}
+	return true
+}
+
+// LexWindow the window of an analytic function, OVER has already been
+// consumed.
+//
+//	OVER ( [PARTITION BY <expr> [, <expr>]*] [ORDER BY <expr> [ASC | DESC] [NULLS FIRST | NULLS LAST] [, ...]] [<frame>] )
+//
+//	<frame> := (ROWS | RANGE) ( <bound> | BETWEEN <bound> AND <bound> )
+//	<bound> := UNBOUNDED (PRECEDING | FOLLOWING) | CURRENT ROW | <int> (PRECEDING | FOLLOWING)
+func LexWindow(l *Lexer) StateFn {
+
+	l.SkipWhiteSpaces()
+	if l.IsEnd() {
+		return l.errorToken("expected ) to end window")
+	}
+
+	r := l.Peek()
+	switch {
+	case r == '(' && l.lastToken.T == TokenOver:
+		l.Next()
+		l.Emit(TokenLeftParenthesis)
+		return LexWindow
+	case r == ')':
+		l.Next()
+		l.Emit(TokenRightParenthesis)
+		return nil
+	case r == ',':
+		l.Next()
+		l.Emit(TokenComma)
+		l.Push("LexWindow", LexWindow)
+		return LexExpressionOrIdentity
+	case isDigit(r):
+		l.Push("LexWindow", LexWindow)
+		return LexNumber
+	}
+
+	word := strings.ToLower(l.PeekWord())
+	switch word {
+	case "partition", "order", "current":
+		second := map[string]string{"partition": "by", "order": "by", "current": "row"}[word]
+		l.ConsumeWord(word)
+		if strings.ToLower(l.PeekWord()) != second {
+			return l.errorToken(fmt.Sprintf("expected %s %s", word, second))
+		}
+		// keep the whitespace between the words in the token value
+		for isWhiteSpace(l.Peek()) {
+			l.Next()
+		}
+		l.ConsumeWord(second)
+		switch word {
+		case "partition":
+			l.Emit(TokenPartitionBy)
+		case "order":
+			l.Emit(TokenOrderBy)
+		case "current":
+			l.Emit(TokenCurrentRow)
+			return LexWindow
+		}
+		l.Push("LexWindow", LexWindow)
+		return LexExpressionOrIdentity
+	case "asc":
+		l.ConsumeWord(word)
+		l.Emit(TokenAsc)
+	case "desc":
+		l.ConsumeWord(word)
+		l.Emit(TokenDesc)
+	case "nulls":
+		if !lexNulls(l) {
+			return l.errorToken("expected NULLS FIRST or NULLS LAST")
+		}
+	case "rows":
+		l.ConsumeWord(word)
+		l.Emit(TokenRows)
+	case "range":
+		l.ConsumeWord(word)
+		l.Emit(TokenRange)
+	case "between":
+		l.ConsumeWord(word)
+		l.Emit(TokenBetween)
+	case "and":
+		l.ConsumeWord(word)
+		l.Emit(TokenLogicAnd)
+	case "unbounded":
+		l.ConsumeWord(word)
+		l.Emit(TokenUnbounded)
+	case "preceding":
+		l.ConsumeWord(word)
+		l.Emit(TokenPreceding)
+	case "following":
+		l.ConsumeWord(word)
+		l.Emit(TokenFollowing)
+	default:
+		return l.errorToken("unexpected window clause " + word)
+	}
+	return LexWindow
+}
+
 // Lex either Json or Key/Value pairs
 //
 //	Must start with { or [ for json
@@ -3004,6 +3333,31 @@ func LexNumber(l *Lexer) StateFn {
 	return nil
 }
 
+// LexNumberOrParam a number, or the placeholder of a prepared statement
+// in its place
+//
+//	LIMIT ? OFFSET $2
+func LexNumberOrParam(l *Lexer) StateFn {
+	l.SkipWhiteSpaces()
+	switch l.Peek() {
+	case '?':
+		l.Next()
+		l.Emit(TokenParam)
+		return nil
+	case '$':
+		l.Next()
+		if !unicode.IsDigit(l.Peek()) {
+			return l.errorToken("expected number after $")
+		}
+		for unicode.IsDigit(l.Peek()) {
+			l.Next()
+		}
+		l.Emit(TokenParam)
+		return nil
+	}
+	return LexNumber(l)
+}
+
 // LexNumberOrDuration floats, integers, hex, exponential, signed
 //
 //	1.23
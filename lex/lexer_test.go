@@ -684,6 +684,80 @@ func TestLexSqlJoin(t *testing.T) {
 		})
 }
 
+func TestLexSqlOuterJoin(t *testing.T) {
+
+	verifyTokenTypes(t, `
+		SELECT
+			t1.name, t2.salary
+		FROM employee AS t1
+		LEFT JOIN info AS t2
+			ON t1.name = t2.name
+		FULL OUTER JOIN orders AS t3
+			ON t3.id = t2.id;`,
+		[]TokenType{TokenSelect,
+			TokenIdentity, TokenComma, TokenIdentity,
+			TokenFrom, TokenIdentity, TokenAs, TokenIdentity,
+			TokenLeft, TokenJoin, TokenIdentity, TokenAs, TokenIdentity,
+			TokenOn, TokenIdentity, TokenEqual, TokenIdentity,
+			TokenFull, TokenOuter, TokenJoin, TokenIdentity, TokenAs, TokenIdentity,
+			TokenOn, TokenIdentity, TokenEqual, TokenIdentity,
+		})
+}
+
+func TestLexSqlSetOperators(t *testing.T) {
+
+	verifyTokenTypes(t, `
+		SELECT name FROM employee WHERE age > 10
+		UNION ALL
+		SELECT name FROM info
+		EXCEPT
+		SELECT name FROM orders ORDER BY name LIMIT 5;`,
+		[]TokenType{TokenSelect, TokenIdentity,
+			TokenFrom, TokenIdentity,
+			TokenWhere, TokenIdentity, TokenGT, TokenInteger,
+			TokenUnion, TokenAll,
+			TokenSelect, TokenIdentity, TokenFrom, TokenIdentity,
+			TokenExcept,
+			TokenSelect, TokenIdentity, TokenFrom, TokenIdentity,
+			TokenOrderBy, TokenIdentity, TokenLimit, TokenInteger,
+		})
+
+	verifyTokenTypes(t, `SELECT name FROM employee INTERSECT DISTINCT SELECT name FROM info`,
+		[]TokenType{TokenSelect, TokenIdentity, TokenFrom, TokenIdentity,
+			TokenIntersect, TokenDistinct,
+			TokenSelect, TokenIdentity, TokenFrom, TokenIdentity,
+		})
+}
+
+func TestLexSqlWindow(t *testing.T) {
+
+	verifyTokenTypes(t, `SELECT lag(event, 1) OVER (PARTITION BY user_id ORDER BY ts DESC) AS prev FROM events`,
+		[]TokenType{TokenSelect,
+			TokenUdfExpr, TokenLeftParenthesis, TokenIdentity, TokenComma, TokenInteger, TokenRightParenthesis,
+			TokenOver, TokenLeftParenthesis,
+			TokenPartitionBy, TokenIdentity,
+			TokenOrderBy, TokenIdentity, TokenDesc,
+			TokenRightParenthesis,
+			TokenAs, TokenIdentity,
+			TokenFrom, TokenIdentity,
+		})
+
+	verifyTokenTypes(t, `SELECT sum(x) OVER (ORDER BY ts ROWS BETWEEN 2 PRECEDING AND CURRENT ROW),
+			count(x) over (rows unbounded preceding) FROM events`,
+		[]TokenType{TokenSelect,
+			TokenUdfExpr, TokenLeftParenthesis, TokenIdentity, TokenRightParenthesis,
+			TokenOver, TokenLeftParenthesis,
+			TokenOrderBy, TokenIdentity,
+			TokenRows, TokenBetween, TokenInteger, TokenPreceding, TokenLogicAnd, TokenCurrentRow,
+			TokenRightParenthesis, TokenComma,
+			TokenUdfExpr, TokenLeftParenthesis, TokenIdentity, TokenRightParenthesis,
+			TokenOver, TokenLeftParenthesis,
+			TokenRows, TokenUnbounded, TokenPreceding,
+			TokenRightParenthesis,
+			TokenFrom, TokenIdentity,
+		})
+}
+
 func TestLexSqlSubQuery(t *testing.T) {
 
 	verifyTokenTypes(t, `select
@@ -699,6 +773,57 @@ func TestLexSqlSubQuery(t *testing.T) {
 			TokenGT, TokenInteger,
 			TokenRightParenthesis,
 		})
+
+	verifyTokenTypes(t, `SELECT user_id FROM users AS u
+		WHERE NOT EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id = u.user_id)
+			AND price > (SELECT avg(price) FROM orders)`,
+		[]TokenType{TokenSelect, TokenIdentity,
+			TokenFrom, TokenIdentity, TokenAs, TokenIdentity,
+			TokenWhere, TokenNegate, TokenExists,
+			TokenLeftParenthesis, TokenSelect, TokenInteger,
+			TokenFrom, TokenIdentity, TokenAs, TokenIdentity,
+			TokenWhere, TokenIdentity, TokenEqual, TokenIdentity,
+			TokenRightParenthesis,
+			TokenLogicAnd, TokenIdentity, TokenGT,
+			TokenLeftParenthesis, TokenSelect,
+			TokenUdfExpr, TokenLeftParenthesis, TokenIdentity, TokenRightParenthesis,
+			TokenFrom, TokenIdentity,
+			TokenRightParenthesis,
+		})
+}
+
+func TestLexSqlWith(t *testing.T) {
+
+	verifyTokenTypes(t, `WITH big AS (SELECT user_id FROM orders WHERE price > 10),
+			named (id) AS (SELECT user_id FROM users)
+		SELECT id FROM named INNER JOIN big ON big.user_id = named.id`,
+		[]TokenType{TokenWith,
+			TokenIdentity, TokenAs,
+			TokenLeftParenthesis, TokenSelect, TokenIdentity, TokenFrom, TokenIdentity,
+			TokenWhere, TokenIdentity, TokenGT, TokenInteger, TokenRightParenthesis,
+			TokenComma,
+			TokenIdentity, TokenLeftParenthesis, TokenIdentity, TokenRightParenthesis, TokenAs,
+			TokenLeftParenthesis, TokenSelect, TokenIdentity, TokenFrom, TokenIdentity, TokenRightParenthesis,
+			TokenSelect, TokenIdentity, TokenFrom, TokenIdentity,
+			TokenInner, TokenJoin, TokenIdentity, TokenOn, TokenIdentity, TokenEqual, TokenIdentity,
+		})
+
+	verifyTokenTypes(t, `WITH RECURSIVE org AS (
+			SELECT id, name FROM employees WHERE manager_id IS NULL
+			UNION ALL
+			SELECT e.id, e.name FROM employees AS e INNER JOIN org AS o ON e.manager_id = o.id
+		) SELECT name FROM org`,
+		[]TokenType{TokenWith, TokenRecursive,
+			TokenIdentity, TokenAs, TokenLeftParenthesis,
+			TokenSelect, TokenIdentity, TokenComma, TokenIdentity, TokenFrom, TokenIdentity,
+			TokenWhere, TokenIdentity, TokenIs, TokenNull,
+			TokenUnion, TokenAll,
+			TokenSelect, TokenIdentity, TokenComma, TokenIdentity, TokenFrom, TokenIdentity, TokenAs, TokenIdentity,
+			TokenInner, TokenJoin, TokenIdentity, TokenAs, TokenIdentity,
+			TokenOn, TokenIdentity, TokenEqual, TokenIdentity,
+			TokenRightParenthesis,
+			TokenSelect, TokenIdentity, TokenFrom, TokenIdentity,
+		})
 }
 
 func TestLexSqlPreparedStmt(t *testing.T) {
@@ -713,6 +838,26 @@ func TestLexSqlPreparedStmt(t *testing.T) {
 			tv(TokenValue, `SELECT SQRT(POW(?,2) + POW(?,2)) AS hypotenuse`),
 			tv(TokenEOS, ";"),
 		})
+
+	verifyTokens(t, `SELECT a FROM t WHERE x > ? AND y IN ($1, $12)`,
+		[]Token{
+			tv(TokenSelect, "SELECT"),
+			tv(TokenIdentity, "a"),
+			tv(TokenFrom, "FROM"),
+			tv(TokenIdentity, "t"),
+			tv(TokenWhere, "WHERE"),
+			tv(TokenIdentity, "x"),
+			tv(TokenGT, ">"),
+			tv(TokenParam, "?"),
+			tv(TokenLogicAnd, "AND"),
+			tv(TokenIdentity, "y"),
+			tv(TokenIN, "IN"),
+			tv(TokenLeftParenthesis, "("),
+			tv(TokenParam, "$1"),
+			tv(TokenComma, ","),
+			tv(TokenParam, "$12"),
+			tv(TokenRightParenthesis, ")"),
+		})
 }
 
 func TestLexGroupBy(t *testing.T) {
@@ -821,6 +966,63 @@ func TestLexOrderBy(t *testing.T) {
 		})
 }
 
+func TestLexOrderByNulls(t *testing.T) {
+	verifyTokens(t, "SELECT a FROM b ORDER BY a DESC NULLS FIRST, c NULLS  last",
+		[]Token{
+			tv(TokenSelect, "SELECT"),
+			tv(TokenIdentity, "a"),
+			tv(TokenFrom, "FROM"),
+			tv(TokenIdentity, "b"),
+			tv(TokenOrderBy, "ORDER BY"),
+			tv(TokenIdentity, "a"),
+			tv(TokenDesc, "DESC"),
+			tv(TokenNullsFirst, "NULLS FIRST"),
+			tv(TokenComma, ","),
+			tv(TokenIdentity, "c"),
+			tv(TokenNullsLast, "NULLS  last"),
+		})
+}
+
+func TestLexCase(t *testing.T) {
+	verifyTokens(t, `SELECT CASE WHEN x > 5 THEN "big" ELSE "small" END AS size, end_date
+	FROM t WHERE CASE x WHEN 1 THEN true END ORDER BY CASE WHEN y THEN 0 END DESC`,
+		[]Token{
+			tv(TokenSelect, "SELECT"),
+			tv(TokenCase, "CASE"),
+			tv(TokenWhen, "WHEN"),
+			tv(TokenIdentity, "x"),
+			tv(TokenGT, ">"),
+			tv(TokenInteger, "5"),
+			tv(TokenThen, "THEN"),
+			tv(TokenValue, "big"),
+			tv(TokenElse, "ELSE"),
+			tv(TokenValue, "small"),
+			tv(TokenEnd, "END"),
+			tv(TokenAs, "AS"),
+			tv(TokenIdentity, "size"),
+			tv(TokenComma, ","),
+			tv(TokenIdentity, "end_date"),
+			tv(TokenFrom, "FROM"),
+			tv(TokenIdentity, "t"),
+			tv(TokenWhere, "WHERE"),
+			tv(TokenCase, "CASE"),
+			tv(TokenIdentity, "x"),
+			tv(TokenWhen, "WHEN"),
+			tv(TokenInteger, "1"),
+			tv(TokenThen, "THEN"),
+			tv(TokenIdentity, "true"),
+			tv(TokenEnd, "END"),
+			tv(TokenOrderBy, "ORDER BY"),
+			tv(TokenCase, "CASE"),
+			tv(TokenWhen, "WHEN"),
+			tv(TokenIdentity, "y"),
+			tv(TokenThen, "THEN"),
+			tv(TokenInteger, "0"),
+			tv(TokenEnd, "END"),
+			tv(TokenDesc, "DESC"),
+		})
+}
+
 func TestLexTSQL(t *testing.T) {
 	verifyTokens(t, `
 	SELECT ProductID, Name, p_name AS pn
@@ -121,6 +121,7 @@ const (
 	TokenNull             TokenType = 88 // NULL
 	TokenContains         TokenType = 89 // CONTAINS
 	TokenIntersects       TokenType = 90 // INTERSECTS
+	TokenIsNot            TokenType = 91 // IS NOT, the operator of x IS NOT NULL
 
 	// ql top-level keywords, these first keywords determine parser
 	TokenPrepare   TokenType = 200
@@ -142,33 +143,50 @@ const (
 	TokenCommit    TokenType = 216
 
 	// Other QL Keywords, These are clause-level keywords that mark separation between clauses
-	TokenFrom     TokenType = 300 // from
-	TokenWhere    TokenType = 301 // where
-	TokenHaving   TokenType = 302 // having
-	TokenGroupBy  TokenType = 303 // group by
-	TokenBy       TokenType = 304 // by
-	TokenAlias    TokenType = 305 // alias
-	TokenWith     TokenType = 306 // with
-	TokenValues   TokenType = 307 // values
-	TokenInto     TokenType = 308 // into
-	TokenLimit    TokenType = 309 // limit
-	TokenOrderBy  TokenType = 310 // order by
-	TokenInner    TokenType = 311 // inner , ie of join
-	TokenCross    TokenType = 312 // cross
-	TokenOuter    TokenType = 313 // outer
-	TokenLeft     TokenType = 314 // left
-	TokenRight    TokenType = 315 // right
-	TokenJoin     TokenType = 316 // Join
-	TokenOn       TokenType = 317 // on
-	TokenDistinct TokenType = 318 // DISTINCT
-	TokenAll      TokenType = 319 // all
-	TokenInclude  TokenType = 320 // INCLUDE
-	TokenExists   TokenType = 321 // EXISTS
-	TokenOffset   TokenType = 322 // OFFSET
-	TokenFull     TokenType = 323 // FULL
-	TokenGlobal   TokenType = 324 // GLOBAL
-	TokenSession  TokenType = 325 // SESSION
-	TokenTables   TokenType = 326 // TABLES
+	TokenFrom        TokenType = 300 // from
+	TokenWhere       TokenType = 301 // where
+	TokenHaving      TokenType = 302 // having
+	TokenGroupBy     TokenType = 303 // group by
+	TokenBy          TokenType = 304 // by
+	TokenAlias       TokenType = 305 // alias
+	TokenWith        TokenType = 306 // with
+	TokenValues      TokenType = 307 // values
+	TokenInto        TokenType = 308 // into
+	TokenLimit       TokenType = 309 // limit
+	TokenOrderBy     TokenType = 310 // order by
+	TokenInner       TokenType = 311 // inner , ie of join
+	TokenCross       TokenType = 312 // cross
+	TokenOuter       TokenType = 313 // outer
+	TokenLeft        TokenType = 314 // left
+	TokenRight       TokenType = 315 // right
+	TokenJoin        TokenType = 316 // Join
+	TokenOn          TokenType = 317 // on
+	TokenDistinct    TokenType = 318 // DISTINCT
+	TokenAll         TokenType = 319 // all
+	TokenInclude     TokenType = 320 // INCLUDE
+	TokenExists      TokenType = 321 // EXISTS
+	TokenOffset      TokenType = 322 // OFFSET
+	TokenFull        TokenType = 323 // FULL
+	TokenGlobal      TokenType = 324 // GLOBAL
+	TokenSession     TokenType = 325 // SESSION
+	TokenTables      TokenType = 326 // TABLES
+	TokenUnion       TokenType = 327 // UNION
+	TokenIntersect   TokenType = 328 // INTERSECT
+	TokenExcept      TokenType = 329 // EXCEPT
+	TokenOver        TokenType = 330 // OVER
+	TokenPartitionBy TokenType = 331 // partition by
+	TokenRows        TokenType = 332 // ROWS
+	TokenRange       TokenType = 333 // RANGE
+	TokenUnbounded   TokenType = 334 // UNBOUNDED
+	TokenPreceding   TokenType = 335 // PRECEDING
+	TokenFollowing   TokenType = 336 // FOLLOWING
+	TokenCurrentRow  TokenType = 337 // current row
+	TokenRecursive   TokenType = 338 // RECURSIVE
+	TokenCase        TokenType = 339 // CASE
+	TokenWhen        TokenType = 340 // WHEN
+	TokenThen        TokenType = 341 // THEN
+	TokenElse        TokenType = 342 // ELSE
+	TokenEnd         TokenType = 343 // END
 
 	// ddl major words
 	TokenSchema         TokenType = 400 // SCHEMA
@@ -202,6 +220,9 @@ const (
 	TokenDesc TokenType = 503 // descending
 	TokenUse  TokenType = 504 // use
 
+	TokenNullsFirst TokenType = 505 // nulls first
+	TokenNullsLast  TokenType = 506 // nulls last
+
 	// User defined function/expression
 	TokenUdfExpr TokenType = 550
 
@@ -211,6 +232,7 @@ const (
 	TokenValueEscaped TokenType = 602 // '' becomes ' inside the string, parser will need to replace the string
 	TokenRegex        TokenType = 603 // regex
 	TokenDuration     TokenType = 604 // 14d , 22w, 3y, 45ms, 45us, 24hr, 2h, 45m, 30s
+	TokenParam        TokenType = 605 // ? or $1 placeholder of a prepared statement
 
 	// Data Type Definitions
 	TokenTypeDef     TokenType = 999
@@ -300,6 +322,7 @@ var (
 		TokenNegate:     {Kw: "not", Description: "NOT"},
 		TokenBetween:    {Kw: "between", Description: "between"},
 		TokenIs:         {Kw: "is", Description: "IS"},
+		TokenIsNot:      {Kw: "is not", Description: "IS NOT"},
 		TokenNull:       {Kw: "null", Description: "NULL"},
 		TokenContains:   {Kw: "contains", Description: "contains"},
 		TokenIntersects: {Kw: "intersects", Description: "intersects"},
@@ -342,27 +365,44 @@ var (
 		TokenHaving:  {Description: "having"},
 		TokenGroupBy: {Description: "group by"},
 		// Other Ql Keywords
-		TokenAlias:    {Description: "alias"},
-		TokenWith:     {Description: "with"},
-		TokenValues:   {Description: "values"},
-		TokenLimit:    {Description: "limit"},
-		TokenOrderBy:  {Description: "order by"},
-		TokenInner:    {Description: "inner"},
-		TokenCross:    {Description: "cross"},
-		TokenOuter:    {Description: "outer"},
-		TokenLeft:     {Description: "left"},
-		TokenRight:    {Description: "right"},
-		TokenJoin:     {Description: "join"},
-		TokenOn:       {Description: "on"},
-		TokenDistinct: {Description: "distinct"},
-		TokenAll:      {Description: "all"},
-		TokenInclude:  {Description: "include"},
-		TokenExists:   {Description: "exists"},
-		TokenOffset:   {Description: "offset"},
-		TokenFull:     {Description: "full"},
-		TokenGlobal:   {Description: "global"},
-		TokenSession:  {Description: "session"},
-		TokenTables:   {Description: "tables"},
+		TokenAlias:       {Description: "alias"},
+		TokenWith:        {Description: "with"},
+		TokenValues:      {Description: "values"},
+		TokenLimit:       {Description: "limit"},
+		TokenOrderBy:     {Description: "order by"},
+		TokenInner:       {Description: "inner"},
+		TokenCross:       {Description: "cross"},
+		TokenOuter:       {Description: "outer"},
+		TokenLeft:        {Description: "left"},
+		TokenRight:       {Description: "right"},
+		TokenJoin:        {Description: "join"},
+		TokenOn:          {Description: "on"},
+		TokenDistinct:    {Description: "distinct"},
+		TokenAll:         {Description: "all"},
+		TokenInclude:     {Description: "include"},
+		TokenExists:      {Description: "exists"},
+		TokenOffset:      {Description: "offset"},
+		TokenFull:        {Description: "full"},
+		TokenGlobal:      {Description: "global"},
+		TokenSession:     {Description: "session"},
+		TokenTables:      {Description: "tables"},
+		TokenUnion:       {Description: "union"},
+		TokenIntersect:   {Description: "intersect"},
+		TokenExcept:      {Description: "except"},
+		TokenOver:        {Description: "over"},
+		TokenPartitionBy: {Description: "partition by"},
+		TokenRows:        {Description: "rows"},
+		TokenRange:       {Description: "range"},
+		TokenUnbounded:   {Description: "unbounded"},
+		TokenPreceding:   {Description: "preceding"},
+		TokenFollowing:   {Description: "following"},
+		TokenCurrentRow:  {Description: "current row"},
+		TokenRecursive:   {Description: "recursive"},
+		TokenCase:        {Description: "case"},
+		TokenWhen:        {Description: "when"},
+		TokenThen:        {Description: "then"},
+		TokenElse:        {Description: "else"},
+		TokenEnd:         {Description: "end"},
 
 		// ddl keywords
 		TokenSchema:         {Description: "schema"},
@@ -394,12 +434,16 @@ var (
 		TokenDesc: {Description: "desc"},
 		TokenUse:  {Description: "use"},
 
+		TokenNullsFirst: {Description: "nulls first"},
+		TokenNullsLast:  {Description: "nulls last"},
+
 		// special value types
 		TokenIdentity:     {Description: "identity"},
 		TokenValue:        {Description: "value"},
 		TokenValueEscaped: {Description: "value-escaped"},
 		TokenRegex:        {Description: "regex"},
 		TokenDuration:     {Description: "duration"},
+		TokenParam:        {Description: "param"},
 
 		// Data TYPES:  ie type system
 		TokenTypeDef:     {Description: "TypeDef"}, // Generic DataType
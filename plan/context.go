@@ -2,6 +2,7 @@ package plan
 
 import (
 	"math/rand"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
@@ -50,13 +51,18 @@ type Context struct {
 	Session expr.ContextReadWriter // Session for this connection
 	Schema  *schema.Schema         // this schema for this connection
 	Funcs   expr.FuncResolver      // Local/Dialect specific functions
+	Tx      *schema.Transaction    // transaction begun on this connection, sources are opened in it
 
 	// From configuration
 	DisableRecover bool
+	MemoryBudget   int64  // bytes of rows an operator may hold before spilling to disk, 0 = unlimited
+	TempDir        string // directory for spill files, defaults to os.TempDir()
+	StrictNulls    bool   // WHERE, HAVING and projections use SQL three valued NULL logic, not lenient FilterQL
 
 	// Local State
 	Errors     []error
 	errRecover any
+	ctes       map[string]*CteTable // common table expressions in scope, by lower-case name
 }
 
 // NewContext plan context
@@ -64,6 +70,71 @@ func NewContext(query string) *Context {
 	return &Context{Raw: query}
 }
 
+// subContext the context to plan sub query @stmt of this context's statement,
+// it shares the schema, session, configuration and common table expressions
+// but has its own projection.
+func (m *Context) subContext(stmt rel.SqlStatement) *Context {
+	ctx := &Context{
+		Context:        m.Context,
+		SchemaName:     m.SchemaName,
+		Raw:            stmt.String(),
+		Stmt:           stmt,
+		Session:        m.Session,
+		Schema:         m.Schema,
+		Funcs:          m.Funcs,
+		Tx:             m.Tx,
+		DisableRecover: m.DisableRecover,
+		MemoryBudget:   m.MemoryBudget,
+		TempDir:        m.TempDir,
+		StrictNulls:    m.StrictNulls,
+		ctes:           make(map[string]*CteTable, len(m.ctes)),
+	}
+	for name, cte := range m.ctes {
+		ctx.ctes[name] = cte
+	}
+	return ctx
+}
+
+// OpenConn open a connection to @table of source @ds, inside the
+// transaction begun on this connection if there is one.
+func (m *Context) OpenConn(ds schema.Source, table string) (schema.Conn, error) {
+	if m != nil && m.Tx != nil {
+		return m.Tx.Open(ds, table)
+	}
+	return ds.Open(table)
+}
+
+// OpenTable open a connection to @table of this context's schema, inside the
+// transaction begun on this connection if there is one.
+func (m *Context) OpenTable(table string) (schema.Conn, error) {
+	if m.Tx == nil {
+		return m.Schema.OpenConn(table)
+	}
+	ss, err := m.Schema.SchemaForTable(table)
+	if err != nil {
+		return nil, err
+	}
+	return m.Tx.Open(ss.DS, strings.ToLower(table))
+}
+
+// cte the common table expression in scope read by @from, nil if it
+// reads a table of the schema.
+func (m *Context) cte(from *rel.SqlSource) *CteTable {
+	if from == nil || from.Schema != "" {
+		return nil
+	}
+	return m.ctes[strings.ToLower(from.Name)]
+}
+
+// table the schema of table @name, a common table expression in scope
+// or else a table of the schema.
+func (m *Context) table(name string) (*schema.Table, error) {
+	if cte, ok := m.ctes[strings.ToLower(name)]; ok {
+		return cte.Tbl, nil
+	}
+	return m.Schema.Table(name)
+}
+
 // called by go routines/tasks to ensure any recovery panics are captured
 func (m *Context) Recover() {
 	if m == nil {
@@ -0,0 +1,257 @@
+package plan
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lytics/qlbridge/rel"
+)
+
+var (
+	// ExplainColumns columns of the rows of EXPLAIN, one row per task of
+	// the plan, see ExplainNode.Rows
+	ExplainColumns = []string{"id", "parent_id", "task", "parallel", "detail"}
+	// ExplainAnalyzeColumns columns of the rows of EXPLAIN ANALYZE, one row
+	// per exec task with its runtime statistics
+	ExplainAnalyzeColumns = []string{"id", "parent_id", "task", "rows_in", "rows_out", "bytes", "wall_ms", "blocked_ms"}
+	// ExplainJsonColumns column of the single row of EXPLAIN FORMAT=JSON
+	ExplainJsonColumns = []string{"explain"}
+)
+
+// ExplainNode describes one task of a plan, and the tasks it reads from.
+type ExplainNode struct {
+	Task     string         `json:"task"`
+	Parallel bool           `json:"parallel,omitempty"`
+	Detail   string         `json:"detail,omitempty"`
+	Children []*ExplainNode `json:"children,omitempty"`
+}
+
+// WalkExplain plan the statement being explained.
+func (m *PlannerDefault) WalkExplain(p *Explain) error {
+	pln, err := WalkStmt(m.Ctx, p.Stmt.Stmt, m.Planner)
+	if err != nil {
+		return err
+	}
+	p.Plan = pln
+	return nil
+}
+
+// ExplainResultColumns the columns of the result rows of an EXPLAIN
+func ExplainResultColumns(stmt *rel.SqlDescribe) []string {
+	switch {
+	case stmt.Format == "json":
+		return ExplainJsonColumns
+	case stmt.Analyze:
+		return ExplainAnalyzeColumns
+	}
+	return ExplainColumns
+}
+
+// Columns of the result rows of the explain
+func (m *Explain) Columns() []string { return ExplainResultColumns(m.Stmt) }
+
+// Rows the result rows of the explain, see Columns.  The runtime statistics
+// of EXPLAIN ANALYZE are only known to the executor which runs the plan.
+func (m *Explain) Rows() ([][]driver.Value, error) {
+	if m.Plan == nil {
+		return nil, ErrNoPlan
+	}
+	if m.Stmt.Analyze {
+		return nil, ErrNotImplemented
+	}
+	node := ExplainTask(m.Plan)
+	if m.Stmt.Format == "json" {
+		by, err := json.MarshalIndent(node, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return [][]driver.Value{{string(by)}}, nil
+	}
+	return node.Rows(), nil
+}
+
+// Rows flattens the tree depth first into rows of ExplainColumns, a
+// parent_id of 0 is the root.
+func (m *ExplainNode) Rows() [][]driver.Value {
+	rows := make([][]driver.Value, 0)
+	var walk func(n *ExplainNode, parent int64)
+	walk = func(n *ExplainNode, parent int64) {
+		id := int64(len(rows) + 1)
+		rows = append(rows, []driver.Value{id, parent, n.Task, n.Parallel, n.Detail})
+		for _, c := range n.Children {
+			walk(c, id)
+		}
+	}
+	walk(m, 0)
+	return rows
+}
+
+// ExplainTask describe the task and its children.  Sub plans which are not
+// children (the sides of joins and set operations, sub queries, common
+// table expressions) come first as they are the inputs of the task.
+func ExplainTask(t Task) *ExplainNode {
+	n := &ExplainNode{Parallel: t.IsParallel()}
+	var details []string
+	detail := func(format string, args ...any) {
+		details = append(details, fmt.Sprintf(format, args...))
+	}
+	var subs []Task
+	switch p := t.(type) {
+	case *Select:
+		n.Task = "Select"
+	case *SetOp:
+		n.Task = "SetOp"
+		detail("op=%s", strings.ToUpper(p.Stmt.Op.String()))
+		if p.Stmt.All {
+			detail("all")
+		}
+		subs = append(subs, p.Left, p.Right)
+	case *With:
+		n.Task = "With"
+		for _, cte := range p.Ctes {
+			subs = append(subs, cte)
+		}
+		subs = append(subs, p.Main)
+	case *Cte:
+		n.Task = "Cte"
+		detail("name=%s", p.Stmt.Name)
+		if p.Recursive != nil {
+			detail("recursive=%s", p.Recursive)
+		}
+		subs = append(subs, p.Query)
+	case *Explain:
+		n.Task = "Explain"
+		subs = append(subs, p.Plan)
+	case *Source:
+		n.Task = "Source"
+		explainSource(p, detail)
+	case *Where:
+		n.Task = "Where"
+		filter := p.Filter
+		if filter == nil && p.Stmt != nil && p.Stmt.Where != nil {
+			filter = p.Stmt.Where.Expr
+		}
+		if filter != nil {
+			detail("filter=%s", filter)
+		}
+		if p.Final {
+			detail("final")
+		}
+		for _, sq := range p.SubQueries {
+			subs = append(subs, sq)
+		}
+	case *SubQuery:
+		n.Task = "SubQuery"
+		subs = append(subs, p.Select)
+	case *SemiJoin:
+		n.Task = "SemiJoin"
+		if p.Anti {
+			detail("anti")
+		}
+		if p.In != nil {
+			detail("in=%s", p.In)
+		}
+		for _, k := range p.Key {
+			detail("key=%s", k)
+		}
+		subs = append(subs, p.Sub)
+	case *Having:
+		n.Task = "Having"
+		detail("filter=%s", p.Stmt.Having)
+	case *GroupBy:
+		n.Task = "GroupBy"
+		if len(p.Stmt.GroupBy) > 0 {
+			detail("by=%s", p.Stmt.GroupBy.String())
+		}
+		if p.Partial {
+			detail("partial")
+		}
+	case *Order:
+		n.Task = "Order"
+		detail("by=%s", p.Stmt.OrderBy.String())
+		if p.Limit > 0 {
+			detail("top=%d", p.Limit)
+		}
+		if len(p.Cursor) > 0 {
+			detail("cursor")
+		}
+	case *Window:
+		n.Task = "Window"
+	case *Projection:
+		n.Task = "Projection"
+		if p.Final {
+			detail("final")
+		}
+		if p.Stmt != nil {
+			detail("columns=%s", p.Stmt.Columns.String())
+		}
+	case *JoinMerge:
+		n.Task = "JoinMerge"
+		switch {
+		case p.LeftOuter && p.RightOuter:
+			detail("type=full")
+		case p.LeftOuter:
+			detail("type=left")
+		case p.RightOuter:
+			detail("type=right")
+		default:
+			detail("type=inner")
+		}
+		for i := range p.LeftKey {
+			detail("on=%s = %s", p.LeftKey[i], p.RightKey[i])
+		}
+		if p.Filter != nil {
+			detail("filter=%s", p.Filter)
+		}
+		if p.Seek {
+			detail("seek")
+		}
+		subs = append(subs, p.Left, p.Right)
+	case *Into:
+		n.Task = "Into"
+		detail("table=%s", p.Stmt.Table)
+	default:
+		n.Task = strings.TrimPrefix(fmt.Sprintf("%T", t), "*plan.")
+	}
+	n.Detail = strings.Join(details, ", ")
+	for _, sub := range subs {
+		if sub != nil {
+			n.Children = append(n.Children, ExplainTask(sub))
+		}
+	}
+	for _, c := range t.Children() {
+		n.Children = append(n.Children, ExplainTask(c))
+	}
+	return n
+}
+
+// explainSource the pushdown decisions of a source
+func explainSource(p *Source, detail func(format string, args ...any)) {
+	if p.Stmt == nil {
+		return
+	}
+	detail("source=%s", p.Stmt.SourceName())
+	if p.Stmt.Alias != "" && p.Stmt.Alias != p.Stmt.SourceName() {
+		detail("alias=%s", p.Stmt.Alias)
+	}
+	switch {
+	case p.Complete:
+		detail("pushdown=complete")
+	case p.SourceExec:
+		detail("pushdown=exec")
+	}
+	if p.Cte != nil {
+		detail("cte")
+	}
+	if len(p.Static) > 0 {
+		detail("static")
+	}
+	if p.Offset > 0 {
+		detail("offset=%d", p.Offset)
+	}
+	if p.Stmt.Source != nil {
+		detail("query=%s", p.Stmt.Source)
+	}
+}
@@ -10,8 +10,11 @@ import (
 
 	u "github.com/araddon/gou"
 
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/lex"
 	"github.com/lytics/qlbridge/rel"
 	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
 )
 
 var (
@@ -21,10 +24,16 @@ var (
 	ErrNoDataSource = fmt.Errorf("QLBridge.plan: No datasource found")
 	// ErrNoPlan no plan
 	ErrNoPlan = fmt.Errorf("No Plan")
+	// ErrNotReusable a plan which can not be run again, see Reopen
+	ErrNotReusable = fmt.Errorf("QLBridge.plan: plan can not be run again")
 
 	// Ensure our tasks implement Task Interface
 	_ Task = (*PreparedStatement)(nil)
 	_ Task = (*Select)(nil)
+	_ Task = (*SetOp)(nil)
+	_ Task = (*With)(nil)
+	_ Task = (*Cte)(nil)
+	_ Task = (*Explain)(nil)
 	_ Task = (*Insert)(nil)
 	_ Task = (*Upsert)(nil)
 	_ Task = (*Update)(nil)
@@ -38,8 +47,10 @@ var (
 	_ Task = (*Having)(nil)
 	_ Task = (*GroupBy)(nil)
 	_ Task = (*Order)(nil)
+	_ Task = (*Window)(nil)
+	_ Task = (*SubQuery)(nil)
+	_ Task = (*SemiJoin)(nil)
 	_ Task = (*JoinMerge)(nil)
-	_ Task = (*JoinKey)(nil)
 )
 
 type (
@@ -101,6 +112,16 @@ type (
 		WalkAlter(p *Alter) error
 	}
 
+	// PlannerExtended are the walk methods of the statements added after
+	// the Planner interface, kept out of it so existing planners still
+	// compile.  A Planner which doesn't implement them plans those
+	// statements with the PlannerDefault.
+	PlannerExtended interface {
+		WalkSetOp(p *SetOp) error
+		WalkWith(p *With) error
+		WalkExplain(p *Explain) error
+	}
+
 	// SourcePlanner Sources can often do their own planning for sub-select statements
 	// ie mysql can do its own (select, projection) mongo, es can as well
 	// - provide interface to allow passing down select planning to source
@@ -130,6 +151,45 @@ type (
 		Stmt     *rel.SqlSelect
 		ChildDag bool
 	}
+	// SetOp plan for UNION, INTERSECT, EXCEPT of two queries, Left and
+	// Right are *Select or *SetOp plans.
+	SetOp struct {
+		*PlanBase
+		Ctx   *Context
+		Stmt  *rel.SqlSetOp
+		Left  Task
+		Right Task
+	}
+	// With plan of the common table expressions of a WITH, each is run in
+	// order into its table before Main (a *Select or *SetOp) reads them.
+	With struct {
+		*PlanBase
+		Ctx  *Context
+		Stmt *rel.SqlWith
+		Ctes []*Cte
+		Main Task
+	}
+	// Cte plan of one common table expression, Query (a *Select or *SetOp)
+	// fills Table.  For a recursive expression Query is the anchor, and the
+	// Recursive select is planned again for each iteration to read the rows
+	// found by the previous one.
+	Cte struct {
+		*PlanBase
+		Ctx       *Context
+		Stmt      *rel.SqlCte
+		Table     *CteTable
+		Query     Task
+		Recursive *rel.SqlSelect // recursive select of the UNION, nil if not recursive
+		All       bool           // UNION ALL, keep duplicate rows
+	}
+	// Explain plan of EXPLAIN, the Plan of the statement is described
+	// rather than run.
+	Explain struct {
+		*PlanBase
+		Ctx  *Context
+		Stmt *rel.SqlDescribe
+		Plan Task
+	}
 	// Insert plan
 	Insert struct {
 		*PlanBase
@@ -181,6 +241,7 @@ type (
 		Final      bool
 		Complete   bool
 		SourceExec bool
+		Offset     int // rows to skip, an OFFSET pushed down to a schema.ConnSkipper
 
 		// Schema and underlying Source provider info, not serialized or transported
 		ctx        *Context       // query context, shared across all parts of this request
@@ -190,6 +251,7 @@ type (
 		Tbl        *schema.Table  // Table schema for this From
 		Static     []driver.Value // this is static data source
 		Cols       []string
+		Cte        *CteTable // this is a common table expression of a WITH
 	}
 	// Into Select INTO table
 	Into struct {
@@ -206,12 +268,47 @@ type (
 	Order struct {
 		*PlanBase
 		Stmt *rel.SqlSelect
+		// Limit when > 0 is a Top-N sort, only the first Limit rows
+		// are needed (ORDER BY ... LIMIT) so only they are kept.
+		Limit int
+		// Cursor keyset pagination (WITH cursor=..), the ORDER BY values of
+		// the last row of the previous page, only rows after it are kept.
+		Cursor []value.Value
+	}
+	// Window evaluates analytic function columns over windows of rows
+	//   SELECT lag(event) OVER (PARTITION BY user_id ORDER BY ts) ...
+	Window struct {
+		*PlanBase
+		Stmt *rel.SqlSelect
 	}
 	// Where pre-aggregation filter
 	Where struct {
 		*PlanBase
-		Final bool
-		Stmt  *rel.SqlSelect
+		Final      bool
+		Stmt       *rel.SqlSelect
+		Filter     expr.Node   // Filter expression, the where of Stmt less any semi-joined conditions
+		SubQueries []*SubQuery // Un-correlated sub queries of Filter, run before filtering
+	}
+	// SubQuery a select nested in an expression, planned as its own query
+	//   WHERE user_id IN (SELECT user_id FROM orders)
+	SubQuery struct {
+		*PlanBase
+		Ctx    *Context
+		Node   *expr.SubQueryNode
+		Select *Select
+	}
+	// SemiJoin keeps rows whose key is found (Anti: not found) in the rows of
+	// a sub query, the plan of [NOT] IN and [NOT] EXISTS conditions of a where.
+	// Correlated sub queries are joined on their equality conditions with the
+	// outer query.  Rows of Sub are the value of In (if any) then the Key.
+	//   WHERE EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id = u.user_id)
+	SemiJoin struct {
+		*PlanBase
+		Stmt *rel.SqlSelect
+		Sub  *SubQuery
+		In   expr.Node   // left side of IN, evaluated against outer rows
+		Key  []expr.Node // correlation key, evaluated against outer rows
+		Anti bool
 	}
 	// Having post-aggregation filter plan.
 	Having struct {
@@ -221,16 +318,17 @@ type (
 	// JoinMerge 2 source/input tasks for join
 	JoinMerge struct {
 		*PlanBase
-		Left      Task
-		Right     Task
-		LeftFrom  *rel.SqlSource
-		RightFrom *rel.SqlSource
-		ColIndex  map[string]int
-	}
-	// JoinKey plan
-	JoinKey struct {
-		*PlanBase
-		Source *Source
+		Left       Task
+		Right      Task
+		LeftFrom   *rel.SqlSource
+		RightFrom  *rel.SqlSource
+		ColIndex   map[string]int
+		LeftOuter  bool        // LEFT, FULL OUTER:  keep un-matched left rows
+		RightOuter bool        // RIGHT, FULL OUTER: keep un-matched right rows
+		Seek       bool        // Right side is looked up by primary key per left row instead of scanned
+		LeftKey    []expr.Node // Join key expressions evaluated against left rows
+		RightKey   []expr.Node // Join key expressions evaluated against right rows
+		Filter     expr.Node   // ON conditions other than the keys, evaluated against the joined rows
 	}
 
 	// DDL Tasks
@@ -263,6 +361,10 @@ func WalkStmt(ctx *Context, stmt rel.SqlStatement, planner Planner) (Task, error
 	switch st := stmt.(type) {
 	case *rel.SqlSelect:
 		p = &Select{Stmt: st, PlanBase: base, Ctx: ctx}
+	case *rel.SqlSetOp:
+		p = NewSetOp(ctx, st)
+	case *rel.SqlWith:
+		p = NewWith(ctx, st)
 	case *rel.SqlInsert:
 		p = &Insert{Stmt: st, PlanBase: base}
 	case *rel.SqlUpsert:
@@ -279,6 +381,10 @@ func WalkStmt(ctx *Context, stmt rel.SqlStatement, planner Planner) (Task, error
 		ctx.Stmt = sel
 		p = &Select{Stmt: sel, PlanBase: base, Ctx: ctx}
 	case *rel.SqlDescribe:
+		if st.Stmt != nil {
+			p = &Explain{Stmt: st, PlanBase: base, Ctx: ctx}
+			break
+		}
 		sel, err := RewriteDescribeAsSelect(st, ctx)
 		if err != nil {
 			return nil, err
@@ -338,6 +444,9 @@ func (m *PlanBase) EqualBase(p *PlanBase) bool {
 
 func (m *PlanBase) Walk(p Planner) error          { return ErrNotImplemented }
 func (m *Select) Walk(p Planner) error            { return p.WalkSelect(m) }
+func (m *SetOp) Walk(p Planner) error             { return extended(p, m.Ctx).WalkSetOp(m) }
+func (m *With) Walk(p Planner) error              { return extended(p, m.Ctx).WalkWith(m) }
+func (m *Explain) Walk(p Planner) error           { return extended(p, m.Ctx).WalkExplain(m) }
 func (m *PreparedStatement) Walk(p Planner) error { return p.WalkPreparedStatement(m) }
 func (m *Insert) Walk(p Planner) error            { return p.WalkInsert(m) }
 func (m *Upsert) Walk(p Planner) error            { return p.WalkUpsert(m) }
@@ -349,6 +458,15 @@ func (m *Create) Walk(p Planner) error            { return p.WalkCreate(m) }
 func (m *Drop) Walk(p Planner) error              { return p.WalkDrop(m) }
 func (m *Alter) Walk(p Planner) error             { return p.WalkAlter(m) }
 
+// extended the planner if it implements PlannerExtended, otherwise the
+// PlannerDefault of the context.
+func extended(p Planner, ctx *Context) PlannerExtended {
+	if pe, ok := p.(PlannerExtended); ok {
+		return pe
+	}
+	return NewPlanner(ctx)
+}
+
 // NewCreate creates a new Create Task plan.
 func NewCreate(ctx *Context, stmt *rel.SqlCreate) *Create {
 	return &Create{Stmt: stmt, PlanBase: NewPlanBase(false), Ctx: ctx}
@@ -398,6 +516,36 @@ func (m *Select) Equal(t Task) bool {
 	}
 	return true
 }
+
+// NewSetOp create SetOp plan task.
+func NewSetOp(ctx *Context, stmt *rel.SqlSetOp) *SetOp {
+	return &SetOp{Stmt: stmt, PlanBase: NewPlanBase(false), Ctx: ctx}
+}
+
+// Equal compares equality of two tasks.
+func (m *SetOp) Equal(t Task) bool {
+	if m == nil && t == nil {
+		return true
+	}
+	if m == nil && t != nil {
+		return false
+	}
+	if m != nil && t == nil {
+		return false
+	}
+	s, ok := t.(*SetOp)
+	if !ok {
+		return false
+	}
+	if !m.Stmt.Equal(s.Stmt) {
+		return false
+	}
+	if !m.PlanBase.EqualBase(s.PlanBase) {
+		return false
+	}
+	return m.Left.Equal(s.Left) && m.Right.Equal(s.Right)
+}
+
 func (m *Select) NeedsFinalProjection() bool {
 	if m.Stmt.Limit > 0 {
 		return true
@@ -456,7 +604,7 @@ func (m *Source) LoadConn() error {
 			return nil
 		}
 	}
-	source, err := m.DataSource.Open(m.Stmt.SourceName())
+	source, err := m.ctx.OpenConn(m.DataSource, m.Stmt.SourceName())
 	if err != nil {
 		u.Debugf("no source? %T for source %q", m.DataSource, m.Stmt.SourceName())
 		return err
@@ -509,6 +657,15 @@ func (m *Source) load() error {
 		return fmt.Errorf("Missing schema for %v", fromName)
 	}
 
+	if cte := m.ctx.cte(m.Stmt); cte != nil {
+		// a common table expression of a WITH
+		m.Cte = cte
+		m.Conn = cte
+		m.Tbl = cte.Tbl
+		m.Schema = m.ctx.Schema
+		return projectionForSourcePlan(m)
+	}
+
 	ss, err := m.ctx.Schema.SchemaForTable(fromName)
 	if err != nil {
 		// u.Debugf("no schema found for %T  %q.%q ? err=%v", m.ctx.Schema, m.Stmt.Schema, fromName, err)
@@ -583,34 +740,53 @@ func NewJoinMerge(l, r Task, lf, rf *rel.SqlSource) *JoinMerge {
 	m.LeftFrom = lf
 	m.RightFrom = rf
 
-	// Build an index of source to destination column indexing
-	for _, col := range lf.Source.Columns {
-		//u.Debugf("left col:  idx=%d  key=%q as=%q col=%v parentidx=%v", len(m.colIndex), col.Key(), col.As, col.String(), col.ParentIndex)
-		m.ColIndex[lf.Alias+"."+col.Key()] = col.ParentIndex
-		//u.Debugf("left  colIndex:  %15q : idx:%d sidx:%d pidx:%d", m.leftStmt.Alias+"."+col.Key(), col.Index, col.SourceIndex, col.ParentIndex)
-	}
-	for _, col := range rf.Source.Columns {
-		//u.Debugf("right col:  idx=%d  key=%q as=%q col=%v", len(m.colIndex), col.Key(), col.As, col.String())
-		m.ColIndex[rf.Alias+"."+col.Key()] = col.ParentIndex
-		//u.Debugf("right colIndex:  %15q : idx:%d sidx:%d pidx:%d", m.rightStmt.Alias+"."+col.Key(), col.Index, col.SourceIndex, col.ParentIndex)
+	// The join type lives on the right-hand source
+	//   FROM users AS u LEFT OUTER JOIN orders AS o
+	switch rf.LeftOrRight {
+	case lex.TokenLeft:
+		m.LeftOuter = true
+	case lex.TokenRight:
+		m.RightOuter = true
+	case lex.TokenFull:
+		m.LeftOuter, m.RightOuter = true, true
+	default:
+		// a bare OUTER JOIN is treated as FULL OUTER
+		if rf.JoinType == lex.TokenOuter {
+			m.LeftOuter, m.RightOuter = true, true
+		}
 	}
 
+	// Build an index of source to destination column indexing
+	m.ColIndex = joinColIndex([]*rel.SqlSource{lf, rf})
+
 	return m
 }
 
-// NewJoinKey creates JoinKey from Source.
-func NewJoinKey(s *Source) *JoinKey {
-	return &JoinKey{Source: s, PlanBase: NewPlanBase(false)}
+// RowWidth is the number of values in a merged row, which is one past
+// the largest position in the ColIndex.
+func (m *JoinMerge) RowWidth() int {
+	width := 0
+	for _, idx := range m.ColIndex {
+		if idx+1 > width {
+			width = idx + 1
+		}
+	}
+	return width
 }
 
 // NewWhere new Where Task from SqlSelect statement.
 func NewWhere(stmt *rel.SqlSelect) *Where {
-	return &Where{Stmt: stmt, PlanBase: NewPlanBase(false)}
+	return &Where{Stmt: stmt, Filter: stmt.Where.Expr, PlanBase: NewPlanBase(false)}
 }
 
 // NewWhereFinal from SqlSelect statement.
 func NewWhereFinal(stmt *rel.SqlSelect) *Where {
-	return &Where{Stmt: stmt, Final: true, PlanBase: NewPlanBase(false)}
+	return &Where{Stmt: stmt, Filter: stmt.Where.Expr, Final: true, PlanBase: NewPlanBase(false)}
+}
+
+// NewSemiJoin from SqlSelect statement and its sub query.
+func NewSemiJoin(stmt *rel.SqlSelect, sub *SubQuery) *SemiJoin {
+	return &SemiJoin{Stmt: stmt, Sub: sub, PlanBase: NewPlanBase(false)}
 }
 
 // NewHaving from SqlSelect statement.
@@ -623,9 +799,19 @@ func NewGroupBy(stmt *rel.SqlSelect) *GroupBy {
 	return &GroupBy{Stmt: stmt, PlanBase: NewPlanBase(false)}
 }
 
-// NewOrder from SqlSelect statement.
+// NewOrder from SqlSelect statement.  If the statement has a LIMIT
+// the order is a Top-N of the LIMIT plus OFFSET rows.
 func NewOrder(stmt *rel.SqlSelect) *Order {
-	return &Order{Stmt: stmt, PlanBase: NewPlanBase(false)}
+	o := &Order{Stmt: stmt, PlanBase: NewPlanBase(false)}
+	if stmt.Limit > 0 {
+		o.Limit = stmt.Limit + stmt.Offset
+	}
+	return o
+}
+
+// NewWindow from SqlSelect statement.
+func NewWindow(stmt *rel.SqlSelect) *Window {
+	return &Window{Stmt: stmt, PlanBase: NewPlanBase(false)}
 }
 
 // Equal compares equality of two tasks.
@@ -723,13 +909,21 @@ func (m *Order) Equal(t Task) bool {
 	if !ok {
 		return false
 	}
+	if m.Limit != s.Limit || len(m.Cursor) != len(s.Cursor) {
+		return false
+	}
+	for i, v := range m.Cursor {
+		if eq, _ := value.Equal(v, s.Cursor[i]); !eq {
+			return false
+		}
+	}
 
 	if !m.PlanBase.EqualBase(s.PlanBase) {
 		return false
 	}
 	return true
 }
-func (m *JoinMerge) Equal(t Task) bool {
+func (m *Window) Equal(t Task) bool {
 	if m == nil && t == nil {
 		return true
 	}
@@ -739,7 +933,7 @@ func (m *JoinMerge) Equal(t Task) bool {
 	if m != nil && t == nil {
 		return false
 	}
-	s, ok := t.(*JoinMerge)
+	s, ok := t.(*Window)
 	if !ok {
 		return false
 	}
@@ -749,7 +943,7 @@ func (m *JoinMerge) Equal(t Task) bool {
 	}
 	return true
 }
-func (m *JoinKey) Equal(t Task) bool {
+func (m *SubQuery) Equal(t Task) bool {
 	if m == nil && t == nil {
 		return true
 	}
@@ -759,7 +953,54 @@ func (m *JoinKey) Equal(t Task) bool {
 	if m != nil && t == nil {
 		return false
 	}
-	s, ok := t.(*JoinKey)
+	s, ok := t.(*SubQuery)
+	if !ok {
+		return false
+	}
+	if !m.Node.Equal(s.Node) {
+		return false
+	}
+	if !m.PlanBase.EqualBase(s.PlanBase) {
+		return false
+	}
+	return true
+}
+func (m *SemiJoin) Equal(t Task) bool {
+	if m == nil && t == nil {
+		return true
+	}
+	if m == nil && t != nil {
+		return false
+	}
+	if m != nil && t == nil {
+		return false
+	}
+	s, ok := t.(*SemiJoin)
+	if !ok {
+		return false
+	}
+	if m.Anti != s.Anti || len(m.Key) != len(s.Key) {
+		return false
+	}
+	if !m.Sub.Equal(s.Sub) {
+		return false
+	}
+	if !m.PlanBase.EqualBase(s.PlanBase) {
+		return false
+	}
+	return true
+}
+func (m *JoinMerge) Equal(t Task) bool {
+	if m == nil && t == nil {
+		return true
+	}
+	if m == nil && t != nil {
+		return false
+	}
+	if m != nil && t == nil {
+		return false
+	}
+	s, ok := t.(*JoinMerge)
 	if !ok {
 		return false
 	}
@@ -0,0 +1,291 @@
+package plan
+
+import (
+	"strings"
+
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/lex"
+	"github.com/lytics/qlbridge/rel"
+)
+
+const (
+	// defaultRowEstimate is used for sources that don't know their size
+	defaultRowEstimate = 1000
+	// defaultJoinSelectivity is fraction of the cross product an equality
+	// join condition is expected to keep when neither side is a key
+	defaultJoinSelectivity = 0.1
+	// whereSelectivity is the fraction of rows expected to survive a
+	// where pushed down into a source
+	whereSelectivity = 0.25
+)
+
+// joinEdge is an equality condition between two sources found in any
+// ON clause of the statement
+//
+//	ON o.user_id = u.user_id AND o.item_id = i.item_id
+//
+// is two edges (o,u) and (o,i).
+type joinEdge struct {
+	aliases [2]string
+	nodes   [2]expr.Node
+}
+
+// joinFilter is a condition of an ON clause that is not an equality
+// between two sources, such as  o.price > 30, so it can't be a join key
+// and is instead evaluated on the rows the join keys matched.
+type joinFilter struct {
+	owner   string          // alias of the source whose ON clause it is in
+	aliases map[string]bool // aliases of the sources it reads
+	node    expr.Node
+	used    bool
+}
+
+// joinEdges finds all equality conditions between two sources across
+// all of the ON clauses, and the remaining conditions as filters.
+func joinEdges(froms []*rel.SqlSource) ([]*joinEdge, []*joinFilter) {
+	edges := make([]*joinEdge, 0)
+	filters := make([]*joinFilter, 0)
+	for _, from := range froms {
+		edges, filters = collectJoinEdges(sourceAlias(from), from.JoinExpr, edges, filters)
+	}
+	return edges, filters
+}
+
+func collectJoinEdges(owner string, node expr.Node, edges []*joinEdge, filters []*joinFilter) ([]*joinEdge, []*joinFilter) {
+	if node == nil {
+		return edges, filters
+	}
+	if bn, ok := node.(*expr.BinaryNode); ok {
+		switch bn.Operator.T {
+		case lex.TokenAnd, lex.TokenLogicAnd:
+			edges, filters = collectJoinEdges(owner, bn.Args[0], edges, filters)
+			return collectJoinEdges(owner, bn.Args[1], edges, filters)
+		case lex.TokenEqual, lex.TokenEqualEqual:
+			la, lok := nodeAlias(bn.Args[0])
+			ra, rok := nodeAlias(bn.Args[1])
+			if lok && rok && la != ra {
+				edges = append(edges, &joinEdge{
+					aliases: [2]string{la, ra},
+					nodes:   [2]expr.Node{bn.Args[0], bn.Args[1]},
+				})
+				return edges, filters
+			}
+		}
+	}
+	f := &joinFilter{owner: owner, aliases: make(map[string]bool), node: node}
+	for _, in := range expr.FindAllIdentities(node) {
+		if left, _, hasLeft := in.LeftRight(); hasLeft {
+			f.aliases[strings.ToLower(left)] = true
+		}
+	}
+	return edges, append(filters, f)
+}
+
+// joinFilterNode the filters to evaluate when joining source @alias onto
+// the already @joined sources, all the sources they read must be joined.
+// A filter of an outer join must be evaluated by the join of its own ON
+// clause, as it decides which rows are NULL filled, while inner joins
+// evaluate each filter as soon as possible.
+func joinFilterNode(filters []*joinFilter, joined map[string]bool, alias string, inner bool) expr.Node {
+	var node expr.Node
+	for _, f := range filters {
+		if f.used || (!inner && f.owner != alias) {
+			continue
+		}
+		ready := true
+		for a := range f.aliases {
+			if a != alias && !joined[a] {
+				ready = false
+				break
+			}
+		}
+		if !ready {
+			continue
+		}
+		f.used = true
+		if node == nil {
+			node = f.node
+		} else {
+			node = expr.NewBinaryNode(lex.Token{T: lex.TokenLogicAnd, V: "AND"}, node, f.node)
+		}
+	}
+	return node
+}
+
+// nodeAlias the single source alias that all identities in node refer to
+func nodeAlias(node expr.Node) (string, bool) {
+	alias := ""
+	for _, in := range expr.FindAllIdentities(node) {
+		left, _, hasLeft := in.LeftRight()
+		if !hasLeft {
+			return "", false
+		}
+		left = strings.ToLower(left)
+		if alias != "" && alias != left {
+			return "", false
+		}
+		alias = left
+	}
+	return alias, alias != ""
+}
+
+// sourceAlias is the lower-cased alias, or name, of a from source
+func sourceAlias(from *rel.SqlSource) string {
+	if from.Alias != "" {
+		return strings.ToLower(from.Alias)
+	}
+	return strings.ToLower(from.Name)
+}
+
+// joinKeys the key expressions to join source @alias onto the already
+// joined sources.  Left nodes are evaluated against the joined rows, right
+// against the new source.
+func joinKeys(edges []*joinEdge, joined map[string]bool, alias string) (left, right []expr.Node) {
+	for _, e := range edges {
+		switch {
+		case e.aliases[1] == alias && joined[e.aliases[0]]:
+			left = append(left, e.nodes[0])
+			right = append(right, e.nodes[1])
+		case e.aliases[0] == alias && joined[e.aliases[1]]:
+			left = append(left, e.nodes[1])
+			right = append(right, e.nodes[0])
+		}
+	}
+	return left, right
+}
+
+// joinColIndex lays out the row built by joining the given sources as
+// "alias.column" -> position.  Columns in the parent projection keep their
+// ParentIndex, columns only needed for join keys or where are placed
+// after them so that later joins and the final where can read them.
+func joinColIndex(froms []*rel.SqlSource) map[string]int {
+	colIndex := make(map[string]int)
+	next := 0
+	for _, from := range froms {
+		for _, col := range from.Source.Columns {
+			if col.ParentIndex >= next {
+				next = col.ParentIndex + 1
+			}
+		}
+	}
+	for _, from := range froms {
+		for _, col := range from.Source.Columns {
+			key := from.Alias + "." + col.Key()
+			if _, exists := colIndex[key]; exists {
+				continue
+			}
+			if col.ParentIndex >= 0 {
+				colIndex[key] = col.ParentIndex
+			} else {
+				colIndex[key] = next
+				next++
+			}
+		}
+	}
+	return colIndex
+}
+
+// isInnerJoin is this source joined with INNER semantics, ie may it be
+// re-ordered with the other sources.
+func isInnerJoin(from *rel.SqlSource) bool {
+	return from.LeftOrRight == 0 && from.JoinType != lex.TokenOuter
+}
+
+// sourceRows estimated rows a source will produce
+func sourceRows(s *Source) float64 {
+	rows := float64(defaultRowEstimate)
+	if s.Tbl != nil && s.Tbl.RowCt > 0 {
+		rows = float64(s.Tbl.RowCt)
+	}
+	if s.Stmt.Source != nil && s.Stmt.Source.Where != nil {
+		rows *= whereSelectivity
+	}
+	return rows
+}
+
+// edgeSelectivity estimated fraction of the cross product of two sources
+// an equality condition keeps, using the most selective known side.
+func edgeSelectivity(e *joinEdge, byAlias map[string]*Source) float64 {
+	sel := 0.0
+	for i, node := range e.nodes {
+		in, ok := node.(*expr.IdentityNode)
+		if !ok {
+			continue
+		}
+		src := byAlias[e.aliases[i]]
+		if src == nil || src.Tbl == nil {
+			continue
+		}
+		_, col, _ := in.LeftRight()
+		if s := src.Tbl.Selectivity(col); s > 0 && (sel == 0 || s < sel) {
+			sel = s
+		}
+	}
+	if sel == 0 {
+		return defaultJoinSelectivity
+	}
+	return sel
+}
+
+// joinOrder the order to join the sources in, as positions in @sources.
+//
+// Outer joins keep the order as written.  For inner joins this is a greedy
+// cost based order of a left-deep join tree: start with the smallest
+// source, then repeatedly join the connected source with the smallest
+// estimated result  rows(joined) * rows(next) * selectivity(ON).  If the
+// sources are not all connected by join conditions the written order is
+// kept.
+func joinOrder(sources []*Source, edges []*joinEdge) []int {
+	written := make([]int, len(sources))
+	for i := range sources {
+		written[i] = i
+	}
+	byAlias := make(map[string]*Source, len(sources))
+	for _, s := range sources {
+		if !isInnerJoin(s.Stmt) {
+			return written
+		}
+		byAlias[sourceAlias(s.Stmt)] = s
+	}
+
+	start := 0
+	for i, s := range sources {
+		if sourceRows(s) < sourceRows(sources[start]) {
+			start = i
+		}
+	}
+	order := []int{start}
+	joined := map[string]bool{sourceAlias(sources[start].Stmt): true}
+	est := sourceRows(sources[start])
+
+	for len(order) < len(sources) {
+		next, nextEst := -1, 0.0
+		for i, s := range sources {
+			alias := sourceAlias(s.Stmt)
+			if joined[alias] {
+				continue
+			}
+			sel, connected := 1.0, false
+			for _, e := range edges {
+				if (e.aliases[0] == alias && joined[e.aliases[1]]) ||
+					(e.aliases[1] == alias && joined[e.aliases[0]]) {
+					connected = true
+					sel *= edgeSelectivity(e, byAlias)
+				}
+			}
+			if !connected {
+				continue
+			}
+			if cost := est * sourceRows(s) * sel; next < 0 || cost < nextEst {
+				next, nextEst = i, cost
+			}
+		}
+		if next < 0 {
+			return written
+		}
+		order = append(order, next)
+		joined[sourceAlias(sources[next].Stmt)] = true
+		est = nextEst
+	}
+	return order
+}
@@ -1,14 +1,98 @@
 package plan
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	u "github.com/araddon/gou"
 
+	"github.com/lytics/qlbridge/expr"
 	"github.com/lytics/qlbridge/rel"
 	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
 )
 
+// seekable determines if the right hand source of a join can be read by
+// looking up each left row's join key with schema.ConnSeeker instead of
+// scanning it.  The right side must be joined on exactly its primary key,
+// have no where of its own, and not need its un-matched rows (RIGHT, FULL).
+func seekable(jm *JoinMerge, right *Source) bool {
+	if jm.RightOuter || right.SourceExec || right.Tbl == nil {
+		return false
+	}
+	if _, ok := right.Conn.(schema.ConnSeeker); !ok {
+		return false
+	}
+	if right.Stmt.Source == nil || right.Stmt.Source.Where != nil {
+		return false
+	}
+	pk := right.Tbl.PrimaryKey()
+	if len(pk) != 1 || len(jm.RightKey) != 1 {
+		return false
+	}
+	in, ok := jm.RightKey[0].(*expr.IdentityNode)
+	if !ok {
+		return false
+	}
+	_, col, _ := in.LeftRight()
+	return strings.EqualFold(col, pk[0])
+}
+
+// skippable determines if the OFFSET of a single source select can be pushed
+// down to the source with schema.ConnSkipper.  Only if every row the source
+// reads is a row of the result, ie nothing filters, groups or re-orders them.
+func skippable(s *rel.SqlSelect, src *Source) bool {
+	if s.Offset <= 0 || src.SourceExec {
+		return false
+	}
+	if _, ok := src.Conn.(schema.ConnSkipper); !ok {
+		return false
+	}
+	if s.Where != nil || s.Having != nil || s.Distinct || len(s.GroupBy) > 0 || len(s.OrderBy) > 0 {
+		return false
+	}
+	return !s.IsAggQuery() && !s.IsWindowQuery()
+}
+
+// keysetCursor the values of the keyset pagination of a select
+//
+//	SELECT * FROM events ORDER BY ts, event_id LIMIT 100 WITH cursor='["2017-01-03", 12]'
+//
+// The cursor is the ORDER BY values of the last row of the previous page as
+// a json array, or a single value when ordering by one column.  The last
+// ORDER BY column should be unique so pages neither skip nor repeat rows.
+func keysetCursor(s *rel.SqlSelect) ([]value.Value, error) {
+	cv, ok := s.With["cursor"]
+	if !ok {
+		return nil, nil
+	}
+	if len(s.OrderBy) == 0 {
+		return nil, fmt.Errorf("WITH cursor requires ORDER BY")
+	}
+	var vals []any
+	switch ct := cv.(type) {
+	case []any:
+		vals = ct
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(ct), "[") {
+			vals = []any{ct}
+		} else if err := json.Unmarshal([]byte(ct), &vals); err != nil {
+			return nil, fmt.Errorf("invalid cursor %q: %v", ct, err)
+		}
+	default:
+		vals = []any{ct}
+	}
+	if len(vals) != len(s.OrderBy) {
+		return nil, fmt.Errorf("cursor has %d values but ORDER BY has %d columns", len(vals), len(s.OrderBy))
+	}
+	cursor := make([]value.Value, len(vals))
+	for i, v := range vals {
+		cursor[i] = value.NewValue(v)
+	}
+	return cursor, nil
+}
+
 func needsFinalProjection(s *rel.SqlSelect) bool {
 	if s.Having != nil {
 		return true
@@ -20,6 +104,9 @@ func needsFinalProjection(s *rel.SqlSelect) bool {
 	if len(s.GroupBy) > 0 {
 		return true
 	}
+	if s.IsWindowQuery() {
+		return true
+	}
 	return false
 }
 
@@ -30,6 +117,11 @@ func (m *PlannerDefault) WalkSelect(p *Select) error {
 
 	needsFinalProject := true
 
+	cursor, err := keysetCursor(p.Stmt)
+	if err != nil {
+		return err
+	}
+
 	if len(p.Stmt.From) == 0 {
 
 		return m.WalkLiteralQuery(p)
@@ -49,6 +141,9 @@ func (m *PlannerDefault) WalkSelect(p *Select) error {
 		if err != nil {
 			return err
 		}
+		if skippable(p.Stmt, srcPlan) {
+			srcPlan.Offset = p.Stmt.Offset
+		}
 
 		if srcPlan.Complete && !needsFinalProjection(p.Stmt) {
 			goto finalProjection
@@ -56,9 +151,7 @@ func (m *PlannerDefault) WalkSelect(p *Select) error {
 
 	} else {
 
-		var prevSource *Source
-		var prevTask Task
-
+		sources := make([]*Source, len(p.Stmt.From))
 		for i, from := range p.Stmt.From {
 
 			// Need to rewrite the From statement to ensure all fields necessary to support
@@ -66,44 +159,81 @@ func (m *PlannerDefault) WalkSelect(p *Select) error {
 			from.Rewrite(p.Stmt)
 			srcPlan, err := NewSource(m.Ctx, from, false)
 			if err != nil {
-				return nil
+				return err
 			}
 			err = m.Planner.WalkSourceSelect(srcPlan)
 			if err != nil {
 				u.Errorf("Could not visitsubselect %v  %s", err, from)
 				return err
 			}
+			sources[i] = srcPlan
+		}
 
-			// now fold into previous task
-			if i != 0 {
-				from.Seekable = true
-				// fold this source into previous
-				curMergeTask := NewJoinMerge(prevTask, srcPlan, prevSource.Stmt, srcPlan.Stmt)
-				prevTask = curMergeTask
-			} else {
-				prevTask = srcPlan
+		// All joins share one row layout, so any later join or the final
+		// where can read columns of any source joined before it.
+		colIndex := joinColIndex(p.Stmt.From)
+		edges, filters := joinEdges(p.Stmt.From)
+		order := joinOrder(sources, edges)
+		inner := true
+		for _, from := range p.Stmt.From {
+			inner = inner && isInnerJoin(from)
+		}
+
+		prevSource := sources[order[0]]
+		var prevTask Task = prevSource
+		joined := map[string]bool{sourceAlias(prevSource.Stmt): true}
+		for _, idx := range order[1:] {
+			srcPlan := sources[idx]
+			from := srcPlan.Stmt
+			alias := sourceAlias(from)
+
+			// fold this source into previous
+			from.Seekable = true
+			curMergeTask := NewJoinMerge(prevTask, srcPlan, prevSource.Stmt, from)
+			curMergeTask.ColIndex = colIndex
+			curMergeTask.LeftKey, curMergeTask.RightKey = joinKeys(edges, joined, alias)
+			if len(curMergeTask.RightKey) == 0 {
+				return fmt.Errorf("join on %q requires an equality condition with a previous source", alias)
 			}
+			curMergeTask.Filter = joinFilterNode(filters, joined, alias, inner)
+			curMergeTask.Seek = seekable(curMergeTask, srcPlan)
+			joined[alias] = true
+			prevTask = curMergeTask
 			prevSource = srcPlan
-			//u.Debugf("got task: %T", lastSource)
+		}
+		for _, f := range filters {
+			if !f.used {
+				return fmt.Errorf("unsupported join condition %q", f.node.String())
+			}
 		}
 		p.Add(prevTask)
-
 	}
 
 	if p.Stmt.Where != nil {
 		switch {
-		case p.Stmt.Where.Source != nil:
-			// SELECT id from article WHERE id in (select article_id from comments where comment_ct > 50);
-			u.Warnf("Found un-supported subquery: %#v", p.Stmt.Where)
-			return ErrNotImplemented
 		case p.Stmt.Where.Expr != nil:
-			p.Add(NewWhere(p.Stmt))
+			// SELECT id from article WHERE id in (select article_id from comments where comment_ct > 50);
+			if err := m.walkWhere(p); err != nil {
+				return err
+			}
 		default:
 			u.Warnf("Found un-supported where type: %#v", p.Stmt.Where)
 			return fmt.Errorf("Unsupported Where Type")
 		}
 	}
 
+	if p.Stmt.IsWindowQuery() {
+		switch {
+		case len(p.Stmt.From) > 1:
+			return fmt.Errorf("window functions are not supported with joins")
+		case p.Stmt.IsAggQuery():
+			return fmt.Errorf("window functions are not supported with GROUP BY")
+		case p.Stmt.Star:
+			return fmt.Errorf("window functions are not supported with SELECT *")
+		}
+		p.Add(NewWindow(p.Stmt))
+	}
+
 	if p.Stmt.IsAggQuery() {
 		//u.Debugf("Adding aggregate/group by? %#v", m.Planner)
 		p.Add(NewGroupBy(p.Stmt))
@@ -115,7 +245,9 @@ func (m *PlannerDefault) WalkSelect(p *Select) error {
 	}
 
 	if len(p.Stmt.OrderBy) > 0 {
-		p.Add(NewOrder(p.Stmt))
+		order := NewOrder(p.Stmt)
+		order.Cursor = cursor
+		p.Add(order)
 	}
 
 	if needsFinalProject {
@@ -140,6 +272,62 @@ finalProjection:
 	return nil
 }
 
+// WalkSetOp plan a UNION, INTERSECT or EXCEPT.  Each side is planned
+// as its own query, then the ORDER BY and LIMIT of the combined rows
+// are applied to rows named by the columns of the first select.
+func (m *PlannerDefault) WalkSetOp(p *SetOp) error {
+
+	colCt := -1
+	for _, sel := range p.Stmt.Selects() {
+		if sel.Star {
+			continue
+		}
+		if colCt >= 0 && len(sel.Columns) != colCt {
+			return fmt.Errorf("each select of %s must have the same number of columns", p.Stmt.Keyword())
+		}
+		colCt = len(sel.Columns)
+	}
+
+	var err error
+	if p.Left, err = m.walkSetOpSide(p.Stmt.Left); err != nil {
+		return err
+	}
+	if p.Right, err = m.walkSetOpSide(p.Stmt.Right); err != nil {
+		return err
+	}
+
+	if len(p.Stmt.OrderBy) == 0 && p.Stmt.Limit == 0 {
+		return nil
+	}
+	outer := rel.NewSqlSelect()
+	for _, col := range p.Stmt.First().Columns {
+		outer.AddColumn(*rel.NewColumn(col.Key()))
+	}
+	outer.OrderBy = p.Stmt.OrderBy
+	outer.Limit = p.Stmt.Limit
+	outer.Offset = p.Stmt.Offset
+	if len(outer.OrderBy) > 0 {
+		p.Add(NewOrder(outer))
+	}
+	if outer.Limit > 0 {
+		p.Add(NewProjectionInProcess(outer))
+	}
+	return nil
+}
+
+func (m *PlannerDefault) walkSetOpSide(stmt rel.SqlStatement) (Task, error) {
+	var p Task
+	switch st := stmt.(type) {
+	case *rel.SqlSelect:
+		p = &Select{Stmt: st, PlanBase: NewPlanBase(false), Ctx: m.Ctx}
+	case *rel.SqlSetOp:
+		p = NewSetOp(m.Ctx, st)
+	default:
+		return nil, fmt.Errorf("unsupported statement in set operation %T", stmt)
+	}
+	return p, p.Walk(m.Planner)
+}
+
 // WalkProjectionFinal walk the select plan to create final projection.
 func (m *PlannerDefault) WalkProjectionFinal(p *Select) error {
 	// Add a Final Projection to choose the columns for results
@@ -176,12 +364,6 @@ func (m *PlannerDefault) WalkSourceSelect(p *Source) error {
 		//u.Debugf("%p VisitSubselect from=%q", p, p)
 	}
 
-	// All of this is plan info, ie needs JoinKey
-	needsJoinKey := false
-	if p.Stmt.Source != nil && len(p.Stmt.JoinNodes()) > 0 {
-		needsJoinKey = true
-	}
-
 	// We need to build a ColIndex of source column/select/projection column
 	//u.Debugf("datasource? %#v", p.Conn)
 	if p.Conn == nil {
@@ -227,6 +409,8 @@ func (m *PlannerDefault) WalkSourceSelect(p *Source) error {
 
 		if p.Stmt.Source != nil && p.Stmt.Source.Where != nil {
 			switch {
+			case hasSubQuery(p.Stmt.Source.Where.Expr):
+				// sub queries are planned with the where of the select
 			case p.Stmt.Source.Where.Expr != nil:
 				p.Add(NewWhere(p.Stmt.Source))
 			default:
@@ -244,11 +428,6 @@ func (m *PlannerDefault) WalkSourceSelect(p *Source) error {
 		}
 	}
 
-	if needsJoinKey {
-		joinKey := NewJoinKey(p)
-		p.Add(joinKey)
-	}
-
 	return nil
 }
 
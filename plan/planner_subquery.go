@@ -0,0 +1,309 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/lex"
+	"github.com/lytics/qlbridge/rel"
+)
+
+// walkWhere plan the where of a select.  Sub queries found in it are planned
+// as queries of their own:
+//
+//	[NOT] IN, [NOT] EXISTS conditions of the where become semi joins, a
+//	correlated sub query is de-correlated by moving its equality conditions
+//	on the outer query into the key of the join.
+//
+//	the rest (scalar, or inside of an OR) must be un-correlated, they are
+//	run before filtering and replaced by their results.
+func (m *PlannerDefault) walkWhere(p *Select) error {
+
+	if !hasSubQuery(p.Stmt.Where.Expr) {
+		p.Add(NewWhere(p.Stmt))
+		return nil
+	}
+
+	outer := fromAliases(p.Stmt.From)
+	filter := make([]expr.Node, 0)
+	subs := make([]*SubQuery, 0)
+	for _, cond := range conjuncts(p.Stmt.Where.Expr) {
+		sj, err := m.semiJoin(p, cond, outer)
+		if err != nil {
+			return err
+		}
+		if sj != nil {
+			p.Add(sj)
+			continue
+		}
+		for _, sqn := range subQueryNodes(cond, nil) {
+			sq, err := m.subQuery(sqn, outer)
+			if err != nil {
+				return err
+			}
+			subs = append(subs, sq)
+		}
+		filter = append(filter, cond)
+	}
+	if len(filter) == 0 {
+		return nil
+	}
+	w := NewWhere(p.Stmt)
+	w.Filter = andNodes(filter)
+	w.SubQueries = subs
+	p.Add(w)
+	return nil
+}
+
+// subQuery plan an un-correlated sub query
+func (m *PlannerDefault) subQuery(node *expr.SubQueryNode, outer map[string]bool) (*SubQuery, error) {
+	sel, ok := node.Stmt.(*rel.SqlSelect)
+	if !ok {
+		return nil, fmt.Errorf("unsupported sub query %T", node.Stmt)
+	}
+	corr, _, err := correlated(sel, outer)
+	if err != nil {
+		return nil, err
+	}
+	if len(corr) > 0 {
+		return nil, fmt.Errorf("correlated sub queries are only supported as [NOT] EXISTS or [NOT] IN conditions of the where: %s", node)
+	}
+	return m.planSubQuery(node, sel)
+}
+
+func (m *PlannerDefault) planSubQuery(node *expr.SubQueryNode, sel *rel.SqlSelect) (*SubQuery, error) {
+	ctx := m.Ctx.subContext(sel)
+	p := &Select{Stmt: sel, PlanBase: NewPlanBase(false), Ctx: ctx}
+	if err := p.Walk(NewPlanner(ctx)); err != nil {
+		return nil, err
+	}
+	return &SubQuery{PlanBase: NewPlanBase(false), Ctx: ctx, Node: node, Select: p}, nil
+}
+
+// semiJoin plan a where condition which is a [NOT] IN or [NOT] EXISTS of
+// a sub query as a semi join, nil if the condition is not one.
+func (m *PlannerDefault) semiJoin(p *Select, cond expr.Node, outer map[string]bool) (*SemiJoin, error) {
+
+	anti := false
+	if un, ok := cond.(*expr.UnaryNode); ok && un.Operator.T == lex.TokenNegate {
+		anti = true
+		cond = un.Arg
+	}
+
+	var in expr.Node
+	var node *expr.SubQueryNode
+	switch n := cond.(type) {
+	case *expr.UnaryNode:
+		if n.Operator.T != lex.TokenExists {
+			return nil, nil
+		}
+		node, _ = n.Arg.(*expr.SubQueryNode)
+	case *expr.BinaryNode:
+		if n.Operator.T != lex.TokenIN {
+			return nil, nil
+		}
+		node, _ = n.Args[1].(*expr.SubQueryNode)
+		in = n.Args[0]
+		if hasSubQuery(in) {
+			return nil, nil
+		}
+	}
+	if node == nil {
+		return nil, nil
+	}
+	sel, ok := node.Stmt.(*rel.SqlSelect)
+	if !ok {
+		return nil, fmt.Errorf("unsupported sub query %T", node.Stmt)
+	}
+	if in != nil && (len(sel.Columns) != 1 || sel.Star) {
+		return nil, fmt.Errorf("sub query of IN must select exactly one column: %s", node)
+	}
+
+	corr, rest, err := correlated(sel, outer)
+	if err != nil {
+		return nil, err
+	}
+
+	sj := NewSemiJoin(p.Stmt, nil)
+	sj.In = in
+	sj.Anti = anti
+
+	if len(corr) > 0 {
+		switch {
+		case len(p.Stmt.From) > 1:
+			return nil, fmt.Errorf("correlated sub queries are not supported with joins: %s", node)
+		case sel.IsAggQuery() || sel.Having != nil || sel.Limit > 0:
+			return nil, fmt.Errorf("correlated sub queries with aggregates or LIMIT are not supported: %s", node)
+		}
+
+		// the sub query selects the values of the join key instead of its columns
+		inner := make([]expr.Node, 0, len(corr))
+		for _, c := range corr {
+			outerKey, innerKey, ok := correlationKey(c, outer, fromAliases(sel.From))
+			if !ok {
+				return nil, fmt.Errorf("correlated sub query condition must be an equality with the outer query: %s", c)
+			}
+			sj.Key = append(sj.Key, outerKey)
+			inner = append(inner, innerKey)
+		}
+
+		decorrelated := *sel
+		decorrelated.Columns = make(rel.Columns, 0, len(inner)+1)
+		if in != nil {
+			decorrelated.AddColumn(*sel.Columns[0])
+		}
+		for i, node := range inner {
+			col := rel.Column{As: fmt.Sprintf("key%d", i), Expr: node}
+			col.SourceOriginal = expr.FindFirstIdentity(node)
+			_, col.SourceField, _ = expr.LeftRight(col.SourceOriginal)
+			decorrelated.AddColumn(col)
+		}
+		decorrelated.Where = nil
+		if len(rest) > 0 {
+			decorrelated.Where = &rel.SqlWhere{Expr: andNodes(rest)}
+		}
+		decorrelated.Raw = decorrelated.String()
+		sel = &decorrelated
+	}
+
+	sj.Sub, err = m.planSubQuery(node, sel)
+	if err != nil {
+		return nil, err
+	}
+	return sj, nil
+}
+
+// correlated finds the conditions of the where of sub query @sel which refer
+// to the @outer query, it is an error to refer to it anywhere else.  Rest
+// is the remaining conditions of the where.
+func correlated(sel *rel.SqlSelect, outer map[string]bool) (corr, rest []expr.Node, err error) {
+
+	inner := fromAliases(sel.From)
+	nodes := make([]expr.Node, 0)
+	for _, cols := range []rel.Columns{sel.Columns, sel.GroupBy, sel.OrderBy} {
+		for _, col := range cols {
+			if col.Expr != nil {
+				nodes = append(nodes, col.Expr)
+			}
+		}
+	}
+	if sel.Having != nil {
+		nodes = append(nodes, sel.Having)
+	}
+	for _, node := range nodes {
+		if len(outerRefs(node, outer, inner)) > 0 {
+			return nil, nil, fmt.Errorf("correlated sub query may only refer to the outer query in its where: %s", node)
+		}
+	}
+
+	if sel.Where == nil || sel.Where.Expr == nil {
+		return nil, nil, nil
+	}
+	for _, cond := range conjuncts(sel.Where.Expr) {
+		if len(outerRefs(cond, outer, inner)) > 0 {
+			corr = append(corr, cond)
+		} else {
+			rest = append(rest, cond)
+		}
+	}
+	return corr, rest, nil
+}
+
+// correlationKey splits a correlated condition   inner = outer   into the
+// expressions of the key of each side.
+func correlationKey(cond expr.Node, outer, inner map[string]bool) (outerKey, innerKey expr.Node, ok bool) {
+	bn, isBinary := cond.(*expr.BinaryNode)
+	if !isBinary || (bn.Operator.T != lex.TokenEqual && bn.Operator.T != lex.TokenEqualEqual) {
+		return nil, nil, false
+	}
+	l, r := bn.Args[0], bn.Args[1]
+	switch {
+	case onlyOuter(l, outer, inner) && len(outerRefs(r, outer, inner)) == 0:
+		return l, r, true
+	case onlyOuter(r, outer, inner) && len(outerRefs(l, outer, inner)) == 0:
+		return r, l, true
+	}
+	return nil, nil, false
+}
+
+// onlyOuter is node an expression of only the outer query
+func onlyOuter(node expr.Node, outer, inner map[string]bool) bool {
+	ids := expr.FindAllIdentities(node)
+	return len(ids) > 0 && len(outerRefs(node, outer, inner)) == len(ids)
+}
+
+// outerRefs the identities of node qualified by an alias of the outer query,
+// that is not also an alias of the sub query.
+func outerRefs(node expr.Node, outer, inner map[string]bool) expr.IdentityNodes {
+	refs := make(expr.IdentityNodes, 0)
+	for _, in := range expr.FindAllIdentities(node) {
+		left, _, hasLeft := in.LeftRight()
+		if !hasLeft {
+			continue
+		}
+		left = strings.ToLower(left)
+		if outer[left] && !inner[left] {
+			refs = append(refs, in)
+		}
+	}
+	return refs
+}
+
+// fromAliases the lower-cased aliases and names of sources
+func fromAliases(froms []*rel.SqlSource) map[string]bool {
+	aliases := make(map[string]bool, len(froms))
+	for _, from := range froms {
+		aliases[sourceAlias(from)] = true
+		if from.Name != "" {
+			aliases[strings.ToLower(from.Name)] = true
+		}
+	}
+	return aliases
+}
+
+// conjuncts splits an expression into the conditions AND'ed together
+func conjuncts(node expr.Node) []expr.Node {
+	switch n := node.(type) {
+	case *expr.BinaryNode:
+		if n.Operator.T == lex.TokenLogicAnd || n.Operator.T == lex.TokenAnd {
+			return append(conjuncts(n.Args[0]), conjuncts(n.Args[1])...)
+		}
+	case *expr.BooleanNode:
+		if !n.Negated() && (n.Operator.T == lex.TokenLogicAnd || n.Operator.T == lex.TokenAnd) {
+			conds := make([]expr.Node, 0, len(n.Args))
+			for _, arg := range n.Args {
+				conds = append(conds, conjuncts(arg)...)
+			}
+			return conds
+		}
+	}
+	return []expr.Node{node}
+}
+
+// andNodes AND's conditions back together
+func andNodes(conds []expr.Node) expr.Node {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return expr.NewBooleanNode(lex.Token{T: lex.TokenLogicAnd, V: "AND"}, conds...)
+}
+
+// hasSubQuery does the expression contain a sub query
+func hasSubQuery(node expr.Node) bool {
+	return len(subQueryNodes(node, nil)) > 0
+}
+
+// subQueryNodes the sub queries of an expression, not including those
+// nested in a sub query.
+func subQueryNodes(node expr.Node, nodes []*expr.SubQueryNode) []*expr.SubQueryNode {
+	switch n := node.(type) {
+	case *expr.SubQueryNode:
+		nodes = append(nodes, n)
+	case expr.NodeArgs:
+		for _, arg := range n.ChildrenArgs() {
+			nodes = subQueryNodes(arg, nodes)
+		}
+	}
+	return nodes
+}
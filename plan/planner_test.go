@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/lytics/qlbridge/datasource/mockcsv"
 	td "github.com/lytics/qlbridge/datasource/mockcsvtestdata"
 	"github.com/lytics/qlbridge/plan"
 	"github.com/lytics/qlbridge/rel"
@@ -61,3 +62,235 @@ func TestPlans(t *testing.T) {
 
 	}
 }
+
+func TestJoinSeekPlan(t *testing.T) {
+	joinPlan := func(sqlText string) *plan.JoinMerge {
+		p := selectPlan(t, td.TestContext(sqlText))
+		for _, task := range p.Children() {
+			if jm, ok := task.(*plan.JoinMerge); ok {
+				return jm
+			}
+		}
+		t.Fatalf("expected join in plan for %s", sqlText)
+		return nil
+	}
+
+	// users is keyed by user_id, so it can be looked up per order
+	jm := joinPlan(`SELECT o.order_id, u.email FROM orders AS o
+		INNER JOIN users AS u ON o.user_id = u.user_id`)
+	assert.True(t, jm.Seek, "should seek users by primary key")
+
+	jm = joinPlan(`SELECT o.order_id, u.email FROM orders AS o
+		LEFT JOIN users AS u ON o.user_id = u.user_id`)
+	assert.True(t, jm.Seek, "should seek users by primary key")
+
+	// orders is keyed by order_id, not user_id
+	jm = joinPlan(`SELECT o.order_id, u.email FROM users AS u
+		INNER JOIN orders AS o ON u.user_id = o.user_id`)
+	assert.False(t, jm.Seek, "orders.user_id is not primary key")
+
+	// needs un-matched users so must scan
+	jm = joinPlan(`SELECT o.order_id, u.email FROM orders AS o
+		RIGHT JOIN users AS u ON o.user_id = u.user_id`)
+	assert.False(t, jm.Seek, "right join must scan right side")
+
+	// right side has its own where
+	jm = joinPlan(`SELECT o.order_id, u.email FROM orders AS o
+		INNER JOIN users AS u ON o.user_id = u.user_id
+		WHERE u.email = "aaron@email.com"`)
+	assert.False(t, jm.Seek, "right side where requires scan")
+}
+
+func TestJoinOrderPlan(t *testing.T) {
+	mockcsv.LoadTable(mockcsv.SchemaName, "vips", "user_id,level\n9Ip1aKbeZe2njCDM,gold")
+
+	// innermost join of the left-deep tree
+	firstJoin := func(sqlText string) *plan.JoinMerge {
+		p := selectPlan(t, td.TestContext(sqlText))
+		for _, task := range p.Children() {
+			if jm, ok := task.(*plan.JoinMerge); ok {
+				for {
+					left, ok := jm.Left.(*plan.JoinMerge)
+					if !ok {
+						return jm
+					}
+					jm = left
+				}
+			}
+		}
+		t.Fatalf("expected join in plan for %s", sqlText)
+		return nil
+	}
+
+	// vips is smallest so is joined first
+	jm := firstJoin(`SELECT o.order_id, u.email, v.level FROM orders AS o
+		INNER JOIN users AS u ON o.user_id = u.user_id
+		INNER JOIN vips AS v ON v.user_id = u.user_id`)
+	assert.Equal(t, "v", jm.LeftFrom.Alias)
+	assert.Equal(t, "u", jm.RightFrom.Alias)
+	assert.Equal(t, 1, len(jm.LeftKey))
+
+	// outer joins keep the written order
+	jm = firstJoin(`SELECT o.order_id, u.email, v.level FROM orders AS o
+		LEFT JOIN users AS u ON o.user_id = u.user_id
+		LEFT JOIN vips AS v ON v.user_id = u.user_id`)
+	assert.Equal(t, "o", jm.LeftFrom.Alias)
+	assert.Equal(t, "u", jm.RightFrom.Alias)
+
+	// a source must be joined on a previous one
+	ctx := td.TestContext(`SELECT o.order_id, u.email FROM orders AS o
+		INNER JOIN users AS u ON o.price > 10`)
+	stmt, err := rel.ParseSql(ctx.Raw)
+	require.NoError(t, err)
+	ctx.Stmt = stmt
+	_, err = plan.WalkStmt(ctx, stmt, plan.NewPlanner(ctx))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestOrderTopNPlan(t *testing.T) {
+	order := func(sqlText string) *plan.Order {
+		p := selectPlan(t, td.TestContext(sqlText))
+		for _, task := range p.Children() {
+			if o, ok := task.(*plan.Order); ok {
+				return o
+			}
+		}
+		t.Fatalf("expected order in plan for %s", sqlText)
+		return nil
+	}
+	assert.Equal(t, 0, order(`SELECT user_id FROM users ORDER BY user_id`).Limit)
+	assert.Equal(t, 10, order(`SELECT user_id FROM users ORDER BY user_id DESC LIMIT 10`).Limit)
+	assert.Equal(t, 15, order(`SELECT user_id FROM users ORDER BY user_id LIMIT 10 OFFSET 5`).Limit)
+
+	o := order(`SELECT user_id FROM users ORDER BY user_id, email LIMIT 10 WITH cursor='["9", "x@y.com"]'`)
+	require.Equal(t, 2, len(o.Cursor))
+	assert.Equal(t, "x@y.com", o.Cursor[1].ToString())
+	o = order(`SELECT user_id FROM users ORDER BY user_id LIMIT 10 WITH cursor=9`)
+	require.Equal(t, 1, len(o.Cursor))
+	assert.Equal(t, "9", o.Cursor[0].ToString())
+
+	for _, sqlText := range []string{
+		`SELECT user_id FROM users LIMIT 10 WITH cursor=9`,
+		`SELECT user_id FROM users ORDER BY user_id, email LIMIT 10 WITH cursor=9`,
+		`SELECT user_id FROM users ORDER BY user_id LIMIT 10 WITH cursor="[1"`,
+	} {
+		ctx := td.TestContext(sqlText)
+		stmt, err := rel.ParseSql(ctx.Raw)
+		require.NoError(t, err)
+		ctx.Stmt = stmt
+		_, err = plan.WalkStmt(ctx, stmt, plan.NewPlanner(ctx))
+		assert.NotEqual(t, nil, err, sqlText)
+	}
+}
+
+func TestOffsetPushDownPlan(t *testing.T) {
+	offset := func(sqlText string) int {
+		p := selectPlan(t, td.TestContext(sqlText))
+		require.Equal(t, 1, len(p.From))
+		return p.From[0].Offset
+	}
+	assert.Equal(t, 5, offset(`SELECT user_id FROM users LIMIT 10 OFFSET 5`))
+	assert.Equal(t, 0, offset(`SELECT user_id FROM users WHERE user_id > "5" LIMIT 10 OFFSET 5`))
+	assert.Equal(t, 0, offset(`SELECT user_id FROM users ORDER BY user_id LIMIT 10 OFFSET 5`))
+	assert.Equal(t, 0, offset(`SELECT count(*) FROM users LIMIT 10 OFFSET 5`))
+}
+
+func TestSubQueryPlan(t *testing.T) {
+	semiJoin := func(sqlText string) *plan.SemiJoin {
+		p := selectPlan(t, td.TestContext(sqlText))
+		for _, task := range p.Children() {
+			if sj, ok := task.(*plan.SemiJoin); ok {
+				return sj
+			}
+		}
+		t.Fatalf("expected semi join in plan for %s", sqlText)
+		return nil
+	}
+
+	sj := semiJoin(`SELECT user_id FROM users WHERE user_id NOT IN (SELECT user_id FROM orders)`)
+	assert.True(t, sj.Anti)
+	assert.Equal(t, "user_id", sj.In.String())
+	assert.Equal(t, 0, len(sj.Key))
+
+	// correlated condition becomes the key of the join
+	sj = semiJoin(`SELECT user_id FROM users AS u
+		WHERE EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id = u.user_id AND o.price > 30)`)
+	assert.False(t, sj.Anti)
+	assert.Equal(t, nil, sj.In)
+	require.Equal(t, 1, len(sj.Key))
+	assert.Equal(t, "u.user_id", sj.Key[0].String())
+	inner := sj.Sub.Select.Stmt
+	require.Equal(t, 1, len(inner.Columns))
+	assert.Equal(t, "key0", inner.Columns[0].As)
+	assert.Equal(t, "o.price > 30", inner.Where.Expr.String())
+
+	// scalar sub queries are run by the where
+	p := selectPlan(t, td.TestContext(`SELECT order_id FROM orders WHERE price > (SELECT avg(price) FROM orders)`))
+	found := false
+	for _, task := range p.Children() {
+		if w, ok := task.(*plan.Where); ok && len(w.SubQueries) > 0 {
+			found = true
+			assert.Equal(t, 1, len(w.SubQueries))
+		}
+	}
+	assert.True(t, found, "where should have sub query")
+
+	for _, sqlText := range []string{
+		// correlated scalar
+		`SELECT user_id FROM users AS u WHERE 1 < (SELECT count(*) FROM orders AS o WHERE o.user_id = u.user_id)`,
+		// correlated on non-equality
+		`SELECT user_id FROM users AS u WHERE EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id > u.user_id)`,
+		// IN of more than one column
+		`SELECT user_id FROM users WHERE user_id IN (SELECT user_id, price FROM orders)`,
+	} {
+		ctx := td.TestContext(sqlText)
+		stmt, err := rel.ParseSql(ctx.Raw)
+		require.NoError(t, err)
+		ctx.Stmt = stmt
+		_, err = plan.WalkStmt(ctx, stmt, plan.NewPlanner(ctx))
+		assert.NotEqual(t, nil, err, sqlText)
+	}
+}
+
+func TestWithPlan(t *testing.T) {
+	ctx := td.TestContext(`WITH big (uid) AS (SELECT user_id FROM orders WHERE price > 30),
+		ids AS (SELECT uid FROM big)
+		SELECT uid FROM ids`)
+	w, ok := planStmt(t, ctx).(*plan.With)
+	require.True(t, ok, "must be *plan.With")
+	require.Equal(t, 2, len(w.Ctes))
+	assert.Equal(t, []string{"uid"}, w.Ctes[0].Table.Columns())
+	assert.Equal(t, []string{"uid"}, w.Ctes[1].Table.Columns())
+	assert.Nil(t, w.Ctes[0].Recursive)
+	_, ok = w.Main.(*plan.Select)
+	assert.True(t, ok, "main statement is a select")
+	assert.True(t, w.Equal(w))
+
+	ctx = td.TestContext(`WITH RECURSIVE n (i) AS (SELECT 1 UNION SELECT i + 1 FROM n WHERE i < 5) SELECT i FROM n`)
+	w, ok = planStmt(t, ctx).(*plan.With)
+	require.True(t, ok, "must be *plan.With")
+	cte := w.Ctes[0]
+	require.NotNil(t, cte.Recursive)
+	assert.False(t, cte.All)
+	assert.Equal(t, "SELECT i + 1 FROM n WHERE i < 5", cte.Recursive.String())
+	p, err := cte.PlanRecursive(nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(p.From))
+	assert.Equal(t, cte.Table.Columns(), p.From[0].Cte.Columns())
+
+	for _, sqlText := range []string{
+		// recursive part is not the last select
+		`WITH RECURSIVE n (i) AS (SELECT i + 1 FROM n UNION SELECT 1) SELECT i FROM n`,
+		// recursive not a union
+		`WITH RECURSIVE n (i) AS (SELECT 1 EXCEPT SELECT i FROM n) SELECT i FROM n`,
+		// different number of columns
+		`WITH RECURSIVE n (i) AS (SELECT 1 UNION SELECT i, i FROM n) SELECT i FROM n`,
+	} {
+		ctx := td.TestContext(sqlText)
+		stmt, err := rel.ParseSql(ctx.Raw)
+		require.NoError(t, err)
+		ctx.Stmt = stmt
+		_, err = plan.WalkStmt(ctx, stmt, plan.NewPlanner(ctx))
+		assert.NotEqual(t, nil, err, sqlText)
+	}
+}
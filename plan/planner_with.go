@@ -0,0 +1,276 @@
+package plan
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lytics/qlbridge/lex"
+	"github.com/lytics/qlbridge/rel"
+	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
+)
+
+var (
+	// Ensure a common table expression can be read as a source
+	_ schema.Conn        = (*CteTable)(nil)
+	_ schema.ConnColumns = (*CteTable)(nil)
+)
+
+// CteTable the rows of a common table expression, which the FROM of the
+// statements of a WITH read as a table.  Its rows are only known once the
+// statement runs, they are set before reading statements run.
+type CteTable struct {
+	Name string
+	Tbl  *schema.Table
+	mu   sync.Mutex
+	rows [][]driver.Value
+}
+
+// NewCteTable create the table of a common table expression
+func NewCteTable(name string, cols []string, types []value.ValueType) *CteTable {
+	tbl := schema.NewTable(name)
+	for i, col := range cols {
+		tbl.AddFieldType(col, types[i])
+	}
+	tbl.SetColumns(cols)
+	return &CteTable{Name: name, Tbl: tbl}
+}
+
+// Close is a no-op, rows are held by the table.
+func (m *CteTable) Close() error { return nil }
+
+// Columns list of column names
+func (m *CteTable) Columns() []string { return m.Tbl.Columns() }
+
+// SetRows set the rows found by running the expression
+func (m *CteTable) SetRows(rows [][]driver.Value) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows = rows
+}
+
+// Rows of this table, nil until the expression has run
+func (m *CteTable) Rows() [][]driver.Value {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rows
+}
+
+// working a table of the same columns holding @rows
+func (m *CteTable) working(rows [][]driver.Value) *CteTable {
+	types := make([]value.ValueType, 0, len(m.Tbl.Fields))
+	for _, f := range m.Tbl.Fields {
+		types = append(types, f.ValueType())
+	}
+	cols := make([]string, len(m.Columns()))
+	copy(cols, m.Columns())
+	t := NewCteTable(m.Name, cols, types)
+	t.rows = rows
+	return t
+}
+
+// NewWith create With plan task.
+func NewWith(ctx *Context, stmt *rel.SqlWith) *With {
+	return &With{Stmt: stmt, PlanBase: NewPlanBase(false), Ctx: ctx}
+}
+
+// Equal compares equality of two tasks.
+func (m *With) Equal(t Task) bool {
+	if m == nil && t == nil {
+		return true
+	}
+	if m == nil && t != nil {
+		return false
+	}
+	if m != nil && t == nil {
+		return false
+	}
+	s, ok := t.(*With)
+	if !ok {
+		return false
+	}
+	if !m.Stmt.Equal(s.Stmt) {
+		return false
+	}
+	if !m.PlanBase.EqualBase(s.PlanBase) {
+		return false
+	}
+	if len(m.Ctes) != len(s.Ctes) {
+		return false
+	}
+	for i, cte := range m.Ctes {
+		if !cte.Equal(s.Ctes[i]) {
+			return false
+		}
+	}
+	return m.Main.Equal(s.Main)
+}
+
+// Equal compares equality of two tasks.
+func (m *Cte) Equal(t Task) bool {
+	if m == nil && t == nil {
+		return true
+	}
+	if m == nil && t != nil {
+		return false
+	}
+	if m != nil && t == nil {
+		return false
+	}
+	s, ok := t.(*Cte)
+	if !ok {
+		return false
+	}
+	if !m.Stmt.Equal(s.Stmt) || m.All != s.All {
+		return false
+	}
+	if (m.Recursive == nil) != (s.Recursive == nil) {
+		return false
+	}
+	if m.Recursive != nil && !m.Recursive.Equal(s.Recursive) {
+		return false
+	}
+	return m.Query.Equal(s.Query)
+}
+
+// PlanRecursive plan the recursive select of a recursive common table
+// expression, reading @rows (the rows found by the previous iteration)
+// as the expression's table.
+func (m *Cte) PlanRecursive(rows [][]driver.Value) (*Select, error) {
+	if m.Recursive == nil {
+		return nil, fmt.Errorf("common table expression %q is not recursive", m.Stmt.Name)
+	}
+	// planning re-writes the statement, so each iteration plans its own copy
+	sel, err := rel.ParseSqlSelectResolver(m.Recursive.String(), m.Ctx.Funcs)
+	if err != nil {
+		return nil, err
+	}
+	ctx := m.Ctx.subContext(sel)
+	ctx.ctes[strings.ToLower(m.Stmt.Name)] = m.Table.working(rows)
+	p := &Select{Stmt: sel, PlanBase: NewPlanBase(false), Ctx: ctx}
+	if err := p.Walk(NewPlanner(ctx)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// WalkWith plan the common table expressions of a WITH, in order, each is
+// in scope of the expressions after it and of the statement.
+func (m *PlannerDefault) WalkWith(p *With) error {
+
+	if m.Ctx.ctes == nil {
+		m.Ctx.ctes = make(map[string]*CteTable, len(p.Stmt.Ctes))
+	}
+	for _, stmt := range p.Stmt.Ctes {
+		cte, err := m.walkCte(p.Stmt, stmt)
+		if err != nil {
+			return err
+		}
+		p.Ctes = append(p.Ctes, cte)
+		m.Ctx.ctes[strings.ToLower(stmt.Name)] = cte.Table
+	}
+
+	var main Task
+	switch st := p.Stmt.Stmt.(type) {
+	case *rel.SqlSelect:
+		main = &Select{Stmt: st, PlanBase: NewPlanBase(false), Ctx: m.Ctx}
+	case *rel.SqlSetOp:
+		main = NewSetOp(m.Ctx, st)
+	default:
+		return fmt.Errorf("unsupported statement of WITH %T", p.Stmt.Stmt)
+	}
+	p.Main = main
+	return main.Walk(m.Planner)
+}
+
+// walkCte plan one common table expression.  A recursive expression must
+// be a UNION of an anchor query, which does not read the expression, and
+// a select which does.
+//
+//	WITH RECURSIVE org (id, depth) AS (
+//	    SELECT id, 0 FROM employees WHERE manager_id = 0
+//	    UNION ALL
+//	    SELECT e.id, o.depth + 1 FROM employees AS e INNER JOIN org AS o ON e.manager_id = o.id
+//	)
+func (m *PlannerDefault) walkCte(with *rel.SqlWith, stmt *rel.SqlCte) (*Cte, error) {
+
+	p := &Cte{PlanBase: NewPlanBase(false), Stmt: stmt}
+	anchor := stmt.Stmt
+
+	if stmt.References(stmt.Name) {
+		if !with.Recursive {
+			return nil, fmt.Errorf("common table expression %q reads itself, which requires WITH RECURSIVE", stmt.Name)
+		}
+		so, ok := stmt.Stmt.(*rel.SqlSetOp)
+		if !ok || so.Op != lex.TokenUnion {
+			return nil, fmt.Errorf("recursive common table expression %q must be a UNION", stmt.Name)
+		}
+		rec, ok := so.Right.(*rel.SqlSelect)
+		switch {
+		case rel.ReadsTable(so.Left, stmt.Name):
+			return nil, fmt.Errorf("only the last select of recursive common table expression %q may read it", stmt.Name)
+		case !ok:
+			return nil, fmt.Errorf("recursive part of common table expression %q must be a single select", stmt.Name)
+		case len(so.OrderBy) > 0 || so.Limit > 0:
+			return nil, fmt.Errorf("ORDER BY and LIMIT are not supported by recursive common table expression %q", stmt.Name)
+		case rec.IsAggQuery():
+			return nil, fmt.Errorf("recursive part of common table expression %q may not aggregate", stmt.Name)
+		}
+		p.Recursive = rec
+		p.All = so.All
+		anchor = so.Left
+	}
+
+	p.Ctx = m.Ctx.subContext(anchor)
+	q, err := WalkStmt(p.Ctx, anchor, NewPlanner(p.Ctx))
+	if err != nil {
+		return nil, err
+	}
+	p.Query = q
+
+	// columns are named as the first select names its result columns, a
+	// select of a join does not have a final projection to type them.
+	var proj []*rel.ResultColumn
+	if p.Ctx.Projection != nil && p.Ctx.Projection.Proj != nil {
+		proj = p.Ctx.Projection.Proj.Columns
+	}
+	first := firstSelect(anchor)
+	names := first.Columns.AliasedFieldNames()
+	if first.Star {
+		if proj == nil {
+			return nil, fmt.Errorf("could not find the columns of common table expression %q", stmt.Name)
+		}
+		names = names[:0]
+		for _, rc := range proj {
+			names = append(names, rc.As)
+		}
+	}
+	cols := stmt.Columns
+	if len(cols) == 0 {
+		cols = names
+	} else if len(cols) != len(names) {
+		return nil, fmt.Errorf("common table expression %q names %d columns but its query has %d", stmt.Name, len(cols), len(names))
+	}
+	if p.Recursive != nil && !p.Recursive.Star && len(p.Recursive.Columns) != len(cols) {
+		return nil, fmt.Errorf("each select of recursive common table expression %q must have the same number of columns", stmt.Name)
+	}
+	types := make([]value.ValueType, len(cols))
+	for i := range types {
+		types[i] = value.StringType
+		if len(proj) == len(cols) {
+			types[i] = proj[i].Type
+		}
+	}
+	p.Table = NewCteTable(stmt.Name, cols, types)
+	return p, nil
+}
+
+// firstSelect the first select of a *Select or *SetOp statement
+func firstSelect(stmt rel.SqlStatement) *rel.SqlSelect {
+	if so, ok := stmt.(*rel.SqlSetOp); ok {
+		return so.First()
+	}
+	return stmt.(*rel.SqlSelect)
+}
@@ -48,6 +48,18 @@ func NewProjectionInProcess(stmt *rel.SqlSelect) *Projection {
 	return s
 }
 
+// Offset the number of rows to skip before the LIMIT, zero if the OFFSET
+// was pushed down to the source.
+func (m *Projection) Offset() int {
+	if m.Stmt == nil {
+		return 0
+	}
+	if m.P != nil && len(m.P.From) == 1 && m.P.From[0].Offset > 0 {
+		return 0
+	}
+	return m.Stmt.Offset
+}
+
 func (m *Projection) loadLiteralProjection(ctx *Context) error {
 
 	//u.Debugf("creating plan.Projection literal %s", ctx.Stmt.String())
@@ -97,7 +109,7 @@ func (m *Projection) loadFinal(ctx *Context, isFinal bool) error {
 	for _, from := range m.Stmt.From {
 
 		fromName := strings.ToLower(from.SourceName())
-		tbl, err := ctx.Schema.Table(fromName)
+		tbl, err := ctx.table(fromName)
 		if err != nil {
 			u.Errorf("could not get table: %v", err)
 			return err
@@ -207,7 +219,7 @@ func projectionForSourcePlan(plan *Source) error {
 					} else {
 						plan.Proj.AddColumnShort(col.As, value.NumberType)
 					}
-				case *expr.FuncNode, *expr.BinaryNode:
+				case *expr.FuncNode, *expr.BinaryNode, *expr.CaseNode:
 					// Probably not string?
 					plan.Proj.AddColumnShort(col.As, value.StringType)
 				default:
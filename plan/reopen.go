@@ -0,0 +1,101 @@
+package plan
+
+// Reopen readies plan @t, which has already run, to be run again in @ctx,
+// the context it was planned with, as for the next execution of a prepared
+// statement.  The contexts of its sub queries and common table expressions
+// take the go context, session and transaction of @ctx, and its sources
+// and mutations open new connections.  ErrNotReusable if a part of it can
+// not be run again, such as a source which planned its own query, the
+// statement must then be planned again.
+func Reopen(ctx *Context, t Task) error {
+	return reopen(ctx, t, make(map[Task]bool))
+}
+
+func reopen(ctx *Context, t Task, seen map[Task]bool) error {
+	if t == nil || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	var next []Task
+	switch p := t.(type) {
+	case *Select:
+		ctx.share(p.Ctx)
+		for _, from := range p.From {
+			next = append(next, from)
+		}
+	case *SetOp:
+		ctx.share(p.Ctx)
+		next = append(next, p.Left, p.Right)
+	case *With:
+		ctx.share(p.Ctx)
+		for _, cte := range p.Ctes {
+			next = append(next, cte)
+		}
+		next = append(next, p.Main)
+	case *Cte:
+		ctx.share(p.Ctx)
+		next = append(next, p.Query)
+	case *Explain:
+		ctx.share(p.Ctx)
+		next = append(next, p.Plan)
+	case *Command:
+		ctx.share(p.Ctx)
+	case *Where:
+		for _, sq := range p.SubQueries {
+			next = append(next, sq)
+		}
+	case *SubQuery:
+		ctx.share(p.Ctx)
+		next = append(next, p.Select)
+	case *SemiJoin:
+		next = append(next, p.Sub)
+	case *JoinMerge:
+		next = append(next, p.Left, p.Right)
+	case *Projection:
+		if p.P != nil {
+			next = append(next, p.P)
+		}
+	case *Source:
+		ctx.share(p.ctx)
+		if err := p.reopen(); err != nil {
+			return err
+		}
+	case *Insert, *Upsert, *Update, *Delete:
+		// the planner opens the connection of a mutation
+		return t.Walk(NewPlanner(ctx))
+	case *GroupBy, *Order, *Window, *Having:
+	default:
+		return ErrNotReusable
+	}
+	for _, c := range append(next, t.Children()...) {
+		if err := reopen(ctx, c, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// share the go context, session and transaction of this context with
+// @sub, the context of a sub query of its statement.
+func (m *Context) share(sub *Context) {
+	if sub == nil || sub == m {
+		return
+	}
+	sub.Context = m.Context
+	sub.Session = m.Session
+	sub.Tx = m.Tx
+}
+
+// reopen the connection of this source in its (shared) context, static
+// data and common table expressions have none.
+func (m *Source) reopen() error {
+	if _, ok := m.Conn.(SourcePlanner); ok {
+		return ErrNotReusable
+	}
+	if m.DataSource == nil || m.Cte != nil || len(m.Static) > 0 {
+		return nil
+	}
+	m.Conn = nil
+	return m.LoadConn()
+}
@@ -20,6 +20,18 @@ Usage
 		// Use db here
 
 	}
+
+The data source name is either the name of an already registered schema, or a
+dsn of the form sourcetype://path?setting=value that creates and registers a
+schema from the registered source type on first Open.  The schema is shared by
+later Opens of the same dsn.
+
+	csv:///path/to/file.csv?delimiter=;   csv file, or folder of csv files as tables
+	json:///path/to/dir                   new line delimited json files as tables
+	sqlite:///path/to/file.db             import _ "github.com/lytics/qlbridge/datasource/sqlite"
+	files:///path/to/bucket?format=csv    import _ "github.com/lytics/qlbridge/datasource/files"
+
+Query parameters become the source config settings, the path is the "path" setting.
 */
 package qlbdriver
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 
 	u "github.com/araddon/gou"
 
@@ -39,6 +40,36 @@ func parseSqlResolver(sqlQuery string, fr expr.FuncResolver) (SqlStatement, erro
 	return s, nil
 }
 
+// PrepareSql parses a statement with placeholders, ? or $1, whose arguments
+// are bound before each execution, see PreparedStatement.Bind.
+func PrepareSql(sqlQuery string) (*PreparedStatement, error) {
+	l := lex.NewSqlLexer(sqlQuery)
+	m := Sqlbridge{l: l, SqlTokenPager: NewSqlTokenPager(l)}
+	stmt, err := m.parse()
+	if err != nil {
+		return nil, &ParseError{err}
+	}
+	if ps, ok := stmt.(*PreparedStatement); ok {
+		return ps, nil
+	}
+	return newPrepared(stmt, m.params, m.limits)
+}
+
+func newPrepared(stmt SqlStatement, params []*expr.ParamNode, limits []*limitParam) (*PreparedStatement, error) {
+	var numbered, positional bool
+	for _, p := range params {
+		if p.Text == "?" {
+			positional = true
+		} else {
+			numbered = true
+		}
+	}
+	if numbered && positional {
+		return nil, &ParseError{fmt.Errorf("can not mix ? and $n placeholders")}
+	}
+	return &PreparedStatement{Statement: stmt, Params: params, limits: limits}, nil
+}
+
 // ParseSqlSelect parse a sql statement as SELECT (or else error)
 func ParseSqlSelect(sqlQuery string) (*SqlSelect, error) {
 	stmt, err := ParseSql(sqlQuery)
@@ -104,7 +135,9 @@ func (m *Sqlbridge) parse() (SqlStatement, error) {
 	case lex.TokenPrepare:
 		return m.parsePrepare()
 	case lex.TokenSelect:
-		return m.parseSqlSelect()
+		return m.parseSqlSelectOrSetOp()
+	case lex.TokenWith:
+		return m.parseSqlWith()
 	case lex.TokenInsert, lex.TokenReplace:
 		return m.parseSqlInsert()
 	case lex.TokenUpdate:
@@ -201,6 +234,11 @@ func (m *Sqlbridge) parseSqlSelect() (*SqlSelect, error) {
 		return req, nil
 	}
 
+	// SELECT 1 without FROM nested in parens, or followed by UNION
+	if m.Cur().T == lex.TokenRightParenthesis || isSetOp(m.Cur().T) {
+		return req, nil
+	}
+
 	// INTO
 	discardComments(m)
 	if err := m.parseInto(req); err != nil {
@@ -263,7 +301,9 @@ func (m *Sqlbridge) parseSqlSelect() (*SqlSelect, error) {
 		return nil, err
 	}
 
-	if m.Cur().T == lex.TokenEOF || m.Cur().T == lex.TokenEOS || m.Cur().T == lex.TokenRightParenthesis {
+	switch m.Cur().T {
+	case lex.TokenEOF, lex.TokenEOS, lex.TokenRightParenthesis,
+		lex.TokenUnion, lex.TokenIntersect, lex.TokenExcept:
 
 		if err := req.Finalize(); err != nil {
 			return nil, err
@@ -277,6 +317,172 @@ func (m *Sqlbridge) parseSqlSelect() (*SqlSelect, error) {
 	return nil, fmt.Errorf("Did not complete parsing input: %v", m.LexTokenPager.Cur().V)
 }
 
+// First keyword was SELECT, parse the select and any set operators
+// combining it with further selects
+//
+//	SELECT ... UNION [ALL] SELECT ... EXCEPT SELECT ... [ORDER BY ...] [LIMIT n]
+//
+// INTERSECT binds tighter than UNION and EXCEPT, which are left-associative.
+func (m *Sqlbridge) parseSqlSelectOrSetOp() (SqlStatement, error) {
+
+	raw := m.l.RawInput()
+	sel, err := m.parseSqlSelect()
+	if err != nil {
+		return nil, err
+	}
+	if !isSetOp(m.Cur().T) {
+		return sel, nil
+	}
+
+	terms := []SqlStatement{sel}
+	ops := make([]*SqlSetOp, 0)
+	last := sel
+	for isSetOp(m.Cur().T) {
+		op := &SqlSetOp{Raw: raw, Op: m.Cur().T}
+		m.Next()
+		switch m.Cur().T {
+		case lex.TokenAll:
+			op.All = true
+			m.Next()
+		case lex.TokenDistinct:
+			m.Next()
+		}
+		if m.Cur().T != lex.TokenSelect {
+			return nil, m.ErrMsg(fmt.Sprintf("expected SELECT after %s", op.Op))
+		}
+		if last, err = m.parseSqlSelect(); err != nil {
+			return nil, err
+		}
+		if op.Op == lex.TokenIntersect {
+			op.Left, op.Right = terms[len(terms)-1], last
+			terms[len(terms)-1] = op
+			continue
+		}
+		ops = append(ops, op)
+		terms = append(terms, last)
+	}
+
+	stmt := terms[0]
+	for i, op := range ops {
+		op.Left, op.Right = stmt, terms[i+1]
+		stmt = op
+	}
+	setOp := stmt.(*SqlSetOp)
+
+	// the trailing ORDER BY, LIMIT, OFFSET belong to the combined result
+	setOp.OrderBy, setOp.Limit, setOp.Offset = last.OrderBy, last.Limit, last.Offset
+	last.OrderBy, last.Limit, last.Offset = nil, 0, 0
+	for _, lp := range m.limits {
+		switch lp.dest {
+		case &last.Limit:
+			lp.dest = &setOp.Limit
+		case &last.Offset:
+			lp.dest = &setOp.Offset
+		}
+	}
+
+	return setOp, nil
+}
+
+// First keyword was WITH, parse the common table expressions and the
+// statement which reads them
+//
+//	WITH [RECURSIVE] name [(col, ...)] AS (SELECT ...) [, ...] SELECT ...
+func (m *Sqlbridge) parseSqlWith() (*SqlWith, error) {
+
+	req := &SqlWith{Raw: m.l.RawInput()}
+	m.Next() // Consume WITH
+
+	if m.Cur().T == lex.TokenRecursive {
+		req.Recursive = true
+		m.Next()
+	}
+
+	for {
+		if m.Cur().T != lex.TokenIdentity {
+			return nil, m.ErrMsg("expected name of common table expression")
+		}
+		cte := &SqlCte{Name: m.Cur().V}
+		if req.Cte(cte.Name) != nil {
+			return nil, m.ErrMsg(fmt.Sprintf("common table expression %q is defined more than once", cte.Name))
+		}
+		m.Next()
+
+		// optional column names
+		if m.Cur().T == lex.TokenLeftParenthesis {
+			m.Next()
+			for m.Cur().T == lex.TokenIdentity {
+				cte.Columns = append(cte.Columns, m.Cur().V)
+				m.Next()
+				if m.Cur().T != lex.TokenComma {
+					break
+				}
+				m.Next()
+			}
+			if m.Cur().T != lex.TokenRightParenthesis || len(cte.Columns) == 0 {
+				return nil, m.ErrMsg("expected column names of common table expression")
+			}
+			m.Next()
+		}
+
+		if m.Cur().T != lex.TokenAs {
+			return nil, m.ErrMsg("expected AS after common table expression name")
+		}
+		m.Next()
+		if m.Cur().T != lex.TokenLeftParenthesis {
+			return nil, m.ErrMsg("expected ( for common table expression query")
+		}
+		m.Next()
+		if m.Cur().T != lex.TokenSelect {
+			return nil, m.ErrMsg("expected SELECT for common table expression query")
+		}
+		stmt, err := m.parseSqlSelectOrSetOp()
+		if err != nil {
+			return nil, err
+		}
+		if m.Cur().T != lex.TokenRightParenthesis {
+			return nil, m.ErrMsg("expected ) to end common table expression query")
+		}
+		m.Next()
+		cte.Stmt = withRaw(stmt)
+		req.Ctes = append(req.Ctes, cte)
+
+		if m.Cur().T != lex.TokenComma {
+			break
+		}
+		m.Next()
+	}
+
+	if m.Cur().T != lex.TokenSelect {
+		return nil, m.ErrMsg("expected SELECT after common table expressions")
+	}
+	stmt, err := m.parseSqlSelectOrSetOp()
+	if err != nil {
+		return nil, err
+	}
+	req.Stmt = withRaw(stmt)
+	return req, nil
+}
+
+// withRaw set the raw sql of a statement nested in a larger one to its own
+func withRaw(stmt SqlStatement) SqlStatement {
+	switch st := stmt.(type) {
+	case *SqlSelect:
+		st.Raw = st.String()
+	case *SqlSetOp:
+		st.Raw = st.String()
+	}
+	return stmt
+}
+
+func isSetOp(t lex.TokenType) bool {
+	switch t {
+	case lex.TokenUnion, lex.TokenIntersect, lex.TokenExcept:
+		return true
+	}
+	return false
+}
+
 // First keyword was INSERT, REPLACE
 func (m *Sqlbridge) parseSqlInsert() (*SqlInsert, error) {
 
@@ -493,43 +699,59 @@ func (m *Sqlbridge) parsePrepare() (*PreparedStatement, error) {
 	if m.Cur().T != lex.TokenValue {
 		return nil, m.ErrMsg("expected statement value ")
 	}
-	stmt, err := ParseSql(m.Cur().V)
+	ps, err := PrepareSql(m.Cur().V)
 	if err != nil {
 		return nil, err
 	}
-	req.Statement = stmt
+	req.Statement = ps.Statement
+	req.Params = ps.Params
+	req.limits = ps.limits
 	// we are good
 	return req, nil
 }
 
 // First keyword was DESCRIBE
+//
+//	DESCRIBE mytable
+//	EXPLAIN [ANALYZE] [EXTENDED | FORMAT = {JSON | TRADITIONAL}] SELECT ...
 func (m *Sqlbridge) parseDescribe() (SqlStatement, error) {
 
 	req := &SqlDescribe{Raw: m.l.RawInput()}
 	req.Tok = m.Cur()
 	m.Next() // Consume Describe
 
+	// the lexer doesn't lex the described statement, so it is parsed from
+	// the raw text following the keyword
+	sqlText := strings.TrimSpace(strings.Replace(m.l.RawInput(), req.Tok.V, "", 1))
 	//u.Debugf("token:  %v", m.Cur())
-	switch nextWord := strings.ToLower(m.Cur().V); nextWord {
-	case "select":
-		// TODO:  make the lexer handle this
-		sqlText := strings.Replace(m.l.RawInput(), req.Tok.V, "", 1)
-		sqlSel, err := ParseSql(sqlText)
-		if err != nil {
-			return nil, err
-		}
-		req.Stmt = sqlSel
-		return req, nil
+	nextWord := strings.ToLower(firstWord(sqlText))
+	if nextWord == "analyze" {
+		req.Analyze = true
+		sqlText = strings.TrimSpace(sqlText[len(nextWord):])
+		nextWord = strings.ToLower(firstWord(sqlText))
+	}
+	switch nextWord {
+	case "select", "with":
+		return req, req.parseStmt(sqlText)
 	case "extended":
-		sqlText := strings.Replace(m.l.RawInput(), req.Tok.V, "", 1)
-		sqlText = strings.Replace(sqlText, m.Cur().V, "", 1)
-		sqlSel, err := ParseSql(sqlText)
-		if err != nil {
-			return nil, err
+		return req, req.parseStmt(sqlText[len(nextWord):])
+	case "format":
+		sqlText = strings.TrimSpace(sqlText[len(nextWord):])
+		if !strings.HasPrefix(sqlText, "=") {
+			return nil, m.ErrMsg("expected = after FORMAT")
+		}
+		sqlText = strings.TrimSpace(sqlText[1:])
+		req.Format = strings.ToLower(firstWord(sqlText))
+		switch req.Format {
+		case "json", "traditional":
+		default:
+			return nil, m.ErrMsg("unknown EXPLAIN format, expected JSON or TRADITIONAL")
 		}
-		req.Stmt = sqlSel
-		return req, nil
+		return req, req.parseStmt(sqlText[len(req.Format):])
 	default:
+		if req.Analyze {
+			return nil, m.ErrMsg("expected statement to explain")
+		}
 		if lex.TokenIdentity == m.Cur().T {
 			req.Identity = m.Cur().V
 		} else {
@@ -541,6 +763,27 @@ func (m *Sqlbridge) parseDescribe() (SqlStatement, error) {
 	return req, nil
 }
 
+// firstWord the leading letters, digits and underscores of the text
+func firstWord(text string) string {
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	if end >= 0 {
+		return text[:end]
+	}
+	return text
+}
+
+// parseStmt parse the statement being described
+func (m *SqlDescribe) parseStmt(sqlText string) error {
+	stmt, err := ParseSql(sqlText)
+	if err != nil {
+		return err
+	}
+	m.Stmt = stmt
+	return nil
+}
+
 // First keyword was SHOW
 func (m *Sqlbridge) parseShow() (*SqlShow, error) {
 
@@ -944,6 +1187,11 @@ func parseColumns(m expr.TokenPager, fr expr.FuncResolver, stmt ColumnsStatement
 					col.SourceField = right
 				}
 			}
+			if m.Cur().T == lex.TokenOver {
+				if col.Over, err = parseWindow(m, fr); err != nil {
+					return err
+				}
+			}
 
 			if m.Cur().T != lex.TokenAs {
 				switch n := col.Expr.(type) {
@@ -972,6 +1220,10 @@ func parseColumns(m expr.TokenPager, fr expr.FuncResolver, stmt ColumnsStatement
 					col.Agg = n.F.Aggregate
 				}
 			}
+			if col.Over != nil {
+				// aggregates over a window are evaluated per row, not grouped
+				col.Agg = false
+			}
 			//u.Debugf("next? %v", m.Cur())
 
 		case lex.TokenIdentity:
@@ -981,14 +1233,23 @@ func parseColumns(m expr.TokenPager, fr expr.FuncResolver, stmt ColumnsStatement
 				return err
 			}
 			col.Expr = exprNode
-		case lex.TokenValue, lex.TokenInteger:
-			// Value Literal
+		case lex.TokenValue, lex.TokenInteger, lex.TokenParam:
+			// Value Literal, or placeholder of one
 			col = NewColumnValue(m.Cur())
 			exprNode, err := expr.ParseExprWithFuncs(m, fr)
 			if err != nil {
 				return err
 			}
 			col.Expr = exprNode
+		case lex.TokenCase:
+			// CASE WHEN ... END, named by its expression unless aliased
+			col = NewColumnValue(m.Cur())
+			exprNode, err := expr.ParseExprWithFuncs(m, fr)
+			if err != nil {
+				return err
+			}
+			col.Expr = exprNode
+			col.As = exprNode.String()
 		}
 		//u.Debugf("after colstart?:   %v  ", m.Cur())
 		comment += readComment(m)
@@ -1006,8 +1267,12 @@ func parseColumns(m expr.TokenPager, fr expr.FuncResolver, stmt ColumnsStatement
 				continue
 			}
 			return m.ErrMsg("expected identity")
-		case lex.TokenFrom, lex.TokenInto, lex.TokenLimit, lex.TokenEOS, lex.TokenEOF:
+		case lex.TokenFrom, lex.TokenInto, lex.TokenLimit, lex.TokenEOS, lex.TokenEOF,
+			lex.TokenUnion, lex.TokenIntersect, lex.TokenExcept:
 			// This indicates we have come to the End of the columns
+			if col == nil {
+				return m.ErrMsg("Expected Column Expression")
+			}
 			col.Comment = comment
 			stmt.AddColumn(*col)
 			return nil
@@ -1022,6 +1287,12 @@ func parseColumns(m expr.TokenPager, fr expr.FuncResolver, stmt ColumnsStatement
 			// Hm, we need to backup here?  Parse Node went to deep?
 			continue
 		case lex.TokenRightParenthesis:
+			if col != nil && col.Expr != nil {
+				// end of a select without FROM nested in parens  (SELECT 1)
+				col.Comment = comment
+				stmt.AddColumn(*col)
+				return nil
+			}
 			// loop on my friend
 		case lex.TokenComma:
 			if col == nil {
@@ -1030,6 +1301,7 @@ func parseColumns(m expr.TokenPager, fr expr.FuncResolver, stmt ColumnsStatement
 			col.Comment = comment
 			stmt.AddColumn(*col)
 			comment = ""
+			col = nil // a column must follow the comma
 		default:
 			return m.ErrMsg("Expected Column Expression")
 		}
@@ -1037,6 +1309,150 @@ func parseColumns(m expr.TokenPager, fr expr.FuncResolver, stmt ColumnsStatement
 	}
 }
 
+// parseWindow the window of an analytic function column
+//
+//	OVER ( [PARTITION BY <expr> [, <expr>]*] [ORDER BY <expr> [ASC|DESC] [, ...]] [<frame>] )
+func parseWindow(m expr.TokenPager, fr expr.FuncResolver) (*Window, error) {
+
+	m.Next() // Consume OVER
+	if m.Cur().T != lex.TokenLeftParenthesis {
+		return nil, m.ErrMsg("expected ( after OVER")
+	}
+	m.Next()
+
+	w := &Window{}
+	if m.Cur().T == lex.TokenPartitionBy {
+		m.Next()
+		for {
+			node, err := expr.ParseExprWithFuncs(m, fr)
+			if err != nil {
+				return nil, err
+			}
+			w.PartitionBy = append(w.PartitionBy, node)
+			if m.Cur().T != lex.TokenComma {
+				break
+			}
+			m.Next()
+		}
+	}
+	if m.Cur().T == lex.TokenOrderBy {
+		m.Next()
+		for {
+			node, err := expr.ParseExprWithFuncs(m, fr)
+			if err != nil {
+				return nil, err
+			}
+			col := &Column{Expr: node}
+			switch m.Cur().T {
+			case lex.TokenAsc, lex.TokenDesc:
+				col.Order = strings.ToUpper(m.Cur().V)
+				m.Next()
+			}
+			switch m.Cur().T {
+			case lex.TokenNullsFirst:
+				col.Nulls = "FIRST"
+				m.Next()
+			case lex.TokenNullsLast:
+				col.Nulls = "LAST"
+				m.Next()
+			}
+			w.OrderBy = append(w.OrderBy, col)
+			if m.Cur().T != lex.TokenComma {
+				break
+			}
+			m.Next()
+		}
+	}
+	switch m.Cur().T {
+	case lex.TokenRows, lex.TokenRange:
+		frame, err := parseWindowFrame(m)
+		if err != nil {
+			return nil, err
+		}
+		w.Frame = frame
+	}
+	if m.Cur().T != lex.TokenRightParenthesis {
+		return nil, m.ErrMsg("expected ) to end window")
+	}
+	m.Next()
+	return w, nil
+}
+
+// parseWindowFrame a window frame, a single bound is the start of a frame
+// ending at the current row.
+//
+//	(ROWS | RANGE) ( <bound> | BETWEEN <bound> AND <bound> )
+func parseWindowFrame(m expr.TokenPager) (*WindowFrame, error) {
+
+	f := &WindowFrame{Range: m.Cur().T == lex.TokenRange}
+	m.Next()
+
+	var err error
+	if m.Cur().T == lex.TokenBetween {
+		m.Next()
+		if f.Start, err = parseWindowBound(m); err != nil {
+			return nil, err
+		}
+		if m.Cur().T != lex.TokenLogicAnd {
+			return nil, m.ErrMsg("expected AND in window frame")
+		}
+		m.Next()
+		if f.End, err = parseWindowBound(m); err != nil {
+			return nil, err
+		}
+	} else {
+		if f.Start, err = parseWindowBound(m); err != nil {
+			return nil, err
+		}
+		f.End = WindowBound{Type: lex.TokenCurrentRow}
+	}
+
+	if f.Start.Unbounded && f.Start.Type == lex.TokenFollowing {
+		return nil, fmt.Errorf("window frame can not start at UNBOUNDED FOLLOWING")
+	}
+	if f.End.Unbounded && f.End.Type == lex.TokenPreceding {
+		return nil, fmt.Errorf("window frame can not end at UNBOUNDED PRECEDING")
+	}
+	start, startUnbounded := f.Start.Position()
+	end, endUnbounded := f.End.Position()
+	if !startUnbounded && !endUnbounded && start > end {
+		return nil, fmt.Errorf("window frame starts after it ends")
+	}
+	if f.Range && ((!startUnbounded && start != 0) || (!endUnbounded && end != 0)) {
+		return nil, fmt.Errorf("RANGE window frames only support UNBOUNDED and CURRENT ROW")
+	}
+	return f, nil
+}
+
+func parseWindowBound(m expr.TokenPager) (WindowBound, error) {
+	b := WindowBound{}
+	switch m.Cur().T {
+	case lex.TokenCurrentRow:
+		b.Type = lex.TokenCurrentRow
+		m.Next()
+		return b, nil
+	case lex.TokenUnbounded:
+		b.Unbounded = true
+	case lex.TokenInteger:
+		offset, err := strconv.Atoi(m.Cur().V)
+		if err != nil {
+			return b, m.ErrMsg("expected integer window frame offset")
+		}
+		b.Offset = offset
+	default:
+		return b, m.ErrMsg("expected window frame bound")
+	}
+	m.Next()
+	switch m.Cur().T {
+	case lex.TokenPreceding, lex.TokenFollowing:
+		b.Type = m.Cur().T
+	default:
+		return b, m.ErrMsg("expected PRECEDING or FOLLOWING")
+	}
+	m.Next()
+	return b, nil
+}
+
 func (m *Sqlbridge) parseFieldList() (Columns, error) {
 
 	if m.Cur().T != lex.TokenLeftParenthesis {
@@ -1089,6 +1505,12 @@ func (m *Sqlbridge) parseUpdateList() (map[string]*ValueColumn, error) {
 			cols[lastColName] = &ValueColumn{Value: value.NewIntValue(iv)}
 		case lex.TokenComma, lex.TokenEqual:
 			// don't need to do anything
+		case lex.TokenParam:
+			n, err := m.param()
+			if err != nil {
+				return nil, err
+			}
+			cols[lastColName] = &ValueColumn{Expr: n}
 		case lex.TokenIdentity:
 			// TODO:  this is a bug in lexer
 			lv := m.Cur().V
@@ -1111,6 +1533,16 @@ func (m *Sqlbridge) parseUpdateList() (map[string]*ValueColumn, error) {
 	}
 }
 
+// param the placeholder of the current token
+func (m *Sqlbridge) param() (*expr.ParamNode, error) {
+	n, err := expr.NewParamNode(m.Cur())
+	if err != nil {
+		return nil, m.ErrMsg(err.Error())
+	}
+	m.AddParam(n)
+	return n, nil
+}
+
 func (m *Sqlbridge) parseValueList() ([][]*ValueColumn, error) {
 
 	if m.Cur().T != lex.TokenLeftParenthesis {
@@ -1131,6 +1563,7 @@ func (m *Sqlbridge) parseValueList() ([][]*ValueColumn, error) {
 			row = make([]*ValueColumn, 0)
 		case lex.TokenRightParenthesis:
 			values = append(values, row)
+			row = nil
 		case lex.TokenFrom, lex.TokenInto, lex.TokenLimit, lex.TokenEOS, lex.TokenEOF:
 			if len(row) > 0 {
 				values = append(values, row)
@@ -1156,6 +1589,12 @@ func (m *Sqlbridge) parseValueList() ([][]*ValueColumn, error) {
 				return nil, err
 			}
 			row = append(row, &ValueColumn{Value: value.NewBoolValue(bv)})
+		case lex.TokenParam:
+			n, err := m.param()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, &ValueColumn{Expr: n})
 		case lex.TokenIdentity:
 			// TODO:  this is a bug in lexer
 			lv := m.Cur().V
@@ -1223,13 +1662,14 @@ func (m *Sqlbridge) parseSources(req *SqlSelect) error {
 			if m.Cur().T == lex.TokenRightParenthesis {
 				m.Next()
 			}
-		case lex.TokenLeft, lex.TokenRight, lex.TokenInner, lex.TokenOuter, lex.TokenJoin:
+		case lex.TokenLeft, lex.TokenRight, lex.TokenFull, lex.TokenInner, lex.TokenOuter, lex.TokenJoin:
 			// JOIN
 			if err := m.parseSourceJoin(src); err != nil {
 				return err
 			}
 		case lex.TokenEOF, lex.TokenEOS, lex.TokenWhere, lex.TokenGroupBy, lex.TokenLimit,
-			lex.TokenOffset, lex.TokenWith, lex.TokenAlias, lex.TokenOrderBy:
+			lex.TokenOffset, lex.TokenWith, lex.TokenAlias, lex.TokenOrderBy,
+			lex.TokenUnion, lex.TokenIntersect, lex.TokenExcept:
 			return nil
 		default:
 			return m.ErrMsg("unexpected token")
@@ -1297,8 +1737,9 @@ func (m *Sqlbridge) parseSourceTable(req *SqlSelect) error {
 
 func (m *Sqlbridge) parseSourceJoin(src *SqlSource) error {
 
+	// Optional Left/Right/Full
 	switch m.Cur().T {
-	case lex.TokenLeft, lex.TokenRight:
+	case lex.TokenLeft, lex.TokenRight, lex.TokenFull:
 		src.LeftOrRight = m.Cur().T
 		m.Next()
 	}
@@ -1350,17 +1791,26 @@ func (m *Sqlbridge) parseInto(req *SqlSelect) error {
 	return nil
 }
 
-func (m *Sqlbridge) parseWhereSubSelect(req *SqlSelect) error {
-
-	if m.Cur().T != lex.TokenSelect {
-		return nil
+// ParseSubQuery parse a select statement nested in parens inside of an
+// expression, for the expression parser.
+//
+//	WHERE user_id IN (SELECT user_id FROM orders)
+//	WHERE EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.user_id)
+func (m *Sqlbridge) ParseSubQuery() (expr.SubQuery, error) {
+	if m.Cur().T != lex.TokenLeftParenthesis {
+		return nil, m.ErrMsg("expected ( for sub query")
 	}
+	m.Next()
 	stmt, err := m.parseSqlSelect()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req = stmt
-	return nil
+	if m.Cur().T != lex.TokenRightParenthesis {
+		return nil, m.ErrMsg("expected ) to end sub query")
+	}
+	m.Next()
+	stmt.Raw = stmt.String()
+	return stmt, nil
 }
 
 func (m *Sqlbridge) parseWhereSelect(req *SqlSelect) error {
@@ -1372,12 +1822,6 @@ func (m *Sqlbridge) parseWhereSelect(req *SqlSelect) error {
 	defer func() {
 		if r := recover(); r != nil {
 			u.Errorf("where error? %v \n %v\n%s", r, m.Cur(), m.Lexer().RawInput())
-			if m.Cur().T == lex.TokenSelect {
-				// TODO this is deeply flawed, need to fix/use tokenpager
-				//    with rewind ability
-				err = m.parseWhereSubSelect(req)
-				return
-			}
 			err = fmt.Errorf("panic err: %v", r)
 		}
 	}()
@@ -1403,39 +1847,10 @@ func (m *Sqlbridge) parseWhere() (*SqlWhere, error) {
 
 	where := SqlWhere{}
 
-	// We are going to Peek forward at the next 3 tokens used
-	// to determine which type of where clause
-	m.Next() // x
-	t2 := m.Cur().T
-	m.Next()
-	t3 := m.Cur().T
-	m.Next()
-	t4 := m.Cur().T
-	m.Backup()
-	m.Backup()
-	m.Backup()
-
-	// Check for Types of Where
-	//                                 t1            T2      T3     T4
-	//    SELECT x FROM user   WHERE user_id         IN      (      SELECT user_id from orders where ...)
-	//    SELECT * FROM t1     WHERE column1         =       (      SELECT column1 FROM t2);
-	//    select a FROM movies WHERE director        IN      (     "Quentin","copola","Bay","another")
-	//    select b FROM movies WHERE director        =       "bob";
-	//    select b FROM movies WHERE create          BETWEEN "2015" AND "2010";
-	//    select b from movies WHERE director        LIKE    "%bob"
-	// TODO:
-	//    SELECT * FROM t3     WHERE ROW(5*t2.s1,77) =       (      SELECT 50,11*s1 FROM t4)
-	switch {
-	case (t2 == lex.TokenIN || t2 == lex.TokenEqual) && t3 == lex.TokenLeftParenthesis && t4 == lex.TokenSelect:
-		//u.Infof("in parseWhere: %v", m.Cur())
-		m.Next() // T1  ?? this might be udf?
-		m.Next() // t2  (IN | =)
-		m.Next() // t3 = (
-		//m.Next() // t4 = SELECT
-		where.Op = t2
-		where.Source = &SqlSelect{}
-		return &where, m.parseWhereSubSelect(where.Source)
-	}
+	// Sub queries are part of the expression
+	//    SELECT x FROM user   WHERE user_id   IN  (SELECT user_id from orders where ...)
+	//    SELECT * FROM t1     WHERE column1   =   (SELECT column1 FROM t2);
+	//    SELECT * FROM t1     WHERE EXISTS (SELECT 1 FROM t2 WHERE t2.id = t1.id);
 	exprNode, err := expr.ParseExprWithFuncs(m, m.funcs)
 	if err != nil {
 		return nil, err
@@ -1492,6 +1907,14 @@ func (m *Sqlbridge) parseGroupBy(req *SqlSelect) (err error) {
 				return err
 			}
 			col.Expr = exprNode
+		case lex.TokenCase:
+			col = NewColumnValue(m.Cur())
+			exprNode, err := expr.ParseExprWithFuncs(m, m.funcs)
+			if err != nil {
+				return err
+			}
+			col.Expr = exprNode
+			col.As = exprNode.String()
 		case lex.TokenValue:
 			// Value Literal
 			col = NewColumnFromToken(m.Cur())
@@ -1518,7 +1941,8 @@ func (m *Sqlbridge) parseGroupBy(req *SqlSelect) (err error) {
 			}
 			return m.ErrMsg("expected identity")
 		case lex.TokenFrom, lex.TokenOrderBy, lex.TokenInto, lex.TokenLimit, lex.TokenHaving,
-			lex.TokenWith, lex.TokenEOS, lex.TokenEOF:
+			lex.TokenWith, lex.TokenEOS, lex.TokenEOF,
+			lex.TokenUnion, lex.TokenIntersect, lex.TokenExcept:
 
 			// This indicates we have come to the End of the columns
 			req.GroupBy = append(req.GroupBy, col)
@@ -1611,6 +2035,14 @@ func (m *Sqlbridge) parseOrderBy(req *SqlSelect) (err error) {
 				return err
 			}
 			col.Expr = exprNode
+		case lex.TokenCase:
+			col = NewColumnValue(m.Cur())
+			exprNode, err := expr.ParseExprWithFuncs(m, m.funcs)
+			if err != nil {
+				return err
+			}
+			col.Expr = exprNode
+			col.As = exprNode.String()
 		}
 		//u.Debugf("OrderBy after colstart?:   %v  ", m.Cur())
 
@@ -1618,6 +2050,10 @@ func (m *Sqlbridge) parseOrderBy(req *SqlSelect) (err error) {
 		switch m.Cur().T {
 		case lex.TokenAsc, lex.TokenDesc:
 			col.Order = strings.ToUpper(m.Cur().V)
+		case lex.TokenNullsFirst:
+			col.Nulls = "FIRST"
+		case lex.TokenNullsLast:
+			col.Nulls = "LAST"
 
 		case lex.TokenInto, lex.TokenLimit, lex.TokenEOS, lex.TokenEOF:
 			// This indicates we have come to the End of the columns
@@ -2027,35 +2463,53 @@ func (m *Sqlbridge) parseLimit(req *SqlSelect) error {
 		return nil
 	}
 	m.Next()
-	if m.Cur().T != lex.TokenInteger {
-		return m.ErrMsg("Limit must be an integer")
-	}
-	limval := m.Next()
-	iv, err := strconv.Atoi(limval.V)
-	if err != nil {
-		return m.ErrMsg("Could not convert limit to integer")
+	if m.Cur().T == lex.TokenParam {
+		if err := m.limitParam(&req.Limit); err != nil {
+			return err
+		}
+	} else {
+		if m.Cur().T != lex.TokenInteger {
+			return m.ErrMsg("Limit must be an integer")
+		}
+		limval := m.Next()
+		iv, err := strconv.Atoi(limval.V)
+		if err != nil {
+			return m.ErrMsg("Could not convert limit to integer")
+		}
+		req.Limit = int(iv)
 	}
-	req.Limit = int(iv)
 
 	switch m.Cur().T {
 	case lex.TokenComma:
 		// LIMIT 0, 1000
 		m.Next() // consume the comma
+		// the first number was the offset
+		req.Offset = req.Limit
+		for _, lp := range m.limits {
+			if lp.dest == &req.Limit {
+				lp.dest = &req.Offset
+			}
+		}
+		if m.Cur().T == lex.TokenParam {
+			return m.limitParam(&req.Limit)
+		}
 		if m.Cur().T != lex.TokenInteger {
 			return m.ErrMsg("Limit 0, 1000 2nd number must be an integer")
 		}
-		iv, err = strconv.Atoi(m.Next().V)
+		iv, err := strconv.Atoi(m.Next().V)
 		if err != nil {
 			return m.ErrMsg("Could not convert limit to integer")
 		}
-		req.Offset = req.Limit
 		req.Limit = iv
 	case lex.TokenOffset:
 		m.Next() // consume "OFFSET"
+		if m.Cur().T == lex.TokenParam {
+			return m.limitParam(&req.Offset)
+		}
 		if m.Cur().T != lex.TokenInteger {
 			return m.ErrMsg("Offset must be an integer")
 		}
-		iv, err = strconv.Atoi(m.Cur().V)
+		iv, err := strconv.Atoi(m.Cur().V)
 		m.Next()
 		if err != nil {
 			return m.ErrMsg("Could not convert offset to integer")
@@ -2064,11 +2518,26 @@ func (m *Sqlbridge) parseLimit(req *SqlSelect) error {
 	}
 	return nil
 }
+
+// limitParam the placeholder of the current token as the LIMIT or OFFSET
+// @dest, set when the arguments of the statement are bound.
+func (m *Sqlbridge) limitParam(dest *int) error {
+	n, err := m.param()
+	if err != nil {
+		return err
+	}
+	m.limits = append(m.limits, &limitParam{param: n, dest: dest})
+	m.Next()
+	return nil
+}
 func (m *Sqlbridge) parseOffset(req *SqlSelect) error {
 	if m.Cur().T != lex.TokenOffset {
 		return nil
 	}
 	m.Next() // Consume "OFFSET"
+	if m.Cur().T == lex.TokenParam {
+		return m.limitParam(&req.Offset)
+	}
 	if m.Cur().T != lex.TokenInteger && m.Cur().T != lex.TokenValue {
 		return m.ErrMsg("Expected Integer/Value for OFFSET")
 	}
@@ -2369,7 +2838,19 @@ func ParseKeyValue(pg expr.TokenPager, jh u.JsonHelper) error {
 // current tree (column, etc)
 type SqlTokenPager struct {
 	*expr.LexTokenPager
-	lastKw lex.TokenType
+	lastKw     lex.TokenType
+	params     []*expr.ParamNode // placeholders in the order parsed
+	limits     []*limitParam     // placeholders of a LIMIT or OFFSET
+	positional int               // number of ? placeholders
+}
+
+// AddParam collects a placeholder, numbering ? placeholders in order.
+func (m *SqlTokenPager) AddParam(n *expr.ParamNode) {
+	if n.Pos == 0 {
+		m.positional++
+		n.Pos = m.positional
+	}
+	m.params = append(m.params, n)
 }
 
 func NewSqlTokenPager(l *lex.Lexer) *SqlTokenPager {
@@ -2388,7 +2869,7 @@ func (m *SqlTokenPager) ClauseEnd() bool {
 	tok := m.Cur()
 	switch tok.T {
 	case lex.TokenEOF, lex.TokenEOS, lex.TokenFrom, lex.TokenHaving, lex.TokenComma,
-		lex.TokenIf, lex.TokenAs, lex.TokenLimit, lex.TokenSelect:
+		lex.TokenIf, lex.TokenAs, lex.TokenLimit, lex.TokenSelect, lex.TokenOver:
 		return true
 	}
 	return false
@@ -10,6 +10,7 @@ import (
 	"github.com/lytics/qlbridge/expr"
 	"github.com/lytics/qlbridge/lex"
 	"github.com/lytics/qlbridge/rel"
+	"github.com/lytics/qlbridge/value"
 )
 
 func init() {
@@ -87,6 +88,7 @@ func TestSqlParseOnly(t *testing.T) {
 
 	parseSqlTest(t, "SELECT exists(firstname), user_id FROM user")
 	parseSqlTest(t, "SELECT count(*) FROM user")
+	parseSqlTest(t, "SELECT count(DISTINCT user_id), string_agg(DISTINCT email, \"|\") FROM user GROUP BY x")
 
 	parseSqlTest(t, `
 	SELECT exists(firstname), x
@@ -147,6 +149,14 @@ func TestSqlParseOnly(t *testing.T) {
 
 	parseSqlError(t, "SELECT hash(a,,) AS id, `z` FROM nothing;")
 	parseSqlError(t, "SELECT a, b INTO FROM user;")
+	// set operators, a trailing comma or FROM where a column is expected
+	parseSqlError(t, "SELECT union FROM t")
+	parseSqlError(t, "SELECT except FROM t")
+	parseSqlError(t, "SELECT FROM t")
+	parseSqlError(t, "SELECT a, FROM t")
+	_, err := rel.ParseSql("SELECT a, intersect FROM t")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Expected Column Expression")
 	//parseSqlError(t, "SELECT a FROM user WHERE x")
 	parseSqlError(t, "SELECT hash(join(, \", \")) AS id, `x`, `y`, `z` FROM nothing;")
 
@@ -154,6 +164,8 @@ func TestSqlParseOnly(t *testing.T) {
 
 	parseSqlTest(t, "select title from article WITH distributed=true, node_ct=10")
 	parseSqlTest(t, "SELECT `appearances`.`G_ph` AS `field` FROM `appearances` ORDER BY `appearances`.`G_ph` ASC LIMIT 500 OFFSET 0")
+	parseSqlTest(t, "SELECT name FROM users ORDER BY age DESC NULLS FIRST, name NULLS LAST LIMIT 5")
+	parseSqlError(t, "SELECT name FROM users ORDER BY age NULLS")
 
 	parseSqlTest(t, `
 		select  @@session.auto_increment_increment as auto_increment_increment,
@@ -205,6 +217,24 @@ func TestSqlParseOnly(t *testing.T) {
 		INNER JOIN orders AS t3
 			ON t3.id = t2.fake_id;`)
 
+	parseSqlTest(t, `
+		SELECT
+			t1.name, t2.salary, t3.price
+		FROM employee AS t1
+		LEFT OUTER JOIN info AS t2
+			ON t1.name = t2.name
+		FULL OUTER JOIN orders AS t3
+			ON t3.id = t2.fake_id;`)
+
+	parseSqlTest(t, `
+		SELECT
+			left(t1.name, 2), t2.salary
+		FROM employee AS t1
+		RIGHT JOIN info AS t2
+			ON t1.name = t2.name
+		LEFT JOIN orders AS t3
+			ON t3.id = t2.fake_id`)
+
 	// TODO:
 	//parseSqlTest(t, `INSERT INTO events (id,event_date,event) SELECT id,last_logon,"last_logon" FROM users;`)
 	// parseSqlTest(t, `REPLACE INTO tbl_3 (id,lastname) SELECT id,lastname FROM tbl_1;`)
@@ -294,9 +324,14 @@ func TestSqlParseOnly(t *testing.T) {
 	    FROM mockcsv.users
 	    WHERE user_id in
 	    	(select user_id from mockcsv.orders)`)
-	// Currently unsupported
-	//parseSqlTest(t, `select user_id, email FROM mockcsv.users
-	//    WHERE tolower(email) IN (select email from mockcsv.orders)`)
+	parseSqlTest(t, `select user_id, email FROM mockcsv.users
+	    WHERE tolower(email) IN (select email from mockcsv.orders)`)
+	parseSqlTest(t, `select user_id FROM mockcsv.users
+	    WHERE user_id NOT IN (select user_id from mockcsv.orders WHERE price > 10)`)
+	parseSqlTest(t, `select user_id FROM mockcsv.users AS u
+	    WHERE EXISTS (select 1 from mockcsv.orders AS o WHERE o.user_id = u.user_id) AND email IS NOT NULL`)
+	parseSqlTest(t, `select item_id FROM mockcsv.orders
+	    WHERE price > (select avg(price) from mockcsv.orders) LIMIT 2`)
 
 	parseSqlTest(t, `PREPARE stmt1 FROM 'SELECT toint(field) + 4 AS field FROM table1';`)
 
@@ -441,6 +476,36 @@ func TestSqlParseAstCheck(t *testing.T) {
 	assert.True(t, ok, "is SqlSelect: %T", req)
 	u.Info(sel.Where.String())
 
+	sql = `EXPLAIN FORMAT=JSON SELECT actor FROM github_watch WHERE actor = "bob"`
+	req, err = rel.ParseSql(sql)
+	assert.True(t, err == nil && req != nil, "Must parse: %s  \n\t%v", sql, err)
+	desc, ok = req.(*rel.SqlDescribe)
+	assert.True(t, ok, "is SqlDescribe: %T", req)
+	assert.Equal(t, "json", desc.Format)
+	sel, ok = desc.Stmt.(*rel.SqlSelect)
+	assert.True(t, ok, "is SqlSelect: %T", desc.Stmt)
+	assert.Equal(t, `actor = "bob"`, sel.Where.String())
+
+	sql = `EXPLAIN SELECT actor FROM github_watch`
+	req, err = rel.ParseSql(sql)
+	assert.True(t, err == nil && req != nil, "Must parse: %s  \n\t%v", sql, err)
+	desc = req.(*rel.SqlDescribe)
+	assert.Equal(t, "", desc.Format)
+	_, ok = desc.Stmt.(*rel.SqlSelect)
+	assert.True(t, ok, "is SqlSelect: %T", desc.Stmt)
+
+	_, err = rel.ParseSql(`EXPLAIN FORMAT=YAML SELECT actor FROM github_watch`)
+	assert.NotEqual(t, nil, err)
+
+	sql = `EXPLAIN ANALYZE FORMAT=JSON SELECT actor FROM github_watch`
+	req, err = rel.ParseSql(sql)
+	assert.True(t, err == nil && req != nil, "Must parse: %s  \n\t%v", sql, err)
+	desc = req.(*rel.SqlDescribe)
+	assert.True(t, desc.Analyze)
+	assert.Equal(t, "json", desc.Format)
+	_, ok = desc.Stmt.(*rel.SqlSelect)
+	assert.True(t, ok, "is SqlSelect: %T", desc.Stmt)
+
 	// Where In Sub-Query Clause
 	sql = `select user_id, email
 				FROM mockcsv.users
@@ -451,7 +516,15 @@ func TestSqlParseAstCheck(t *testing.T) {
 	sel, ok = req.(*rel.SqlSelect)
 	assert.True(t, ok, "is SqlSelect: %T", req)
 	assert.True(t, len(sel.From) == 1, "has 1 from: %v", sel.From)
-	assert.True(t, sel.Where != nil && sel.Where.Source != nil, "has sub-select: %v", sel.Where)
+	assert.True(t, sel.Where != nil && sel.Where.Expr != nil, "has where: %v", sel.Where)
+	bn, ok := sel.Where.Expr.(*expr.BinaryNode)
+	assert.True(t, ok, "is binary in: %T", sel.Where.Expr)
+	sq, ok := bn.Args[1].(*expr.SubQueryNode)
+	assert.True(t, ok, "has sub-select: %T", bn.Args[1])
+	inner, ok := sq.Stmt.(*rel.SqlSelect)
+	assert.True(t, ok, "is SqlSelect: %T", sq.Stmt)
+	assert.Equal(t, "orders", inner.From[0].Name)
+	assert.Equal(t, "user_id", inner.Columns[0].As)
 }
 
 func TestSqlAggregateTypeSelect(t *testing.T) {
@@ -596,6 +669,172 @@ func TestSqlUpsert(t *testing.T) {
 	//assert.True(t, sel.Alias == "user_query", "has alias: %v", sel.Alias)
 }
 
+func TestSqlSetOp(t *testing.T) {
+	t.Parallel()
+	sql := `SELECT name FROM users WHERE age > 10
+		UNION ALL SELECT name FROM employees
+		EXCEPT SELECT name FROM retired
+		ORDER BY name LIMIT 5`
+	req, err := rel.ParseSql(sql)
+	require.NoError(t, err)
+	op, ok := req.(*rel.SqlSetOp)
+	require.True(t, ok, "is SqlSetOp: %T", req)
+	assert.Equal(t, lex.TokenExcept, op.Op)
+	assert.True(t, len(op.OrderBy) == 1 && op.Limit == 5, "order, limit on set op: %v", op)
+	left, ok := op.Left.(*rel.SqlSetOp)
+	require.True(t, ok, "left is SqlSetOp: %T", op.Left)
+	assert.True(t, left.Op == lex.TokenUnion && left.All, "union all: %v", left)
+	assert.Equal(t, "users", op.First().From[0].Name)
+	sels := op.Selects()
+	assert.Equal(t, 3, len(sels))
+	assert.True(t, len(sels[2].OrderBy) == 0 && sels[2].Limit == 0, "moved off of last select")
+
+	// INTERSECT binds tighter than UNION
+	req, err = rel.ParseSql(`SELECT a FROM x UNION SELECT a FROM y INTERSECT DISTINCT SELECT a FROM z`)
+	require.NoError(t, err)
+	op = req.(*rel.SqlSetOp)
+	assert.Equal(t, lex.TokenUnion, op.Op)
+	right, ok := op.Right.(*rel.SqlSetOp)
+	require.True(t, ok, "right is SqlSetOp: %T", op.Right)
+	assert.True(t, right.Op == lex.TokenIntersect && !right.All, "intersect: %v", right)
+
+	for _, sql := range []string{
+		"SELECT name FROM users UNION SELECT name FROM employees",
+		"SELECT name FROM users UNION ALL SELECT name FROM employees ORDER BY name DESC LIMIT 2",
+		"SELECT name FROM users UNION SELECT name FROM employees ORDER BY name LIMIT 2 OFFSET 4",
+		"SELECT a FROM x INTERSECT SELECT a FROM y EXCEPT ALL SELECT a FROM z",
+	} {
+		req, err = rel.ParseSql(sql)
+		require.NoError(t, err)
+		req2, err := rel.ParseSql(req.String())
+		require.NoError(t, err, "round trip %s", req.String())
+		assert.Equal(t, sql, req.String())
+		assert.True(t, req.(*rel.SqlSetOp).Equal(req2), "equal after round trip %s", sql)
+	}
+
+	parseSqlError(t, "SELECT a FROM x UNION")
+	parseSqlError(t, "SELECT a FROM x UNION ALL DELETE FROM y")
+}
+
+func TestSqlSubQuery(t *testing.T) {
+	t.Parallel()
+	for _, sql := range []string{
+		"SELECT user_id FROM users WHERE user_id IN (SELECT user_id FROM orders)",
+		"SELECT user_id FROM users WHERE NOT (user_id IN (SELECT user_id FROM orders WHERE price > 10))",
+		"SELECT user_id FROM users AS u WHERE EXISTS (SELECT 1 FROM orders AS o WHERE o.user_id = u.user_id)",
+		"SELECT item_id FROM orders WHERE price > (SELECT avg(price) FROM orders) LIMIT 2",
+	} {
+		sel, err := rel.ParseSqlSelect(sql)
+		require.NoError(t, err)
+		sel2, err := rel.ParseSqlSelect(sel.String())
+		require.NoError(t, err, "round trip %s", sel.String())
+		assert.True(t, sel.Equal(sel2), "equal after round trip %s", sql)
+	}
+
+	sel, err := rel.ParseSqlSelect(`SELECT user_id FROM users
+		WHERE NOT EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.user_id) AND email IS NOT NULL`)
+	require.NoError(t, err)
+	bn, ok := sel.Where.Expr.(*expr.BinaryNode)
+	require.True(t, ok && bn.Operator.T == lex.TokenLogicAnd, "is AND: %T", sel.Where.Expr)
+	un, ok := bn.Args[0].(*expr.UnaryNode)
+	require.True(t, ok, "is NOT: %T", bn.Args[0])
+	un, ok = un.Arg.(*expr.UnaryNode)
+	require.True(t, ok && un.Operator.T == lex.TokenExists, "is EXISTS: %v", un)
+	_, ok = un.Arg.(*expr.SubQueryNode)
+	assert.True(t, ok, "is sub query: %T", un.Arg)
+
+	parseSqlError(t, "SELECT a FROM x WHERE a IN (SELECT b FROM")
+	parseSqlError(t, "SELECT a FROM x WHERE a IN (SELECT b FROM y")
+}
+
+func TestSqlWith(t *testing.T) {
+	t.Parallel()
+	req, err := rel.ParseSql(`WITH RECURSIVE org (id, name, depth) AS (
+			SELECT id, name, 0 FROM employees WHERE manager_id IS NULL
+			UNION ALL
+			SELECT e.id, e.name, o.depth + 1 FROM employees AS e INNER JOIN org AS o ON e.manager_id = o.id
+		), top AS (SELECT name FROM org WHERE depth < 2)
+		SELECT name FROM top ORDER BY name`)
+	require.NoError(t, err)
+	with, ok := req.(*rel.SqlWith)
+	require.True(t, ok, "is SqlWith: %T", req)
+	assert.True(t, with.Recursive)
+	require.Equal(t, 2, len(with.Ctes))
+	org := with.Cte("ORG")
+	require.NotNil(t, org)
+	assert.Equal(t, []string{"id", "name", "depth"}, org.Columns)
+	op, ok := org.Stmt.(*rel.SqlSetOp)
+	require.True(t, ok, "is SqlSetOp: %T", org.Stmt)
+	assert.True(t, op.All)
+	assert.True(t, org.References("org"))
+	assert.False(t, with.Ctes[1].References("employees"))
+	sel, ok := with.Stmt.(*rel.SqlSelect)
+	require.True(t, ok, "is SqlSelect: %T", with.Stmt)
+	assert.Equal(t, "top", sel.From[0].Name)
+	assert.Equal(t, 1, len(sel.OrderBy))
+
+	for _, sql := range []string{
+		"WITH big AS (SELECT user_id FROM orders WHERE price > 10) SELECT user_id FROM big",
+		"WITH a (x) AS (SELECT 1), b AS (SELECT x FROM a) SELECT x FROM b UNION SELECT x FROM a",
+		"WITH RECURSIVE n (i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5) SELECT i FROM n",
+	} {
+		req, err = rel.ParseSql(sql)
+		require.NoError(t, err)
+		req2, err := rel.ParseSql(req.String())
+		require.NoError(t, err, "round trip %s", req.String())
+		assert.True(t, req.(*rel.SqlWith).Equal(req2), "equal after round trip %s", sql)
+	}
+
+	parseSqlError(t, "WITH a AS (SELECT 1)")
+	parseSqlError(t, "WITH a AS SELECT 1 SELECT * FROM a")
+	parseSqlError(t, "WITH a AS (SELECT 1), a AS (SELECT 2) SELECT * FROM a")
+	parseSqlError(t, "WITH a AS (SELECT 1) DELETE FROM a")
+}
+
+func TestSqlWindow(t *testing.T) {
+	t.Parallel()
+	sql := `SELECT user_id, lag(event) OVER (PARTITION BY user_id ORDER BY ts DESC) AS prev,
+		sum(amount) OVER (PARTITION BY user_id ORDER BY ts ROWS 2 PRECEDING) AS total
+		FROM events`
+	sel, err := rel.ParseSqlSelect(sql)
+	require.NoError(t, err)
+	assert.True(t, sel.IsWindowQuery(), "is window query")
+	assert.True(t, !sel.IsAggQuery(), "sum over a window is not an aggregate query")
+	require.Equal(t, 3, len(sel.Columns))
+	assert.Equal(t, (*rel.Window)(nil), sel.Columns[0].Over)
+
+	prev := sel.Columns[1]
+	require.True(t, prev.Over != nil, "has window")
+	assert.Equal(t, "prev", prev.As)
+	assert.Equal(t, 1, len(prev.Over.PartitionBy))
+	assert.True(t, len(prev.Over.OrderBy) == 1 && prev.Over.OrderBy[0].Order == "DESC", "order: %v", prev.Over)
+
+	total := sel.Columns[2]
+	require.True(t, total.Over != nil && total.Over.Frame != nil, "has frame")
+	assert.Equal(t, rel.WindowBound{Type: lex.TokenPreceding, Offset: 2}, total.Over.Frame.Start)
+	assert.Equal(t, rel.WindowBound{Type: lex.TokenCurrentRow}, total.Over.Frame.End)
+
+	for _, sql := range []string{
+		"SELECT row_number() OVER () AS rn FROM events",
+		"SELECT rank() OVER (ORDER BY score DESC, name) FROM events",
+		"SELECT rank() OVER (ORDER BY score DESC NULLS LAST) FROM events",
+		"SELECT count(x) OVER (PARTITION BY a, tolower(b) ROWS BETWEEN UNBOUNDED PRECEDING AND 1 FOLLOWING) AS ct FROM events",
+		"SELECT avg(x) OVER (ORDER BY ts RANGE BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING) AS a FROM events WHERE x > 1",
+	} {
+		sel, err = rel.ParseSqlSelect(sql)
+		require.NoError(t, err, sql)
+		sel2, err := rel.ParseSqlSelect(sel.String())
+		require.NoError(t, err, "round trip %s", sel.String())
+		assert.Equal(t, sql, sel.String())
+		assert.True(t, sel.Equal(sel2), "equal after round trip %s", sql)
+	}
+
+	parseSqlError(t, "SELECT row_number() OVER (ORDER BY ts FROM events")
+	parseSqlError(t, "SELECT sum(x) OVER (ROWS BETWEEN 1 FOLLOWING AND 1 PRECEDING) FROM events")
+	parseSqlError(t, "SELECT sum(x) OVER (ROWS BETWEEN UNBOUNDED FOLLOWING AND CURRENT ROW) FROM events")
+	parseSqlError(t, "SELECT sum(x) OVER (RANGE 2 PRECEDING) FROM events")
+}
+
 func TestSqlMultiStatement(t *testing.T) {
 	t.Parallel()
 	sql := `SET @var1 = "hello"; select a, b from accounts where name = @var1;`
@@ -623,6 +862,57 @@ func TestSqlUpdate(t *testing.T) {
 	assert.True(t, len(up.Values) == 2, "%v", up)
 }
 
+func TestSqlPrepare(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		sql      string
+		numInput int
+		args     []value.Value
+		bound    string
+	}{
+		{`SELECT a FROM t WHERE x > ? AND y IN (?, ?)`, 3,
+			[]value.Value{value.NewIntValue(5), value.NewStringValue("it's"), value.NewNilValue()},
+			`SELECT a FROM t WHERE x > 5 AND y IN ("it's", NULL)`},
+		{`SELECT a, $2 AS b FROM t WHERE x = $1 OR z = $1`, 2,
+			[]value.Value{value.NewStringValue("x1"), value.NewBoolValue(true)},
+			`SELECT a, true AS b FROM t WHERE x = "x1" OR z = "x1"`},
+		{`SELECT a FROM t WHERE x IN (SELECT x FROM u WHERE y > ?) AND z = ?`, 2,
+			[]value.Value{value.NewNumberValue(1.5), value.NewIntValue(2)},
+			`SELECT a FROM t WHERE x IN (SELECT x FROM u WHERE y > 1.5) AND z = 2`},
+		{`INSERT INTO t (a, b) VALUES (?, ?), (?, 4)`, 3,
+			[]value.Value{value.NewIntValue(1), value.NewIntValue(2), value.NewIntValue(3)},
+			"INSERT INTO t (a, b) VALUES (1 ,2)\n\t, (3 ,4)"},
+		{`UPDATE t SET a = ? WHERE b = ?`, 2,
+			[]value.Value{value.NewIntValue(1), value.NewStringValue("x")},
+			`UPDATE t SET a = 1 WHERE b = "x"`},
+		{`SELECT a FROM t`, 0, nil, `SELECT a FROM t`},
+	} {
+		ps, err := rel.PrepareSql(tc.sql)
+		require.NoError(t, err, tc.sql)
+		assert.Equal(t, tc.numInput, ps.NumInput(), tc.sql)
+		if tc.numInput > 0 {
+			assert.NotEqual(t, nil, ps.Bind(tc.args[:len(tc.args)/2]), "argument count: %s", tc.sql)
+		}
+		require.NoError(t, ps.Bind(tc.args), tc.sql)
+		assert.Equal(t, tc.bound, ps.Statement.String(), tc.sql)
+	}
+
+	// unbound placeholders are written as parsed
+	ps, err := rel.PrepareSql(`SELECT a FROM t WHERE x = $1`)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT a FROM t WHERE x = $1`, ps.Statement.String())
+
+	ps, err = rel.PrepareSql(`PREPARE stmt1 FROM 'SELECT a FROM t WHERE x = ?'`)
+	require.NoError(t, err)
+	assert.Equal(t, "stmt1", ps.Alias)
+	assert.Equal(t, 1, ps.NumInput())
+
+	_, err = rel.PrepareSql(`SELECT a FROM t WHERE x = ? AND y = $1`)
+	assert.NotEqual(t, nil, err, "can not mix ? and $n")
+	_, err = rel.PrepareSql(`SELECT a FROM t WHERE x = $`)
+	assert.NotEqual(t, nil, err)
+}
+
 func TestSqlCreate(t *testing.T) {
 	t.Parallel()
 	// Test IF NOT EXISTS
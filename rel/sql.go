@@ -8,6 +8,7 @@ import (
 	"hash/fnv"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 
 	u "github.com/araddon/gou"
@@ -20,6 +21,8 @@ import (
 var (
 	// Ensure SqlSelect and cousins etc are SqlStatements
 	_ SqlStatement = (*SqlSelect)(nil)
+	_ SqlStatement = (*SqlSetOp)(nil)
+	_ SqlStatement = (*SqlWith)(nil)
 	_ SqlStatement = (*SqlInsert)(nil)
 	_ SqlStatement = (*SqlUpsert)(nil)
 	_ SqlStatement = (*SqlUpdate)(nil)
@@ -78,6 +81,8 @@ type (
 	PreparedStatement struct {
 		Alias     string
 		Statement SqlStatement
+		Params    []*expr.ParamNode // placeholders of the statement, ? or $1
+		limits    []*limitParam     // placeholders of a LIMIT or OFFSET
 	}
 	// SqlSelect SQL Select statement
 	SqlSelect struct {
@@ -103,6 +108,38 @@ type (
 
 		fingerprintid int64
 	}
+	// SqlSetOp combines the rows of two queries with a set operator
+	//  - SELECT .. UNION [ALL|DISTINCT] SELECT ..
+	//  - SELECT .. INTERSECT [ALL|DISTINCT] SELECT ..
+	//  - SELECT .. EXCEPT [ALL|DISTINCT] SELECT ..
+	// Left and Right are either *SqlSelect or *SqlSetOp.  An ORDER BY or
+	// LIMIT following the last select applies to the combined rows.
+	SqlSetOp struct {
+		Raw     string        // full original raw statement
+		Op      lex.TokenType // Union, Intersect, Except
+		All     bool          // ALL keeps duplicate rows
+		Left    SqlStatement  // left query
+		Right   SqlStatement  // right query
+		OrderBy Columns       // order of combined rows
+		Limit   int           // limit of combined rows
+		Offset  int           // offset of combined rows
+	}
+	// SqlWith common table expressions, named queries which the FROM of the
+	// statement (and of later expressions) reads as tables.
+	//  - WITH name AS (SELECT ..) SELECT .. FROM name
+	//  - WITH RECURSIVE name (col, ..) AS (SELECT .. UNION ALL SELECT .. FROM name) SELECT ..
+	SqlWith struct {
+		Raw       string       // full original raw statement
+		Recursive bool         // expressions may refer to themselves
+		Ctes      []*SqlCte    // named queries, in order
+		Stmt      SqlStatement // *SqlSelect or *SqlSetOp using them
+	}
+	// SqlCte a named query of a WITH, its Stmt is a *SqlSelect or *SqlSetOp.
+	SqlCte struct {
+		Name    string       // name the query is read by
+		Columns []string     // optional column names, else those of the query
+		Stmt    SqlStatement // the query
+	}
 	// SqlSource is a table name, sub-query, or join as used in
 	// SELECT <columns> FROM <SQLSOURCE>
 	//  - SELECT .. FROM table_name
@@ -120,7 +157,7 @@ type (
 		Alias       string             // From name aliased
 		Schema      string             //  FROM `schema`.`table`
 		Op          lex.TokenType      // In, =, ON
-		LeftOrRight lex.TokenType      // Left, Right
+		LeftOrRight lex.TokenType      // Left, Right, Full
 		JoinType    lex.TokenType      // INNER, OUTER
 		JoinExpr    expr.Node          // Join expression       x.y = q.y
 		SubQuery    *SqlSelect         // optional, Join/SubSelect statement
@@ -189,6 +226,8 @@ type (
 		Identity string    // Describe
 		Tok      lex.Token // Explain, Describe, Desc
 		Stmt     SqlStatement
+		Format   string // EXPLAIN FORMAT = {json | traditional}
+		Analyze  bool   // EXPLAIN ANALYZE, run the statement and describe its runtime statistics
 	}
 	// SqlInto   INTO statement   (select a,b,c from y INTO z)
 	SqlInto struct {
@@ -248,10 +287,36 @@ type (
 		As              string    // As field, auto-populate the Field Name if exists
 		Comment         string    // optional in-line comments
 		Order           string    // (ASC | DESC)
+		Nulls           string    // (FIRST | LAST) position of NULL values when ordering
 		Star            bool      // *
 		Agg             bool      // aggregate function column?   count(*), avg(x) etc
 		Expr            expr.Node // Expression, optional, often Identity.Node
 		Guard           expr.Node // column If guard, non-standard sql column guard
+		Over            *Window   // window of an analytic function column, optional
+	}
+	// Window is the window of rows an analytic function column is evaluated over
+	//
+	//	row_number() OVER (PARTITION BY user_id ORDER BY ts)
+	//	sum(amount) OVER (ORDER BY ts ROWS BETWEEN 2 PRECEDING AND CURRENT ROW)
+	Window struct {
+		PartitionBy []expr.Node  // rows with equal partition values share a window
+		OrderBy     Columns      // order of rows within a partition
+		Frame       *WindowFrame // rows relative to the current row, optional
+	}
+	// WindowFrame the rows of a partition relative to the current row that
+	// an aggregate window function is evaluated over.
+	WindowFrame struct {
+		Range bool // RANGE frames include the peers (equal order values) of the current row
+		Start WindowBound
+		End   WindowBound
+	}
+	// WindowBound is the start or end of a window frame
+	//
+	//	UNBOUNDED PRECEDING, 2 PRECEDING, CURRENT ROW, 2 FOLLOWING, UNBOUNDED FOLLOWING
+	WindowBound struct {
+		Type      lex.TokenType // TokenPreceding, TokenCurrentRow, TokenFollowing
+		Unbounded bool
+		Offset    int // rows from the current row
 	}
 	// ValueColumn List of Value columns in INSERT into TABLE (colnames) VALUES (valuecolumns)
 	ValueColumn struct {
@@ -577,6 +642,9 @@ func (m *Column) WriteDialect(w expr.DialectWriter) {
 		if w.Len() > start {
 			exprStr = w.String()[start:]
 		}
+		if m.Over != nil {
+			m.Over.WriteDialect(w)
+		}
 	}
 
 	if m.asQuoteByte != 0 && m.originalAs != "" {
@@ -596,6 +664,10 @@ func (m *Column) WriteDialect(w expr.DialectWriter) {
 		io.WriteString(w, " ")
 		io.WriteString(w, m.Order)
 	}
+	if m.Nulls != "" {
+		io.WriteString(w, " NULLS ")
+		io.WriteString(w, m.Nulls)
+	}
 }
 
 // Is this a select count(*) column
@@ -635,7 +707,7 @@ func (m *Column) IsLiteral() bool {
 			return true
 		}
 		return false
-	case *expr.StringNode, *expr.NumberNode, *expr.ValueNode:
+	case *expr.StringNode, *expr.NumberNode, *expr.ValueNode, *expr.ParamNode:
 		return true
 	default:
 		u.Warnf("Unknown Node column type? %T", n)
@@ -653,20 +725,35 @@ func (m *Column) IsLiteralOrFunc() bool {
 		// now()
 		// tolower(field_name)
 		return true
+	case *expr.CaseNode:
+		// CASE WHEN x > 5 THEN "big" END
+		return true
 	case *expr.IdentityNode:
 		// What about NULL?
 		if n.IsBooleanIdentity() {
 			return true
 		}
 		return false
-	case *expr.StringNode, *expr.NumberNode, *expr.ValueNode:
+	case *expr.StringNode, *expr.NumberNode, *expr.ValueNode, *expr.ParamNode:
 		return true
 	}
 	return false
 }
 
+// Asc is this column sorted ascending, which is the default when
+// no direction was given.
 func (m *Column) Asc() bool {
-	return strings.ToLower(m.Order) == "asc"
+	return !strings.EqualFold(m.Order, "desc")
+}
+
+// NullsFirst do NULL values sort ahead of non-null ones.  Without an
+// explicit NULLS FIRST/LAST, NULL is the smallest value so it is first
+// when ascending and last when descending.
+func (m *Column) NullsFirst() bool {
+	if m.Nulls != "" {
+		return strings.EqualFold(m.Nulls, "first")
+	}
+	return m.Asc()
 }
 func (m *Column) Equal(c *Column) bool {
 	if m == nil && c == nil {
@@ -714,6 +801,9 @@ func (m *Column) Equal(c *Column) bool {
 	if m.Order != c.Order {
 		return false
 	}
+	if m.Nulls != c.Nulls {
+		return false
+	}
 	if m.Star != c.Star {
 		return false
 	}
@@ -727,6 +817,9 @@ func (m *Column) Equal(c *Column) bool {
 			return false
 		}
 	}
+	if !m.Over.Equal(c.Over) {
+		return false
+	}
 	return true
 }
 
@@ -760,10 +853,103 @@ func (m *Column) Copy() *Column {
 		As:              m.right,
 		Comment:         m.Comment,
 		Order:           m.Order,
+		Nulls:           m.Nulls,
 		Star:            m.Star,
 		Expr:            m.Expr,
 		Guard:           m.Guard,
+		Over:            m.Over,
+	}
+}
+
+// WriteDialect writes the window as
+//
+//	OVER (PARTITION BY a ORDER BY b DESC ROWS BETWEEN 2 PRECEDING AND CURRENT ROW)
+func (m *Window) WriteDialect(w expr.DialectWriter) {
+	io.WriteString(w, " OVER (")
+	sep := ""
+	if len(m.PartitionBy) > 0 {
+		io.WriteString(w, "PARTITION BY ")
+		for i, n := range m.PartitionBy {
+			if i != 0 {
+				io.WriteString(w, ", ")
+			}
+			n.WriteDialect(w)
+		}
+		sep = " "
+	}
+	if len(m.OrderBy) > 0 {
+		io.WriteString(w, sep)
+		io.WriteString(w, "ORDER BY ")
+		m.OrderBy.WriteDialect(w)
+		sep = " "
+	}
+	if m.Frame != nil {
+		io.WriteString(w, sep)
+		m.Frame.WriteDialect(w)
+	}
+	io.WriteString(w, ")")
+}
+func (m *Window) String() string {
+	w := expr.NewDefaultWriter()
+	m.WriteDialect(w)
+	return w.String()
+}
+func (m *Window) Equal(s *Window) bool {
+	if m == nil || s == nil {
+		return m == nil && s == nil
+	}
+	if len(m.PartitionBy) != len(s.PartitionBy) {
+		return false
+	}
+	for i, n := range m.PartitionBy {
+		if !n.Equal(s.PartitionBy[i]) {
+			return false
+		}
+	}
+	if !m.OrderBy.Equal(s.OrderBy) {
+		return false
 	}
+	if m.Frame == nil || s.Frame == nil {
+		return m.Frame == nil && s.Frame == nil
+	}
+	return *m.Frame == *s.Frame
+}
+
+// WriteDialect writes the frame as  (ROWS | RANGE) BETWEEN <start> AND <end>
+func (m *WindowFrame) WriteDialect(w expr.DialectWriter) {
+	if m.Range {
+		io.WriteString(w, "RANGE BETWEEN ")
+	} else {
+		io.WriteString(w, "ROWS BETWEEN ")
+	}
+	m.Start.WriteDialect(w)
+	io.WriteString(w, " AND ")
+	m.End.WriteDialect(w)
+}
+func (m *WindowBound) WriteDialect(w expr.DialectWriter) {
+	switch {
+	case m.Type == lex.TokenCurrentRow:
+		io.WriteString(w, "CURRENT ROW")
+		return
+	case m.Unbounded:
+		io.WriteString(w, "UNBOUNDED ")
+	default:
+		io.WriteString(w, strconv.Itoa(m.Offset))
+		io.WriteString(w, " ")
+	}
+	io.WriteString(w, strings.ToUpper(m.Type.String()))
+}
+
+// Position of this bound relative to the current row, preceding rows are
+// negative.  Unbounded is reported by the bool.
+func (m *WindowBound) Position() (int, bool) {
+	switch m.Type {
+	case lex.TokenPreceding:
+		return -m.Offset, m.Unbounded
+	case lex.TokenFollowing:
+		return m.Offset, m.Unbounded
+	}
+	return 0, false
 }
 
 // Return left, right values if is of form   `table.column` and
@@ -788,6 +974,47 @@ func (m *PreparedStatement) WriteDialect(w expr.DialectWriter) {
 	m.Statement.WriteDialect(w)
 }
 
+// NumInput the number of arguments bound to the placeholders, the
+// highest $n or else the number of ?.
+func (m *PreparedStatement) NumInput() int {
+	n := 0
+	for _, p := range m.Params {
+		if p.Pos > n {
+			n = p.Pos
+		}
+	}
+	return n
+}
+
+// Bind the arguments to the placeholders before an execution of the
+// statement, $n (or the n'th ?) is bound to args[n-1].
+func (m *PreparedStatement) Bind(args []value.Value) error {
+	if len(args) != m.NumInput() {
+		return fmt.Errorf("expected %d arguments but got %d", m.NumInput(), len(args))
+	}
+	for _, p := range m.Params {
+		p.Value = args[p.Pos-1]
+	}
+	for _, lp := range m.limits {
+		n, ok := value.ValueToInt64(lp.param.Value)
+		if !ok || n < 0 {
+			return fmt.Errorf("LIMIT and OFFSET must be non-negative integers but got %s", lp.param)
+		}
+		*lp.dest = int(n)
+	}
+	return nil
+}
+
+// limitParam a placeholder of a LIMIT or OFFSET, binding it sets @dest.
+type limitParam struct {
+	param *expr.ParamNode
+	dest  *int
+}
+
+// BindsLimit is a LIMIT or OFFSET of the statement a placeholder, so a
+// plan of it depends on the arguments bound.
+func (m *PreparedStatement) BindsLimit() bool { return len(m.limits) > 0 }
+
 func (m *SqlSelect) Keyword() lex.TokenType { return lex.TokenSelect }
 func (m *SqlSelect) SystemQry() bool        { return len(m.From) == 0 && m.schemaqry }
 func (m *SqlSelect) SetSystemQry()          { m.schemaqry = true }
@@ -891,6 +1118,17 @@ func (m *SqlSelect) IsAggQuery() bool {
 	}
 	return false
 }
+
+// IsWindowQuery does this select have analytic function columns evaluated
+// over a window  ie  row_number() OVER (PARTITION BY user_id)
+func (m *SqlSelect) IsWindowQuery() bool {
+	for _, col := range m.Columns {
+		if col.Over != nil {
+			return true
+		}
+	}
+	return false
+}
 func (m *SqlSelect) String() string {
 	w := NewSqlDialect()
 	m.writeDialectDepth(0, w)
@@ -1055,6 +1293,209 @@ func (m *SqlSelect) RewriteAsRawSelect() {
 	RewriteSelect(m)
 }
 
+func (m *SqlSetOp) Keyword() lex.TokenType { return m.Op }
+func (m *SqlSetOp) String() string {
+	w := NewSqlDialect()
+	m.WriteDialect(w)
+	return w.String()
+}
+func (m *SqlSetOp) WriteDialect(w expr.DialectWriter) {
+	m.Left.WriteDialect(w)
+	io.WriteString(w, " ")
+	io.WriteString(w, strings.ToUpper(m.Op.String()))
+	if m.All {
+		io.WriteString(w, " ALL")
+	}
+	io.WriteString(w, " ")
+	m.Right.WriteDialect(w)
+	if len(m.OrderBy) > 0 {
+		io.WriteString(w, " ORDER BY ")
+		m.OrderBy.WriteDialect(w)
+	}
+	if m.Limit > 0 {
+		io.WriteString(w, fmt.Sprintf(" LIMIT %d", m.Limit))
+	}
+	if m.Offset > 0 {
+		io.WriteString(w, fmt.Sprintf(" OFFSET %d", m.Offset))
+	}
+}
+func (m *SqlSetOp) Equal(ss SqlStatement) bool {
+	s, ok := ss.(*SqlSetOp)
+	if !ok {
+		return false
+	}
+	if m == nil && s == nil {
+		return true
+	}
+	if m == nil || s == nil {
+		return false
+	}
+	if m.Op != s.Op || m.All != s.All || m.Limit != s.Limit || m.Offset != s.Offset {
+		return false
+	}
+	if len(m.OrderBy) != len(s.OrderBy) {
+		return false
+	}
+	for i, c := range m.OrderBy {
+		if !c.Equal(s.OrderBy[i]) {
+			return false
+		}
+	}
+	return m.Left.String() == s.Left.String() && m.Right.String() == s.Right.String()
+}
+
+// First is the left-most select, whose columns name the result columns.
+func (m *SqlSetOp) First() *SqlSelect {
+	switch lt := m.Left.(type) {
+	case *SqlSelect:
+		return lt
+	case *SqlSetOp:
+		return lt.First()
+	}
+	return nil
+}
+
+// Selects all of the selects of this statement, left to right.
+func (m *SqlSetOp) Selects() []*SqlSelect {
+	sels := make([]*SqlSelect, 0, 2)
+	for _, stmt := range []SqlStatement{m.Left, m.Right} {
+		switch st := stmt.(type) {
+		case *SqlSelect:
+			sels = append(sels, st)
+		case *SqlSetOp:
+			sels = append(sels, st.Selects()...)
+		}
+	}
+	return sels
+}
+
+func (m *SqlWith) Keyword() lex.TokenType { return lex.TokenWith }
+func (m *SqlWith) String() string {
+	w := NewSqlDialect()
+	m.WriteDialect(w)
+	return w.String()
+}
+func (m *SqlWith) WriteDialect(w expr.DialectWriter) {
+	io.WriteString(w, "WITH ")
+	if m.Recursive {
+		io.WriteString(w, "RECURSIVE ")
+	}
+	for i, cte := range m.Ctes {
+		if i > 0 {
+			io.WriteString(w, ", ")
+		}
+		cte.WriteDialect(w)
+	}
+	io.WriteString(w, " ")
+	m.Stmt.WriteDialect(w)
+}
+func (m *SqlWith) Equal(ss SqlStatement) bool {
+	s, ok := ss.(*SqlWith)
+	if !ok {
+		return false
+	}
+	if m == nil && s == nil {
+		return true
+	}
+	if m == nil || s == nil {
+		return false
+	}
+	if m.Recursive != s.Recursive || len(m.Ctes) != len(s.Ctes) {
+		return false
+	}
+	for i, cte := range m.Ctes {
+		if !cte.Equal(s.Ctes[i]) {
+			return false
+		}
+	}
+	return m.Stmt.String() == s.Stmt.String()
+}
+
+// First the first select of the statement, which names its columns.
+func (m *SqlWith) First() *SqlSelect {
+	switch st := m.Stmt.(type) {
+	case *SqlSelect:
+		return st
+	case *SqlSetOp:
+		return st.First()
+	}
+	return nil
+}
+
+// Cte find a common table expression by name
+func (m *SqlWith) Cte(name string) *SqlCte {
+	for _, cte := range m.Ctes {
+		if strings.EqualFold(cte.Name, name) {
+			return cte
+		}
+	}
+	return nil
+}
+
+func (m *SqlCte) String() string {
+	w := NewSqlDialect()
+	m.WriteDialect(w)
+	return w.String()
+}
+func (m *SqlCte) WriteDialect(w expr.DialectWriter) {
+	w.WriteIdentity(m.Name)
+	if len(m.Columns) > 0 {
+		io.WriteString(w, " (")
+		for i, col := range m.Columns {
+			if i > 0 {
+				io.WriteString(w, ", ")
+			}
+			w.WriteIdentity(col)
+		}
+		io.WriteString(w, ")")
+	}
+	io.WriteString(w, " AS (")
+	m.Stmt.WriteDialect(w)
+	io.WriteString(w, ")")
+}
+func (m *SqlCte) Equal(s *SqlCte) bool {
+	if m == nil && s == nil {
+		return true
+	}
+	if m == nil || s == nil {
+		return false
+	}
+	if m.Name != s.Name || len(m.Columns) != len(s.Columns) {
+		return false
+	}
+	for i, col := range m.Columns {
+		if col != s.Columns[i] {
+			return false
+		}
+	}
+	return m.Stmt.String() == s.Stmt.String()
+}
+
+// References does the FROM of one of the selects of the query read from
+// the table @name (not including sub queries of expressions).
+func (m *SqlCte) References(name string) bool {
+	return ReadsTable(m.Stmt, name)
+}
+
+// ReadsTable does the FROM of one of the selects of @stmt read from the
+// table @name (not including sub queries of expressions).
+func ReadsTable(stmt SqlStatement, name string) bool {
+	switch st := stmt.(type) {
+	case *SqlSelect:
+		for _, from := range st.From {
+			if from.SubQuery != nil && ReadsTable(from.SubQuery, name) {
+				return true
+			}
+			if from.Schema == "" && strings.EqualFold(from.Name, name) {
+				return true
+			}
+		}
+	case *SqlSetOp:
+		return ReadsTable(st.Left, name) || ReadsTable(st.Right, name)
+	}
+	return false
+}
+
 func (m *SqlSource) IsLiteral() bool        { return len(m.Name) == 0 }
 func (m *SqlSource) Keyword() lex.TokenType { return m.Op }
 func (m *SqlSource) SourceName() string {
@@ -1101,8 +1542,12 @@ func (m *SqlSource) writeDialectDepth(depth int, w expr.DialectWriter) {
 		return
 	}
 
-	//   Jointype                Op
-	//  INNER JOIN orders AS o 	ON
+	//   LeftOrRight Jointype                Op
+	//  LEFT        OUTER JOIN orders AS o 	ON
+	if int(m.LeftOrRight) != 0 {
+		io.WriteString(w, strings.ToTitle(m.LeftOrRight.String())) // left/right/full
+		io.WriteString(w, " ")
+	}
 	if int(m.JoinType) != 0 {
 		io.WriteString(w, strings.ToTitle(m.JoinType.String())) // inner/outer
 		io.WriteString(w, " ")
@@ -1522,7 +1967,12 @@ func (m *SqlUpdate) WriteDialect(w expr.DialectWriter) {
 		}
 		firstCol = false
 		w.WriteIdentity(key)
-		w.WriteValue(val.Value)
+		io.WriteString(w, " = ")
+		if val.Expr != nil {
+			val.Expr.WriteDialect(w)
+		} else {
+			w.WriteValue(val.Value)
+		}
 	}
 	if m.Where != nil {
 		io.WriteString(w, " WHERE ")
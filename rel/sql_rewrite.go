@@ -50,10 +50,17 @@ func RewriteSqlSource(m *SqlSource, parentStmt *SqlSelect) *SqlSelect {
 
 			} else if hasLeft && left == m.Alias {
 				newCol := col.CopyRewrite(m.Alias)
+				if _, isIdent := newCol.Expr.(*expr.IdentityNode); !isIdent && newCol.SourceField != "" {
+					// the source reads the field, the expression is evaluated
+					// by the parent on the joined row
+					newCol.Expr = &expr.IdentityNode{Text: newCol.SourceField}
+					newCol.As = newCol.SourceField
+				}
 				newCol.ParentIndex = idx
 				newCol.SourceIndex = len(newCols)
 				newCol.Index = len(newCols)
 				newCols = append(newCols, newCol)
+				newCols = columnsFromExpr(m, col.Expr, newCols)
 			}
 		}
 	}
@@ -77,6 +84,11 @@ func RewriteSqlSource(m *SqlSource, parentStmt *SqlSelect) *SqlSelect {
 		// We need to check each participant in the Join for possible
 		// columns which need to be re-written
 		sql2.Columns = columnsFromJoin(m, from.JoinExpr, sql2.Columns)
+		if from.JoinExpr != nil {
+			// conditions of the ON clause which are not join keys are
+			// evaluated on the joined rows, and read any of its fields
+			sql2.Columns = columnsFromExpr(m, from.JoinExpr, sql2.Columns)
+		}
 
 		// We also need to create an expression used for evaluating
 		// the values of Join "Keys"
@@ -87,23 +99,78 @@ func RewriteSqlSource(m *SqlSource, parentStmt *SqlSelect) *SqlSelect {
 
 	if parentStmt.Where != nil {
 		node, cols := rewriteWhere(parentStmt, m, parentStmt.Where.Expr, make(Columns, 0))
-		if node != nil {
+		// the where is evaluated again on the joined rows, but a source
+		// whose rows an outer join NULL fills may not be filtered before
+		// it, as a NULL of it may be a row the join did not match
+		if node != nil && !nullSupplying(parentStmt, m) {
 			sql2.Where = &SqlWhere{Expr: node}
 		}
-		if len(cols) > 0 {
-			parentIdx := len(parentStmt.Columns)
-			for _, col := range cols {
-				col.Index = len(sql2.Columns)
-				col.ParentIndex = parentIdx
-				parentIdx++
-				sql2.Columns = append(sql2.Columns, col)
+		for _, col := range cols {
+			if _, exists := sql2.Columns.ByName(col.SourceField); exists {
+				continue // already read for the projection
 			}
+			col.Index = len(sql2.Columns)
+			col.ParentIndex = -1 // only needed for where, not in parent projection
+			sql2.Columns = append(sql2.Columns, col)
 		}
+		// fields the where of the joined rows reads, which are not
+		// all read by the where rewritten for this source
+		sql2.Columns = columnsFromExpr(m, parentStmt.Where.Expr, sql2.Columns)
 	}
 	m.Source = sql2
 	m.cols = sql2.UnAliasedColumns()
 	return sql2
 }
+
+// columnsFromExpr adds a column for each field of source @from read by
+// @node which isn't already one of @cols, not needed in the parent
+// projection but for evaluating its expression on the joined row.
+func columnsFromExpr(from *SqlSource, node expr.Node, cols Columns) Columns {
+	for _, in := range expr.FindAllIdentities(node) {
+		left, right, ok := in.LeftRight()
+		if !ok || left != from.Alias {
+			continue
+		}
+		found := false
+		for _, col := range cols {
+			if col.SourceField == right {
+				found = true
+				break
+			}
+		}
+		if !found {
+			newCol := &Column{As: right, SourceField: right, Expr: &expr.IdentityNode{Text: right}}
+			newCol.Index = len(cols)
+			newCol.ParentIndex = -1
+			cols = append(cols, newCol)
+		}
+	}
+	return cols
+}
+
+// nullSupplying is @from the null-supplying side of an outer join of
+// @stmt, ie are its columns NULL in joined rows it did not match.  The
+// join type is on the right-hand source: the source of a LEFT JOIN, and
+// the sources before a RIGHT JOIN, are NULL filled, of a FULL JOIN both.
+func nullSupplying(stmt *SqlSelect, from *SqlSource) bool {
+	after := false
+	for i, f := range stmt.From {
+		full := i > 0 && (f.LeftOrRight == lex.TokenFull || (f.LeftOrRight == 0 && f.JoinType == lex.TokenOuter))
+		switch {
+		case f == from:
+			if f.LeftOrRight == lex.TokenLeft || full {
+				return true
+			}
+			after = true
+		case after:
+			if f.LeftOrRight == lex.TokenRight || full {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func rewriteIntoProjection(sel *SqlSelect, m Columns) {
 	if len(m) == 0 {
 		return
@@ -114,7 +181,7 @@ func rewriteIntoProjection(sel *SqlSelect, m Columns) {
 		switch n := c.Expr.(type) {
 		case *expr.IdentityNode:
 			colsToAdd = append(colsToAdd, c.SourceField)
-		case *expr.FuncNode:
+		case *expr.FuncNode, *expr.CaseNode:
 
 			idents := expr.FindAllIdentities(n)
 			for _, in := range idents {
@@ -176,7 +243,7 @@ func rewriteWhere(stmt *SqlSelect, from *SqlSource, node expr.Node, cols Columns
 			//u.Debugf("returning original: %s", nt)
 			return node, cols
 		}
-	case *expr.NumberNode, *expr.NullNode, *expr.StringNode:
+	case *expr.NumberNode, *expr.NullNode, *expr.StringNode, *expr.ParamNode:
 		return nt, cols
 	case *expr.BinaryNode:
 		//u.Infof("binaryNode  T:%v", nt.Operator.T.String())
@@ -195,7 +262,8 @@ func rewriteWhere(stmt *SqlSelect, from *SqlSource, node expr.Node, cols Columns
 			} else {
 				//u.Warnf("n1=%#v  n2=%#v    %#v", n1, n2, nt)
 			}
-		case lex.TokenEqual, lex.TokenEqualEqual, lex.TokenGT, lex.TokenGE, lex.TokenLE, lex.TokenNE:
+		case lex.TokenEqual, lex.TokenEqualEqual, lex.TokenGT, lex.TokenGE, lex.TokenLE, lex.TokenNE,
+			lex.TokenIs, lex.TokenIsNot:
 			var n1, n2 expr.Node
 			n1, cols = rewriteWhere(stmt, from, nt.Args[0], cols)
 			n2, cols = rewriteWhere(stmt, from, nt.Args[1], cols)
@@ -240,7 +308,7 @@ func joinNodesForFrom(stmt *SqlSelect, from *SqlSource, node expr.Node, depth in
 		} else {
 			u.Warnf("dropping join expr node: %q", nt.String())
 		}
-	case *expr.NumberNode, *expr.NullNode, *expr.StringNode, *expr.ValueNode:
+	case *expr.NumberNode, *expr.NullNode, *expr.StringNode, *expr.ValueNode, *expr.ParamNode:
 		//u.Warnf("skipping? %v", nt.String())
 		return nt
 	case *expr.FuncNode:
@@ -281,7 +349,8 @@ func joinNodesForFrom(stmt *SqlSelect, from *SqlSource, node expr.Node, depth in
 			} else {
 				//u.Warnf("%d n1=%#v  n2=%#v    %#v", depth, n1, n2, nt)
 			}
-		case lex.TokenEqual, lex.TokenEqualEqual, lex.TokenGT, lex.TokenGE, lex.TokenLE, lex.TokenNE:
+		case lex.TokenEqual, lex.TokenEqualEqual, lex.TokenGT, lex.TokenGE, lex.TokenLE, lex.TokenNE,
+			lex.TokenIs, lex.TokenIsNot:
 			n1 := joinNodesForFrom(stmt, from, nt.Args[0], depth+1)
 			n2 := joinNodesForFrom(stmt, from, nt.Args[1], depth+1)
 
@@ -387,7 +456,7 @@ func rewriteNode(from *SqlSource, node expr.Node) expr.Node {
 				return &in
 			}
 		}
-	case *expr.NumberNode, *expr.NullNode, *expr.StringNode, *expr.ValueNode:
+	case *expr.NumberNode, *expr.NullNode, *expr.StringNode, *expr.ValueNode, *expr.ParamNode:
 		//u.Warnf("skipping? %v", nt.String())
 		return nt
 	case *expr.BinaryNode:
@@ -421,6 +490,27 @@ func rewriteNode(from *SqlSource, node expr.Node) expr.Node {
 			}
 		}
 		return fn
+	case *expr.CaseNode:
+		cn := &expr.CaseNode{}
+		if nt.Operand != nil {
+			if cn.Operand = rewriteNode(from, nt.Operand); cn.Operand == nil {
+				return nil
+			}
+		}
+		for i, when := range nt.Whens {
+			w, t := rewriteNode(from, when), rewriteNode(from, nt.Thens[i])
+			if w == nil || t == nil {
+				return nil
+			}
+			cn.Whens = append(cn.Whens, w)
+			cn.Thens = append(cn.Thens, t)
+		}
+		if nt.Else != nil {
+			if cn.Else = rewriteNode(from, nt.Else); cn.Else == nil {
+				return nil
+			}
+		}
+		return cn
 	default:
 		u.Warnf("%T node types are not suppored yet for column rewrite", node)
 	}
@@ -47,6 +47,13 @@ type (
 		// Table get table schema for given table name.
 		Table(table string) (*Table, error)
 	}
+	// SourceFactory is an optional interface for a registered source type whose
+	// instances are stateful per schema (a file path, a database handle).  When
+	// present the registry creates a new source for each schema built from config
+	// instead of sharing the registered singleton.
+	SourceFactory interface {
+		NewSource() Source
+	}
 	// SourceTableSchema Partial interface from Source to define just Table()
 	SourceTableSchema interface {
 		Table(table string) (*Table, error)
@@ -129,6 +136,13 @@ type (
 	ConnSeeker interface {
 		Get(key driver.Value) (Message, error)
 	}
+	// ConnSkipper is a scanner that can skip over rows without reading them
+	// into messages, the OFFSET of a query is pushed down to it.
+	ConnSkipper interface {
+		// Skip the next n rows, returns the number skipped which is less
+		// than n only if the rows ran out.
+		Skip(n int) int
+	}
 	// ConnMutation creates a Mutator connection similar to Open() connection for select
 	// - accepts the plan context used in this upsert/insert/update
 	// - returns a connection which must be closed
@@ -158,4 +172,17 @@ type (
 		// Delete with given expression
 		DeleteExpression(p any /* plan.Delete */, n expr.Node) (int, error)
 	}
+	// ConnTransactional is an optional interface for connections of mutating sources
+	// that support transactions spanning statements.  Conns opened through the
+	// returned ConnTx read and write the transaction's state until it ends.
+	ConnTransactional interface {
+		Begin() (ConnTx, error)
+	}
+	// ConnTx a transaction begun on a source by ConnTransactional.
+	ConnTx interface {
+		// Open a connection to table inside this transaction.
+		Open(table string) (Conn, error)
+		Commit() error
+		Rollback() error
+	}
 )
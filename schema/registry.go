@@ -181,6 +181,9 @@ func (m *Registry) SchemaAddFromConfig(conf *ConfigSource) error {
 		u.Warnf("could not find source type %q  \nregistry: %s", conf.SourceType, m.String())
 		return err
 	}
+	if f, ok := source.(SourceFactory); ok {
+		source = f.NewSource()
+	}
 
 	s := NewSchema(conf.Name)
 	s.Conf = conf
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"hash/fnv"
+	"net/url"
 	"sort"
 	"strings"
 	"sync"
@@ -103,6 +104,7 @@ type (
 		FieldMap       map[string]*Field // Map of Field-name -> Field
 		Schema         *Schema           // The schema this is member of
 		Source         Source            // The source
+		RowCt          uint64            // Estimated row count for planning, 0 if unknown
 		tblID          uint64            // internal tableid, hash of table name + schema?
 		cols           []string          // array of column names
 		lastRefreshed  time.Time         // Last time we refreshed this schema
@@ -565,6 +567,29 @@ func (m *Table) SetColumnsFromFields() {
 // Columns list of all column names.
 func (m *Table) Columns() []string { return m.cols }
 
+// PrimaryKey the field names of the primary key index, nil if this
+// table does not have one.
+func (m *Table) PrimaryKey() []string {
+	for _, idx := range m.Indexes {
+		if idx.PrimaryKey {
+			return idx.Fields
+		}
+	}
+	return nil
+}
+
+// Selectivity estimated fraction of rows an equality condition on the given
+// column matches, 0 if unknown.  A single column primary key matches one row.
+func (m *Table) Selectivity(col string) float64 {
+	if m.RowCt == 0 {
+		return 0
+	}
+	if pk := m.PrimaryKey(); len(pk) == 1 && strings.EqualFold(pk[0], col) {
+		return 1 / float64(m.RowCt)
+	}
+	return 0
+}
+
 // AsRows return all fields suiteable as list of values for Describe/Show statements.
 func (m *Table) AsRows() [][]driver.Value {
 	if len(m.rows) > 0 {
@@ -702,6 +727,41 @@ func NewSourceConfig(name, sourceType string) *ConfigSource {
 	}
 }
 
+// NewConfigSourceFromDsn create a source config from a dsn of the form
+//
+//	sourcetype://host/path?key=value&key2=value2
+//
+// such as "csv:///tmp/data?delimiter=;" or "sqlite:///tmp/my.db".  The
+// scheme is the registered source type, host+path is the "path" setting and
+// each query parameter becomes a setting.  The lowercased dsn is the schema name.
+func NewConfigSourceFromDsn(dsn string) (*ConfigSource, error) {
+	dsnUrl, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dsnUrl.Scheme == "" {
+		return nil, fmt.Errorf("dsn %q must be of form sourcetype://path", dsn)
+	}
+	settings := u.JsonHelper{"path": dsnUrl.Host + dsnUrl.Path}
+	// url.Query() rejects ";" as a separator so parse the query ourselves.
+	for _, kv := range strings.Split(dsnUrl.RawQuery, "&") {
+		if kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		if k, err = url.QueryUnescape(k); err != nil {
+			return nil, err
+		}
+		if v, err = url.QueryUnescape(v); err != nil {
+			return nil, err
+		}
+		settings[k] = v
+	}
+	conf := NewSourceConfig(strings.ToLower(dsn), strings.ToLower(dsnUrl.Scheme))
+	conf.Settings = settings
+	return conf, nil
+}
+
 func (m *ConfigSource) String() string {
 	return fmt.Sprintf(`<sourceconfig name=%q type=%q settings=%v/>`, m.Name, m.SourceType, m.Settings)
 }
@@ -255,3 +255,22 @@ func TestConfig(t *testing.T) {
 	assert.NotEqual(t, nil, c)
 	assert.NotEqual(t, "", c.String())
 }
+
+func TestConfigFromDsn(t *testing.T) {
+	c, err := schema.NewConfigSourceFromDsn("CSV:///tmp/Data?delimiter=;&header=a%20b")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "csv:///tmp/data?delimiter=;&header=a%20b", c.Name)
+	assert.Equal(t, "csv", c.SourceType)
+	assert.Equal(t, "/tmp/Data", c.Settings.String("path"))
+	assert.Equal(t, ";", c.Settings.String("delimiter"))
+	assert.Equal(t, "a b", c.Settings.String("header"))
+
+	c, err = schema.NewConfigSourceFromDsn("files://bucket/tables?format=json")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "files", c.SourceType)
+	assert.Equal(t, "bucket/tables", c.Settings.String("path"))
+	assert.Equal(t, "json", c.Settings.String("format"))
+
+	_, err = schema.NewConfigSourceFromDsn("/tmp/data.csv")
+	assert.NotEqual(t, nil, err)
+}
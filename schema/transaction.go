@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"sync"
+)
+
+// Transaction is a transaction spanning the statements run on a connection.
+// The sources are opened through it; the transaction of each ConnTransactional
+// source is begun the first time a statement opens it, and they are all committed
+// or rolled back together.  Sources that are not transactional are opened as is,
+// their writes are applied immediately.
+type Transaction struct {
+	mu   sync.Mutex
+	txs  map[Source]ConnTx
+	done bool
+}
+
+// NewTransaction create a new transaction, its sources' transactions
+// are begun as they are opened.
+func NewTransaction() *Transaction {
+	return &Transaction{txs: make(map[Source]ConnTx)}
+}
+
+// Open a connection to @table of source @ds inside this transaction.  Once
+// the transaction is committed or rolled back conns are opened on the source.
+func (m *Transaction) Open(ds Source, table string) (Conn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return ds.Open(table)
+	}
+	if tx, ok := m.txs[ds]; ok {
+		return tx.Open(table)
+	}
+	conn, err := ds.Open(table)
+	if err != nil {
+		return nil, err
+	}
+	tc, ok := conn.(ConnTransactional)
+	if !ok {
+		return conn, nil
+	}
+	tx, err := tc.Begin()
+	// this conn was only needed to begin the transaction, sources such
+	// as sqlite hold a lock until it is closed.
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+	m.txs[ds] = tx
+	return tx.Open(table)
+}
+
+// Done is true once this transaction has been committed or rolled back.
+func (m *Transaction) Done() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.done
+}
+
+// Commit the transactions of all sources opened in this transaction, returns
+// the first error.  Committing an ended transaction does nothing.
+func (m *Transaction) Commit() error { return m.end(ConnTx.Commit) }
+
+// Rollback the transactions of all sources opened in this transaction, returns
+// the first error.  Rolling back an ended transaction does nothing.
+func (m *Transaction) Rollback() error { return m.end(ConnTx.Rollback) }
+
+func (m *Transaction) end(endTx func(ConnTx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return nil
+	}
+	m.done = true
+	var err error
+	for _, tx := range m.txs {
+		if txErr := endTx(tx); txErr != nil && err == nil {
+			err = txErr
+		}
+	}
+	m.txs = nil
+	return err
+}
@@ -0,0 +1,740 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/exec"
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/lex"
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/rel"
+	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/value"
+)
+
+// commands of the client
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_command_phase.html
+const (
+	comQuit             byte = 0x01
+	comInitDB           byte = 0x02
+	comQuery            byte = 0x03
+	comFieldList        byte = 0x04
+	comPing             byte = 0x0e
+	comStmtPrepare      byte = 0x16
+	comStmtExecute      byte = 0x17
+	comStmtSendLongData byte = 0x18
+	comStmtClose        byte = 0x19
+	comStmtReset        byte = 0x1a
+)
+
+// capability flags
+const (
+	clientLongPassword               uint32 = 0x00000001
+	clientFoundRows                  uint32 = 0x00000002
+	clientLongFlag                   uint32 = 0x00000004
+	clientConnectWithDB              uint32 = 0x00000008
+	clientProtocol41                 uint32 = 0x00000200
+	clientTransactions               uint32 = 0x00002000
+	clientSecureConn                 uint32 = 0x00008000
+	clientPluginAuth                 uint32 = 0x00080000
+	clientPluginAuthLenEncClientData uint32 = 0x00200000
+
+	serverCapabilities = clientLongPassword | clientFoundRows | clientLongFlag |
+		clientConnectWithDB | clientProtocol41 | clientTransactions | clientSecureConn |
+		clientPluginAuth | clientPluginAuthLenEncClientData
+)
+
+// server status flags
+const (
+	statusInTrans    uint16 = 0x0001
+	statusAutocommit uint16 = 0x0002
+)
+
+const nativePasswordPlugin = "mysql_native_password"
+
+// mysqlError is an error sent to the client in an ERR packet, other errors
+// are sent as ER_UNKNOWN_ERROR.
+//
+// https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+type mysqlError struct {
+	code  uint16
+	state string
+	msg   string
+}
+
+func (e *mysqlError) Error() string { return e.msg }
+
+func newError(code uint16, state, format string, args ...any) *mysqlError {
+	return &mysqlError{code: code, state: state, msg: fmt.Sprintf(format, args...)}
+}
+
+var (
+	errNoDatabase     = newError(1046, "3D000", "No database selected")
+	errPacketTooLarge = newError(1153, "08S01", "Got a packet bigger than 'max_allowed_packet' bytes")
+)
+
+// conn is a client connection, its session variables, selected schema,
+// transaction and prepared statements.  Commands are served one at a time.
+type conn struct {
+	srv    *Server
+	nc     net.Conn
+	pkt    *packetIO
+	id     uint32
+	salt   []byte
+	ctx    context.Context // canceled once closed, stopping running queries
+	cancel context.CancelFunc
+	once   sync.Once
+
+	schema   *schema.Schema
+	session  expr.ContextReadWriter // session variables, SET by this connection
+	tx       *schema.Transaction    // transaction begun on this connection
+	stmts    map[uint32]*stmt
+	lastStmt uint32
+}
+
+// stmt a prepared statement of the connection
+type stmt struct {
+	id       uint32
+	prepared *exec.PreparedJob // nil for BEGIN
+	params   int
+	types    []byte         // 2 byte type of each parameter, sent on first execute
+	longData map[int][]byte // parameter values sent by COM_STMT_SEND_LONG_DATA
+	longErr  error          // error of COM_STMT_SEND_LONG_DATA, reported by the execute
+}
+
+func newConn(srv *Server, nc net.Conn, id uint32) *conn {
+	m := &conn{
+		srv:     srv,
+		nc:      nc,
+		pkt:     newPacketIO(nc, datasource.MaxAllowedPacket),
+		id:      id,
+		session: datasource.NewMySqlSessionVars(),
+		stmts:   make(map[uint32]*stmt),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// close the network connection, stopping a running query.
+func (m *conn) close() {
+	m.once.Do(func() {
+		m.cancel()
+		m.nc.Close()
+	})
+}
+
+// serve the connection, the handshake then commands until the client quits
+// or the connection is closed.  A transaction left open is rolled back.
+func (m *conn) serve() {
+	defer func() {
+		if m.tx != nil {
+			if err := m.tx.Rollback(); err != nil {
+				u.Warnf("could not rollback transaction of connection %d: %v", m.id, err)
+			}
+		}
+		m.close()
+		m.srv.removeConn(m)
+	}()
+
+	if err := m.handshake(); err != nil {
+		u.Debugf("mysql handshake of %v failed: %v", m.nc.RemoteAddr(), err)
+		return
+	}
+	for {
+		// each command starts a new packet sequence
+		m.pkt.seq = 0
+		m.nc.SetReadDeadline(time.Now().Add(m.srv.conf.IdleTimeout))
+		data, err := m.pkt.readPacket()
+		if err != nil {
+			if err == errPacketTooLarge {
+				m.writeError(err)
+				m.pkt.flush()
+			} else if err != io.EOF {
+				u.Debugf("mysql connection %d read error: %v", m.id, err)
+			}
+			return
+		}
+		if len(data) == 0 {
+			return
+		}
+		quit, err := m.dispatch(data[0], data[1:])
+		if err == nil {
+			err = m.pkt.flush()
+		}
+		if err != nil {
+			u.Debugf("mysql connection %d write error: %v", m.id, err)
+			return
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// dispatch runs a command, writing its response.  The error returned is
+// that of writing the response, errors of the command are sent to the client.
+func (m *conn) dispatch(cmd byte, data []byte) (quit bool, err error) {
+	// a panic of the parser or planner fails the command, not the server
+	defer func() {
+		if r := recover(); r != nil {
+			u.Errorf("panic on mysql connection %d command %d: %v\n%s", m.id, cmd, r, debug.Stack())
+			quit, err = false, m.writeError(fmt.Errorf("internal error: %v", r))
+		}
+	}()
+	switch cmd {
+	case comQuit:
+		return true, nil
+	case comInitDB:
+		if err := m.useSchema(string(data)); err != nil {
+			return false, m.writeError(err)
+		}
+		return false, m.writeOK(0, 0)
+	case comQuery:
+		return false, m.handleQuery(string(data))
+	case comFieldList:
+		// the columns of tables are listed by SHOW COLUMNS, the mysql cli
+		// only uses this for completion
+		return false, m.writeEOF()
+	case comPing:
+		return false, m.writeOK(0, 0)
+	case comStmtPrepare:
+		return false, m.handlePrepare(string(data))
+	case comStmtExecute:
+		return false, m.handleExecute(data)
+	case comStmtSendLongData:
+		// no response, errors are reported by the execute
+		r := &reader{data: data}
+		id, param := r.uint32(), int(r.uint16())
+		if st, ok := m.stmts[id]; ok && r.err == nil {
+			st.sendLongData(param, r.rest())
+		}
+		return false, nil
+	case comStmtClose:
+		// no response
+		r := &reader{data: data}
+		delete(m.stmts, r.uint32())
+		return false, nil
+	case comStmtReset:
+		r := &reader{data: data}
+		st, ok := m.stmts[r.uint32()]
+		if !ok {
+			return false, m.writeError(newError(1243, "HY000", "Unknown prepared statement handler given to mysqld_stmt_reset"))
+		}
+		st.reset()
+		return false, m.writeOK(0, 0)
+	}
+	return false, m.writeError(newError(1047, "08S01", "Unknown command %d", cmd))
+}
+
+// handshake sends the initial handshake, authenticates the response of the
+// client and selects the database it names, or else that of the config.
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_connection_phase.html
+func (m *conn) handshake() error {
+	// the client is not yet authenticated, it may not hold the connection
+	m.nc.SetReadDeadline(time.Now().Add(m.srv.conf.HandshakeTimeout))
+	m.salt = newSalt()
+	b := []byte{0x0a} // protocol version
+	b = append(append(b, ServerVersion...), 0)
+	b = binary.LittleEndian.AppendUint32(b, m.id)
+	b = append(append(b, m.salt[:8]...), 0)
+	b = binary.LittleEndian.AppendUint16(b, uint16(serverCapabilities&0xffff))
+	b = append(b, charsetUtf8)
+	b = binary.LittleEndian.AppendUint16(b, m.status())
+	b = binary.LittleEndian.AppendUint16(b, uint16(serverCapabilities>>16))
+	b = append(b, byte(len(m.salt)+1))
+	b = append(b, make([]byte, 10)...) // reserved
+	b = append(append(b, m.salt[8:]...), 0)
+	b = append(append(b, nativePasswordPlugin...), 0)
+	if err := m.pkt.writePacket(b); err != nil {
+		return err
+	}
+	if err := m.pkt.flush(); err != nil {
+		return err
+	}
+
+	data, err := m.pkt.readPacket()
+	if err == errPacketTooLarge {
+		m.writeError(err)
+		m.pkt.flush()
+		return err
+	} else if err != nil {
+		return err
+	}
+	// HandshakeResponse41
+	r := &reader{data: data}
+	caps := r.uint32()
+	r.uint32() // max packet size
+	r.uint8()  // charset
+	r.bytes(23)
+	if caps&clientProtocol41 == 0 {
+		err := newError(1043, "08S01", "Bad handshake, protocol 4.1 is required")
+		m.writeError(err)
+		m.pkt.flush()
+		return err
+	}
+	user := r.nulString()
+	var auth []byte
+	switch {
+	case caps&clientPluginAuthLenEncClientData != 0:
+		n, _ := r.lengthEncodedInt()
+		auth = r.bytes(int(n))
+	case caps&clientSecureConn != 0:
+		auth = r.bytes(int(r.uint8()))
+	default:
+		auth = []byte(r.nulString())
+	}
+	var db, plugin string
+	if caps&clientConnectWithDB != 0 && !r.eof() {
+		db = r.nulString()
+	}
+	if caps&clientPluginAuth != 0 && !r.eof() {
+		plugin = r.nulString()
+	}
+	if r.err != nil {
+		err := newError(1043, "08S01", "Bad handshake")
+		m.writeError(err)
+		m.pkt.flush()
+		return err
+	}
+
+	if plugin != "" && plugin != nativePasswordPlugin {
+		// AuthSwitchRequest to the only supported auth method
+		b := append([]byte{iEOF}, nativePasswordPlugin...)
+		b = append(append(append(b, 0), m.salt...), 0)
+		if err := m.pkt.writePacket(b); err != nil {
+			return err
+		}
+		if err := m.pkt.flush(); err != nil {
+			return err
+		}
+		if auth, err = m.pkt.readPacket(); err != nil {
+			return err
+		}
+	}
+
+	err = m.authenticate(user, auth)
+	if err == nil {
+		if db == "" {
+			db = m.srv.conf.Schema
+		}
+		if db != "" {
+			err = m.useSchema(db)
+		}
+	}
+	if err != nil {
+		m.writeError(err)
+		m.pkt.flush()
+		return err
+	}
+	if err := m.writeOK(0, 0); err != nil {
+		return err
+	}
+	return m.pkt.flush()
+}
+
+// authenticate the user by the mysql_native_password scramble of the salt,
+// any user is allowed if the config has no user and allows anonymous
+// access.
+func (m *conn) authenticate(user string, auth []byte) error {
+	conf := m.srv.conf
+	if conf.User == "" && conf.AllowAnonymous {
+		return nil
+	}
+	if conf.User != "" && user == conf.User && checkNativePassword(m.salt, auth, conf.Password) {
+		return nil
+	}
+	host, _, _ := net.SplitHostPort(m.nc.RemoteAddr().String())
+	usingPassword := "NO"
+	if len(auth) > 0 {
+		usingPassword = "YES"
+	}
+	return newError(1045, "28000", "Access denied for user '%s'@'%s' (using password: %s)", user, host, usingPassword)
+}
+
+// checkNativePassword the auth response is SHA1(password) XOR
+// SHA1(salt + SHA1(SHA1(password))), empty for an empty password.
+func checkNativePassword(salt, auth []byte, password string) bool {
+	if password == "" {
+		return len(auth) == 0
+	}
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	h := sha1.New()
+	h.Write(salt)
+	h.Write(stage2[:])
+	expected := h.Sum(nil)
+	for i := range expected {
+		expected[i] ^= stage1[i]
+	}
+	return subtle.ConstantTimeCompare(expected, auth) == 1
+}
+
+// newSalt 20 random bytes, without 0 bytes as the salt is sent nul terminated.
+func newSalt() []byte {
+	salt := make([]byte, 20)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	for i, c := range salt {
+		salt[i] = c%126 + 1
+	}
+	return salt
+}
+
+// useSchema select the schema of given (database) name.
+func (m *conn) useSchema(name string) error {
+	name = expr.IdentityTrim(strings.TrimSpace(name))
+	s, ok := m.srv.registry.Schema(name)
+	if !ok || s == nil {
+		return newError(1049, "42000", "Unknown database '%s'", name)
+	}
+	m.schema = s
+	return nil
+}
+
+// begin a transaction, the statements of this connection run inside it
+// until a COMMIT or ROLLBACK.  As with mysql beginning a transaction
+// commits the open one.
+func (m *conn) begin() error {
+	if m.tx != nil && !m.tx.Done() {
+		if err := m.tx.Commit(); err != nil {
+			return err
+		}
+	}
+	m.tx = schema.NewTransaction()
+	return nil
+}
+
+// isBegin is the query BEGIN [WORK] or START TRANSACTION, which the sql
+// parser does not know.
+func isBegin(query string) bool {
+	words := strings.Fields(strings.ToUpper(strings.TrimRight(query, "; \t\r\n")))
+	switch {
+	case len(words) == 1 && words[0] == "BEGIN":
+		return true
+	case len(words) == 2 && words[0] == "BEGIN" && words[1] == "WORK":
+		return true
+	case len(words) >= 2 && words[0] == "START" && words[1] == "TRANSACTION":
+		return true
+	}
+	return false
+}
+
+// status flags of the connection, autocommit unless in a transaction
+func (m *conn) status() uint16 {
+	if m.tx != nil && !m.tx.Done() {
+		return statusAutocommit | statusInTrans
+	}
+	return statusAutocommit
+}
+
+// handleQuery runs the query of COM_QUERY, a text protocol result set.
+func (m *conn) handleQuery(query string) error {
+	u.Debugf("mysql connection %d query: %s", m.id, query)
+	if isBegin(query) {
+		if err := m.begin(); err != nil {
+			return m.writeError(err)
+		}
+		return m.writeOK(0, 0)
+	}
+	prepared, err := exec.NewPreparedJob(query)
+	if err != nil {
+		return m.writeError(err)
+	}
+	return m.run(prepared, nil, false)
+}
+
+// handlePrepare parses the query of COM_STMT_PREPARE, responding with the
+// id of the statement and its parameters.  The result columns are sent
+// by each execution.
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_stmt_prepare.html
+func (m *conn) handlePrepare(query string) error {
+	st := &stmt{longData: make(map[int][]byte)}
+	if !isBegin(query) {
+		prepared, err := exec.NewPreparedJob(query)
+		if err != nil {
+			return m.writeError(err)
+		}
+		st.prepared = prepared
+		st.params = prepared.NumInput()
+	}
+	m.lastStmt++
+	st.id = m.lastStmt
+	m.stmts[st.id] = st
+
+	b := []byte{iOK}
+	b = binary.LittleEndian.AppendUint32(b, st.id)
+	b = binary.LittleEndian.AppendUint16(b, 0) // columns
+	b = binary.LittleEndian.AppendUint16(b, uint16(st.params))
+	b = append(b, 0, 0, 0) // reserved, warnings
+	if err := m.pkt.writePacket(b); err != nil {
+		return err
+	}
+	if st.params == 0 {
+		return nil
+	}
+	param := &column{name: "?", typ: fieldTypeVarString, charset: charsetUtf8}
+	for i := 0; i < st.params; i++ {
+		if err := m.pkt.writePacket(param.appendDef(nil, "")); err != nil {
+			return err
+		}
+	}
+	return m.writeEOF()
+}
+
+// handleExecute binds the parameters of COM_STMT_EXECUTE to the prepared
+// statement and runs it, a binary protocol result set.
+func (m *conn) handleExecute(data []byte) error {
+	r := &reader{data: data}
+	id := r.uint32()
+	r.uint8()  // cursor flags
+	r.uint32() // iteration count
+	st, ok := m.stmts[id]
+	if !ok {
+		return m.writeError(newError(1243, "HY000", "Unknown prepared statement handler (%d) given to mysqld_stmt_execute", id))
+	}
+	defer st.reset()
+	if st.longErr != nil {
+		return m.writeError(st.longErr)
+	}
+
+	args := make([]value.Value, st.params)
+	if st.params > 0 {
+		nullMap := r.bytes((st.params + 7) / 8)
+		if r.uint8() == 1 {
+			st.types = append([]byte(nil), r.bytes(2*st.params)...)
+		}
+		if r.err != nil || len(st.types) != 2*st.params {
+			return m.writeError(newError(1210, "HY000", "Incorrect arguments to mysqld_stmt_execute"))
+		}
+		for i := range args {
+			var arg driver.Value
+			if long, ok := st.longData[i]; ok {
+				arg = string(long)
+			} else if nullMap[i/8]&(1<<uint(i%8)) == 0 {
+				arg = readParam(r, st.types[2*i], st.types[2*i+1]&0x80 != 0)
+			}
+			args[i] = value.NewValue(arg)
+		}
+		if r.err != nil {
+			return m.writeError(newError(1210, "HY000", "Incorrect arguments to mysqld_stmt_execute"))
+		}
+	}
+
+	if st.prepared == nil {
+		if err := m.begin(); err != nil {
+			return m.writeError(err)
+		}
+		return m.writeOK(0, 0)
+	}
+	return m.run(st.prepared, args, true)
+}
+
+// sendLongData appends @data to the value of parameter @param, which may
+// not be longer than max_allowed_packet.  As mysql does, an error fails
+// the next execute.
+func (m *stmt) sendLongData(param int, data []byte) {
+	switch {
+	case m.longErr != nil:
+	case param >= m.params:
+		m.longErr = newError(1210, "HY000", "Incorrect arguments to mysqld_stmt_send_long_data")
+	case len(m.longData[param])+len(data) > datasource.MaxAllowedPacket:
+		m.longErr = newError(1105, "HY000", "Parameter of prepared statement which is set through mysql_send_long_data() is longer than 'max_allowed_packet' bytes")
+		delete(m.longData, param)
+	default:
+		m.longData[param] = append(m.longData[param], data...)
+	}
+}
+
+// reset the parameter values sent by COM_STMT_SEND_LONG_DATA
+func (m *stmt) reset() {
+	m.longData = make(map[int][]byte)
+	m.longErr = nil
+}
+
+// run the statement with @args bound to its placeholders, writing its
+// result set if it returns rows, else an OK packet with the rows it
+// affected.  The plan of a prepared statement is run again by each
+// execution.
+func (m *conn) run(prepared *exec.PreparedJob, args []value.Value, binaryRows bool) error {
+	if cmd, ok := prepared.Stmt.(*rel.SqlCommand); ok && cmd.Keyword() == lex.TokenUse {
+		if err := m.useSchema(cmd.Identity); err != nil {
+			return m.writeError(err)
+		}
+		return m.writeOK(0, 0)
+	}
+	if m.schema == nil {
+		return m.writeError(errNoDatabase)
+	}
+
+	// the statement runs in a context of its own, canceled once it is
+	// answered, which stops a job whose rows are no longer read
+	goCtx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+	ctx := m.newContext(goCtx, prepared.Raw)
+	job, err := prepared.BuildSqlJob(ctx, args)
+	if err != nil {
+		return m.writeError(err)
+	}
+	// the planner rewrites SHOW, DESCRIBE statements as selects
+	if cols, ok := resultColumns(ctx.Stmt); ok {
+		return m.query(ctx, job, cols, binaryRows)
+	}
+	return m.exec(ctx, job)
+}
+
+// newContext the plan context of a statement run in go context @goCtx,
+// with the session of this connection and its transaction.
+func (m *conn) newContext(goCtx context.Context, query string) *plan.Context {
+	ctx := plan.NewContext(query)
+	ctx.Context = goCtx
+	ctx.Schema = m.schema
+	ctx.Session = m.session
+	if m.tx != nil && !m.tx.Done() {
+		ctx.Tx = m.tx
+	}
+	return ctx
+}
+
+// exec runs a job which does not return rows, such as an insert or SET.
+func (m *conn) exec(ctx *plan.Context, job *exec.JobExecutor) error {
+	resultWriter := exec.NewResultExecWriter(ctx)
+	job.RootTask.Add(resultWriter)
+	err := job.Setup()
+	if err == nil {
+		err = job.Run()
+	}
+	// the job has run, closing it closes the connections to its sources
+	job.Close()
+	if err != nil {
+		return m.writeError(err)
+	}
+	result := resultWriter.Result()
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return m.writeError(err)
+	}
+	lastID, _ := result.LastInsertId()
+	return m.writeOK(uint64(affected), uint64(lastID))
+}
+
+// query runs a job which returns rows, streaming them as a result set.
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_query_response_text_resultset.html
+func (m *conn) query(ctx *plan.Context, job *exec.JobExecutor, names []string, binaryRows bool) error {
+	resultWriter := exec.NewResultRows(ctx, names)
+	job.RootTask.Add(resultWriter)
+	if err := job.Setup(); err != nil {
+		job.Close()
+		return m.writeError(err)
+	}
+	// once the statement is answered, or the connection closed, the
+	// canceled context of the job stops it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := job.Run(); err != nil {
+			u.Warnf("error on mysql connection %d query: %v", m.id, err)
+		}
+		job.Close()
+	}()
+
+	cols := newColumns(resultWriter)
+	if err := m.pkt.writePacket(appendLengthEncodedInt(nil, uint64(len(cols)))); err != nil {
+		return err
+	}
+	for _, c := range cols {
+		if err := m.pkt.writePacket(c.appendDef(nil, m.schema.Name)); err != nil {
+			return err
+		}
+	}
+	if err := m.writeEOF(); err != nil {
+		return err
+	}
+
+	dest := make([]driver.Value, len(cols))
+	var row []byte
+	for {
+		for i := range dest {
+			dest[i] = nil
+		}
+		err := resultWriter.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// an error instead of the next row ends the result set
+			return m.writeError(err)
+		}
+		if binaryRows {
+			row = appendBinaryRow(row[:0], cols, dest)
+		} else {
+			row = appendTextRow(row[:0], cols, dest)
+		}
+		if err := m.pkt.writePacket(row); err != nil {
+			return err
+		}
+	}
+	// all rows are read, the job closes its source connections before
+	// the next statement of the connection
+	job.Close()
+	<-done
+	return m.writeEOF()
+}
+
+// writeOK writes an OK packet
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_ok_packet.html
+func (m *conn) writeOK(affected, lastID uint64) error {
+	b := []byte{iOK}
+	b = appendLengthEncodedInt(b, affected)
+	b = appendLengthEncodedInt(b, lastID)
+	b = binary.LittleEndian.AppendUint16(b, m.status())
+	b = binary.LittleEndian.AppendUint16(b, 0) // warnings
+	return m.pkt.writePacket(b)
+}
+
+// writeEOF writes an EOF packet, ending column definitions and rows.
+func (m *conn) writeEOF() error {
+	b := []byte{iEOF, 0, 0} // warnings
+	b = binary.LittleEndian.AppendUint16(b, m.status())
+	return m.pkt.writePacket(b)
+}
+
+// writeError writes the error as an ERR packet.
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_err_packet.html
+func (m *conn) writeError(err error) error {
+	var me *mysqlError
+	var pe *rel.ParseError
+	switch {
+	case errors.As(err, &me):
+	case errors.As(err, &pe):
+		me = newError(1064, "42000", "%v", err)
+	default:
+		me = newError(1105, "HY000", "%v", err)
+	}
+	b := []byte{iERR}
+	b = binary.LittleEndian.AppendUint16(b, me.code)
+	b = append(append(b, '#'), me.state...)
+	b = append(b, me.msg...)
+	return m.pkt.writePacket(b)
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// maxPayload is the largest payload of a single packet, longer
+	// payloads are split into several packets.
+	maxPayload = 1<<24 - 1
+
+	// packet headers
+	iOK  byte = 0x00
+	iEOF byte = 0xfe
+	iERR byte = 0xff
+	// null column value of text result set rows
+	iNULL byte = 0xfb
+)
+
+// packetIO reads and writes the packets of a connection, a 3 byte length
+// and a sequence id header followed by the payload.
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_packets.html
+type packetIO struct {
+	rd    *bufio.Reader
+	wr    *bufio.Writer
+	seq   uint8
+	limit int // largest payload read
+}
+
+func newPacketIO(rw io.ReadWriter, limit int) *packetIO {
+	return &packetIO{rd: bufio.NewReader(rw), wr: bufio.NewWriter(rw), limit: limit}
+}
+
+// readPacket the payload of the next packet, joining those split
+// across several packets.  A payload longer than the limit is an
+// errPacketTooLarge, it is not read.
+func (m *packetIO) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(m.rd, header[:]); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		if header[3] != m.seq {
+			return nil, fmt.Errorf("packet out of order, expected sequence %d but got %d", m.seq, header[3])
+		}
+		m.seq++
+		if len(payload)+length > m.limit {
+			return nil, errPacketTooLarge
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(m.rd, data); err != nil {
+			return nil, err
+		}
+		payload = append(payload, data...)
+		if length < maxPayload {
+			return payload, nil
+		}
+	}
+}
+
+// writePacket write the payload, split into packets of at most maxPayload.
+// The packets are buffered until flush.
+func (m *packetIO) writePacket(payload []byte) error {
+	for {
+		length := len(payload)
+		if length > maxPayload {
+			length = maxPayload
+		}
+		header := [4]byte{byte(length), byte(length >> 8), byte(length >> 16), m.seq}
+		if _, err := m.wr.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := m.wr.Write(payload[:length]); err != nil {
+			return err
+		}
+		m.seq++
+		payload = payload[length:]
+		// a payload of exactly maxPayload ends with an empty packet
+		if length < maxPayload {
+			return nil
+		}
+	}
+}
+
+func (m *packetIO) flush() error { return m.wr.Flush() }
+
+// appendLengthEncodedInt appends n as a length encoded integer
+func appendLengthEncodedInt(b []byte, n uint64) []byte {
+	switch {
+	case n < 251:
+		return append(b, byte(n))
+	case n < 1<<16:
+		return append(b, 0xfc, byte(n), byte(n>>8))
+	case n < 1<<24:
+		return append(b, 0xfd, byte(n), byte(n>>8), byte(n>>16))
+	}
+	return binary.LittleEndian.AppendUint64(append(b, 0xfe), n)
+}
+
+// appendLengthEncodedString appends s prefixed by its length encoded length
+func appendLengthEncodedString(b []byte, s string) []byte {
+	return append(appendLengthEncodedInt(b, uint64(len(s))), s...)
+}
+
+// reader is a cursor over the payload of a received packet, reading past
+// its end sets err.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (m *reader) bytes(n int) []byte {
+	if m.err != nil || n < 0 || m.pos+n > len(m.data) {
+		m.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := m.data[m.pos : m.pos+n]
+	m.pos += n
+	return b
+}
+
+func (m *reader) uint8() uint8 {
+	if b := m.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (m *reader) uint16() uint16 {
+	if b := m.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (m *reader) uint32() uint32 {
+	if b := m.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (m *reader) uint64() uint64 {
+	if b := m.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// lengthEncodedInt reads a length encoded integer, null is true for the
+// 0xfb null marker.
+func (m *reader) lengthEncodedInt() (n uint64, null bool) {
+	switch first := m.uint8(); first {
+	case iNULL:
+		return 0, true
+	case 0xfc:
+		return uint64(m.uint16()), false
+	case 0xfd:
+		b := m.bytes(3)
+		if b == nil {
+			return 0, false
+		}
+		return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16, false
+	case 0xfe:
+		return m.uint64(), false
+	default:
+		return uint64(first), false
+	}
+}
+
+func (m *reader) lengthEncodedString() string {
+	n, null := m.lengthEncodedInt()
+	if null {
+		return ""
+	}
+	return string(m.bytes(int(n)))
+}
+
+// nulString reads a string terminated by a 0 byte, or the end of packet.
+func (m *reader) nulString() string {
+	if m.err != nil {
+		return ""
+	}
+	rest := m.data[m.pos:]
+	for i, c := range rest {
+		if c == 0 {
+			m.pos += i + 1
+			return string(rest[:i])
+		}
+	}
+	m.pos = len(m.data)
+	return string(rest)
+}
+
+// rest the unread remainder of the payload
+func (m *reader) rest() []byte {
+	if m.err != nil {
+		return nil
+	}
+	b := m.data[m.pos:]
+	m.pos = len(m.data)
+	return b
+}
+
+func (m *reader) eof() bool { return m.err != nil || m.pos >= len(m.data) }
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/lytics/qlbridge/exec"
+	"github.com/lytics/qlbridge/plan"
+	"github.com/lytics/qlbridge/rel"
+	"github.com/lytics/qlbridge/value"
+)
+
+// mysql column types
+// https://dev.mysql.com/doc/dev/mysql-server/latest/field__types_8h.html
+const (
+	fieldTypeTiny         byte = 0x01
+	fieldTypeShort        byte = 0x02
+	fieldTypeLong         byte = 0x03
+	fieldTypeFloat        byte = 0x04
+	fieldTypeDouble       byte = 0x05
+	fieldTypeNULL         byte = 0x06
+	fieldTypeTimestamp    byte = 0x07
+	fieldTypeLongLong     byte = 0x08
+	fieldTypeInt24        byte = 0x09
+	fieldTypeDate         byte = 0x0a
+	fieldTypeTime         byte = 0x0b
+	fieldTypeDateTime     byte = 0x0c
+	fieldTypeYear         byte = 0x0d
+	fieldTypeJSON         byte = 0xf5
+	fieldTypeBLOB         byte = 0xfc
+	fieldTypeVarString    byte = 0xfd
+	fieldFlagBinary            = 0x0080
+	fieldFlagBlob              = 0x0010
+	charsetUtf8                = 33 // utf8_general_ci
+	charsetBinary              = 63
+	mysqlDateTimeFormat        = "2006-01-02 15:04:05.999999"
+	fieldDecimalsNotFixed      = 0x1f
+)
+
+// column of a result set, its name and the mysql type the values of
+// its value type are sent as.
+type column struct {
+	name     string
+	vt       value.ValueType
+	typ      byte
+	charset  uint16
+	length   uint32
+	flags    uint16
+	decimals byte
+}
+
+// resultColumns the names of the columns of the rows the planned statement
+// returns, false for statements that don't return rows.
+func resultColumns(stmt rel.SqlStatement) ([]string, bool) {
+	switch st := stmt.(type) {
+	case *rel.SqlSelect:
+		return st.Columns.AliasedFieldNames(), true
+	case *rel.SqlSetOp:
+		// result columns are named by the first select
+		return st.First().Columns.AliasedFieldNames(), true
+	case *rel.SqlWith:
+		return st.First().Columns.AliasedFieldNames(), true
+	case *rel.SqlDescribe:
+		return plan.ExplainResultColumns(st), true
+	}
+	return nil, false
+}
+
+// newColumns the columns of the result writer, those whose type is not
+// known are sent as strings.
+func newColumns(rw *exec.ResultWriter) []*column {
+	names := rw.Columns()
+	cols := make([]*column, len(names))
+	for i, name := range names {
+		c := &column{name: name, vt: rw.ColumnType(i), charset: charsetBinary, flags: fieldFlagBinary}
+		switch c.vt {
+		case value.IntType:
+			c.typ, c.length = fieldTypeLongLong, 20
+		case value.NumberType:
+			c.typ, c.length, c.decimals = fieldTypeDouble, 22, fieldDecimalsNotFixed
+		case value.BoolType:
+			c.typ, c.length = fieldTypeTiny, 1
+		case value.TimeType:
+			c.typ, c.length, c.decimals = fieldTypeDateTime, 26, 6
+		case value.ByteSliceType:
+			c.typ, c.length, c.flags = fieldTypeBLOB, math.MaxUint32, fieldFlagBinary|fieldFlagBlob
+		case value.JsonType:
+			c.typ, c.length, c.flags = fieldTypeJSON, math.MaxUint32, fieldFlagBinary|fieldFlagBlob
+		default:
+			c.vt = value.StringType
+			c.typ, c.charset, c.length, c.flags = fieldTypeVarString, charsetUtf8, 255*3, 0
+		}
+		cols[i] = c
+	}
+	return cols
+}
+
+// appendDef appends the ColumnDefinition41 packet payload of the column
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_query_response_text_resultset_column_definition.html
+func (c *column) appendDef(b []byte, schemaName string) []byte {
+	b = appendLengthEncodedString(b, "def")
+	b = appendLengthEncodedString(b, schemaName)
+	b = appendLengthEncodedString(b, "") // table
+	b = appendLengthEncodedString(b, "") // org_table
+	b = appendLengthEncodedString(b, c.name)
+	b = appendLengthEncodedString(b, c.name)
+	b = append(b, 0x0c) // length of the fixed length fields
+	b = binary.LittleEndian.AppendUint16(b, c.charset)
+	b = binary.LittleEndian.AppendUint32(b, c.length)
+	b = append(b, c.typ)
+	b = binary.LittleEndian.AppendUint16(b, c.flags)
+	return append(b, c.decimals, 0, 0)
+}
+
+// convert the value of a row to the go type of the column, int64, float64,
+// bool, time.Time, []byte or string.  Values which can't be converted are
+// sent as NULL.
+func (c *column) convert(v driver.Value) driver.Value {
+	if v == nil {
+		return nil
+	}
+	switch c.vt {
+	case value.IntType:
+		if n, ok := v.(int64); ok {
+			return n
+		}
+		if n, ok := value.ValueToInt64(value.NewValue(v)); ok {
+			return n
+		}
+		return nil
+	case value.NumberType:
+		if f, ok := v.(float64); ok {
+			return f
+		}
+		if f, ok := value.ValueToFloat64(value.NewValue(v)); ok && !math.IsNaN(f) {
+			return f
+		}
+		return nil
+	case value.BoolType:
+		if b, ok := v.(bool); ok {
+			return b
+		}
+		if b, ok := value.ValueToBool(value.NewValue(v)); ok {
+			return b
+		}
+		return nil
+	case value.TimeType:
+		if t, ok := v.(time.Time); ok {
+			return t
+		}
+		if t, ok := value.ValueToTime(value.NewValue(v)); ok {
+			return t
+		}
+		return nil
+	case value.ByteSliceType, value.JsonType:
+		if b, ok := v.([]byte); ok {
+			return b
+		}
+		return []byte(textValue(v))
+	}
+	return textValue(v)
+}
+
+// textValue the text protocol representation of a value
+func textValue(v driver.Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(mysqlDateTimeFormat)
+	case value.Value:
+		return v.ToString()
+	}
+	// slices, maps of json columns
+	if by, err := json.Marshal(v); err == nil {
+		return string(by)
+	}
+	return fmt.Sprint(v)
+}
+
+// appendTextRow appends a row of a text protocol result set, each value as a
+// length encoded string.
+func appendTextRow(b []byte, cols []*column, dest []driver.Value) []byte {
+	for i, c := range cols {
+		v := c.convert(dest[i])
+		if v == nil {
+			b = append(b, iNULL)
+			continue
+		}
+		b = appendLengthEncodedString(b, textValue(v))
+	}
+	return b
+}
+
+// appendBinaryRow appends a row of a binary protocol (prepared statement)
+// result set, a null bitmap followed by the values encoded by column type.
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_binary_resultset.html
+func appendBinaryRow(b []byte, cols []*column, dest []driver.Value) []byte {
+	b = append(b, iOK)
+	nullMap := len(b)
+	b = append(b, make([]byte, (len(cols)+7+2)/8)...)
+	for i, c := range cols {
+		switch v := c.convert(dest[i]).(type) {
+		case nil:
+			// the first 2 bits of the bitmap are reserved
+			b[nullMap+(i+2)/8] |= 1 << uint((i+2)%8)
+		case int64:
+			b = binary.LittleEndian.AppendUint64(b, uint64(v))
+		case float64:
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+		case bool:
+			if v {
+				b = append(b, 1)
+			} else {
+				b = append(b, 0)
+			}
+		case time.Time:
+			b = appendBinaryDateTime(b, v)
+		case []byte:
+			b = appendLengthEncodedInt(b, uint64(len(v)))
+			b = append(b, v...)
+		case string:
+			b = appendLengthEncodedString(b, v)
+		}
+	}
+	return b
+}
+
+// appendBinaryDateTime appends a DATETIME of the binary protocol, its length
+// followed by only the non-zero parts.
+func appendBinaryDateTime(b []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return append(b, 0)
+	}
+	usec := t.Nanosecond() / 1000
+	length := byte(4)
+	switch {
+	case usec > 0:
+		length = 11
+	case t.Hour() > 0 || t.Minute() > 0 || t.Second() > 0:
+		length = 7
+	}
+	b = append(b, length)
+	b = binary.LittleEndian.AppendUint16(b, uint16(t.Year()))
+	b = append(b, byte(t.Month()), byte(t.Day()))
+	if length == 4 {
+		return b
+	}
+	b = append(b, byte(t.Hour()), byte(t.Minute()), byte(t.Second()))
+	if length == 7 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint32(b, uint32(usec))
+}
+
+// readParam reads the value of a prepared statement parameter of the binary
+// protocol of given type.
+//
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_stmt_execute.html
+func readParam(r *reader, typ byte, unsigned bool) driver.Value {
+	switch typ {
+	case fieldTypeNULL:
+		return nil
+	case fieldTypeTiny:
+		if n := r.uint8(); unsigned {
+			return int64(n)
+		} else {
+			return int64(int8(n))
+		}
+	case fieldTypeShort, fieldTypeYear:
+		if n := r.uint16(); unsigned {
+			return int64(n)
+		} else {
+			return int64(int16(n))
+		}
+	case fieldTypeLong, fieldTypeInt24:
+		if n := r.uint32(); unsigned {
+			return int64(n)
+		} else {
+			return int64(int32(n))
+		}
+	case fieldTypeLongLong:
+		n := r.uint64()
+		if unsigned && n > math.MaxInt64 {
+			return strconv.FormatUint(n, 10)
+		}
+		return int64(n)
+	case fieldTypeFloat:
+		return float64(math.Float32frombits(r.uint32()))
+	case fieldTypeDouble:
+		return math.Float64frombits(r.uint64())
+	case fieldTypeDate, fieldTypeDateTime, fieldTypeTimestamp:
+		return readBinaryDateTime(r)
+	case fieldTypeTime:
+		return readBinaryTime(r)
+	}
+	// strings, blobs, decimals, json
+	return r.lengthEncodedString()
+}
+
+func readBinaryDateTime(r *reader) driver.Value {
+	b := r.bytes(int(r.uint8()))
+	if len(b) < 4 {
+		return time.Time{}
+	}
+	var hour, min, sec, usec int
+	if len(b) >= 7 {
+		hour, min, sec = int(b[4]), int(b[5]), int(b[6])
+	}
+	if len(b) >= 11 {
+		usec = int(binary.LittleEndian.Uint32(b[7:11]))
+	}
+	return time.Date(int(binary.LittleEndian.Uint16(b[0:2])), time.Month(b[2]), int(b[3]),
+		hour, min, sec, usec*1000, time.UTC)
+}
+
+// readBinaryTime reads a TIME, which is a duration of up to 838 hours, as
+// its string [-]HH:MM:SS[.ffffff]
+func readBinaryTime(r *reader) driver.Value {
+	b := r.bytes(int(r.uint8()))
+	if len(b) < 8 {
+		return "00:00:00"
+	}
+	sign := ""
+	if b[0] == 1 {
+		sign = "-"
+	}
+	hours := int(binary.LittleEndian.Uint32(b[1:5]))*24 + int(b[5])
+	s := fmt.Sprintf("%s%02d:%02d:%02d", sign, hours, b[6], b[7])
+	if len(b) >= 12 {
+		s += fmt.Sprintf(".%06d", binary.LittleEndian.Uint32(b[8:12]))
+	}
+	return s
+}
@@ -0,0 +1,206 @@
+// Package server is a front end speaking the MySQL client/server protocol
+// to the schemas of a qlbridge registry, so the mysql cli, go-sql-driver and
+// BI tools can connect and run queries, which are planned and executed by
+// exec, prepared statements are planned once.
+//
+//	srv := server.New(&server.Config{Schema: "mockcsv", User: "qlb", Password: "secret"})
+//	log.Fatal(srv.ListenAndServe())
+//
+// The server listens on the loopback interface unless an Addr is
+// configured, and without a User only accepts connections if
+// AllowAnonymous.  Packets are limited to max_allowed_packet, and clients
+// are disconnected once the HandshakeTimeout or IdleTimeout passes.
+//
+// The databases of the server are the schemas of the registry.  Supported
+// are the text protocol (COM_QUERY) and prepared statements
+// (COM_STMT_PREPARE, COM_STMT_EXECUTE) with mysql_native_password auth,
+// not TLS or compression.
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	u "github.com/araddon/gou"
+
+	"github.com/lytics/qlbridge/schema"
+)
+
+const (
+	// ServerVersion is announced to clients in the handshake
+	ServerVersion = "5.7.0-qlbridge"
+	// DefaultAddr is the address of ListenAndServe if none is configured,
+	// only local clients connect
+	DefaultAddr = "127.0.0.1:3306"
+	// DefaultHandshakeTimeout is how long a client may take to authenticate
+	DefaultHandshakeTimeout = 10 * time.Second
+	// DefaultIdleTimeout is how long a connection waits for its next
+	// command before it is closed, the wait_timeout of mysql
+	DefaultIdleTimeout = 8 * time.Hour
+)
+
+var (
+	// ErrServerClosed is returned by Serve once the server is closed.
+	ErrServerClosed = errors.New("server closed")
+
+	_ = u.EMPTY
+)
+
+// Config of a Server
+type Config struct {
+	// Addr tcp address to listen on, defaults to DefaultAddr "127.0.0.1:3306"
+	Addr string
+	// Schema the default schema of connections which do not name a database
+	Schema string
+	// User if set is the only user allowed to connect, authenticated by Password
+	// (mysql_native_password).
+	User     string
+	Password string
+	// AllowAnonymous without a User any user connects without a password,
+	// else connections are refused.
+	AllowAnonymous bool
+	// HandshakeTimeout how long a client may take to authenticate, defaults
+	// to DefaultHandshakeTimeout
+	HandshakeTimeout time.Duration
+	// IdleTimeout how long a connection may wait between commands, defaults
+	// to DefaultIdleTimeout
+	IdleTimeout time.Duration
+	// Registry of the schemas served, defaults to schema.DefaultRegistry()
+	Registry *schema.Registry
+}
+
+// Server accepts connections of mysql clients, each served by its own
+// go-routine with its own session and transaction.
+type Server struct {
+	conf     Config
+	registry *schema.Registry
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*conn]struct{}
+	lastID   uint32
+	closed   bool
+}
+
+// New create a server of given config, which is not listening until
+// ListenAndServe or Serve.
+func New(conf *Config) *Server {
+	m := &Server{conns: make(map[*conn]struct{})}
+	if conf != nil {
+		m.conf = *conf
+	}
+	m.registry = m.conf.Registry
+	if m.registry == nil {
+		m.registry = schema.DefaultRegistry()
+	}
+	if m.conf.HandshakeTimeout <= 0 {
+		m.conf.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+	if m.conf.IdleTimeout <= 0 {
+		m.conf.IdleTimeout = DefaultIdleTimeout
+	}
+	return m
+}
+
+// ListenAndServe listens on the tcp address of the config and serves
+// connections until Close.
+func (m *Server) ListenAndServe() error {
+	addr := m.conf.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return m.Serve(l)
+}
+
+// Serve accepts connections on the listener until Close, it always
+// returns an error, ErrServerClosed once closed.
+func (m *Server) Serve(l net.Listener) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	m.listener = l
+	m.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			m.mu.Lock()
+			closed := m.closed
+			m.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				u.Warnf("mysql server accept error: %v", err)
+				continue
+			}
+			return err
+		}
+		c := m.newConn(nc)
+		if c == nil {
+			nc.Close()
+			return ErrServerClosed
+		}
+		go c.serve()
+	}
+}
+
+// Addr the address the server is listening on, nil if not yet serving.
+func (m *Server) Addr() net.Addr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.listener == nil {
+		return nil
+	}
+	return m.listener.Addr()
+}
+
+// Close stops listening and closes all connections, rolling back their
+// open transactions.
+func (m *Server) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	l := m.listener
+	conns := make([]*conn, 0, len(m.conns))
+	for c := range m.conns {
+		conns = append(conns, c)
+	}
+	m.mu.Unlock()
+
+	var err error
+	if l != nil {
+		err = l.Close()
+	}
+	for _, c := range conns {
+		c.close()
+	}
+	return err
+}
+
+func (m *Server) newConn(nc net.Conn) *conn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.lastID++
+	c := newConn(m, nc, m.lastID)
+	m.conns[c] = struct{}{}
+	return c
+}
+
+func (m *Server) removeConn(c *conn) {
+	m.mu.Lock()
+	delete(m.conns, c)
+	m.mu.Unlock()
+}
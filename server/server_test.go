@@ -0,0 +1,338 @@
+package server_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lytics/qlbridge/datasource"
+	"github.com/lytics/qlbridge/datasource/memdb"
+	"github.com/lytics/qlbridge/datasource/mockcsv"
+	td "github.com/lytics/qlbridge/datasource/mockcsvtestdata"
+	"github.com/lytics/qlbridge/exec"
+	"github.com/lytics/qlbridge/schema"
+	"github.com/lytics/qlbridge/server"
+	"github.com/lytics/qlbridge/testutil"
+)
+
+func TestMain(m *testing.M) {
+	exec.DisableRecover()
+	testutil.Setup()
+	td.LoadTestDataOnce()
+	os.Exit(m.Run())
+}
+
+// startServer a server listening on a free local port, closed at the end
+// of the test, returns its address.
+func startServer(t *testing.T, conf *server.Config) string {
+	conf.Addr = "127.0.0.1:0"
+	srv := server.New(conf)
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	for srv.Addr() == nil {
+		select {
+		case err := <-errs:
+			t.Fatalf("could not start server: %v", err)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	t.Cleanup(func() {
+		assert.Equal(t, nil, srv.Close())
+		assert.Equal(t, server.ErrServerClosed, <-errs)
+	})
+	return srv.Addr().String()
+}
+
+func openDB(t *testing.T, dsn string) *sql.DB {
+	db, err := sql.Open("mysql", dsn)
+	assert.Equal(t, nil, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestServerQuery(t *testing.T) {
+	addr := startServer(t, &server.Config{AllowAnonymous: true})
+	db := openDB(t, fmt.Sprintf("root@tcp(%s)/%s", addr, mockcsv.SchemaName))
+	assert.Equal(t, nil, db.Ping())
+
+	// text protocol
+	rows, err := db.Query("SELECT user_id, email, referral_count FROM users WHERE referral_count > 20")
+	assert.Equal(t, nil, err)
+	cols, err := rows.Columns()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"user_id", "email", "referral_count"}, cols)
+	types, err := rows.ColumnTypes()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "BIGINT", types[2].DatabaseTypeName())
+	var userID, email string
+	var ct int64
+	assert.True(t, rows.Next())
+	assert.Equal(t, nil, rows.Scan(&userID, &email, &ct))
+	assert.Equal(t, "9Ip1aKbeZe2njCDM", userID)
+	assert.Equal(t, "aaron@email.com", email)
+	assert.Equal(t, int64(82), ct)
+	assert.False(t, rows.Next())
+	assert.Equal(t, nil, rows.Err())
+
+	// prepared statement, binary protocol with null values
+	stmt, err := db.Prepare("SELECT user_id, interests, reg_date FROM users WHERE user_id = ?")
+	assert.Equal(t, nil, err)
+	defer stmt.Close()
+	for _, id := range []string{"hT2impsabc345c", "hT2impsOPUREcVPc"} {
+		var interests sql.NullString
+		var regDate []byte
+		err = stmt.QueryRow(id).Scan(&userID, &interests, &regDate)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, id, userID)
+		assert.Equal(t, id == "hT2impsOPUREcVPc", interests.Valid)
+		assert.Equal(t, "2009-12-11 19:53:31.547000", string(regDate))
+	}
+	err = db.QueryRow("SELECT count(*) AS ct FROM users WHERE referral_count = ?", 12).Scan(&ct)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(2), ct)
+
+	// session variables, schema queries of the mysql cli
+	var comment string
+	err = db.QueryRow("select @@version_comment limit 1").Scan(&comment)
+	assert.Equal(t, nil, err)
+	var tables []string
+	rows, err = db.Query("SHOW TABLES")
+	assert.Equal(t, nil, err)
+	for rows.Next() {
+		var name string
+		assert.Equal(t, nil, rows.Scan(&name))
+		tables = append(tables, name)
+	}
+	assert.Contains(t, tables, "users")
+
+	_, err = db.Query("SELEKT user_id FROM users")
+	me, ok := err.(*mysql.MySQLError)
+	assert.True(t, ok, "expected mysql error but got %T %v", err, err)
+	if ok {
+		assert.Equal(t, uint16(1064), me.Number)
+	}
+}
+
+func TestServerLongData(t *testing.T) {
+	addr := startServer(t, &server.Config{AllowAnonymous: true})
+	// the client sends arguments longer than a packet of this size as
+	// COM_STMT_SEND_LONG_DATA
+	db := openDB(t, fmt.Sprintf("root@tcp(%s)/%s?maxAllowedPacket=1024", addr, mockcsv.SchemaName))
+
+	stmt, err := db.Prepare("SELECT user_id FROM users WHERE email != ?")
+	assert.Equal(t, nil, err)
+	defer stmt.Close()
+	count := func(arg string) (int, error) {
+		rows, err := stmt.Query(arg)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		ct := 0
+		for rows.Next() {
+			ct++
+		}
+		return ct, rows.Err()
+	}
+	ct, err := count(strings.Repeat("a", 2000))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, ct)
+
+	// values are at most max_allowed_packet long
+	_, err = count(strings.Repeat("a", datasource.MaxAllowedPacket+1))
+	me, ok := err.(*mysql.MySQLError)
+	assert.True(t, ok, "expected mysql error but got %T %v", err, err)
+	if ok {
+		assert.Equal(t, uint16(1105), me.Number)
+	}
+	ct, err = count("a")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, ct)
+}
+
+func TestServerUseDatabase(t *testing.T) {
+	addr := startServer(t, &server.Config{AllowAnonymous: true})
+
+	// a database that is not a schema
+	db := openDB(t, fmt.Sprintf("root@tcp(%s)/notadb", addr))
+	err := db.Ping()
+	me, ok := err.(*mysql.MySQLError)
+	assert.True(t, ok, "expected mysql error but got %T %v", err, err)
+	if ok {
+		assert.Equal(t, uint16(1049), me.Number)
+	}
+
+	// without a database queries fail until one is selected
+	db = openDB(t, fmt.Sprintf("root@tcp(%s)/", addr))
+	db.SetMaxOpenConns(1)
+	_, err = db.Query("SELECT user_id FROM users")
+	assert.NotEqual(t, nil, err)
+	_, err = db.Exec("USE notadb")
+	assert.NotEqual(t, nil, err)
+	_, err = db.Exec("USE " + mockcsv.SchemaName)
+	assert.Equal(t, nil, err)
+	var ct int64
+	err = db.QueryRow("SELECT count(*) AS ct FROM users").Scan(&ct)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(3), ct)
+}
+
+func TestServerAuth(t *testing.T) {
+	addr := startServer(t, &server.Config{Schema: mockcsv.SchemaName, User: "qlb", Password: "secret"})
+
+	db := openDB(t, fmt.Sprintf("qlb:secret@tcp(%s)/", addr))
+	assert.Equal(t, nil, db.Ping())
+
+	// without a user anonymous access must be allowed
+	anon := startServer(t, &server.Config{Schema: mockcsv.SchemaName})
+
+	for _, dsn := range []string{"qlb:wrong@tcp(%s)/", "qlb@tcp(%s)/", "root:secret@tcp(%s)/"} {
+		for _, addr := range []string{addr, anon} {
+			db := openDB(t, fmt.Sprintf(dsn, addr))
+			err := db.Ping()
+			me, ok := err.(*mysql.MySQLError)
+			assert.True(t, ok, "expected mysql error but got %T %v", err, err)
+			if ok {
+				assert.Equal(t, uint16(1045), me.Number)
+			}
+		}
+	}
+	db = openDB(t, fmt.Sprintf("root@tcp(%s)/", anon))
+	assert.NotEqual(t, nil, db.Ping())
+}
+
+func TestServerPacketLimits(t *testing.T) {
+	addr := startServer(t, &server.Config{Schema: mockcsv.SchemaName, AllowAnonymous: true,
+		HandshakeTimeout: 200 * time.Millisecond, IdleTimeout: 200 * time.Millisecond})
+
+	readPacket := func(nc net.Conn) ([]byte, error) {
+		var header [4]byte
+		if _, err := io.ReadFull(nc, header[:]); err != nil {
+			return nil, err
+		}
+		data := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+		_, err := io.ReadFull(nc, data)
+		return data, err
+	}
+	dial := func() net.Conn {
+		nc, err := net.Dial("tcp", addr)
+		assert.Equal(t, nil, err)
+		t.Cleanup(func() { nc.Close() })
+		nc.SetDeadline(time.Now().Add(5 * time.Second))
+		_, err = readPacket(nc) // the initial handshake
+		assert.Equal(t, nil, err)
+		return nc
+	}
+
+	// the first of the packets of a split payload, larger than
+	// max_allowed_packet, is refused before the client authenticated
+	nc := dial()
+	go func() {
+		nc.Write([]byte{0xff, 0xff, 0xff, 1})
+		nc.Write(make([]byte, datasource.MaxAllowedPacket+1))
+	}()
+	data, err := readPacket(nc)
+	assert.Equal(t, nil, err)
+	assert.True(t, len(data) > 3 && data[0] == 0xff, "expected error packet %v", data)
+	if len(data) > 3 {
+		assert.Equal(t, uint16(1153), uint16(data[1])|uint16(data[2])<<8)
+	}
+	_, err = readPacket(nc)
+	assert.NotEqual(t, nil, err, "connection is closed")
+
+	// a client which does not answer the handshake is disconnected
+	nc = dial()
+	start := time.Now()
+	_, err = readPacket(nc)
+	assert.NotEqual(t, nil, err)
+	assert.True(t, time.Since(start) < 4*time.Second, "closed by the handshake timeout")
+
+	// as is one idle between commands
+	db := openDB(t, fmt.Sprintf("root@tcp(%s)/", addr))
+	conn, err := db.Conn(context.Background())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	assert.Equal(t, nil, conn.PingContext(context.Background()))
+	time.Sleep(500 * time.Millisecond)
+	assert.NotEqual(t, nil, conn.PingContext(context.Background()))
+}
+
+func TestServerExecTransaction(t *testing.T) {
+	src, err := memdb.NewMemDbData("accounts", [][]driver.Value{{int64(1), "bob"}}, []string{"id", "name"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, schema.RegisterSourceAsSchema("srvtxdb", src))
+
+	addr := startServer(t, &server.Config{AllowAnonymous: true})
+	db := openDB(t, fmt.Sprintf("root@tcp(%s)/srvtxdb", addr))
+
+	type queryer interface {
+		Query(query string, args ...any) (*sql.Rows, error)
+	}
+	names := func(q queryer) []string {
+		rows, err := q.Query("SELECT name FROM accounts")
+		assert.Equal(t, nil, err)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		var vals []string
+		for rows.Next() {
+			var v string
+			assert.Equal(t, nil, rows.Scan(&v))
+			vals = append(vals, v)
+		}
+		sort.Strings(vals)
+		return vals
+	}
+
+	res, err := db.Exec("INSERT INTO accounts (id, name) VALUES (2, 'ana')")
+	assert.Equal(t, nil, err)
+	affected, err := res.RowsAffected()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), affected)
+	res, err = db.Exec("INSERT INTO accounts (id, name) VALUES (?, ?)", 3, "ann")
+	assert.Equal(t, nil, err)
+	affected, err = res.RowsAffected()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), affected)
+	assert.Equal(t, []string{"ana", "ann", "bob"}, names(db))
+
+	// rolled back writes are discarded, the transaction is begun by a
+	// START TRANSACTION statement
+	tx, err := db.Begin()
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("INSERT INTO accounts (id, name) VALUES (4, 'eve')")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"ana", "ann", "bob", "eve"}, names(tx))
+	assert.Equal(t, []string{"ana", "ann", "bob"}, names(db))
+	assert.Equal(t, nil, tx.Rollback())
+	assert.Equal(t, []string{"ana", "ann", "bob"}, names(db))
+
+	tx, err = db.Begin()
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("DELETE FROM accounts WHERE id = ?", 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, tx.Commit())
+	assert.Equal(t, []string{"ana", "ann"}, names(db))
+
+	// SET writes the session of the connection
+	conn, err := db.Conn(context.Background())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), `SET @myvar = "hello"`)
+	assert.Equal(t, nil, err)
+	var v string
+	assert.Equal(t, nil, conn.QueryRowContext(context.Background(), "SELECT @myvar").Scan(&v))
+	assert.Equal(t, "hello", v)
+}
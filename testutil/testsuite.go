@@ -133,6 +133,9 @@ func RunTestSuite(t TestingT) {
 		[][]driver.Value{{"aaron@email.com"}, {"bob@email.com"}, {"not_an_email_2"}},
 	)
 
+	// CASE expressions and null handling functions in projection
+	runCaseSuite(t)
+
 	// This is an error because we have schema on this table, and this column
 	// doesn't exist.
 	TestSelectErr(t, "SELECT email, non_existent_field FROM users ORDER BY email ASC", nil)
@@ -151,6 +154,17 @@ func RunTestSuite(t TestingT) {
 	*/
 }
 
+// runCaseSuite CASE expressions and null handling functions in projection,
+// run by both the normal and simple suites.
+func runCaseSuite(t TestingT) {
+	TestSelect(t, "SELECT email, CASE WHEN referral_count > 50 THEN \"high\" ELSE \"low\" END AS lvl FROM users WHERE email = \"aaron@email.com\"",
+		[][]driver.Value{{"aaron@email.com", "high"}},
+	)
+	TestSelect(t, "SELECT CASE email WHEN \"bob@email.com\" THEN \"bob\" END AS name, coalesce(interests, \"none\") AS interests FROM users WHERE email = \"bob@email.com\"",
+		[][]driver.Value{{"bob", "swimming"}},
+	)
+}
+
 // RunSimpleSuite run the normal DML SQL test suite.
 func RunSimpleSuite(t TestingT) {
 
@@ -205,6 +219,9 @@ func RunSimpleSuite(t TestingT) {
 		[][]driver.Value{{int64(0)}},
 	)
 
+	// CASE expressions and null handling functions in projection
+	runCaseSuite(t)
+
 	// Function in select projected columns that needs to be late evaluated.
 	// "select json.jmespath(body,\"name\") AS name FROM article WHERE `author` = \"aaron\";",
 	TestSelect(t, "select json.jmespath(json_data,\"name\") AS name FROM users WHERE `email` = \"aaron@email.com\";",
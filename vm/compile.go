@@ -0,0 +1,261 @@
+package vm
+
+import (
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/lex"
+	"github.com/lytics/qlbridge/value"
+)
+
+// evalFn evaluates a compiled expression against a context
+type evalFn func(ctx expr.EvalContext) (value.Value, bool)
+
+// Program is an expression compiled for repeated evaluation, see Compile.
+// It holds no per evaluation state so is safe for concurrent use.
+type Program struct {
+	node expr.Node
+	mode NullMode
+	eval evalFn
+}
+
+// Compile an expression into a Program whose Eval gives results identical
+// to Eval, without walking the expression on each evaluation.  Identities
+// and functions are resolved once, and operators on literals are folded
+// to constants.
+//
+//	prog, err := vm.Compile(where)
+//	for _, msg := range msgs {
+//	    val, ok := prog.Eval(msg)
+//	}
+func Compile(node expr.Node) (*Program, error) {
+	return CompileMode(NullLenient, node)
+}
+
+// CompileMode compiles an expression with the given NULL handling, its
+// results are identical to EvalMode.
+func CompileMode(mode NullMode, node expr.Node) (*Program, error) {
+	c := &compiler{mode: mode}
+	fn, _, err := c.compile(node, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{node: node, mode: mode, eval: fn}, nil
+}
+
+// Eval the program against the given context.
+func (m *Program) Eval(ctx expr.EvalContext) (value.Value, bool) {
+	return m.eval(ctx)
+}
+
+// Node the expression this program was compiled from.
+func (m *Program) Node() expr.Node { return m.node }
+
+// String the expression this program was compiled from.
+func (m *Program) String() string { return m.node.String() }
+
+type compiler struct {
+	mode NullMode
+}
+
+func constant(v value.Value, ok bool) evalFn {
+	return func(expr.EvalContext) (value.Value, bool) {
+		return v, ok
+	}
+}
+
+// compile returns the evaluator of the node, and whether it is a constant
+// which doesn't depend on the context.
+func (m *compiler) compile(node expr.Node, depth int) (evalFn, bool, error) {
+	if depth > MaxDepth {
+		return nil, false, ErrMaxDepth
+	}
+
+	switch n := node.(type) {
+	case nil, *expr.NumberNode, *expr.StringNode, *expr.NullNode, *expr.ValueNode:
+		return constant(evalDepth(nil, nil, m.mode, node, 0, nil)), true, nil
+	case *expr.ParamNode:
+		// bound before each execution, so never folded into a constant
+		return func(expr.EvalContext) (value.Value, bool) {
+			return evalParam(n)
+		}, false, nil
+	case *expr.IdentityNode:
+		if n.IsBooleanIdentity() {
+			return constant(value.NewBoolValue(n.Bool()), true), true, nil
+		}
+		key := n.Text
+		if n.HasLeftRight() {
+			key = n.OriginalText()
+		}
+		return func(ctx expr.EvalContext) (value.Value, bool) {
+			if ctx == nil {
+				return nil, false
+			}
+			return ctx.Get(key)
+		}, false, nil
+	case *expr.BinaryNode:
+		return m.binary(n, depth)
+	case *expr.BooleanNode:
+		return m.boolean(n, depth)
+	case *expr.UnaryNode:
+		return m.unary(n, depth)
+	case *expr.TriNode:
+		return m.ternary(n, depth)
+	case *expr.ArrayNode:
+		return m.array(n, depth)
+	case *expr.FuncNode:
+		return m.function(n, depth)
+	case *expr.CaseNode, *expr.IncludeNode, *expr.SubQueryNode:
+		// evaluated by walking, includes are resolved against the context
+		mode := m.mode
+		return func(ctx expr.EvalContext) (value.Value, bool) {
+			return evalDepth(ctx, nil, mode, node, 0, make([]string, 0, 10))
+		}, false, nil
+	}
+	return nil, false, ErrUnknownNodeType
+}
+
+// args compiles the nodes, all is true if every one is a constant
+func (m *compiler) args(nodes []expr.Node, depth int) ([]evalFn, bool, error) {
+	fns := make([]evalFn, len(nodes))
+	all := true
+	for i, n := range nodes {
+		fn, isConst, err := m.compile(n, depth+1)
+		if err != nil {
+			return nil, false, err
+		}
+		fns[i] = fn
+		all = all && isConst
+	}
+	return fns, all, nil
+}
+
+// fold evaluates a constant expression once
+func fold(fn evalFn) (evalFn, bool, error) {
+	return constant(fn(nil)), true, nil
+}
+
+func (m *compiler) binary(node *expr.BinaryNode, depth int) (evalFn, bool, error) {
+	args, isConst, err := m.args(node.Args, depth)
+	if err != nil {
+		return nil, false, err
+	}
+	var fn evalFn
+	switch {
+	case node.Operator.T == lex.TokenIs || node.Operator.T == lex.TokenIsNot:
+		fn = func(ctx expr.EvalContext) (value.Value, bool) {
+			a, aok := args[0](ctx)
+			return operateIs(node, a, aok)
+		}
+	case m.mode == NullStrict:
+		fn = func(ctx expr.EvalContext) (value.Value, bool) {
+			a, aok := args[0](ctx)
+			b, bok := args[1](ctx)
+			return operateBinaryStrict(node, a, aok, b, bok)
+		}
+	default:
+		fn = func(ctx expr.EvalContext) (value.Value, bool) {
+			a, aok := args[0](ctx)
+			b, bok := args[1](ctx)
+			return operateBinary(node, a, aok, b, bok)
+		}
+	}
+	if isConst {
+		return fold(fn)
+	}
+	return fn, false, nil
+}
+
+func (m *compiler) boolean(node *expr.BooleanNode, depth int) (evalFn, bool, error) {
+	args, isConst, err := m.args(node.Args, depth)
+	if err != nil {
+		return nil, false, err
+	}
+	mode := m.mode
+	fn := func(ctx expr.EvalContext) (value.Value, bool) {
+		return operateBoolean(mode, node, func(i int) (value.Value, bool) {
+			return args[i](ctx)
+		})
+	}
+	if isConst {
+		return fold(fn)
+	}
+	return fn, false, nil
+}
+
+func (m *compiler) unary(node *expr.UnaryNode, depth int) (evalFn, bool, error) {
+	arg, isConst, err := m.compile(node.Arg, depth+1)
+	if err != nil {
+		return nil, false, err
+	}
+	mode := m.mode
+	fn := func(ctx expr.EvalContext) (value.Value, bool) {
+		a, ok := arg(ctx)
+		return operateUnary(mode, node, a, ok)
+	}
+	if isConst {
+		return fold(fn)
+	}
+	return fn, false, nil
+}
+
+func (m *compiler) ternary(node *expr.TriNode, depth int) (evalFn, bool, error) {
+	args, isConst, err := m.args(node.Args, depth)
+	if err != nil {
+		return nil, false, err
+	}
+	mode := m.mode
+	fn := func(ctx expr.EvalContext) (value.Value, bool) {
+		a, aok := args[0](ctx)
+		b, bok := args[1](ctx)
+		c, cok := args[2](ctx)
+		return operateTernary(mode, node, a, aok, b, bok, c, cok)
+	}
+	if isConst {
+		return fold(fn)
+	}
+	return fn, false, nil
+}
+
+func (m *compiler) array(node *expr.ArrayNode, depth int) (evalFn, bool, error) {
+	args, isConst, err := m.args(node.Args, depth)
+	if err != nil {
+		return nil, false, err
+	}
+	fn := func(ctx expr.EvalContext) (value.Value, bool) {
+		vals := make([]value.Value, len(args))
+		for i, arg := range args {
+			v, ok := arg(ctx)
+			if !ok {
+				v = value.NewNilValue()
+			}
+			vals[i] = v
+		}
+		return value.NewSliceValues(vals), true
+	}
+	if isConst {
+		return fold(fn)
+	}
+	return fn, false, nil
+}
+
+// function calls are never folded, as now(), rand() etc differ per call
+func (m *compiler) function(node *expr.FuncNode, depth int) (evalFn, bool, error) {
+	if node.F.CustomFunc == nil || node.Eval == nil {
+		return constant(nil, false), false, nil
+	}
+	args, _, err := m.args(node.Args, depth)
+	if err != nil {
+		return nil, false, err
+	}
+	eval := node.Eval
+	return func(ctx expr.EvalContext) (value.Value, bool) {
+		vals := make([]value.Value, len(args))
+		for i, arg := range args {
+			v, ok := arg(ctx)
+			if !ok {
+				v = value.NewNilValue()
+			}
+			vals[i] = v
+		}
+		return eval(ctx, vals)
+	}, false, nil
+}
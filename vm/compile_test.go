@@ -0,0 +1,94 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lytics/qlbridge/expr"
+	"github.com/lytics/qlbridge/value"
+	"github.com/lytics/qlbridge/vm"
+)
+
+func TestCompileMatchesEval(t *testing.T) {
+	exprs := []string{
+		`NOT (not_a_field = 1)`,
+		`user_id IN ("xyz", NULL)`,
+		`not_a_field IS NULL AND int5 BETWEEN 1 AND 10`,
+		`CASE WHEN int5 > 2 THEN "big" ELSE "small" END`,
+		`int5 + 1 > 2 * 2`,
+		`NOT bvalf`,
+	}
+	for _, test := range vmTests {
+		if test.parseok {
+			exprs = append(exprs, test.qlText)
+		}
+	}
+	for _, qlText := range exprs {
+		n, err := expr.ParseExpression(qlText)
+		require.NoError(t, err, qlText)
+		for _, mode := range []vm.NullMode{vm.NullLenient, vm.NullStrict} {
+			prog, err := vm.CompileMode(mode, n)
+			require.NoError(t, err, qlText)
+
+			ctx := &includer{msgContext}
+			expected, expectedOk := vm.EvalMode(mode, ctx, n)
+			val, ok := prog.Eval(ctx)
+			assert.Equal(t, expectedOk, ok, "mode=%d %s", mode, qlText)
+			if expected == nil || val == nil {
+				assert.Equal(t, expected, val, "mode=%d %s", mode, qlText)
+				continue
+			}
+			assert.Equal(t, expected.Value(), val.Value(), "mode=%d %s", mode, qlText)
+		}
+	}
+}
+
+func TestCompileFolds(t *testing.T) {
+	n, err := expr.ParseExpression(`(1 + 2) * 3 > 8 AND "a" IN ("a", "b")`)
+	require.NoError(t, err)
+	prog, err := vm.Compile(n)
+	require.NoError(t, err)
+	assert.Equal(t, n.String(), prog.String())
+
+	// constant so needs no context
+	val, ok := prog.Eval(nil)
+	require.True(t, ok)
+	assert.Equal(t, value.BoolValueTrue, val)
+
+	// functions are never folded
+	n, err = expr.ParseExpression(`now()`)
+	require.NoError(t, err)
+	prog, err = vm.Compile(n)
+	require.NoError(t, err)
+	v1, ok := prog.Eval(nil)
+	require.True(t, ok)
+	_, isTime := v1.(value.TimeValue)
+	assert.True(t, isTime, "%T", v1)
+}
+
+func BenchmarkVmCompiled(b *testing.B) {
+	n, err := expr.ParseExpression(`user_id = "abc" AND int5 > 2 AND email LIKE "*.com"`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	prog, err := vm.Compile(n)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("eval", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if v, ok := vm.Eval(msgContext, n); !ok || v != value.BoolValueTrue {
+				b.Fatal(v)
+			}
+		}
+	})
+	b.Run("compiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if v, ok := prog.Eval(msgContext); !ok || v != value.BoolValueTrue {
+				b.Fatal(v)
+			}
+		}
+	})
+}
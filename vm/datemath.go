@@ -208,6 +208,10 @@ func findDateMathFn(node expr.Node) BoundaryFns {
 		for _, arg := range n.Args {
 			fns = append(fns, findDateMathFn(arg)...)
 		}
+	case *expr.CaseNode:
+		for _, arg := range n.ChildrenArgs() {
+			fns = append(fns, findDateMathFn(arg)...)
+		}
 	case *expr.IncludeNode:
 		// Assumes all includes are resolved
 		if n.ExprNode != nil {
@@ -33,6 +33,20 @@ var (
 	ErrExecute = errors.New("could not execute")
 )
 
+// NullMode how the evaluator treats NULL and missing operands in
+// comparisons and boolean logic.
+type NullMode uint8
+
+const (
+	// NullLenient a comparison with a NULL or missing operand is false
+	// (true for !=), the FilterQL behavior and the default.
+	NullLenient NullMode = iota
+	// NullStrict SQL three valued logic, a comparison with a NULL or
+	// missing operand is unknown, which NOT, AND, OR, BETWEEN and IN
+	// propagate.  Unknown evaluates to a nil value.
+	NullStrict
+)
+
 // EvalBaseContext base context for expression evaluation
 type EvalBaseContext struct {
 	expr.EvalContext
@@ -44,11 +58,18 @@ type EvalBaseContext struct {
 // object whhich implements EvalContext.
 func Eval(eCtx expr.EvalContext, arg expr.Node) (value.Value, bool) {
 	// Initialize a visited includes stack of 10
-	return evalDepth(eCtx, nil, arg, 0, make([]string, 0, 10))
+	return evalDepth(eCtx, nil, NullLenient, arg, 0, make([]string, 0, 10))
 }
 func EvalInc(includer expr.Includer, eCtx expr.EvalContext, arg expr.Node) (value.Value, bool) {
 	// Initialize a visited includes stack of 10
-	return evalDepth(eCtx, includer, arg, 0, make([]string, 0, 10))
+	return evalDepth(eCtx, includer, NullLenient, arg, 0, make([]string, 0, 10))
+}
+
+// EvalMode evaluates the expression like Eval, with the given NULL handling.
+//
+//	EvalMode(NullStrict, ctx, `NOT (x = 1)`)  // nil, true when x is NULL
+func EvalMode(mode NullMode, eCtx expr.EvalContext, arg expr.Node) (value.Value, bool) {
+	return evalDepth(eCtx, nil, mode, arg, 0, make([]string, 0, 10))
 }
 
 // creates a new Value with a nil group and given value.
@@ -112,8 +133,14 @@ func resolveIncludesDepth(ctx expr.Includer, arg expr.Node, depth int, visitedIn
 				return err
 			}
 		}
+	case *expr.CaseNode:
+		for _, narg := range n.ChildrenArgs() {
+			if err := resolveIncludesDepth(ctx, narg, depth+1, visitedIncludes); err != nil {
+				return err
+			}
+		}
 	case *expr.NumberNode, *expr.IdentityNode, *expr.StringNode, nil,
-		*expr.ValueNode, *expr.NullNode:
+		*expr.ValueNode, *expr.NullNode, *expr.ParamNode:
 		return nil
 	case *expr.IncludeNode:
 		return resolveInclude(ctx, n, depth+1, visitedIncludes)
@@ -121,8 +148,12 @@ func resolveIncludesDepth(ctx expr.Includer, arg expr.Node, depth int, visitedIn
 	return nil
 }
 
-func evalBool(ctx expr.EvalContext, includer expr.Includer, arg expr.Node, depth int, visitedIncludes []string) (bool, bool) {
-	val, ok := evalDepth(ctx, includer, arg, depth, visitedIncludes)
+func evalBool(ctx expr.EvalContext, includer expr.Includer, mode NullMode, arg expr.Node, depth int, visitedIncludes []string) (bool, bool) {
+	return toBool(evalDepth(ctx, includer, mode, arg, depth, visitedIncludes))
+}
+
+// toBool the bool of an evaluated value, not ok unless it is a bool
+func toBool(val value.Value, ok bool) (bool, bool) {
 	if !ok || val == nil {
 		return false, false
 	}
@@ -132,7 +163,7 @@ func evalBool(ctx expr.EvalContext, includer expr.Includer, arg expr.Node, depth
 	return false, false
 }
 
-func evalDepth(ctx expr.EvalContext, includer expr.Includer, arg expr.Node, depth int, visitedIncludes []string) (value.Value, bool) {
+func evalDepth(ctx expr.EvalContext, includer expr.Includer, mode NullMode, arg expr.Node, depth int, visitedIncludes []string) (value.Value, bool) {
 	if depth > MaxDepth {
 		return nil, false
 	}
@@ -141,17 +172,19 @@ func evalDepth(ctx expr.EvalContext, includer expr.Includer, arg expr.Node, dept
 	case *expr.NumberNode:
 		return numberNodeToValue(argVal)
 	case *expr.BinaryNode:
-		return evalBinary(ctx, includer, argVal, depth, visitedIncludes)
+		return evalBinary(ctx, includer, mode, argVal, depth, visitedIncludes)
 	case *expr.BooleanNode:
-		return walkBoolean(ctx, includer, argVal, depth, visitedIncludes)
+		return walkBoolean(ctx, includer, mode, argVal, depth, visitedIncludes)
 	case *expr.UnaryNode:
-		return walkUnary(ctx, includer, argVal, depth, visitedIncludes)
+		return walkUnary(ctx, includer, mode, argVal, depth, visitedIncludes)
 	case *expr.TriNode:
-		return walkTernary(ctx, includer, argVal, depth, visitedIncludes)
+		return walkTernary(ctx, includer, mode, argVal, depth, visitedIncludes)
 	case *expr.ArrayNode:
-		return walkArray(ctx, includer, argVal, depth, visitedIncludes)
+		return walkArray(ctx, includer, mode, argVal, depth, visitedIncludes)
 	case *expr.FuncNode:
-		return walkFunc(ctx, includer, argVal, depth, visitedIncludes)
+		return walkFunc(ctx, includer, mode, argVal, depth, visitedIncludes)
+	case *expr.CaseNode:
+		return walkCase(ctx, includer, mode, argVal, depth, visitedIncludes)
 	case *expr.IdentityNode:
 		return walkIdentity(ctx, argVal)
 	case *expr.StringNode:
@@ -161,8 +194,13 @@ func evalDepth(ctx expr.EvalContext, includer expr.Includer, arg expr.Node, dept
 	case *expr.NullNode:
 		// WHERE (`users.user_id` != NULL)
 		return value.NewNilValue(), true
+	case *expr.ParamNode:
+		return evalParam(argVal)
 	case *expr.IncludeNode:
-		return walkInclude(ctx, includer, argVal, depth+1, visitedIncludes)
+		return walkInclude(ctx, includer, mode, argVal, depth+1, visitedIncludes)
+	case *expr.SubQueryNode:
+		// sub queries are run, and replaced by their results, by the executor
+		return nil, false
 	case *expr.ValueNode:
 		if argVal.Value == nil {
 			return nil, false
@@ -172,6 +210,9 @@ func evalDepth(ctx expr.EvalContext, includer expr.Includer, arg expr.Node, dept
 			return nil, false
 		case value.SliceValue:
 			return val, true
+		case value.StringValue, value.NumberValue, value.IntValue, value.BoolValue, value.TimeValue:
+			// results of a sub query
+			return val, true
 		}
 		u.Errorf("Unknonwn node type:  %#v", argVal.Value)
 		panic(ErrUnknownNodeType)
@@ -214,7 +255,7 @@ func resolveInclude(ctx expr.Includer, inc *expr.IncludeNode, depth int, visited
 
 var errFailedInclusion = errors.New("failed inclusion")
 
-func walkInclude(ctx expr.EvalContext, includer expr.Includer, inc *expr.IncludeNode, depth int, visitedIncludes []string) (value.Value, bool) {
+func walkInclude(ctx expr.EvalContext, includer expr.Includer, mode NullMode, inc *expr.IncludeNode, depth int, visitedIncludes []string) (value.Value, bool) {
 	var matches, ok bool
 	var err error
 	var cachedValue expr.CachedValue
@@ -255,7 +296,7 @@ func walkInclude(ctx expr.EvalContext, includer expr.Includer, inc *expr.Include
 			}
 		}
 
-		matches, ok = evalBool(ctx, includer, inc.ExprNode, depth+1, visitedIncludes)
+		matches, ok = evalBool(ctx, includer, mode, inc.ExprNode, depth+1, visitedIncludes)
 		if cachedValue != nil {
 			cachedValue.Set(matches, ok)
 		}
@@ -272,11 +313,19 @@ func walkInclude(ctx expr.EvalContext, includer expr.Includer, inc *expr.Include
 	return value.NewBoolValue(matches), true
 }
 
-func walkBoolean(ctx expr.EvalContext, includer expr.Includer, n *expr.BooleanNode, depth int, visitedIncludes []string) (value.Value, bool) {
+func walkBoolean(ctx expr.EvalContext, includer expr.Includer, mode NullMode, n *expr.BooleanNode, depth int, visitedIncludes []string) (value.Value, bool) {
 	if depth > MaxDepth {
 		u.Warnf("Recursive query death? %v", n)
 		return nil, false
 	}
+	return operateBoolean(mode, n, func(i int) (value.Value, bool) {
+		return evalDepth(ctx, includer, mode, n.Args[i], depth+1, visitedIncludes)
+	})
+}
+
+// operateBoolean evaluates AND, OR of the args short circuiting, @eval
+// evaluates the i'th arg.
+func operateBoolean(mode NullMode, n *expr.BooleanNode, eval func(i int) (value.Value, bool)) (value.Value, bool) {
 	var and bool
 	switch n.Operator.T {
 	case lex.TokenAnd, lex.TokenLogicAnd:
@@ -288,9 +337,31 @@ func walkBoolean(ctx expr.EvalContext, includer expr.Includer, n *expr.BooleanNo
 		return value.BoolValueFalse, false
 	}
 
-	for _, bn := range n.Args {
+	if mode == NullStrict {
+		result := triFalse
+		if and {
+			result = triTrue
+		}
+		for i := range n.Args {
+			arg := toTri(eval(i))
+			if and {
+				result = result.and(arg)
+			} else {
+				result = result.or(arg)
+			}
+			if (and && result == triFalse) || (!and && result == triTrue) {
+				break
+			}
+		}
+		if n.Negated() {
+			result = result.not()
+		}
+		return result.Value(), true
+	}
+
+	for i := range n.Args {
 
-		matches, ok := evalBool(ctx, includer, bn, depth+1, visitedIncludes)
+		matches, ok := toBool(eval(i))
 		if !ok && and {
 			return nil, false
 		} else if !ok {
@@ -327,9 +398,95 @@ func walkBoolean(ctx expr.EvalContext, includer expr.Includer, n *expr.BooleanNo
 //	x OR y
 //	x > y
 //	x < =
-func evalBinary(ctx expr.EvalContext, includer expr.Includer, node *expr.BinaryNode, depth int, visitedIncludes []string) (value.Value, bool) {
-	ar, aok := evalDepth(ctx, includer, node.Args[0], depth+1, visitedIncludes)
-	br, bok := evalDepth(ctx, includer, node.Args[1], depth+1, visitedIncludes)
+func evalBinary(ctx expr.EvalContext, includer expr.Includer, mode NullMode, node *expr.BinaryNode, depth int, visitedIncludes []string) (value.Value, bool) {
+	switch node.Operator.T {
+	case lex.TokenIs, lex.TokenIsNot:
+		return evalIs(ctx, includer, mode, node, depth, visitedIncludes)
+	}
+
+	ar, aok := evalDepth(ctx, includer, mode, node.Args[0], depth+1, visitedIncludes)
+	br, bok := evalDepth(ctx, includer, mode, node.Args[1], depth+1, visitedIncludes)
+
+	if mode == NullStrict {
+		return operateBinaryStrict(node, ar, aok, br, bok)
+	}
+	return operateBinary(node, ar, aok, br, bok)
+}
+
+// evalIs evaluates IS [NOT] NULL, TRUE or FALSE, which is never unknown,
+// a missing operand IS NULL.
+//
+//	x IS NULL
+//	x IS NOT TRUE
+func evalIs(ctx expr.EvalContext, includer expr.Includer, mode NullMode, node *expr.BinaryNode, depth int, visitedIncludes []string) (value.Value, bool) {
+
+	ar, aok := evalDepth(ctx, includer, mode, node.Args[0], depth+1, visitedIncludes)
+	return operateIs(node, ar, aok)
+}
+
+// evalParam the value bound to a placeholder, a bound NULL is as the NULL
+// literal, an unbound placeholder has no value.
+func evalParam(node *expr.ParamNode) (value.Value, bool) {
+	switch node.Value.(type) {
+	case nil:
+		return nil, false
+	case value.NilValue, *value.NilValue:
+		return value.NewNilValue(), true
+	}
+	return node.Value, true
+}
+
+// operateIs evaluates IS [NOT] on the evaluated left operand.
+func operateIs(node *expr.BinaryNode, ar value.Value, aok bool) (value.Value, bool) {
+	var is bool
+	switch rh := node.Args[1].(type) {
+	case *expr.NullNode:
+		is = isNull(ar, aok)
+	case *expr.IdentityNode:
+		if !rh.IsBooleanIdentity() {
+			return nil, false
+		}
+		bv, isBool := ar.(value.BoolValue)
+		is = aok && isBool && bv.Val() == rh.Bool()
+	default:
+		return nil, false
+	}
+	if node.Operator.T == lex.TokenIsNot {
+		is = !is
+	}
+	return value.NewBoolValue(is), true
+}
+
+// operateBinaryStrict evaluates a binary with SQL three valued logic, where
+// an operation with a NULL operand is unknown except for AND, OR.
+//
+//	NULL = 1            =>  unknown
+//	NULL AND false      =>  false
+//	1 IN (2, NULL)      =>  unknown
+func operateBinaryStrict(node *expr.BinaryNode, ar value.Value, aok bool, br value.Value, bok bool) (value.Value, bool) {
+	switch node.Operator.T {
+	case lex.TokenLogicAnd, lex.TokenAnd:
+		return toTri(ar, aok).and(toTri(br, bok)).Value(), true
+	case lex.TokenLogicOr, lex.TokenOr:
+		return toTri(ar, aok).or(toTri(br, bok)).Value(), true
+	}
+	if isNull(ar, aok) || isNull(br, bok) {
+		return value.NilValueVal, true
+	}
+	v, ok := operateBinary(node, ar, aok, br, bok)
+	switch node.Operator.T {
+	case lex.TokenIN, lex.TokenIntersects:
+		// no match against a list holding a NULL is unknown, not false
+		if bv, isBool := v.(value.BoolValue); ok && isBool && !bv.Val() && hasNull(br) {
+			return value.NilValueVal, true
+		}
+	}
+	return v, ok
+}
+
+// operateBinary evaluates a binary on its evaluated operands, @aok, @bok
+// false if that operand could not be evaluated.
+func operateBinary(node *expr.BinaryNode, ar value.Value, aok bool, br value.Value, bok bool) (value.Value, bool) {
 
 	// If we could not evaluate either we can shortcut
 	if !aok && !bok {
@@ -803,6 +960,81 @@ func evalBinary(ctx expr.EvalContext, includer expr.Includer, node *expr.BinaryN
 	return nil, false
 }
 
+// triBool a three valued logic truth value
+type triBool uint8
+
+const (
+	triUnknown triBool = iota
+	triFalse
+	triTrue
+)
+
+// toTri the truth of an evaluated operand, anything but a bool is unknown.
+func toTri(v value.Value, ok bool) triBool {
+	if bv, isBool := v.(value.BoolValue); ok && isBool {
+		if bv.Val() {
+			return triTrue
+		}
+		return triFalse
+	}
+	return triUnknown
+}
+func (m triBool) not() triBool {
+	switch m {
+	case triTrue:
+		return triFalse
+	case triFalse:
+		return triTrue
+	}
+	return triUnknown
+}
+func (m triBool) and(b triBool) triBool {
+	if m == triFalse || b == triFalse {
+		return triFalse
+	}
+	if m == triUnknown || b == triUnknown {
+		return triUnknown
+	}
+	return triTrue
+}
+func (m triBool) or(b triBool) triBool {
+	if m == triTrue || b == triTrue {
+		return triTrue
+	}
+	if m == triUnknown || b == triUnknown {
+		return triUnknown
+	}
+	return triFalse
+}
+
+// Value the bool value, or nil value for unknown.
+func (m triBool) Value() value.Value {
+	switch m {
+	case triTrue:
+		return value.BoolValueTrue
+	case triFalse:
+		return value.BoolValueFalse
+	}
+	return value.NilValueVal
+}
+
+// isNull is an evaluated operand NULL, ie missing, nil or an empty value
+func isNull(v value.Value, ok bool) bool {
+	return !ok || v == nil || v.Nil()
+}
+
+// hasNull does this list value hold a NULL
+func hasNull(v value.Value) bool {
+	if sv, ok := v.(value.SliceValue); ok {
+		for _, item := range sv.Val() {
+			if isNull(item, true) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func walkIdentity(ctx expr.EvalContext, node *expr.IdentityNode) (value.Value, bool) {
 
 	if node.IsBooleanIdentity() {
@@ -817,9 +1049,17 @@ func walkIdentity(ctx expr.EvalContext, node *expr.IdentityNode) (value.Value, b
 	return ctx.Get(node.Text)
 }
 
-func walkUnary(ctx expr.EvalContext, includer expr.Includer, node *expr.UnaryNode, depth int, visitedIncludes []string) (value.Value, bool) {
+func walkUnary(ctx expr.EvalContext, includer expr.Includer, mode NullMode, node *expr.UnaryNode, depth int, visitedIncludes []string) (value.Value, bool) {
+
+	a, ok := evalDepth(ctx, includer, mode, node.Arg, depth, visitedIncludes)
+	return operateUnary(mode, node, a, ok)
+}
 
-	a, ok := evalDepth(ctx, includer, node.Arg, depth, visitedIncludes)
+// operateUnary evaluates the unary on its evaluated operand.
+func operateUnary(mode NullMode, node *expr.UnaryNode, a value.Value, ok bool) (value.Value, bool) {
+	if mode == NullStrict && node.Operator.T == lex.TokenNegate {
+		return toTri(a, ok).not().Value(), true
+	}
 	if !ok {
 		switch node.Operator.T {
 		case lex.TokenExists:
@@ -861,18 +1101,20 @@ func walkUnary(ctx expr.EvalContext, includer expr.Includer, node *expr.UnaryNod
 // walkTernary ternary evaluator
 //
 //	A   BETWEEN   B  AND C
-func walkTernary(ctx expr.EvalContext, includer expr.Includer, node *expr.TriNode, depth int, visitedIncludes []string) (value.Value, bool) {
+func walkTernary(ctx expr.EvalContext, includer expr.Includer, mode NullMode, node *expr.TriNode, depth int, visitedIncludes []string) (value.Value, bool) {
 
-	a, aok := evalDepth(ctx, includer, node.Args[0], depth, visitedIncludes)
-	if a == nil || !aok {
-		return nil, false
-	}
-	b, bok := evalDepth(ctx, includer, node.Args[1], depth, visitedIncludes)
-	if b == nil || !bok {
-		return nil, false
-	}
-	c, cok := evalDepth(ctx, includer, node.Args[2], depth, visitedIncludes)
-	if c == nil || !cok {
+	a, aok := evalDepth(ctx, includer, mode, node.Args[0], depth, visitedIncludes)
+	b, bok := evalDepth(ctx, includer, mode, node.Args[1], depth, visitedIncludes)
+	c, cok := evalDepth(ctx, includer, mode, node.Args[2], depth, visitedIncludes)
+	return operateTernary(mode, node, a, aok, b, bok, c, cok)
+}
+
+// operateTernary evaluates the ternary on its evaluated operands.
+func operateTernary(mode NullMode, node *expr.TriNode, a value.Value, aok bool, b value.Value, bok bool, c value.Value, cok bool) (value.Value, bool) {
+	if isNull(a, aok) || isNull(b, bok) || isNull(c, cok) {
+		if mode == NullStrict {
+			return value.NilValueVal, true
+		}
 		return nil, false
 	}
 	switch node.Operator.T {
@@ -954,12 +1196,15 @@ func walkTernary(ctx expr.EvalContext, includer expr.Includer, node *expr.TriNod
 // walkArray Array evaluator:  evaluate multiple values into an array
 //
 //	(b,c,d)
-func walkArray(ctx expr.EvalContext, includer expr.Includer, node *expr.ArrayNode, depth int, visitedIncludes []string) (value.Value, bool) {
+func walkArray(ctx expr.EvalContext, includer expr.Includer, mode NullMode, node *expr.ArrayNode, depth int, visitedIncludes []string) (value.Value, bool) {
 
 	vals := make([]value.Value, len(node.Args))
 
 	for i := range node.Args {
-		v, _ := evalDepth(ctx, includer, node.Args[i], depth, visitedIncludes)
+		v, ok := evalDepth(ctx, includer, mode, node.Args[i], depth, visitedIncludes)
+		if !ok {
+			v = value.NewNilValue()
+		}
 		vals[i] = v
 	}
 
@@ -967,8 +1212,50 @@ func walkArray(ctx expr.EvalContext, includer expr.Includer, node *expr.ArrayNod
 	return value.NewSliceValues(vals), true
 }
 
+// walkCase evaluates the THEN of the first WHEN which is true (searched)
+// or equal to the operand (simple), else the ELSE.  A NULL operand
+// matches no WHEN.
+//
+//	CASE WHEN x > 5 THEN "big" ELSE "small" END
+//	CASE x WHEN 1 THEN "one" END
+func walkCase(ctx expr.EvalContext, includer expr.Includer, mode NullMode, node *expr.CaseNode, depth int, visitedIncludes []string) (value.Value, bool) {
+
+	var operand value.Value
+	if node.Operand != nil {
+		v, ok := evalDepth(ctx, includer, mode, node.Operand, depth+1, visitedIncludes)
+		if ok && v != nil && !v.Nil() {
+			operand = v
+		}
+	}
+
+	for i, when := range node.Whens {
+		if node.Operand == nil {
+			if matched, ok := evalBool(ctx, includer, mode, when, depth+1, visitedIncludes); !ok || !matched {
+				continue
+			}
+		} else {
+			if operand == nil {
+				break
+			}
+			wv, ok := evalDepth(ctx, includer, mode, when, depth+1, visitedIncludes)
+			if !ok || wv == nil || wv.Nil() {
+				continue
+			}
+			if eq, err := value.Equal(operand, wv); err != nil || !eq {
+				continue
+			}
+		}
+		return evalDepth(ctx, includer, mode, node.Thens[i], depth+1, visitedIncludes)
+	}
+
+	if node.Else != nil {
+		return evalDepth(ctx, includer, mode, node.Else, depth+1, visitedIncludes)
+	}
+	return nil, false
+}
+
 // walkFunc evaluates a function
-func walkFunc(ctx expr.EvalContext, includer expr.Includer, node *expr.FuncNode, depth int, visitedIncludes []string) (value.Value, bool) {
+func walkFunc(ctx expr.EvalContext, includer expr.Includer, mode NullMode, node *expr.FuncNode, depth int, visitedIncludes []string) (value.Value, bool) {
 
 	if node.F.CustomFunc == nil {
 		return nil, false
@@ -981,7 +1268,7 @@ func walkFunc(ctx expr.EvalContext, includer expr.Includer, node *expr.FuncNode,
 	args := make([]value.Value, len(node.Args))
 
 	for i, a := range node.Args {
-		v, ok := evalDepth(ctx, includer, a, depth, visitedIncludes)
+		v, ok := evalDepth(ctx, includer, mode, a, depth, visitedIncludes)
 		if !ok {
 			v = value.NewNilValue()
 		}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/araddon/dateparse"
 	u "github.com/araddon/gou"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/lytics/qlbridge/datasource"
 	"github.com/lytics/qlbridge/expr"
@@ -173,6 +175,13 @@ var (
 		vmt(`user_id LIKE "*bc"`, true, noError),
 		vmt(`user_id LIKE "\*bc"`, false, noError),
 		vmt(`user_id != NULL`, true, noError),
+		vmt(`user_id IS NOT NULL`, true, noError),
+		vmt(`user_id IS NULL`, false, noError),
+		vmt(`not_a_field IS NULL`, true, noError),
+		vmt(`not_a_field IS NOT NULL AND user_id = "abc"`, false, noError),
+		vmt(`bvalt IS TRUE`, true, noError),
+		vmt(`bvalf IS NOT TRUE`, true, noError),
+		vmt(`not_a_field IS NOT FALSE`, true, noError),
 
 		// Binary Bool
 		vmt(`bvalt == true`, true, noError),
@@ -245,6 +254,18 @@ var (
 		// context lookups? simple
 		vmt(`user_id`, "abc", noError),
 
+		// Case:  first matching WHEN, else ELSE, else nil
+		vmt(`CASE WHEN int5 > 10 THEN "big" WHEN int5 > 2 THEN "medium" ELSE "small" END`, "medium", noError),
+		vmt(`CASE WHEN int5 > 10 THEN "big" ELSE "small" END`, "small", noError),
+		vmt(`CASE WHEN not_a_field > 10 THEN "big" ELSE "small" END`, "small", noError),
+		vmtall(`CASE WHEN int5 > 10 THEN "big" END`, nil, parseOk, evalError),
+		vmt(`CASE user_id WHEN "xyz" THEN 1 WHEN "abc" THEN 2 ELSE 3 END`, int64(2), noError),
+		vmt(`CASE str5 WHEN 5 THEN "five" END`, "five", noError),
+		vmt(`CASE not_a_field WHEN "abc" THEN 1 ELSE 0 END`, int64(0), noError),
+		vmt(`CASE WHEN bvalt THEN int5 * 2 END + 1`, int64(11), noError),
+		vmt(`CASE WHEN bvalf THEN false ELSE email LIKE "bob*" END`, true, noError),
+		vmt(`CASE WHEN int5 > 2 THEN CASE user_id WHEN "abc" THEN "nested" END END`, "nested", noError),
+
 		// functional syntax
 		vmt(`eq(toint(int5),5)`, true, noError),
 		vmt(`eq(toint(int5),6)`, false, noError),
@@ -347,6 +368,56 @@ func TestRunExpr(t *testing.T) {
 	}
 }
 
+func TestNullStrict(t *testing.T) {
+	// expression, lenient result, strict result where nil is unknown
+	tests := []struct {
+		qlText  string
+		lenient any
+		strict  any
+	}{
+		{`not_a_field = 1`, false, nil},
+		{`NOT (not_a_field = 1)`, true, nil},
+		{`not_a_field != 1`, true, nil},
+		{`not_a_field = 1 OR int5 = 5`, true, true},
+		{`not_a_field = 1 AND int5 = 5`, false, nil},
+		{`not_a_field = 1 AND int5 = 4`, false, false},
+		{`AND(not_a_field = 1, int5 = 5)`, false, nil},
+		{`OR(not_a_field = 1, int5 = 4)`, false, nil},
+		{`OR(not_a_field = 1, int5 = 5)`, true, true},
+		{`NOT AND(not_a_field = 1, int5 = 5)`, true, nil},
+		{`int5 BETWEEN 1 AND 10`, true, true},
+		{`not_a_field BETWEEN 1 AND 10`, nil, nil},
+		{`not_a_field IN ("a", "b")`, false, nil},
+		{`user_id IN ("abc", NULL)`, true, true},
+		{`user_id IN ("xyz", NULL)`, false, nil},
+		{`user_id NOT IN ("xyz", NULL)`, true, nil},
+		{`not_a_field IS NULL`, true, true},
+		{`NOT (not_a_field IS NOT NULL)`, true, true},
+		{`int5 = 5`, true, true},
+		{`CASE WHEN NOT (not_a_field = 1) THEN "yes" ELSE "no" END`, "yes", "no"},
+	}
+	for _, tc := range tests {
+		n, err := expr.ParseExpression(tc.qlText)
+		require.NoError(t, err, tc.qlText)
+
+		val, ok := vm.Eval(msgContext, n)
+		if tc.lenient == nil {
+			assert.True(t, !ok || val == nil || val.Nil(), "lenient %s got %v", tc.qlText, val)
+		} else {
+			require.True(t, ok, "lenient %s", tc.qlText)
+			assert.Equal(t, tc.lenient, val.Value(), "lenient %s", tc.qlText)
+		}
+
+		val, ok = vm.EvalMode(vm.NullStrict, msgContext, n)
+		if tc.strict == nil {
+			assert.True(t, !ok || val == nil || val.Nil(), "strict %s got %v", tc.qlText, val)
+		} else {
+			require.True(t, ok, "strict %s", tc.qlText)
+			assert.Equal(t, tc.strict, val.Value(), "strict %s", tc.qlText)
+		}
+	}
+}
+
 type vmTest struct {
 	qlText  string
 	parseok bool